@@ -0,0 +1,205 @@
+//-----------------------------------------------------------------------------
+/*
+
+3MF Save
+
+3MF is a zip archive of XML parts. Each material of a model is written as a
+separate mesh object, with a base material that slicers can map to an
+extruder.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+)
+
+//-----------------------------------------------------------------------------
+
+// materialColors are the display colors for material ids.
+var materialColors = []string{
+	"#C0C0C0FF", // 0 default
+	"#E6194BFF", // 1 red
+	"#3CB44BFF", // 2 green
+	"#4363D8FF", // 3 blue
+	"#FFE119FF", // 4 yellow
+	"#F58231FF", // 5 orange
+	"#911EB4FF", // 6 purple
+	"#42D4F4FF", // 7 cyan
+}
+
+// materialColor returns the display color for a material id.
+func materialColor(id int) string {
+	return materialColors[id%len(materialColors)]
+}
+
+//-----------------------------------------------------------------------------
+
+type xml3mfVertex struct {
+	X float64 `xml:"x,attr"`
+	Y float64 `xml:"y,attr"`
+	Z float64 `xml:"z,attr"`
+}
+
+type xml3mfTriangle struct {
+	V1 int `xml:"v1,attr"`
+	V2 int `xml:"v2,attr"`
+	V3 int `xml:"v3,attr"`
+}
+
+type xml3mfMesh struct {
+	Vertices  []xml3mfVertex   `xml:"vertices>vertex"`
+	Triangles []xml3mfTriangle `xml:"triangles>triangle"`
+}
+
+type xml3mfObject struct {
+	ID     int        `xml:"id,attr"`
+	Type   string     `xml:"type,attr"`
+	Name   string     `xml:"name,attr"`
+	PID    int        `xml:"pid,attr"`
+	PIndex int        `xml:"pindex,attr"`
+	Mesh   xml3mfMesh `xml:"mesh"`
+}
+
+type xml3mfBase struct {
+	Name  string `xml:"name,attr"`
+	Color string `xml:"displaycolor,attr"`
+}
+
+type xml3mfItem struct {
+	ObjectID int `xml:"objectid,attr"`
+}
+
+type xml3mfMaterials struct {
+	ID   int          `xml:"id,attr"`
+	Base []xml3mfBase `xml:"base"`
+}
+
+type xml3mfModel struct {
+	XMLName   xml.Name        `xml:"model"`
+	Unit      string          `xml:"unit,attr"`
+	Xmlns     string          `xml:"xmlns,attr"`
+	Materials xml3mfMaterials `xml:"resources>basematerials"`
+	Objects   []xml3mfObject  `xml:"resources>object"`
+	Items     []xml3mfItem    `xml:"build>item"`
+}
+
+//-----------------------------------------------------------------------------
+
+const content3mf = `<?xml version="1.0" encoding="UTF-8"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+ <Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+ <Default Extension="model" ContentType="application/vnd.ms-package.3dmanufacturing-3dmodel+xml"/>
+</Types>
+`
+
+const rels3mf = `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+ <Relationship Target="/3D/3dmodel.model" Id="rel0" Type="http://schemas.microsoft.com/3dmanufacturing/2013/01/3dmodel"/>
+</Relationships>
+`
+
+// new3mfModel returns the 3MF model for a set of material meshes.
+func new3mfModel(parts []*MaterialMesh) *xml3mfModel {
+	// the base materials group has id 1, objects are numbered from 2
+	const matID = 1
+	model := xml3mfModel{
+		Unit:      "millimeter",
+		Xmlns:     "http://schemas.microsoft.com/3dmanufacturing/core/2015/02",
+		Materials: xml3mfMaterials{ID: matID},
+	}
+	for i, p := range parts {
+		model.Materials.Base = append(model.Materials.Base, xml3mfBase{
+			Name:  fmt.Sprintf("material %d", p.Material),
+			Color: materialColor(p.Material),
+		})
+		m := newMeshIndex(p.Mesh.Triangles)
+		obj := xml3mfObject{
+			ID:     i + 2,
+			Type:   "model",
+			Name:   fmt.Sprintf("material %d", p.Material),
+			PID:    matID,
+			PIndex: i,
+		}
+		obj.Mesh.Vertices = make([]xml3mfVertex, len(m.v))
+		for j, v := range m.v {
+			obj.Mesh.Vertices[j] = xml3mfVertex{v.X, v.Y, v.Z}
+		}
+		obj.Mesh.Triangles = make([]xml3mfTriangle, len(m.f))
+		for j, f := range m.f {
+			obj.Mesh.Triangles[j] = xml3mfTriangle{f[0], f[1], f[2]}
+		}
+		model.Objects = append(model.Objects, obj)
+		model.Items = append(model.Items, xml3mfItem{obj.ID})
+	}
+	return &model
+}
+
+// write3mf writes a 3MF model to a writer.
+func write3mf(w io.Writer, model *xml3mfModel) error {
+	z := zip.NewWriter(w)
+	files := []struct {
+		name string
+		data string
+	}{
+		{"[Content_Types].xml", content3mf},
+		{"_rels/.rels", rels3mf},
+	}
+	for _, f := range files {
+		fw, err := z.Create(f.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, f.data); err != nil {
+			return err
+		}
+	}
+	fw, err := z.Create("3D/3dmodel.model")
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(fw, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(fw)
+	enc.Indent("", " ")
+	if err := enc.Encode(model); err != nil {
+		return err
+	}
+	return z.Close()
+}
+
+// Save3MF writes a set of material meshes to a 3MF file.
+// Each material is a separate object.
+func Save3MF(path string, parts []*MaterialMesh) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return write3mf(f, new3mfModel(parts))
+}
+
+//-----------------------------------------------------------------------------
+
+// Render3MF renders an SDF3 with material regions as a 3MF file (octree sampling).
+// See Material3D and SplitMaterials for the material assignment.
+func Render3MF(
+	s SDF3, //sdf3 to render
+	mesh_cells int, //number of cells on the longest axis. e.g 200
+	path string, //path to filename
+) {
+	fmt.Printf("rendering %s (%d cells)\n", path, mesh_cells)
+	parts := SplitMaterials(s, RenderMesh(s, mesh_cells))
+	if err := Save3MF(path, parts); err != nil {
+		fmt.Printf("%s", err)
+	}
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,163 @@
+//-----------------------------------------------------------------------------
+/*
+
+AMF Save
+
+AMF (Additive Manufacturing File Format, ISO/ASTM 52915) is an XML format.
+A model is written as a single object with a shared vertex list and a
+volume for each material.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+//-----------------------------------------------------------------------------
+
+type xmlAmfCoordinates struct {
+	X float64 `xml:"x"`
+	Y float64 `xml:"y"`
+	Z float64 `xml:"z"`
+}
+
+type xmlAmfVertex struct {
+	Coordinates xmlAmfCoordinates `xml:"coordinates"`
+}
+
+type xmlAmfTriangle struct {
+	V1 int `xml:"v1"`
+	V2 int `xml:"v2"`
+	V3 int `xml:"v3"`
+}
+
+type xmlAmfVolume struct {
+	MaterialID int              `xml:"materialid,attr"`
+	Triangles  []xmlAmfTriangle `xml:"triangle"`
+}
+
+type xmlAmfMesh struct {
+	Vertices []xmlAmfVertex `xml:"vertices>vertex"`
+	Volumes  []xmlAmfVolume `xml:"volume"`
+}
+
+type xmlAmfObject struct {
+	ID   int        `xml:"id,attr"`
+	Mesh xmlAmfMesh `xml:"mesh"`
+}
+
+type xmlAmfColor struct {
+	R float64 `xml:"r"`
+	G float64 `xml:"g"`
+	B float64 `xml:"b"`
+}
+
+type xmlAmfMetadata struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type xmlAmfMaterial struct {
+	ID       int            `xml:"id,attr"`
+	Metadata xmlAmfMetadata `xml:"metadata"`
+	Color    xmlAmfColor    `xml:"color"`
+}
+
+type xmlAmf struct {
+	XMLName   xml.Name         `xml:"amf"`
+	Unit      string           `xml:"unit,attr"`
+	Materials []xmlAmfMaterial `xml:"material"`
+	Objects   []xmlAmfObject   `xml:"object"`
+}
+
+//-----------------------------------------------------------------------------
+
+// amfColor returns the AMF color for a material id.
+func amfColor(id int) xmlAmfColor {
+	// "#RRGGBBAA"
+	c := materialColor(id)
+	x := func(i int) float64 {
+		v, _ := strconv.ParseUint(c[i:i+2], 16, 8)
+		return float64(v) / 255
+	}
+	return xmlAmfColor{x(1), x(3), x(5)}
+}
+
+// newAmf returns the AMF model for a set of material meshes.
+func newAmf(parts []*MaterialMesh) *xmlAmf {
+	amf := xmlAmf{Unit: "millimeter"}
+	obj := xmlAmfObject{}
+	// the vertices are shared by all volumes
+	index := make(map[V3]int)
+	vertex := func(v V3) int {
+		i, ok := index[v]
+		if !ok {
+			i = len(obj.Mesh.Vertices)
+			index[v] = i
+			obj.Mesh.Vertices = append(obj.Mesh.Vertices, xmlAmfVertex{xmlAmfCoordinates{v.X, v.Y, v.Z}})
+		}
+		return i
+	}
+	for _, p := range parts {
+		// AMF material ids start at 1, 0 is reserved for no material
+		id := p.Material + 1
+		amf.Materials = append(amf.Materials, xmlAmfMaterial{
+			ID:       id,
+			Metadata: xmlAmfMetadata{"name", fmt.Sprintf("material %d", p.Material)},
+			Color:    amfColor(p.Material),
+		})
+		vol := xmlAmfVolume{MaterialID: id}
+		for _, f := range newMeshIndex(p.Mesh.Triangles).triangles() {
+			vol.Triangles = append(vol.Triangles, xmlAmfTriangle{vertex(f.V[0]), vertex(f.V[1]), vertex(f.V[2])})
+		}
+		obj.Mesh.Volumes = append(obj.Mesh.Volumes, vol)
+	}
+	amf.Objects = append(amf.Objects, obj)
+	return &amf
+}
+
+// writeAmf writes an AMF model to a writer.
+func writeAmf(w io.Writer, amf *xmlAmf) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", " ")
+	return enc.Encode(amf)
+}
+
+// SaveAMF writes a set of material meshes to an AMF file.
+// Each material is a separate volume of a single object.
+func SaveAMF(path string, parts []*MaterialMesh) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return writeAmf(f, newAmf(parts))
+}
+
+//-----------------------------------------------------------------------------
+
+// RenderAMF renders an SDF3 with material regions as an AMF file (octree sampling).
+// See Material3D and SplitMaterials for the material assignment.
+func RenderAMF(
+	s SDF3, //sdf3 to render
+	mesh_cells int, //number of cells on the longest axis. e.g 200
+	path string, //path to filename
+) {
+	fmt.Printf("rendering %s (%d cells)\n", path, mesh_cells)
+	parts := SplitMaterials(s, RenderMesh(s, mesh_cells))
+	if err := SaveAMF(path, parts); err != nil {
+		fmt.Printf("%s", err)
+	}
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,492 @@
+//-----------------------------------------------------------------------------
+/*
+
+Analysis of SDF2 and SDF3 objects.
+
+These functions sample the distance field on a grid to answer questions
+about the shape (Do two parts overlap? How thin are the walls?) before
+it is rendered and printed. The answers are approximate and are only as
+good as the sampling resolution.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"math"
+	"sort"
+)
+
+//-----------------------------------------------------------------------------
+
+// Interfere3D checks two SDF3 objects for interference.
+// The overlap of the bounding boxes is sampled at the cell centers of a
+// resolution[0] x resolution[1] x resolution[2] grid. It returns true if the
+// solids overlap, and the sampled point of deepest penetration.
+// Solids that only touch on their surfaces do not interfere.
+func Interfere3D(a, b SDF3, resolution V3i) (bool, V3) {
+	depth, p := interference3(a, b, resolution)
+	return depth > TOLERANCE, p
+}
+
+// interference3 returns the depth of the sampled point of deepest
+// penetration (0 if none) and the point, see Interfere3D.
+func interference3(a, b SDF3, resolution V3i) (float64, V3) {
+	// the intersection can only be within the overlap of the bounding boxes
+	bb := a.BoundingBox().Intersect(b.BoundingBox())
+	if bb.Empty() {
+		// the bounding boxes don't overlap
+		return 0, V3{}
+	}
+
+	s := Intersect3D(a, b)
+	step := bb.Size().Div(resolution.ToV3())
+
+	dmin := 0.0
+	var pmin V3
+	for i := 0; i < resolution[0]; i++ {
+		for j := 0; j < resolution[1]; j++ {
+			for k := 0; k < resolution[2]; k++ {
+				p := bb.Min.Add(V3{float64(i) + 0.5, float64(j) + 0.5, float64(k) + 0.5}.Mul(step))
+				d := s.Evaluate(p)
+				if d < dmin {
+					dmin = d
+					pmin = p
+				}
+			}
+		}
+	}
+
+	return -dmin, pmin
+}
+
+// Interference is an overlap of two parts of an assembly.
+type Interference struct {
+	A, B  int     // indices of the parts, A < B
+	Depth float64 // distance from At to the surface of the overlap
+	At    V3      // the sampled point of deepest penetration
+}
+
+// CheckAssembly3D checks the parts of an assembly for interference, e.g. a
+// boss poking through a wall. Pairs of parts with overlapping bounding
+// boxes are found by sweeping along the X axis, only those are sampled (see
+// Interfere3D) with a resolution grid over the overlap of their bounding
+// boxes. The depth of an overlap is half its thickness for a slab, and
+// about the radius of the largest sphere that fits inside it in general.
+// The interferences are returned in order of the part indices.
+func CheckAssembly3D(parts []SDF3, resolution V3i) []Interference {
+	bb := make([]Box3, len(parts))
+	order := make([]int, len(parts))
+	for i, p := range parts {
+		bb[i] = p.BoundingBox()
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return bb[order[i]].Min.X < bb[order[j]].Min.X })
+	var result []Interference
+	for i, a := range order {
+		for _, b := range order[i+1:] {
+			if bb[b].Min.X > bb[a].Max.X {
+				// no later part overlaps a in X
+				break
+			}
+			if bb[b].Min.Y > bb[a].Max.Y || bb[a].Min.Y > bb[b].Max.Y ||
+				bb[b].Min.Z > bb[a].Max.Z || bb[a].Min.Z > bb[b].Max.Z {
+				continue
+			}
+			if depth, p := interference3(parts[a], parts[b], resolution); depth > TOLERANCE {
+				x := Interference{a, b, depth, p}
+				if a > b {
+					x.A, x.B = b, a
+				}
+				result = append(result, x)
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].A != result[j].A {
+			return result[i].A < result[j].A
+		}
+		return result[i].B < result[j].B
+	})
+	return result
+}
+
+//-----------------------------------------------------------------------------
+
+// ProjectToSurface3 moves a point onto the surface of an SDF3.
+// The point is sphere traced along the gradient of the distance field. A
+// step that doesn't bring the point closer to the surface is retried at half
+// the length, so fields that overestimate the distance still converge. It
+// returns the surface point and true, or the last point and false if the
+// surface isn't reached within maxSteps evaluations, the gradient vanishes
+// (e.g. at the center of a sphere) or the point wanders off into the empty
+// space more than a bounding box size from the bounding box.
+func ProjectToSurface3(s SDF3, p V3, maxSteps int) (V3, bool) {
+	bb := s.BoundingBox()
+	limit := bb.ScaleAboutCenter(3)
+	tol := 1e-6 * bb.Size().MaxComponent()
+	eps := normal_eps(s)
+	k := 1.0
+	d := s.Evaluate(p)
+	for i := 0; i < maxSteps; i++ {
+		if Abs(d) <= tol {
+			return p, true
+		}
+		if !limit.Contains(p) {
+			return p, false
+		}
+		n := Normal3(s, p, eps)
+		if math.IsNaN(n.X) {
+			return p, false
+		}
+		q := p.Sub(n.MulScalar(k * d))
+		dq := s.Evaluate(q)
+		if Abs(dq) >= Abs(d) {
+			// no progress, damp the step
+			k *= 0.5
+			continue
+		}
+		p, d = q, dq
+		k = Min(1, 2*k)
+	}
+	return p, Abs(d) <= tol
+}
+
+//-----------------------------------------------------------------------------
+
+// wallThickness marches from surface point p along the inward direction
+// n until it leaves the solid. It returns the distance travelled, or a
+// negative value if the ray doesn't leave the solid within tmax.
+func wallThickness(s SDF3, p, n V3, step, tmax float64) float64 {
+	t0 := 0.0
+	t1 := step
+	for t1 < tmax {
+		d := s.Evaluate(p.Sub(n.MulScalar(t1)))
+		if d >= 0 {
+			// the sign flipped between t0 and t1: bisect to refine the exit point
+			for i := 0; i < 8; i++ {
+				t := 0.5 * (t0 + t1)
+				if s.Evaluate(p.Sub(n.MulScalar(t))) >= 0 {
+					t1 = t
+				} else {
+					t0 = t
+				}
+			}
+			return 0.5 * (t0 + t1)
+		}
+		// Inside the solid the distance to the nearest surface is a safe step.
+		t0 = t1
+		t1 += Max(-d, step)
+	}
+	return -1
+}
+
+// MinWallThickness3D estimates the minimum wall thickness of an SDF3.
+// The bounding box is sampled on a resolution[0] x resolution[1] x resolution[2]
+// grid. Samples close to the surface are projected onto it, and from each
+// surface point a ray is marched along the inward normal until the field
+// changes sign. The shortest such span and the surface point it starts from
+// are returned.
+//
+// Accuracy is limited by the sampling: walls are only found where there are
+// grid samples close to their surface, so features much smaller than a grid
+// cell may be missed entirely. The span itself is resolved to a small
+// fraction of a cell. Measuring along the normal means sharp inside corners
+// can report the distance to the adjoining wall rather than the wall itself.
+func MinWallThickness3D(s SDF3, resolution V3i) (float64, V3) {
+	tmin := math.Inf(1)
+	var pmin V3
+	wallSamples3(s, resolution, func(p V3, t float64) {
+		if t < tmin {
+			tmin = t
+			pmin = p
+		}
+	})
+	return tmin, pmin
+}
+
+// wallSamples3 calls visit with the surface points and wall thicknesses
+// sampled by MinWallThickness3D.
+func wallSamples3(s SDF3, resolution V3i, visit func(p V3, t float64)) {
+	bb := s.BoundingBox().ScaleAboutCenter(1.01)
+	size := bb.Size()
+	cell := size.Div(resolution.ToV3())
+	// samples within this distance of the surface are considered
+	near := 0.5 * cell.Length()
+	// march step and gradient step
+	step := 0.1 * cell.MinComponent()
+	eps := 0.01 * cell.MinComponent()
+	tmax := size.Length()
+
+	for i := 0; i <= resolution[0]; i++ {
+		for j := 0; j <= resolution[1]; j++ {
+			for k := 0; k <= resolution[2]; k++ {
+				p := bb.Min.Add(V3{float64(i), float64(j), float64(k)}.Mul(cell))
+				d := s.Evaluate(p)
+				if Abs(d) > near {
+					continue
+				}
+				p, ok := ProjectToSurface3(s, p, 20)
+				if !ok {
+					continue
+				}
+				n := Normal3(s, p, eps)
+				if math.IsNaN(n.X) {
+					// no gradient at this point
+					continue
+				}
+				if t := wallThickness(s, p, n, step, tmax); t > 0 {
+					visit(p, t)
+				}
+			}
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// Overhangs3D returns the surface points of an SDF3 that need support when
+// printed along +Z. The surface is meshed with cells of size resolution and
+// the centroid of every downward facing triangle that is more than
+// angleThreshold (radians) from vertical is projected onto the surface and
+// returned. E.g. with a threshold
+// of 45 degrees, vertical walls and 45 degree chamfers print without
+// support, shallower downward faces do not.
+// Faces on the bottom of the bounding box rest on the build plate and are
+// not reported.
+func Overhangs3D(s SDF3, angleThreshold, resolution float64) []V3 {
+	bb := s.BoundingBox()
+	m := MarchingCubes(s, sampleBox3(bb, resolution), resolution)
+	// a face overhangs if its normal is below this z component
+	nz := -math.Sin(angleThreshold)
+	zplate := bb.Min.Z + resolution
+	var points []V3
+	for _, t := range m {
+		n := t.Normal()
+		if math.IsNaN(n.Z) || n.Z >= nz {
+			continue
+		}
+		c := t.V[0].Add(t.V[1]).Add(t.V[2]).DivScalar(3)
+		// the centroid of a flat triangle is off a curved surface
+		if p, ok := ProjectToSurface3(s, c, 20); ok {
+			c = p
+		}
+		if c.Z <= zplate {
+			continue
+		}
+		points = append(points, c)
+	}
+	return points
+}
+
+//-----------------------------------------------------------------------------
+
+// GenerateSupports3D returns support pillars for printing an SDF3 along +Z,
+// to be unioned with the SDF3 for printing. The overhangs (see Overhangs3D)
+// are sampled on a square grid with the given spacing and from each grid
+// cell with an overhang a vertical pillar of diameter pillarDia is dropped
+// down to the build plate (the bottom of the bounding box) or to the nearest
+// surface below. The top of a pillar is at the lowest overhang point in the
+// cell. It returns nil if no supports are needed.
+func GenerateSupports3D(s SDF3, angleThreshold, pillarDia, spacing float64) SDF3 {
+	if pillarDia <= 0 {
+		panic("pillarDia <= 0")
+	}
+	if spacing <= 0 {
+		panic("spacing <= 0")
+	}
+	resolution := 0.5 * Min(spacing, pillarDia)
+	zplate := s.BoundingBox().Min.Z
+	// the lowest overhang point in each grid cell
+	tops := make(map[V2i]V3)
+	for _, p := range Overhangs3D(s, angleThreshold, resolution) {
+		k := V2{p.X, p.Y}.DivScalar(spacing).Floor().ToV2i()
+		if q, ok := tops[k]; !ok || p.Z < q.Z {
+			tops[k] = p
+		}
+	}
+	// in grid order, so the result doesn't depend on the map order
+	keys := make([]V2i, 0, len(tops))
+	for k := range tops {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][1] != keys[j][1] {
+			return keys[i][1] < keys[j][1]
+		}
+		return keys[i][0] < keys[j][0]
+	})
+	var pillars []SDF3
+	step := 0.1 * resolution
+	for _, k := range keys {
+		p := tops[k]
+		// march down to the surface below
+		z := p.Z - step
+		for z > zplate {
+			d := s.Evaluate(V3{p.X, p.Y, z})
+			if d <= 0 {
+				break
+			}
+			z -= Max(d, step)
+		}
+		z = Max(z, zplate)
+		h := p.Z - z
+		if h <= step {
+			continue
+		}
+		c := Cylinder3D(h, 0.5*pillarDia, 0)
+		pillars = append(pillars, Transform3D(c, Translate3d(V3{p.X, p.Y, z + 0.5*h})))
+	}
+	return UnionMany3D(pillars...)
+}
+
+//-----------------------------------------------------------------------------
+
+// footprint returns the cross section of an SDF3 just above the bottom of
+// it's bounding box (the first layer of a print), in XY coordinates.
+func footprint(s SDF3) SDF2 {
+	bb := s.BoundingBox()
+	z := bb.Min.Z + 1e-4*bb.Size().MaxComponent()
+	return Slice2D(s, V3{0, 0, z}, V3{0, 0, 1})
+}
+
+// Raft3D returns a raft for printing an SDF3 along +Z, to be unioned with the
+// SDF3 for printing. The raft is the footprint of the SDF3 (it's cross section
+// at the bottom of the bounding box) grown by margin, extruded to thickness
+// and placed just below the SDF3. The footprint is grown with the 3D distance,
+// this is exact where the walls at the base are vertical.
+func Raft3D(s SDF3, margin, thickness float64) SDF3 {
+	if margin < 0 {
+		panic("margin < 0")
+	}
+	if thickness <= 0 {
+		panic("thickness <= 0")
+	}
+	raft := Extrude3D(Offset2D(footprint(s), margin), thickness)
+	z := s.BoundingBox().Min.Z - 0.5*thickness
+	return Transform3D(raft, Translate3d(V3{0, 0, z}))
+}
+
+// Brim2D returns a brim for printing an SDF3 along +Z, a flat ring of the
+// given width around the footprint of the SDF3 (see Raft3D). Extrude it to
+// the first layer height and union it with the SDF3 at the bottom of the
+// bounding box.
+func Brim2D(s SDF3, width float64) SDF2 {
+	if width <= 0 {
+		panic("width <= 0")
+	}
+	f := footprint(s)
+	return Difference2D(Offset2D(f, width), f)
+}
+
+//-----------------------------------------------------------------------------
+
+// HollowForResin3D hollows out an SDF3 for resin printing. The solid is
+// replaced by a shell of the given wall thickness within it (the outside
+// surface is kept) and drain holes of diameter drainDia are cut through the
+// shell at drainPositions so trapped resin can escape. A drain position is
+// moved onto the nearest surface (see ProjectToSurface3) and the hole is cut
+// along the surface normal, to a depth of 2 * wall on either side of the
+// surface.
+func HollowForResin3D(s SDF3, wall, drainDia float64, drainPositions []V3) SDF3 {
+	if wall <= 0 {
+		panic("wall <= 0")
+	}
+	if drainDia <= 0 && len(drainPositions) > 0 {
+		panic("drainDia <= 0")
+	}
+	shell := Shell3D(Offset3D(s, -0.5*wall), wall)
+	eps := normal_eps(s)
+	var holes []SDF3
+	for _, p := range drainPositions {
+		if q, ok := ProjectToSurface3(s, p, 20); ok {
+			p = q
+		}
+		n := Normal3(s, p, eps)
+		if math.IsNaN(n.X) {
+			panic("no surface normal at drain position")
+		}
+		// rotate the cylinder axis (z) onto the normal
+		m := Translate3d(p)
+		if axis := (V3{0, 0, 1}).Cross(n); axis.Length() > TOLERANCE {
+			m = m.Mul(Rotate3d(axis.Normalize(), math.Acos(Clamp(n.Z, -1, 1))))
+		}
+		holes = append(holes, Transform3D(Cylinder3D(4*wall, 0.5*drainDia, 0), m))
+	}
+	return Difference3D(shell, UnionMany3D(holes...))
+}
+
+//-----------------------------------------------------------------------------
+
+// MedialAxis2D returns an approximate medial axis (skeleton) of an SDF2.
+// The bounding box is sampled at the cell centers of a resolution[0] x
+// resolution[1] grid. A sample inside the SDF2 is on the skeleton if the
+// depth has a ridge through it, i.e. along some grid direction the depth at
+// the sample is well above the average of its neighbours. Adjacent skeleton
+// samples are joined and returned as line segments (pairs of points).
+// The skeleton is only located to within a cell, may be 2 cells wide, and
+// branches with a shallow ridge (e.g. from obtuse corners) may be missed.
+func MedialAxis2D(s SDF2, resolution V2i) [][]V2 {
+	bb := s.BoundingBox()
+	nx, ny := resolution[0], resolution[1]
+	h := bb.Size().Div(V2{float64(nx), float64(ny)})
+	// sample the depth (distance inside the SDF2) with a border of 1 cell
+	depth := make([][]float64, nx+2)
+	point := func(i, j int) V2 {
+		return bb.Min.Add(h.Mul(V2{float64(i) - 0.5, float64(j) - 0.5}))
+	}
+	for i := range depth {
+		depth[i] = make([]float64, ny+2)
+		for j := range depth[i] {
+			depth[i][j] = -s.Evaluate(point(i, j))
+		}
+	}
+	// grid directions and their step lengths
+	dirs := []struct {
+		di, dj int
+		l      float64
+	}{
+		{1, 0, h.X},
+		{0, 1, h.Y},
+		{1, 1, h.Length()},
+		{1, -1, h.Length()},
+	}
+	ridge := make([][]bool, nx+2)
+	for i := range ridge {
+		ridge[i] = make([]bool, ny+2)
+	}
+	for i := 1; i <= nx; i++ {
+		for j := 1; j <= ny; j++ {
+			d := depth[i][j]
+			if d <= 0 {
+				continue
+			}
+			for _, k := range dirs {
+				avg := 0.5 * (depth[i+k.di][j+k.dj] + depth[i-k.di][j-k.dj])
+				// the depth is linear away from the skeleton
+				if d-avg > 0.2*k.l {
+					ridge[i][j] = true
+					break
+				}
+			}
+		}
+	}
+	// join adjacent skeleton samples
+	var segments [][]V2
+	for i := 1; i <= nx; i++ {
+		for j := 1; j <= ny; j++ {
+			if !ridge[i][j] {
+				continue
+			}
+			for _, k := range dirs {
+				if ridge[i+k.di][j+k.dj] {
+					segments = append(segments, []V2{point(i, j), point(i+k.di, j+k.dj)})
+				}
+			}
+		}
+	}
+	return segments
+}
+
+//-----------------------------------------------------------------------------
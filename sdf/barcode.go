@@ -0,0 +1,584 @@
+//-----------------------------------------------------------------------------
+/*
+
+Barcodes
+
+QR codes and Code 128 barcodes as SDF2s for embossing onto parts.
+
+The QR encoder is minimal: byte mode, error correction level L and
+versions 1 to 6 (up to 134 bytes of data).
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "math"
+
+//-----------------------------------------------------------------------------
+// Module Grids
+
+// ModuleGridSDF2 is a grid of square modules (dark or light), centered on
+// the origin. Row 0 is the top row.
+type ModuleGridSDF2 struct {
+	dark   [][]bool // [row][col]
+	rows   int
+	cols   int
+	width  float64 // module width
+	height float64 // module height
+	bb     Box2
+}
+
+// moduleGrid2D returns the SDF2 for a grid of modules.
+func moduleGrid2D(dark [][]bool, width, height float64) SDF2 {
+	if width <= 0 || height <= 0 {
+		panic("module size <= 0")
+	}
+	s := ModuleGridSDF2{}
+	s.dark = dark
+	s.rows = len(dark)
+	s.cols = len(dark[0])
+	s.width = width
+	s.height = height
+	size := V2{float64(s.cols) * width, float64(s.rows) * height}
+	s.bb = Box2{size.MulScalar(-0.5), size.MulScalar(0.5)}
+	return &s
+}
+
+// isDark returns true if a module is dark. Modules outside the grid are light.
+func (s *ModuleGridSDF2) isDark(row, col int) bool {
+	if row < 0 || col < 0 || row >= s.rows || col >= s.cols {
+		return false
+	}
+	return s.dark[row][col]
+}
+
+// Return the minimum distance to the dark modules.
+func (s *ModuleGridSDF2) Evaluate(p V2) float64 {
+	// point in grid coordinates, x = col, y = row
+	q := V2{p.X - s.bb.Min.X, s.bb.Max.Y - p.Y}
+	col := int(math.Floor(q.X / s.width))
+	row := int(math.Floor(q.Y / s.height))
+	inside := s.isDark(row, col)
+	// distance from q to a module
+	dist := func(r, c int) float64 {
+		x0 := float64(c) * s.width
+		y0 := float64(r) * s.height
+		dx := Max(Max(x0-q.X, q.X-(x0+s.width)), 0)
+		dy := Max(Max(y0-q.Y, q.Y-(y0+s.height)), 0)
+		return math.Sqrt(dx*dx + dy*dy)
+	}
+	// search rings of modules about q for the nearest module of the other color
+	dmin := math.MaxFloat64
+	if inside {
+		// the outside of the grid is light
+		dmin = Min(Min(q.X, float64(s.cols)*s.width-q.X), Min(q.Y, float64(s.rows)*s.height-q.Y))
+	} else {
+		// outside the grid: search from the nearest grid module
+		row = int(Clamp(float64(row), 0, float64(s.rows-1)))
+		col = int(Clamp(float64(col), 0, float64(s.cols-1)))
+	}
+	step := Min(s.width, s.height)
+	for r := 0; r <= s.rows+s.cols; r++ {
+		// modules in ring r are at least r-1 steps away
+		if dmin <= float64(r-1)*step {
+			break
+		}
+		for i := row - r; i <= row+r; i++ {
+			for j := col - r; j <= col+r; j++ {
+				if i != row-r && i != row+r && j != col-r && j != col+r {
+					continue
+				}
+				if i < 0 || j < 0 || i >= s.rows || j >= s.cols {
+					continue
+				}
+				if s.dark[i][j] != inside {
+					dmin = Min(dmin, dist(i, j))
+				}
+			}
+		}
+	}
+	if inside {
+		return -dmin
+	}
+	return dmin
+}
+
+// Return the bounding box.
+func (s *ModuleGridSDF2) BoundingBox() Box2 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+// QR Code Reed-Solomon error correction, GF(256) with polynomial 0x11d
+
+var gfExp, gfLog = gfTables()
+
+func gfTables() ([512]int, [256]int) {
+	var exp [512]int
+	var log [256]int
+	x := 1
+	for i := 0; i < 255; i++ {
+		exp[i] = x
+		log[x] = i
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+	for i := 255; i < 512; i++ {
+		exp[i] = exp[i-255]
+	}
+	return exp, log
+}
+
+func gfMul(a, b int) int {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[gfLog[a]+gfLog[b]]
+}
+
+// rsEncode returns n error correction codewords for the data codewords.
+func rsEncode(data []byte, n int) []byte {
+	// generator polynomial (x - a^0)(x - a^1)...(x - a^(n-1)), highest power first
+	gen := []int{1}
+	for i := 0; i < n; i++ {
+		next := make([]int, len(gen)+1)
+		for j, g := range gen {
+			next[j] ^= g
+			next[j+1] ^= gfMul(g, gfExp[i])
+		}
+		gen = next
+	}
+	// remainder of data * x^n / gen
+	res := make([]int, len(data)+n)
+	for i, d := range data {
+		res[i] = int(d)
+	}
+	for i := range data {
+		c := res[i]
+		if c != 0 {
+			for j := 1; j < len(gen); j++ {
+				res[i+j] ^= gfMul(gen[j], c)
+			}
+		}
+	}
+	ec := make([]byte, n)
+	for i := range ec {
+		ec[i] = byte(res[len(data)+i])
+	}
+	return ec
+}
+
+//-----------------------------------------------------------------------------
+// QR Code Symbols
+
+// qrVersions are the level L block sizes for versions 1 to 6.
+var qrVersions = []struct {
+	data   int // data codewords per block
+	ec     int // error correction codewords per block
+	blocks int // number of blocks
+	align  int // position of the alignment pattern (0 == none)
+}{
+	{19, 7, 1, 0},
+	{34, 10, 1, 18},
+	{55, 15, 1, 22},
+	{80, 20, 1, 26},
+	{108, 26, 1, 30},
+	{68, 18, 2, 34},
+}
+
+// qrSymbol is a QR code symbol under construction.
+type qrSymbol struct {
+	n       int      // size in modules
+	dark    [][]bool // [row][col]
+	reserve [][]bool // function pattern modules
+}
+
+func newQRSymbol(version int) *qrSymbol {
+	q := qrSymbol{n: 17 + 4*version}
+	q.dark = make([][]bool, q.n)
+	q.reserve = make([][]bool, q.n)
+	for i := range q.dark {
+		q.dark[i] = make([]bool, q.n)
+		q.reserve[i] = make([]bool, q.n)
+	}
+	return &q
+}
+
+// set a function pattern module
+func (q *qrSymbol) set(row, col int, dark bool) {
+	if row >= 0 && col >= 0 && row < q.n && col < q.n {
+		q.dark[row][col] = dark
+		q.reserve[row][col] = true
+	}
+}
+
+// finder adds a finder pattern (and separator) centered on row, col.
+func (q *qrSymbol) finder(row, col int) {
+	for i := -4; i <= 4; i++ {
+		for j := -4; j <= 4; j++ {
+			d := int(math.Max(math.Abs(float64(i)), math.Abs(float64(j))))
+			q.set(row+i, col+j, d != 2 && d != 4)
+		}
+	}
+}
+
+// alignment adds an alignment pattern centered on row, col.
+func (q *qrSymbol) alignment(row, col int) {
+	for i := -2; i <= 2; i++ {
+		for j := -2; j <= 2; j++ {
+			d := int(math.Max(math.Abs(float64(i)), math.Abs(float64(j))))
+			q.set(row+i, col+j, d != 1)
+		}
+	}
+}
+
+// functionPatterns adds the finder, timing and alignment patterns.
+func (q *qrSymbol) functionPatterns(align int) {
+	for i := 0; i < q.n; i++ {
+		q.set(6, i, i%2 == 0)
+		q.set(i, 6, i%2 == 0)
+	}
+	q.finder(3, 3)
+	q.finder(3, q.n-4)
+	q.finder(q.n-4, 3)
+	if align != 0 {
+		q.alignment(align, align)
+	}
+	// reserve the format areas
+	q.format(0)
+}
+
+// qrFormatBits returns the 15 bit format information for level L.
+func qrFormatBits(mask int) int {
+	bits := 1<<3 | mask
+	rem := bits
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	return (bits<<10 | rem) ^ 0x5412
+}
+
+// format adds the format information for a mask.
+func (q *qrSymbol) format(mask int) {
+	bits := qrFormatBits(mask)
+	bit := func(i int) bool { return (bits>>uint(i))&1 != 0 }
+	// around the top left finder
+	for i := 0; i <= 5; i++ {
+		q.set(i, 8, bit(i))
+	}
+	q.set(7, 8, bit(6))
+	q.set(8, 8, bit(7))
+	q.set(8, 7, bit(8))
+	for i := 9; i < 15; i++ {
+		q.set(8, 14-i, bit(i))
+	}
+	// split between the other finders
+	for i := 0; i < 8; i++ {
+		q.set(8, q.n-1-i, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		q.set(q.n-15+i, 8, bit(i))
+	}
+	q.set(q.n-8, 8, true)
+}
+
+// place adds the codewords in the zigzag order from the bottom right.
+func (q *qrSymbol) place(data []byte) {
+	i := 0
+	for right := q.n - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < q.n; vert++ {
+			for j := 0; j < 2; j++ {
+				col := right - j
+				row := vert
+				if (right+1)&2 == 0 {
+					// upwards
+					row = q.n - 1 - vert
+				}
+				if !q.reserve[row][col] && i < len(data)*8 {
+					q.dark[row][col] = (data[i>>3]>>uint(7-i&7))&1 != 0
+					i++
+				}
+			}
+		}
+	}
+}
+
+// qrMask returns true if the module at row, col is inverted by a mask.
+func qrMask(mask, row, col int) bool {
+	switch mask {
+	case 0:
+		return (row+col)%2 == 0
+	case 1:
+		return row%2 == 0
+	case 2:
+		return col%3 == 0
+	case 3:
+		return (row+col)%3 == 0
+	case 4:
+		return (row/2+col/3)%2 == 0
+	case 5:
+		return (row*col)%2+(row*col)%3 == 0
+	case 6:
+		return ((row*col)%2+(row*col)%3)%2 == 0
+	}
+	return ((row+col)%2+(row*col)%3)%2 == 0
+}
+
+// mask inverts the data modules with a mask (applying it twice removes it).
+func (q *qrSymbol) mask(mask int) {
+	for row := 0; row < q.n; row++ {
+		for col := 0; col < q.n; col++ {
+			if !q.reserve[row][col] && qrMask(mask, row, col) {
+				q.dark[row][col] = !q.dark[row][col]
+			}
+		}
+	}
+}
+
+// penalty returns the mask penalty score of the symbol.
+func (q *qrSymbol) penalty() int {
+	p := 0
+	at := func(i, j int, transpose bool) bool {
+		if transpose {
+			return q.dark[j][i]
+		}
+		return q.dark[i][j]
+	}
+	finder := []bool{true, false, true, true, true, false, true}
+	for _, t := range []bool{false, true} {
+		for i := 0; i < q.n; i++ {
+			// runs of 5 or more modules of the same color
+			run := 1
+			for j := 1; j < q.n; j++ {
+				if at(i, j, t) == at(i, j-1, t) {
+					run++
+					if run == 5 {
+						p += 3
+					} else if run > 5 {
+						p++
+					}
+				} else {
+					run = 1
+				}
+			}
+			// finder like patterns with 4 light modules on one side
+			for j := 0; j+7 <= q.n; j++ {
+				match := true
+				for k, f := range finder {
+					if at(i, j+k, t) != f {
+						match = false
+						break
+					}
+				}
+				if !match {
+					continue
+				}
+				light := func(j0, j1 int) bool {
+					if j0 < 0 || j1 > q.n {
+						return false
+					}
+					for k := j0; k < j1; k++ {
+						if at(i, k, t) {
+							return false
+						}
+					}
+					return true
+				}
+				if light(j-4, j) || light(j+7, j+11) {
+					p += 40
+				}
+			}
+		}
+	}
+	// 2x2 blocks of the same color
+	dark := 0
+	for i := 0; i < q.n; i++ {
+		for j := 0; j < q.n; j++ {
+			if q.dark[i][j] {
+				dark++
+			}
+			if i > 0 && j > 0 {
+				c := q.dark[i][j]
+				if q.dark[i-1][j] == c && q.dark[i][j-1] == c && q.dark[i-1][j-1] == c {
+					p += 3
+				}
+			}
+		}
+	}
+	// balance of dark and light modules
+	percent := float64(100*dark) / float64(q.n*q.n)
+	p += 10 * int(math.Abs(percent-50)/5)
+	return p
+}
+
+// qrCodewords returns the interleaved data and error correction codewords.
+func qrCodewords(data string, version int) []byte {
+	v := qrVersions[version-1]
+	// byte mode, 8 bit count, data, terminator
+	var bits []bool
+	add := func(x, n int) {
+		for i := n - 1; i >= 0; i-- {
+			bits = append(bits, (x>>uint(i))&1 != 0)
+		}
+	}
+	add(4, 4)
+	add(len(data), 8)
+	for i := 0; i < len(data); i++ {
+		add(int(data[i]), 8)
+	}
+	capacity := v.data * v.blocks * 8
+	for i := 0; i < 4 && len(bits) < capacity; i++ {
+		bits = append(bits, false)
+	}
+	for len(bits)%8 != 0 {
+		bits = append(bits, false)
+	}
+	cw := make([]byte, 0, v.data*v.blocks)
+	for i := 0; i < len(bits); i += 8 {
+		var b byte
+		for j := 0; j < 8; j++ {
+			if bits[i+j] {
+				b |= 1 << uint(7-j)
+			}
+		}
+		cw = append(cw, b)
+	}
+	// pad codewords
+	for i := 0; len(cw) < cap(cw); i++ {
+		cw = append(cw, []byte{0xec, 0x11}[i%2])
+	}
+	// split into blocks and interleave
+	var out []byte
+	ec := make([][]byte, v.blocks)
+	for b := range ec {
+		ec[b] = rsEncode(cw[b*v.data:(b+1)*v.data], v.ec)
+	}
+	for i := 0; i < v.data; i++ {
+		for b := 0; b < v.blocks; b++ {
+			out = append(out, cw[b*v.data+i])
+		}
+	}
+	for i := 0; i < v.ec; i++ {
+		for b := 0; b < v.blocks; b++ {
+			out = append(out, ec[b][i])
+		}
+	}
+	return out
+}
+
+// qrEncode returns the modules of a QR code symbol for the data.
+func qrEncode(data string) [][]bool {
+	// find the smallest version that holds the data
+	version := 0
+	for i, v := range qrVersions {
+		if 4+8+8*len(data) <= v.data*v.blocks*8 {
+			version = i + 1
+			break
+		}
+	}
+	if version == 0 {
+		panic("too much data for a QR code")
+	}
+	q := newQRSymbol(version)
+	q.functionPatterns(qrVersions[version-1].align)
+	q.place(qrCodewords(data, version))
+	// use the mask with the lowest penalty
+	best, pmin := 0, math.MaxInt32
+	for m := 0; m < 8; m++ {
+		q.mask(m)
+		q.format(m)
+		if p := q.penalty(); p < pmin {
+			best, pmin = m, p
+		}
+		q.mask(m)
+	}
+	q.mask(best)
+	q.format(best)
+	return q.dark
+}
+
+// quietZone returns a grid with a margin of light modules.
+func quietZone(dark [][]bool, rows, cols int) [][]bool {
+	grid := make([][]bool, len(dark)+2*rows)
+	for i := range grid {
+		grid[i] = make([]bool, len(dark[0])+2*cols)
+		if i >= rows && i < rows+len(dark) {
+			copy(grid[i][cols:], dark[i-rows])
+		}
+	}
+	return grid
+}
+
+// QRCode2D returns the SDF2 for a QR code of the data, centered on the
+// origin. The dark modules are inside the SDF2. The symbol has the standard
+// 4 module quiet zone, so it is (4 * version + 25) modules wide.
+func QRCode2D(data string, moduleSize float64) SDF2 {
+	return moduleGrid2D(quietZone(qrEncode(data), 4, 4), moduleSize, moduleSize)
+}
+
+//-----------------------------------------------------------------------------
+// Code 128 Barcodes
+
+// code128Patterns are the bar/space widths of the Code 128 symbols.
+var code128Patterns = []string{
+	"212222", "222122", "222221", "121223", "121322", "131222", "122213", "122312", "132212", "221213",
+	"221312", "231212", "112232", "122132", "122231", "113222", "123122", "123221", "223211", "221132",
+	"221231", "213212", "223112", "312131", "311222", "321122", "321221", "312212", "322112", "322211",
+	"212123", "212321", "232121", "111323", "131123", "131321", "112313", "132113", "132311", "211313",
+	"231113", "231311", "112133", "112331", "132131", "113123", "113321", "133121", "313121", "211331",
+	"231131", "213113", "213311", "213131", "311123", "311321", "331121", "312113", "312311", "332111",
+	"314111", "221411", "431111", "111224", "111422", "121124", "121421", "141122", "141221", "112214",
+	"112412", "122114", "122411", "142112", "142211", "241211", "221114", "413111", "241112", "134111",
+	"111242", "121142", "121241", "114212", "124112", "124211", "411212", "421112", "421211", "212141",
+	"214121", "412121", "111143", "111341", "131141", "114113", "114311", "411113", "411311", "113141",
+	"114131", "311141", "411131", "211412", "211214", "211232", "2331112",
+}
+
+const (
+	code128StartB = 104
+	code128Stop   = 106
+)
+
+// code128Encode returns the modules of a Code 128 (code set B) barcode.
+func code128Encode(data string) []bool {
+	symbols := []int{code128StartB}
+	sum := code128StartB
+	for i := 0; i < len(data); i++ {
+		c := int(data[i])
+		if c < 32 || c > 127 {
+			panic("character not in Code 128 code set B")
+		}
+		symbols = append(symbols, c-32)
+		sum += (c - 32) * (i + 1)
+	}
+	symbols = append(symbols, sum%103, code128Stop)
+	var modules []bool
+	for _, s := range symbols {
+		for i, w := range code128Patterns[s] {
+			// odd elements are bars
+			for j := 0; j < int(w-'0'); j++ {
+				modules = append(modules, i%2 == 0)
+			}
+		}
+	}
+	return modules
+}
+
+// Code128_2D returns the SDF2 for a Code 128 barcode of the data, centered on
+// the origin. The bars are inside the SDF2 and there is a 10 module quiet zone
+// on each side.
+func Code128_2D(data string, moduleSize, height float64) SDF2 {
+	if height <= 0 {
+		panic("height <= 0")
+	}
+	grid := quietZone([][]bool{code128Encode(data)}, 0, 10)
+	return moduleGrid2D(grid, moduleSize, height)
+}
+
+//-----------------------------------------------------------------------------
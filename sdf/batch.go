@@ -0,0 +1,165 @@
+//-----------------------------------------------------------------------------
+/*
+
+Batch Evaluation
+
+An SDF3 can evaluate many points in one call by implementing BatchSDF3.
+This saves the per point call overhead of deep SDF3 trees (each node is
+called once per batch rather than once per point) and gives the compiler
+simple loops to work with. The mesher uses it when it's available.
+
+The batch results must be the same as Evaluate for each point, so the mesh
+doesn't depend on how the points were evaluated.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "sync"
+
+//-----------------------------------------------------------------------------
+
+// BatchSDF3 is an SDF3 that can evaluate a set of points in one call.
+type BatchSDF3 interface {
+	SDF3
+	EvaluateBatch(p []V3) []float64
+}
+
+// The slices used within a batch evaluation are recycled, saving the
+// allocations for each node of the SDF3 tree.
+var batch_v3 = sync.Pool{New: func() interface{} { return []V3(nil) }}
+var batch_f64 = sync.Pool{New: func() interface{} { return []float64(nil) }}
+
+// Return a V3 slice of length n.
+func get_v3(n int) []V3 {
+	q := batch_v3.Get().([]V3)
+	if cap(q) < n {
+		return make([]V3, n)
+	}
+	return q[:n]
+}
+
+// Return a float64 slice of length n.
+func get_f64(n int) []float64 {
+	d := batch_f64.Get().([]float64)
+	if cap(d) < n {
+		return make([]float64, n)
+	}
+	return d[:n]
+}
+
+// EvaluateBatch3 returns the distances of an SDF3 at a set of points.
+// It uses EvaluateBatch if the SDF3 has it, else Evaluate for each point.
+func EvaluateBatch3(s SDF3, p []V3) []float64 {
+	if b, ok := s.(BatchSDF3); ok {
+		return b.EvaluateBatch(p)
+	}
+	d := get_f64(len(p))
+	for i := range p {
+		d[i] = s.Evaluate(p[i])
+	}
+	return d
+}
+
+//-----------------------------------------------------------------------------
+// primitives
+
+// EvaluateBatch returns the minimum distances to a sphere.
+func (s *SphereSDF3) EvaluateBatch(p []V3) []float64 {
+	d := get_f64(len(p))
+	for i := range p {
+		d[i] = p[i].Length() - s.radius
+	}
+	return d
+}
+
+// EvaluateBatch returns the minimum distances to a box.
+func (s *BoxSDF3) EvaluateBatch(p []V3) []float64 {
+	d := get_f64(len(p))
+	for i := range p {
+		d[i] = sdf_box3d(p[i], s.size) - s.round
+	}
+	return d
+}
+
+// EvaluateBatch returns the minimum distances to a cylinder.
+func (s *CylinderSDF3) EvaluateBatch(p []V3) []float64 {
+	d := get_f64(len(p))
+	for i := range p {
+		d[i] = sdf_box2d(V2{V2{p[i].X, p[i].Y}.Length(), p[i].Z}, V2{s.radius, s.height}) - s.round
+	}
+	return d
+}
+
+//-----------------------------------------------------------------------------
+// transforms
+
+// EvaluateBatch returns the minimum distances to a transformed SDF3.
+func (s *TransformSDF3) EvaluateBatch(p []V3) []float64 {
+	q := get_v3(len(p))
+	for i := range p {
+		q[i] = s.inverse.MulPosition(p[i])
+	}
+	d := EvaluateBatch3(s.sdf, q)
+	batch_v3.Put(q)
+	return d
+}
+
+// EvaluateBatch returns the minimum distances to a scaled SDF3.
+func (s *ScaleUniformSDF3) EvaluateBatch(p []V3) []float64 {
+	q := get_v3(len(p))
+	for i := range p {
+		q[i] = p[i].MulScalar(s.inv_k)
+	}
+	d := EvaluateBatch3(s.sdf, q)
+	batch_v3.Put(q)
+	for i := range d {
+		d[i] *= s.k
+	}
+	return d
+}
+
+//-----------------------------------------------------------------------------
+// booleans
+
+// EvaluateBatch returns the minimum distances to a union.
+func (s *UnionSDF3) EvaluateBatch(p []V3) []float64 {
+	var d []float64
+	for i, x := range s.sdf {
+		if i == 0 {
+			d = EvaluateBatch3(x, p)
+		} else {
+			e := EvaluateBatch3(x, p)
+			for j := range d {
+				d[j] = s.min(d[j], e[j])
+			}
+			batch_f64.Put(e)
+		}
+	}
+	return d
+}
+
+// EvaluateBatch returns the minimum distances to a difference.
+func (s *DifferenceSDF3) EvaluateBatch(p []V3) []float64 {
+	d := EvaluateBatch3(s.s0, p)
+	e := EvaluateBatch3(s.s1, p)
+	for i := range d {
+		d[i] = s.max(d[i], -e[i])
+	}
+	batch_f64.Put(e)
+	return d
+}
+
+// EvaluateBatch returns the minimum distances to an intersection.
+func (s *IntersectionSDF3) EvaluateBatch(p []V3) []float64 {
+	d := EvaluateBatch3(s.s0, p)
+	e := EvaluateBatch3(s.s1, p)
+	for i := range d {
+		d[i] = s.max(d[i], e[i])
+	}
+	batch_f64.Put(e)
+	return d
+}
+
+//-----------------------------------------------------------------------------
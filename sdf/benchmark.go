@@ -6,6 +6,7 @@ package sdf
 
 import (
 	"fmt"
+	"sync/atomic"
 	"time"
 )
 
@@ -63,3 +64,34 @@ func BenchmarkSDF3(description string, s SDF3) {
 }
 
 //-----------------------------------------------------------------------------
+
+// CountedSDF3 counts the evaluations of an SDF3.
+type CountedSDF3 struct {
+	sdf   SDF3
+	count *int64
+	bb    Box3
+}
+
+// Counted3D wraps an SDF3 with an evaluation counter, e.g. to see how many
+// times a part of a model is evaluated while rendering. The counter is
+// incremented atomically, use atomic.LoadInt64 to read it during a render.
+func Counted3D(sdf SDF3) (SDF3, *int64) {
+	s := CountedSDF3{}
+	s.sdf = sdf
+	s.count = new(int64)
+	s.bb = sdf.BoundingBox()
+	return &s, s.count
+}
+
+// Return the minimum distance to the SDF3.
+func (s *CountedSDF3) Evaluate(p V3) float64 {
+	atomic.AddInt64(s.count, 1)
+	return s.sdf.Evaluate(p)
+}
+
+// Return the bounding box.
+func (s *CountedSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
@@ -10,7 +10,7 @@ package sdf
 
 import (
 	"fmt"
-	"math/rand"
+	"math"
 )
 
 //-----------------------------------------------------------------------------
@@ -166,7 +166,7 @@ func (s *BezierSpline) Sample(p *Polygon, t0, t1 float64, p0, p1 V2, n int) {
 	if colinearSlow(pmid, p0, p1, s.tolerance) {
 		// the curve could be periodic so perturb the midpoint
 		// pick a t value in [0.45,0.55]
-		k := 0.45 + 0.1*rand.Float64()
+		k := 0.45 + 0.1*randomFloat64()
 		t2 := t0 + k*(t1-t0)
 		p2 := s.f0(t2)
 		if colinearSlow(p2, p0, p1, s.tolerance) {
@@ -194,12 +194,33 @@ func (s *BezierSpline) Sample(p *Polygon, t0, t1 float64, p0, p1 V2, n int) {
 	s.Sample(p, tmid, t1, pmid, p1, n+1)
 }
 
+// Return the 1st derivative for a given t value.
+func (s *BezierSpline) f1(t float64) V2 {
+	return V2{s.px.f1(t), s.py.f1(t)}
+}
+
+// length returns the arc length of the spline from t0 to t1 by adaptive
+// subdivision. The chord p0-p1 and the two half chords via the midpoint are
+// compared, the segment is split until they agree to within eps.
+func (s *BezierSpline) length(t0, t1 float64, p0, p1 V2, eps float64, n int) float64 {
+	tmid := (t0 + t1) / 2
+	pmid := s.f0(tmid)
+	l0 := p1.Sub(p0).Length()
+	l1 := pmid.Sub(p0).Length() + p1.Sub(pmid).Length()
+	// a minimum depth so a symmetric curve isn't mistaken for a line
+	if (n > 3 && l1-l0 < eps) || n > 24 {
+		// Richardson extrapolation
+		return l1 + (l1-l0)/3
+	}
+	return s.length(t0, tmid, p0, pmid, eps/2, n+1) + s.length(tmid, t1, pmid, p1, eps/2, n+1)
+}
+
 // NewBezierSpline returns a bezier spline from the provided control/end points.
+// The curve is sampled with the default flatness, BezierFlatness.
 func NewBezierSpline(p []V2) *BezierSpline {
 	//fmt.Printf("%v\n", p)
 	s := BezierSpline{}
-	// closer to 0, more polygon line segments
-	s.tolerance = 0.02 // sin(theta)
+	s.tolerance = BezierFlatness
 	// work out the polynomials
 	x := make([]float64, len(p))
 	y := make([]float64, len(p))
@@ -232,10 +253,17 @@ type BezierVertex struct {
 
 // Bezier curve specification..
 type Bezier struct {
-	closed bool           // is the curve closed or open?
-	vlist  []BezierVertex // list of bezier vertices
+	closed   bool           // is the curve closed or open?
+	vlist    []BezierVertex // list of bezier vertices
+	flatness float64        // flatness for sampling the curve (0 == default)
+	simplify float64        // polygon simplification tolerance for SDF2 (0 == none)
 }
 
+// BezierFlatness is the default flatness for sampling bezier curves to
+// polygons (see Bezier.SetFlatness), it's used by all new bezier curves
+// including the glyph outlines of text.
+var BezierFlatness = 0.02
+
 //-----------------------------------------------------------------------------
 
 // Convert handles to control points.
@@ -342,6 +370,28 @@ func (b *Bezier) Close() {
 	b.closed = true
 }
 
+// SetFlatness sets the flatness for sampling the curve to a polygon.
+// A curve segment is split until the sine of the angle at its midpoint
+// (between the directions to the ends of the segment) is less than the
+// flatness, so it's independent of the scale of the curve. Closer to 0
+// gives more polygon line segments, the default is BezierFlatness.
+func (b *Bezier) SetFlatness(flatness float64) {
+	if flatness <= 0 {
+		panic("flatness <= 0")
+	}
+	b.flatness = flatness
+}
+
+// SetSimplify sets the tolerance for simplifying the polygon of the curve
+// when it's converted to an SDF2 (see Simplify2D), 0 (the default) gives the
+// unsimplified polygon. The tolerance is in the units of the curve.
+func (b *Bezier) SetSimplify(tol float64) {
+	if tol < 0 {
+		panic("tol < 0")
+	}
+	b.simplify = tol
+}
+
 // AddV2 adds a V2 vertex to a polygon.
 func (b *Bezier) AddV2(x V2) *BezierVertex {
 	v := BezierVertex{}
@@ -356,6 +406,57 @@ func (b *Bezier) Add(x, y float64) *BezierVertex {
 	return b.AddV2(V2{x, y})
 }
 
+// addJoin adds an endpoint, unless the curve already ends at that point.
+func (b *Bezier) addJoin(x V2) {
+	if n := len(b.vlist); n > 0 {
+		last := b.vlist[n-1]
+		if last.vtype == endpoint && last.vertex.Equals(x, TOLERANCE) {
+			return
+		}
+	}
+	b.AddV2(x)
+}
+
+// AddPolyline adds a set of V2 vertices (as endpoints) to the curve.
+// The first vertex is dropped if the curve already ends at that point.
+func (b *Bezier) AddPolyline(x []V2) *Bezier {
+	for _, v := range x {
+		b.addJoin(v)
+	}
+	return b
+}
+
+// AddArc adds a circular arc to the curve. The arc goes from angle a0 to
+// angle a1 (radians), counter-clockwise if a1 > a0, else clockwise. It's
+// approximated with a cubic spline for each 90 degrees (or less) of the
+// arc, the radial error is < 3e-4 * radius. The start of the arc is dropped
+// if the curve already ends at that point, so consecutive lines and arcs
+// join without repeated vertices.
+func (b *Bezier) AddArc(center V2, radius, a0, a1 float64) *Bezier {
+	if radius <= 0 {
+		panic("radius <= 0")
+	}
+	n := int(math.Ceil(Abs(a1-a0)/(PI/2) - EPSILON))
+	if n == 0 {
+		b.addJoin(PolarToXY(radius, a0).Add(center))
+		return b
+	}
+	da := (a1 - a0) / float64(n)
+	// control point distance along the tangent
+	k := radius * 4 / 3 * math.Tan(da/4)
+	for i := 0; i < n; i++ {
+		t0 := a0 + float64(i)*da
+		t1 := t0 + da
+		p0 := PolarToXY(radius, t0).Add(center)
+		p1 := PolarToXY(radius, t1).Add(center)
+		b.addJoin(p0)
+		b.AddV2(p0.Add(PolarToXY(k, t0+PI/2))).Mid()
+		b.AddV2(p1.Sub(PolarToXY(k, t1+PI/2))).Mid()
+		b.AddV2(p1)
+	}
+	return b
+}
+
 // Mid marks the vertex as a mid-curve control point.
 func (v *BezierVertex) Mid() *BezierVertex {
 	v.vtype = midpoint
@@ -387,8 +488,8 @@ func (v *BezierVertex) Handle(theta, fwd, rev float64) *BezierVertex {
 	return v
 }
 
-// Polygon returns a polygon approximating the bezier curve.
-func (b *Bezier) Polygon() *Polygon {
+// splines returns the bezier splines between the endpoints of the curve.
+func (b *Bezier) splines() []*BezierSpline {
 	b.fixups()
 
 	// generate the splines from the vertices
@@ -414,7 +515,11 @@ func (b *Bezier) Polygon() *Polygon {
 			if v.vtype == endpoint {
 				// end of spline
 				vertices = append(vertices, v.vertex)
-				splines = append(splines, NewBezierSpline(vertices))
+				s := NewBezierSpline(vertices)
+				if b.flatness > 0 {
+					s.tolerance = b.flatness
+				}
+				splines = append(splines, s)
 				// this endpoint is the start of the next spline, don't advance
 				state = endpoint
 				// check for the last endpoint
@@ -434,9 +539,16 @@ func (b *Bezier) Polygon() *Polygon {
 		}
 	}
 
+	return splines
+}
+
+// Polygon returns a polygon approximating the bezier curve.
+func (b *Bezier) Polygon() *Polygon {
+	splines := b.splines()
+
 	// render the splines to a polygon
 	p := NewPolygon()
-	n = len(splines)
+	n := len(splines)
 	for i, s := range splines {
 		if s.px.n == 0 && s.py.n == 0 {
 			// This is a point, not a curve. Skip it.
@@ -452,4 +564,64 @@ func (b *Bezier) Polygon() *Polygon {
 	return p
 }
 
+// SDF2 returns the SDF2 for a closed bezier curve. The curve is sampled with
+// the flatness of the curve and simplified with its simplification tolerance
+// (see SetFlatness and SetSimplify).
+func (b *Bezier) SDF2() SDF2 {
+	return Polygon2D(Simplify2D(b.Polygon().Vertices(), b.simplify))
+}
+
+//-----------------------------------------------------------------------------
+
+// segment returns the spline and the spline t value for a curve t value.
+func (b *Bezier) segment(t float64) (*BezierSpline, float64) {
+	var splines []*BezierSpline
+	for _, s := range b.splines() {
+		if s.px.n != 0 || s.py.n != 0 {
+			splines = append(splines, s)
+		}
+	}
+	if len(splines) == 0 {
+		panic("bezier curve has no length")
+	}
+	t = Clamp(t, 0, 1) * float64(len(splines))
+	i := int(t)
+	if i == len(splines) {
+		i--
+	}
+	return splines[i], t - float64(i)
+}
+
+// PointAt returns the point on the bezier curve at t = [0,1]. Each spline of
+// the curve (between endpoints) covers an equal range of t, so t isn't
+// proportional to the arc length.
+func (b *Bezier) PointAt(t float64) V2 {
+	s, u := b.segment(t)
+	return s.f0(u)
+}
+
+// TangentAt returns the unit tangent of the bezier curve at t = [0,1] (see
+// PointAt), in the direction of increasing t.
+func (b *Bezier) TangentAt(t float64) V2 {
+	s, u := b.segment(t)
+	return s.f1(u).Normalize()
+}
+
+// Length returns the arc length of the bezier curve. It's worked out by
+// adaptive subdivision of the splines, the relative error is about 1e-9.
+func (b *Bezier) Length() float64 {
+	l := 0.0
+	for _, s := range b.splines() {
+		p0 := s.f0(0)
+		p1 := s.f0(1)
+		// the chord lengths are a lower bound on the length
+		eps := 1e-9 * (p1.Sub(p0).Length() + s.f0(0.5).Sub(p0).Length())
+		if eps == 0 {
+			continue
+		}
+		l += s.length(0, 1, p0, p1, eps, 0)
+	}
+	return l
+}
+
 //-----------------------------------------------------------------------------
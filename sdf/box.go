@@ -56,6 +56,52 @@ func (a Box2) Extend(b Box2) Box2 {
 	return Box2{a.Min.Min(b.Min), a.Max.Max(b.Max)}
 }
 
+// Union returns the box that encloses two boxes (the same as Extend).
+func (a Box3) Union(b Box3) Box3 {
+	return a.Extend(b)
+}
+
+// Union returns the box that encloses two boxes (the same as Extend).
+func (a Box2) Union(b Box2) Box2 {
+	return a.Extend(b)
+}
+
+// Intersect returns the box that is within both boxes.
+// The boxes may not overlap, the intersection is then Empty.
+func (a Box3) Intersect(b Box3) Box3 {
+	return Box3{a.Min.Max(b.Min), a.Max.Min(b.Max)}
+}
+
+// Intersect returns the box that is within both boxes.
+// The boxes may not overlap, the intersection is then Empty.
+func (a Box2) Intersect(b Box2) Box2 {
+	return Box2{a.Min.Max(b.Min), a.Max.Min(b.Max)}
+}
+
+// Empty returns true if the box has no points, i.e. min > max on an axis.
+// A box of zero size on an axis (e.g. boxes that touch) isn't empty.
+func (a Box3) Empty() bool {
+	return a.Min.X > a.Max.X || a.Min.Y > a.Max.Y || a.Min.Z > a.Max.Z
+}
+
+// Empty returns true if the box has no points, i.e. min > max on an axis.
+// A box of zero size on an axis (e.g. boxes that touch) isn't empty.
+func (a Box2) Empty() bool {
+	return a.Min.X > a.Max.X || a.Min.Y > a.Max.Y
+}
+
+// Expand returns the box grown by a margin on every side (shrunk if the
+// margin < 0), e.g. for the bounding box of an offset SDF.
+func (a Box3) Expand(margin float64) Box3 {
+	return Box3{a.Min.SubScalar(margin), a.Max.AddScalar(margin)}
+}
+
+// Expand returns the box grown by a margin on every side (shrunk if the
+// margin < 0), e.g. for the bounding box of an offset SDF.
+func (a Box2) Expand(margin float64) Box2 {
+	return Box2{a.Min.SubScalar(margin), a.Max.AddScalar(margin)}
+}
+
 //-----------------------------------------------------------------------------
 
 // translate a box a distance v
@@ -189,9 +235,38 @@ func (m *Map2) ToV2i(p V2) V2i {
 	return v.Div(m.delta).ToV2i()
 }
 
+// Contains returns true if a point is within the box (or on its boundary).
+func (a Box2) Contains(p V2) bool {
+	return p.X >= a.Min.X && p.X <= a.Max.X && p.Y >= a.Min.Y && p.Y <= a.Max.Y
+}
+
+// Contains returns true if a point is within the box (or on its boundary).
+func (a Box3) Contains(p V3) bool {
+	return p.X >= a.Min.X && p.X <= a.Max.X &&
+		p.Y >= a.Min.Y && p.Y <= a.Max.Y &&
+		p.Z >= a.Min.Z && p.Z <= a.Max.Z
+}
+
 //-----------------------------------------------------------------------------
 // Minimum/Maximum distances from a point to a box
 
+// minDist2 returns the minimum dist * dist from a point to a box.
+// Points within the box have minimum distance = 0.
+func (a Box2) minDist2(p V2) float64 {
+	dx := Max(Max(a.Min.X-p.X, p.X-a.Max.X), 0)
+	dy := Max(Max(a.Min.Y-p.Y, p.Y-a.Max.Y), 0)
+	return dx*dx + dy*dy
+}
+
+// minDist2 returns the minimum dist * dist from a point to a box.
+// Points within the box have minimum distance = 0.
+func (a Box3) minDist2(p V3) float64 {
+	dx := Max(Max(a.Min.X-p.X, p.X-a.Max.X), 0)
+	dy := Max(Max(a.Min.Y-p.Y, p.Y-a.Max.Y), 0)
+	dz := Max(Max(a.Min.Z-p.Z, p.Z-a.Max.Z), 0)
+	return dx*dx + dy*dy + dz*dz
+}
+
 // MinMaxDist2 returns the minimum and maximum dist * dist from a point to a box.
 // Points within the box have minimum distance = 0.
 func (a Box2) MinMaxDist2(p V2) V2 {
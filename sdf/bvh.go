@@ -0,0 +1,278 @@
+//-----------------------------------------------------------------------------
+/*
+
+Bounding Volume Hierarchy
+
+A binary tree of bounding boxes over a set of SDF3s (or SDF2s). A distance
+query only descends into boxes that could hold a closer surface than the
+best found so far, so evaluating the union of many small scattered objects
+is O(log n) rather than O(n).
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"math"
+	"sort"
+)
+
+//-----------------------------------------------------------------------------
+
+// maximum number of objects in a leaf node
+const bvhLeafSize = 4
+
+type bvhNode struct {
+	bb          Box3
+	left, right *bvhNode
+	sdf         []SDF3 // objects in a leaf node
+}
+
+// newBVH builds a bounding volume hierarchy over a set of SDF3s.
+func newBVH(sdf []SDF3) *bvhNode {
+	n := bvhNode{}
+	n.bb = sdf[0].BoundingBox()
+	for _, x := range sdf[1:] {
+		n.bb = n.bb.Extend(x.BoundingBox())
+	}
+	if len(sdf) <= bvhLeafSize {
+		n.sdf = sdf
+		return &n
+	}
+	// split at the median center on the longest axis
+	size := n.bb.Size()
+	axis := func(v V3) float64 { return v.X }
+	if size.Y > size.X && size.Y >= size.Z {
+		axis = func(v V3) float64 { return v.Y }
+	} else if size.Z > size.X && size.Z > size.Y {
+		axis = func(v V3) float64 { return v.Z }
+	}
+	x := make([]SDF3, len(sdf))
+	copy(x, sdf)
+	sort.Slice(x, func(i, j int) bool {
+		return axis(x[i].BoundingBox().Center()) < axis(x[j].BoundingBox().Center())
+	})
+	mid := len(x) / 2
+	n.left = newBVH(x[:mid])
+	n.right = newBVH(x[mid:])
+	return &n
+}
+
+// evaluate returns the minimum of d and the distances to the objects below this node.
+func (n *bvhNode) evaluate(p V3, d float64) float64 {
+	if n.sdf != nil {
+		for _, x := range n.sdf {
+			if v := x.Evaluate(p); v < d {
+				d = v
+			}
+		}
+		return d
+	}
+	// visit the nearest child first
+	a, b := n.left, n.right
+	da := a.bb.minDist2(p)
+	db := b.bb.minDist2(p)
+	if db < da {
+		a, b = b, a
+		da, db = db, da
+	}
+	// The surfaces of objects in a box can't be closer than the box.
+	// The best distance might be negative, so a point inside a box must
+	// always be tested.
+	if da == 0 || math.Sqrt(da) < d {
+		d = a.evaluate(p, d)
+	}
+	if db == 0 || math.Sqrt(db) < d {
+		d = b.evaluate(p, d)
+	}
+	return d
+}
+
+// nearest is evaluate that also returns the object the minimum distance is
+// for (near if none of the objects below this node are closer than d).
+func (n *bvhNode) nearest(p V3, d float64, near SDF3) (float64, SDF3) {
+	if n.sdf != nil {
+		for _, x := range n.sdf {
+			if v := x.Evaluate(p); v < d {
+				d = v
+				near = x
+			}
+		}
+		return d, near
+	}
+	a, b := n.left, n.right
+	da := a.bb.minDist2(p)
+	db := b.bb.minDist2(p)
+	if db < da {
+		a, b = b, a
+		da, db = db, da
+	}
+	if da == 0 || math.Sqrt(da) < d {
+		d, near = a.nearest(p, d, near)
+	}
+	if db == 0 || math.Sqrt(db) < d {
+		d, near = b.nearest(p, d, near)
+	}
+	return d, near
+}
+
+// isRigid3 returns true if a transform preserves distances (it's a rotation,
+// reflection and translation).
+func isRigid3(m M44) bool {
+	a := V3{m.x00, m.x10, m.x20}
+	b := V3{m.x01, m.x11, m.x21}
+	c := V3{m.x02, m.x12, m.x22}
+	for _, x := range []float64{a.Dot(a) - 1, b.Dot(b) - 1, c.Dot(c) - 1, a.Dot(b), a.Dot(c), b.Dot(c)} {
+		if Abs(x) > TOLERANCE {
+			return false
+		}
+	}
+	return true
+}
+
+// boundedSDF3 returns true if the distance to an SDF3 is never less than the
+// distance to its bounding box, so a bvh can skip it without changing the
+// minimum. This is true for exact SDFs, but in general an SDF3 only has to
+// be no more than the distance to the surface.
+func boundedSDF3(s SDF3) bool {
+	switch t := s.(type) {
+	case *SphereSDF3, *BoxSDF3, *RoundedBoxVertSDF3, *CylinderSDF3:
+		return true
+	case *TransformSDF3:
+		return isRigid3(t.matrix) && boundedSDF3(t.sdf)
+	case *ScaleUniformSDF3:
+		return boundedSDF3(t.sdf)
+	case *OffsetSDF3:
+		// a negative offset can shrink the box by more than the distance
+		return t.offset >= 0 && boundedSDF3(t.sdf)
+	case *UnionSDF3:
+		if !isFunc(t.min, Min) {
+			return false
+		}
+		for _, x := range t.sdf {
+			if !boundedSDF3(x) {
+				return false
+			}
+		}
+		return true
+	case *UnionManySDF3:
+		return len(t.rest) == 0
+	case *DifferenceSDF3:
+		// the distance is at least that for s0, the box is that of s0
+		return isFunc(t.max, Max) && boundedSDF3(t.s0)
+	}
+	return false
+}
+
+//-----------------------------------------------------------------------------
+
+// bvh2Node is the SDF2 version of bvhNode.
+type bvh2Node struct {
+	bb          Box2
+	left, right *bvh2Node
+	sdf         []SDF2 // objects in a leaf node
+}
+
+// newBVH2 builds a bounding volume hierarchy over a set of SDF2s.
+func newBVH2(sdf []SDF2) *bvh2Node {
+	n := bvh2Node{}
+	n.bb = sdf[0].BoundingBox()
+	for _, x := range sdf[1:] {
+		n.bb = n.bb.Extend(x.BoundingBox())
+	}
+	if len(sdf) <= bvhLeafSize {
+		n.sdf = sdf
+		return &n
+	}
+	// split at the median center on the longest axis
+	size := n.bb.Size()
+	axis := func(v V2) float64 { return v.X }
+	if size.Y > size.X {
+		axis = func(v V2) float64 { return v.Y }
+	}
+	x := make([]SDF2, len(sdf))
+	copy(x, sdf)
+	sort.Slice(x, func(i, j int) bool {
+		return axis(x[i].BoundingBox().Center()) < axis(x[j].BoundingBox().Center())
+	})
+	mid := len(x) / 2
+	n.left = newBVH2(x[:mid])
+	n.right = newBVH2(x[mid:])
+	return &n
+}
+
+// evaluate returns the minimum of d and the distances to the objects below this node.
+func (n *bvh2Node) evaluate(p V2, d float64) float64 {
+	if n.sdf != nil {
+		for _, x := range n.sdf {
+			if v := x.Evaluate(p); v < d {
+				d = v
+			}
+		}
+		return d
+	}
+	// visit the nearest child first
+	a, b := n.left, n.right
+	da := a.bb.minDist2(p)
+	db := b.bb.minDist2(p)
+	if db < da {
+		a, b = b, a
+		da, db = db, da
+	}
+	if da == 0 || math.Sqrt(da) < d {
+		d = a.evaluate(p, d)
+	}
+	if db == 0 || math.Sqrt(db) < d {
+		d = b.evaluate(p, d)
+	}
+	return d
+}
+
+//-----------------------------------------------------------------------------
+
+// isRigid2 returns true if a transform preserves distances.
+func isRigid2(m M33) bool {
+	a := V2{m.x00, m.x10}
+	b := V2{m.x01, m.x11}
+	for _, x := range []float64{a.Dot(a) - 1, b.Dot(b) - 1, a.Dot(b)} {
+		if Abs(x) > TOLERANCE {
+			return false
+		}
+	}
+	return true
+}
+
+// boundedSDF2 is the SDF2 version of boundedSDF3.
+func boundedSDF2(s SDF2) bool {
+	switch t := s.(type) {
+	case *CircleSDF2, *BoxSDF2, *PolyFillSDF2:
+		return true
+	case *PolySDF2:
+		// with preserved clockwise winding the outside is solid
+		return !t.invert
+	case *TransformSDF2:
+		return isRigid2(t.m_inv) && boundedSDF2(t.sdf)
+	case *ScaleUniformSDF2:
+		return boundedSDF2(t.sdf)
+	case *OffsetSDF2:
+		return t.offset >= 0 && boundedSDF2(t.sdf)
+	case *UnionSDF2:
+		if !isFunc(t.min, Min) {
+			return false
+		}
+		for _, x := range t.sdf {
+			if !boundedSDF2(x) {
+				return false
+			}
+		}
+		return true
+	case *UnionManySDF2:
+		return len(t.rest) == 0
+	case *DifferenceSDF2:
+		return isFunc(t.max, Max) && boundedSDF2(t.s0)
+	}
+	return false
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,163 @@
+//-----------------------------------------------------------------------------
+/*
+
+Color Tags
+
+An SDF3 can be tagged with a color for previews and documentation. Unlike
+the material tags the colors don't split the mesh, each surface point is
+colored by the nearest tagged part of the model. The preview renderer and
+the PLY writer use the colors.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+)
+
+//-----------------------------------------------------------------------------
+
+// ColorSDF3 tags an SDF3 with a color.
+type ColorSDF3 struct {
+	sdf SDF3
+	rgb [3]uint8
+	bb  Box3
+}
+
+// Color3D tags an SDF3 with an RGB color.
+func Color3D(sdf SDF3, rgb [3]uint8) SDF3 {
+	if sdf == nil {
+		return nil
+	}
+	s := ColorSDF3{}
+	s.sdf = sdf
+	s.rgb = rgb
+	s.bb = sdf.BoundingBox()
+	return &s
+}
+
+// Return the minimum distance to the object.
+func (s *ColorSDF3) Evaluate(p V3) float64 {
+	return s.sdf.Evaluate(p)
+}
+
+// Return the bounding box.
+func (s *ColorSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+
+// colorRegion is a color tagged region in the coordinates of the root SDF3.
+type colorRegion struct {
+	rgb [3]uint8
+	s   SDF3
+}
+
+// colorRegions returns the color tagged regions within an SDF3.
+// See taggedRegions for how the tags are found through the SDF3 tree.
+func colorRegions(s SDF3) []colorRegion {
+	var regions []colorRegion
+	for _, r := range taggedRegions(s, isColor) {
+		regions = append(regions, colorRegion{r.tag.(*ColorSDF3).rgb, r.s})
+	}
+	return regions
+}
+
+// isColor returns true if an SDF3 is a color tag.
+func isColor(s SDF3) bool {
+	_, ok := s.(*ColorSDF3)
+	return ok
+}
+
+// colorAt returns the color of the region nearest to p (smallest absolute
+// distance), with ties going to the region found first in the SDF3 tree.
+// This is the same rule as SplitMaterials, so untagged parts of a model
+// take the color of the nearest tagged part. There must be > 0 regions.
+func colorAt(regions []colorRegion, p V3) [3]uint8 {
+	rgb := regions[0].rgb
+	dmin := Abs(regions[0].s.Evaluate(p))
+	for _, r := range regions[1:] {
+		if d := Abs(r.s.Evaluate(p)); d < dmin {
+			dmin = d
+			rgb = r.rgb
+		}
+	}
+	return rgb
+}
+
+//-----------------------------------------------------------------------------
+// PLY Save
+
+// writePLY writes an indexed mesh (with optional vertex colors) as ASCII PLY.
+// The numbers are written with decimals decimal places (see ftoa).
+func writePLY(w io.Writer, m *meshIndex, colors [][3]uint8, decimals int) error {
+	buf := bufio.NewWriter(w)
+	fmt.Fprintf(buf, "ply\nformat ascii 1.0\n")
+	fmt.Fprintf(buf, "element vertex %d\n", len(m.v))
+	fmt.Fprintf(buf, "property float x\nproperty float y\nproperty float z\n")
+	if colors != nil {
+		fmt.Fprintf(buf, "property uchar red\nproperty uchar green\nproperty uchar blue\n")
+	}
+	fmt.Fprintf(buf, "element face %d\n", len(m.f))
+	fmt.Fprintf(buf, "property list uchar int vertex_indices\nend_header\n")
+	for i, v := range m.v {
+		if colors != nil {
+			c := colors[i]
+			fmt.Fprintf(buf, "%s %s %s %d %d %d\n", ftoa(v.X, decimals), ftoa(v.Y, decimals), ftoa(v.Z, decimals), c[0], c[1], c[2])
+		} else {
+			fmt.Fprintf(buf, "%s %s %s\n", ftoa(v.X, decimals), ftoa(v.Y, decimals), ftoa(v.Z, decimals))
+		}
+	}
+	for _, f := range m.f {
+		fmt.Fprintf(buf, "3 %d %d %d\n", f[0], f[1], f[2])
+	}
+	return buf.Flush()
+}
+
+// SavePLY writes a triangle mesh to a PLY file.
+// If s (the SDF3 the mesh was rendered from) has color tags the vertex
+// colors are written, see Color3D.
+func SavePLY(path string, mesh []*Triangle3, s SDF3) error {
+	return savePLY(path, mesh, s, 0)
+}
+
+// savePLY writes a triangle mesh to a PLY file with the given decimal places.
+func savePLY(path string, mesh []*Triangle3, s SDF3, decimals int) error {
+	m := newMeshIndex(mesh)
+	var colors [][3]uint8
+	if s != nil {
+		if regions := colorRegions(s); len(regions) > 0 {
+			colors = make([][3]uint8, len(m.v))
+			for i, v := range m.v {
+				colors[i] = colorAt(regions, v)
+			}
+		}
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return writePLY(f, m, colors, decimals)
+}
+
+// RenderPLY renders an SDF3 as a PLY file with vertex colors (octree sampling).
+func RenderPLY(
+	s SDF3, //sdf3 to render
+	mesh_cells int, //number of cells on the longest axis. e.g 200
+	path string, //path to filename
+) {
+	fmt.Printf("rendering %s (%d cells)\n", path, mesh_cells)
+	m := RenderMesh(s, mesh_cells)
+	if err := SavePLY(path, m.Triangles, s); err != nil {
+		fmt.Printf("%s", err)
+	}
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,175 @@
+//-----------------------------------------------------------------------------
+/*
+
+Display Fonts
+
+Dot matrix and seven segment text that doesn't need a font file.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "strings"
+
+//-----------------------------------------------------------------------------
+// Dot Matrix Text
+
+// dotFont is a 5x7 dot matrix font, top row first.
+var dotFont = map[rune][7]string{
+	' ': {"00000", "00000", "00000", "00000", "00000", "00000", "00000"},
+	'-': {"00000", "00000", "00000", "11111", "00000", "00000", "00000"},
+	'.': {"00000", "00000", "00000", "00000", "00000", "01100", "01100"},
+	':': {"00000", "01100", "01100", "00000", "01100", "01100", "00000"},
+	'0': {"01110", "10001", "10011", "10101", "11001", "10001", "01110"},
+	'1': {"00100", "01100", "00100", "00100", "00100", "00100", "01110"},
+	'2': {"01110", "10001", "00001", "00010", "00100", "01000", "11111"},
+	'3': {"11111", "00010", "00100", "00010", "00001", "10001", "01110"},
+	'4': {"00010", "00110", "01010", "10010", "11111", "00010", "00010"},
+	'5': {"11111", "10000", "11110", "00001", "00001", "10001", "01110"},
+	'6': {"00110", "01000", "10000", "11110", "10001", "10001", "01110"},
+	'7': {"11111", "00001", "00010", "00100", "01000", "01000", "01000"},
+	'8': {"01110", "10001", "10001", "01110", "10001", "10001", "01110"},
+	'9': {"01110", "10001", "10001", "01111", "00001", "00010", "01100"},
+	'A': {"01110", "10001", "10001", "10001", "11111", "10001", "10001"},
+	'B': {"11110", "10001", "10001", "11110", "10001", "10001", "11110"},
+	'C': {"01110", "10001", "10000", "10000", "10000", "10001", "01110"},
+	'D': {"11100", "10010", "10001", "10001", "10001", "10010", "11100"},
+	'E': {"11111", "10000", "10000", "11110", "10000", "10000", "11111"},
+	'F': {"11111", "10000", "10000", "11110", "10000", "10000", "10000"},
+	'G': {"01110", "10001", "10000", "10111", "10001", "10001", "01111"},
+	'H': {"10001", "10001", "10001", "11111", "10001", "10001", "10001"},
+	'I': {"01110", "00100", "00100", "00100", "00100", "00100", "01110"},
+	'J': {"00111", "00010", "00010", "00010", "00010", "10010", "01100"},
+	'K': {"10001", "10010", "10100", "11000", "10100", "10010", "10001"},
+	'L': {"10000", "10000", "10000", "10000", "10000", "10000", "11111"},
+	'M': {"10001", "11011", "10101", "10101", "10001", "10001", "10001"},
+	'N': {"10001", "10001", "11001", "10101", "10011", "10001", "10001"},
+	'O': {"01110", "10001", "10001", "10001", "10001", "10001", "01110"},
+	'P': {"11110", "10001", "10001", "11110", "10000", "10000", "10000"},
+	'Q': {"01110", "10001", "10001", "10001", "10101", "10010", "01101"},
+	'R': {"11110", "10001", "10001", "11110", "10100", "10010", "10001"},
+	'S': {"01111", "10000", "10000", "01110", "00001", "00001", "11110"},
+	'T': {"11111", "00100", "00100", "00100", "00100", "00100", "00100"},
+	'U': {"10001", "10001", "10001", "10001", "10001", "10001", "01110"},
+	'V': {"10001", "10001", "10001", "10001", "10001", "01010", "00100"},
+	'W': {"10001", "10001", "10001", "10101", "10101", "10101", "01010"},
+	'X': {"10001", "10001", "01010", "00100", "01010", "10001", "10001"},
+	'Y': {"10001", "10001", "10001", "01010", "00100", "00100", "00100"},
+	'Z': {"11111", "00001", "00010", "00100", "01000", "10000", "11111"},
+}
+
+// DotMatrixText returns the SDF2 for text on a dot matrix display.
+// Each character is a rows x cols grid of dots (the built-in 5x7 font is
+// resampled to the grid size) with one empty column between characters.
+// Lower case letters are shown as upper case. Lines are separated by "\n".
+// The dot pitch is 1.25 * dotDia and the bottom left dot of the first line
+// is at the origin. Returns nil if no dots are lit.
+func DotMatrixText(s string, rows, cols int, dotDia float64) SDF2 {
+	if rows <= 0 || cols <= 0 {
+		panic("rows, cols must be > 0")
+	}
+	if dotDia <= 0 {
+		panic("dotDia <= 0")
+	}
+	pitch := 1.25 * dotDia
+	var dots V2Set
+	for l, line := range strings.Split(strings.ToUpper(s), "\n") {
+		y0 := -float64(l*(rows+1)) * pitch
+		for i, r := range []rune(line) {
+			glyph, ok := dotFont[r]
+			if !ok {
+				panic("no dot matrix glyph for character")
+			}
+			x0 := float64(i*(cols+1)) * pitch
+			for row := 0; row < rows; row++ {
+				for col := 0; col < cols; col++ {
+					if glyph[row*7/rows][col*5/cols] == '1' {
+						dots = append(dots, V2{x0 + float64(col)*pitch, y0 + float64(rows-1-row)*pitch})
+					}
+				}
+			}
+		}
+	}
+	if len(dots) == 0 {
+		return nil
+	}
+	return MultiCircle2D(0.5*dotDia, dots)
+}
+
+//-----------------------------------------------------------------------------
+// Seven Segment Display
+
+// segmentMap gives the lit segments for each character.
+//
+//	 aaa
+//	f   b
+//	 ggg
+//	e   c
+//	 ddd
+var segmentMap = map[rune]string{
+	' ': "",
+	'-': "g",
+	'0': "abcdef",
+	'1': "bc",
+	'2': "abdeg",
+	'3': "abcdg",
+	'4': "bcfg",
+	'5': "acdfg",
+	'6': "acdefg",
+	'7': "abc",
+	'8': "abcdefg",
+	'9': "abcdfg",
+	'A': "abcefg",
+	'B': "cdefg",
+	'C': "adef",
+	'D': "bcdeg",
+	'E': "adefg",
+	'F': "aefg",
+	'H': "bcefg",
+	'L': "def",
+	'P': "abefg",
+	'U': "bcdef",
+}
+
+// segment positions for a digit from (0,0) to (1,2)
+var segmentPosition = map[byte]struct {
+	p        V2
+	vertical bool
+}{
+	'a': {V2{0.5, 2}, false},
+	'b': {V2{1, 1.5}, true},
+	'c': {V2{1, 0.5}, true},
+	'd': {V2{0.5, 0}, false},
+	'e': {V2{0, 0.5}, true},
+	'f': {V2{0, 1.5}, true},
+	'g': {V2{0.5, 1}, false},
+}
+
+// SevenSegment returns the SDF2 for text on a seven segment display.
+// Each digit is 1 wide and 2 high with 0.2 wide segments, and the digits are
+// 1.5 apart starting at the origin. Supported characters are the digits,
+// the hex letters, H, L, P, U, '-' and ' '. Returns nil if no segments are lit.
+func SevenSegment(digits string) SDF2 {
+	bar := Line2D(0.8, 0.1)
+	vbar := Transform2D(bar, Rotate2d(DtoR(90)))
+	var ss []SDF2
+	for i, r := range []rune(strings.ToUpper(digits)) {
+		segments, ok := segmentMap[r]
+		if !ok {
+			panic("no seven segment glyph for character")
+		}
+		x0 := 1.5 * float64(i)
+		for j := 0; j < len(segments); j++ {
+			k := segmentPosition[segments[j]]
+			s := bar
+			if k.vertical {
+				s = vbar
+			}
+			ss = append(ss, Transform2D(s, Translate2d(k.p.Add(V2{x0, 0}))))
+		}
+	}
+	return Union2D(ss...)
+}
+
+//-----------------------------------------------------------------------------
@@ -57,6 +57,19 @@ func (d *DXF) Points(s V2Set, r float64) {
 	}
 }
 
+// Circle adds a circle as a closed polygon with n segments.
+// If n < 3 the circle is added as a DXF circle entity.
+func (d *DXF) Circle(c V2, r float64, n int) {
+	if n < 3 {
+		d.drawing.ChangeLayer("Lines")
+		d.drawing.Circle(c.X, c.Y, 0, r)
+		return
+	}
+	v := Nagon(n, r)
+	v.MulVertices(Translate2d(c))
+	d.Lines(append(v, v[0]))
+}
+
 func (d *DXF) Triangle(t Triangle2) {
 	d.Lines([]V2{t[0], t[1], t[2], t[0]})
 }
@@ -0,0 +1,184 @@
+//-----------------------------------------------------------------------------
+/*
+
+SDF Fingerprints
+
+A fingerprint is a hash of the operator tree of a model and the parameters
+of each node, e.g. to key a cache of rendered meshes. Models built the same
+way have the same fingerprint, a change to any parameter changes it.
+
+The tree is walked by reflection, so every SDF type is covered without any
+code of its own. Function values (e.g. the blend function of a union) can
+only be identified by name, so models with closures (e.g. smooth blends,
+twist extrusions, user defined functions) can't be fingerprinted. Note
+that Bezier curves are sampled with random points (see SetSeed), so text and
+other curved models only fingerprint the same when built from the same seed.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+//-----------------------------------------------------------------------------
+
+// FingerprintSDF3 returns a stable hash (hex string) of an SDF3 model.
+// It returns an error if the model has a part that can't be fingerprinted.
+func FingerprintSDF3(s SDF3) (string, error) {
+	return fingerprint(s)
+}
+
+// FingerprintSDF2 returns a stable hash (hex string) of an SDF2 model.
+// It returns an error if the model has a part that can't be fingerprinted.
+func FingerprintSDF2(s SDF2) (string, error) {
+	return fingerprint(s)
+}
+
+//-----------------------------------------------------------------------------
+
+// types that don't contribute to the shape (locks, caches, counters)
+var fp_skip = map[reflect.Type]bool{
+	reflect.TypeOf(sync.Mutex{}):   true,
+	reflect.TypeOf(sync.RWMutex{}): true,
+	reflect.TypeOf(sync.Pool{}):    true,
+	reflect.TypeOf(&SDF2Cache{}):   true,
+	reflect.TypeOf(new(int64)):     true, // see Counted3D
+}
+
+// closures and method values are named like pkg.F.func1 and pkg.T.M-fm
+var fp_closure = regexp.MustCompile(`\.func\d+|-fm$`)
+
+type fp_key struct {
+	p uintptr
+	t reflect.Type
+}
+
+type fingerprinter struct {
+	memo map[fp_key]string // hashes of the values behind pointers
+}
+
+// fingerprint returns the hash of a value.
+func fingerprint(x interface{}) (string, error) {
+	f := fingerprinter{make(map[fp_key]string)}
+	return f.hash(reflect.ValueOf(x))
+}
+
+// hash returns the hash of a value.
+func (f *fingerprinter) hash(v reflect.Value) (string, error) {
+	var buf bytes.Buffer
+	if err := f.write(&buf, v); err != nil {
+		return "", err
+	}
+	h := sha256.Sum256(buf.Bytes())
+	return hex.EncodeToString(h[:]), nil
+}
+
+// write writes the serialized value to the buffer.
+func (f *fingerprinter) write(buf *bytes.Buffer, v reflect.Value) error {
+	if fp_skip[v.Type()] {
+		buf.WriteString("_")
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		fmt.Fprintf(buf, "b%t", v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		fmt.Fprintf(buf, "i%d", v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		fmt.Fprintf(buf, "u%d", v.Uint())
+	case reflect.Float32, reflect.Float64:
+		fmt.Fprintf(buf, "f%x", math.Float64bits(v.Float()))
+	case reflect.String:
+		fmt.Fprintf(buf, "s%q", v.String())
+	case reflect.Array, reflect.Slice:
+		fmt.Fprintf(buf, "[%d", v.Len())
+		for i := 0; i < v.Len(); i++ {
+			buf.WriteString(" ")
+			if err := f.write(buf, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		buf.WriteString("]")
+	case reflect.Map:
+		// in key order
+		items := make([]string, 0, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			var item bytes.Buffer
+			if err := f.write(&item, iter.Key()); err != nil {
+				return err
+			}
+			item.WriteString(":")
+			if err := f.write(&item, iter.Value()); err != nil {
+				return err
+			}
+			items = append(items, item.String())
+		}
+		sort.Strings(items)
+		fmt.Fprintf(buf, "{%d", len(items))
+		for _, item := range items {
+			buf.WriteString(" ")
+			buf.WriteString(item)
+		}
+		buf.WriteString("}")
+	case reflect.Struct:
+		fmt.Fprintf(buf, "%s{", v.Type().String())
+		for i := 0; i < v.NumField(); i++ {
+			fmt.Fprintf(buf, " %s=", v.Type().Field(i).Name)
+			if err := f.write(buf, v.Field(i)); err != nil {
+				return err
+			}
+		}
+		buf.WriteString("}")
+	case reflect.Ptr:
+		if v.IsNil() {
+			buf.WriteString("nil")
+			return nil
+		}
+		// shared values are hashed once
+		k := fp_key{v.Pointer(), v.Type()}
+		h, ok := f.memo[k]
+		if !ok {
+			var err error
+			if h, err = f.hash(v.Elem()); err != nil {
+				return err
+			}
+			f.memo[k] = h
+		}
+		fmt.Fprintf(buf, "*%s", h)
+	case reflect.Interface:
+		if v.IsNil() {
+			buf.WriteString("nil")
+			return nil
+		}
+		fmt.Fprintf(buf, "(%s)", v.Elem().Type().String())
+		return f.write(buf, v.Elem())
+	case reflect.Func:
+		if v.IsNil() {
+			buf.WriteString("nil")
+			return nil
+		}
+		name := runtime.FuncForPC(v.Pointer()).Name()
+		if fp_closure.MatchString(name) {
+			return fmt.Errorf("can't fingerprint the closure %s", name)
+		}
+		fmt.Fprintf(buf, "func %s", name)
+	default:
+		return fmt.Errorf("can't fingerprint a %s", v.Type())
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
@@ -198,3 +198,20 @@ func (s *GearRackSDF2) BoundingBox() Box2 {
 }
 
 //-----------------------------------------------------------------------------
+
+// Rack2D returns the 2D profile for a gear rack that meshes with an
+// InvoluteGear of the same module and pressure angle. The rack has as many
+// whole teeth as fit in length, and a base 2 * module high.
+func Rack2D(
+	gear_module float64, // pitch circle diameter / number of gear teeth
+	length float64, // maximum length of the rack
+	pressure_angle float64, // gear pressure angle (radians)
+) SDF2 {
+	number_teeth := math.Floor(length / (gear_module * PI))
+	if number_teeth < 1 {
+		panic("rack length < tooth pitch")
+	}
+	return GearRack2D(number_teeth, gear_module, pressure_angle, 0, 2*gear_module)
+}
+
+//-----------------------------------------------------------------------------
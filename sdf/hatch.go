@@ -0,0 +1,95 @@
+//-----------------------------------------------------------------------------
+/*
+
+Hatching
+
+Generate parallel fill lines within an SDF2, e.g. for pen plotter and
+engraving toolpaths.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "math"
+
+//-----------------------------------------------------------------------------
+
+// hatchLine returns the inside intervals of an SDF2 along a line from p0 to p1.
+// The line is sphere traced, so features thinner than tol may be missed.
+func hatchLine(s SDF2, p0, p1 V2, tol float64) [][]V2 {
+	var segments [][]V2
+	l := p1.Sub(p0).Length()
+	u := p1.Sub(p0).DivScalar(l)
+	at := func(t float64) V2 { return p0.Add(u.MulScalar(t)) }
+	// bisect for the crossing between t0 and t1
+	crossing := func(t0, t1 float64, inside bool) float64 {
+		for t1-t0 > tol {
+			t := 0.5 * (t0 + t1)
+			if (s.Evaluate(at(t)) < 0) == inside {
+				t0 = t
+			} else {
+				t1 = t
+			}
+		}
+		return 0.5 * (t0 + t1)
+	}
+	t := 0.0
+	d := s.Evaluate(p0)
+	inside := d < 0
+	start := 0.0
+	for t < l {
+		tn := math.Min(t+math.Max(Abs(d), tol), l)
+		dn := s.Evaluate(at(tn))
+		if (dn < 0) != inside {
+			tc := crossing(t, tn, inside)
+			if inside {
+				segments = append(segments, []V2{at(start), at(tc)})
+			} else {
+				start = tc
+			}
+			inside = !inside
+		}
+		t, d = tn, dn
+	}
+	if inside {
+		segments = append(segments, []V2{at(start), p1})
+	}
+	return segments
+}
+
+// Hatch2D returns the hatch lines filling an SDF2.
+// The lines are at angle (radians) to the x-axis and spacing apart, centered
+// within the bounding box. Each line is clipped to the inside of the SDF2,
+// so a line crossing a concave region gives several segments. Segments are
+// returned as pairs of points, ordered by line and then along the line.
+func Hatch2D(s SDF2, angle, spacing float64) [][]V2 {
+	if spacing <= 0 {
+		panic("spacing <= 0")
+	}
+	// line direction and normal
+	u := V2{math.Cos(angle), math.Sin(angle)}
+	v := V2{-u.Y, u.X}
+	// extent of the bounding box along the line and normal
+	umin, umax := math.MaxFloat64, -math.MaxFloat64
+	vmin, vmax := math.MaxFloat64, -math.MaxFloat64
+	for _, p := range s.BoundingBox().Vertices() {
+		umin = Min(umin, p.Dot(u))
+		umax = Max(umax, p.Dot(u))
+		vmin = Min(vmin, p.Dot(v))
+		vmax = Max(vmax, p.Dot(v))
+	}
+	n := int(math.Max(1, math.Ceil((vmax-vmin)/spacing)))
+	v0 := vmin + 0.5*((vmax-vmin)-float64(n-1)*spacing)
+	tol := spacing * 1e-3
+	var segments [][]V2
+	for i := 0; i < n; i++ {
+		o := v.MulScalar(v0 + float64(i)*spacing)
+		p0 := o.Add(u.MulScalar(umin))
+		p1 := o.Add(u.MulScalar(umax))
+		segments = append(segments, hatchLine(s, p0, p1, tol)...)
+	}
+	return segments
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,101 @@
+//-----------------------------------------------------------------------------
+/*
+
+Knurl Textures
+
+A knurl texture is a pattern of V grooves wrapped around the z-axis and
+cut into the surface of an SDF3. The grooves are a displacement of the
+distance field, so the result is only a bound on the distance.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "math"
+
+//-----------------------------------------------------------------------------
+
+// KnurlPattern is the groove pattern of a knurl texture.
+type KnurlPattern int
+
+const (
+	KNURL_STRAIGHT KnurlPattern = iota // grooves parallel to the z-axis
+	KNURL_HELICAL                      // 45 degree right hand helical grooves
+	KNURL_DIAMOND                      // left and right hand helical grooves
+)
+
+// KnurlTextureSDF3 is an SDF3 with a knurl texture.
+type KnurlTextureSDF3 struct {
+	sdf     SDF3
+	pitch   float64      // groove to groove distance at the outer radius
+	depth   float64      // groove depth
+	pattern KnurlPattern // groove pattern
+	n       float64      // number of grooves around the circumference
+	k       float64      // lipschitz correction
+	bb      Box3
+}
+
+// KnurlTexture3D cuts a knurl texture into the surface of an SDF3.
+// The texture is wrapped around the z-axis and is intended for solids of
+// revolution. The number of grooves is set so the pitch is correct at the
+// outer radius of the bounding box, at smaller radii the grooves are closer.
+//
+// The displaced distance is scaled so it stays a bound at the outer radius.
+// The grooves are sharp V shapes, so the mesh cell size needs to be well
+// under pitch/4 to resolve them.
+func KnurlTexture3D(sdf SDF3, pitch, depth float64, pattern KnurlPattern) SDF3 {
+	if pitch <= 0 {
+		panic("pitch <= 0")
+	}
+	if depth <= 0 {
+		panic("depth <= 0")
+	}
+	s := KnurlTextureSDF3{}
+	s.sdf = sdf
+	s.pitch = pitch
+	s.depth = depth
+	s.pattern = pattern
+	s.bb = sdf.BoundingBox()
+	// outer radius
+	r := Max(s.bb.Max.X, s.bb.Max.Y)
+	r = Max(r, Max(-s.bb.Min.X, -s.bb.Min.Y))
+	s.n = math.Max(1, math.Round(TAU*r/pitch))
+	// slope of the groove displacement
+	slope := 2 * depth / pitch
+	if pattern != KNURL_STRAIGHT {
+		slope *= math.Sqrt2
+	}
+	s.k = math.Sqrt(1 + slope*slope)
+	return &s
+}
+
+// groove returns the groove depth for a groove coordinate.
+func (s *KnurlTextureSDF3) groove(u float64) float64 {
+	// 0 at the ridges, depth at the groove center
+	return s.depth * (1 - 2*Abs(u-math.Round(u)))
+}
+
+// Return the minimum distance to the knurled surface.
+func (s *KnurlTextureSDF3) Evaluate(p V3) float64 {
+	// groove coordinates, 1 per groove
+	a := math.Atan2(p.Y, p.X) * s.n / TAU
+	z := p.Z / s.pitch
+	var g float64
+	switch s.pattern {
+	case KNURL_STRAIGHT:
+		g = s.groove(a)
+	case KNURL_HELICAL:
+		g = s.groove(a + z)
+	case KNURL_DIAMOND:
+		g = Max(s.groove(a+z), s.groove(a-z))
+	}
+	return (s.sdf.Evaluate(p) + g) / s.k
+}
+
+// Return the bounding box.
+func (s *KnurlTextureSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,169 @@
+//-----------------------------------------------------------------------------
+/*
+
+Polygon Loft
+
+Build the mesh for a ruled surface between two polygon profiles.
+The profiles are resampled to the same number of vertices and walls are
+built between corresponding vertices. Unlike Loft3D (which blends the
+distance fields of the profiles) the side walls are exact.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+//-----------------------------------------------------------------------------
+
+// Return true if p is within (or on the edges of) the triangle a-b-c.
+// The triangle is counter-clockwise.
+func in_triangle(p, a, b, c V2) bool {
+	cross := func(o, a, b V2) float64 {
+		return (a.X-o.X)*(b.Y-o.Y) - (a.Y-o.Y)*(b.X-o.X)
+	}
+	return cross(a, b, p) >= 0 && cross(b, c, p) >= 0 && cross(c, a, p) >= 0
+}
+
+// Return the vertices in reverse order, keeping the first vertex.
+func reverse_vertices(v []V2) []V2 {
+	r := make([]V2, len(v))
+	for i := range v {
+		r[i] = v[(len(v)-i)%len(v)]
+	}
+	return r
+}
+
+// Triangulate a simple counter-clockwise polygon by ear clipping.
+// Return the triangles as (counter-clockwise) vertex indices.
+func triangulate_polygon(v []V2) [][3]int {
+	idx := make([]int, len(v))
+	for i := range idx {
+		idx[i] = i
+	}
+	var t [][3]int
+	for len(idx) > 3 {
+		n := len(idx)
+		ear := -1
+		cmax := 0.0
+		imax := 0
+		for i := 0; i < n && ear < 0; i++ {
+			a := v[idx[(i+n-1)%n]]
+			b := v[idx[i]]
+			c := v[idx[(i+1)%n]]
+			k := (b.X-a.X)*(c.Y-a.Y) - (b.Y-a.Y)*(c.X-a.X)
+			if k > cmax {
+				cmax = k
+				imax = i
+			}
+			if k <= 0 {
+				// reflex or collinear
+				continue
+			}
+			// no other vertex can be within the ear
+			ear = i
+			for j := 0; j < n; j++ {
+				if j == (i+n-1)%n || j == i || j == (i+1)%n {
+					// a vertex of the ear
+					continue
+				}
+				if in_triangle(v[idx[j]], a, b, c) {
+					ear = -1
+					break
+				}
+			}
+		}
+		if ear < 0 {
+			// numerical trouble, clip the most convex vertex
+			ear = imax
+		}
+		t = append(t, [3]int{idx[(ear+n-1)%n], idx[ear], idx[(ear+1)%n]})
+		idx = append(idx[:ear], idx[ear+1:]...)
+	}
+	t = append(t, [3]int{idx[0], idx[1], idx[2]})
+	return t
+}
+
+//-----------------------------------------------------------------------------
+
+// PolygonLoft3D returns the mesh of a ruled surface between a bottom
+// profile (at z = 0) and a top profile (at z = height), with both ends
+// capped. The profiles are closed simple polygons. Profiles with the same
+// number of vertices are used as is, otherwise they are resampled to the same
+// number of vertices at equal arc-length intervals (see Resample2D). The top
+// profile is rotated to best match the bottom profile and each bottom vertex
+// is joined to a top vertex by a straight line. The mesh is watertight.
+func PolygonLoft3D(bottom, top []V2, height float64) *Mesh {
+	if len(bottom) < 3 || len(top) < 3 {
+		panic("len(profile) < 3")
+	}
+	if height <= 0 {
+		panic("height <= 0")
+	}
+	b := bottom
+	t := top
+	n := len(b)
+	if len(t) != n {
+		// resample the profiles to the same number of vertices,
+		// oversampled so the vertices of the profiles are (nearly) kept
+		if len(t) > n {
+			n = len(t)
+		}
+		n *= 4
+		b = Resample2D(b, n, true)
+		t = Resample2D(t, n, true)
+	}
+	// make the profiles counter-clockwise
+	if PolygonArea2D(b) < 0 {
+		b = reverse_vertices(b)
+	}
+	if PolygonArea2D(t) < 0 {
+		t = reverse_vertices(t)
+	}
+	// rotate the top vertices to minimise the length of the walls
+	shift := 0
+	dmin := -1.0
+	for k := 0; k < n; k++ {
+		d := 0.0
+		for i := range b {
+			d += b[i].Sub(t[(i+k)%n]).Length2()
+		}
+		if dmin < 0 || d < dmin {
+			dmin = d
+			shift = k
+		}
+	}
+	r := make([]V2, n)
+	for i := range r {
+		r[i] = t[(i+shift)%n]
+	}
+	t = r
+	// 3D vertices
+	b3 := make([]V3, n)
+	t3 := make([]V3, n)
+	for i := range b {
+		b3[i] = V3{b[i].X, b[i].Y, 0}
+		t3[i] = V3{t[i].X, t[i].Y, height}
+	}
+	var m []*Triangle3
+	// side walls, split each quad on the shorter diagonal
+	for i := 0; i < n; i++ {
+		j := (i + 1) % n
+		if b3[i].Sub(t3[j]).Length2() <= b3[j].Sub(t3[i]).Length2() {
+			m = append(m, NewTriangle3(b3[i], b3[j], t3[j]))
+			m = append(m, NewTriangle3(b3[i], t3[j], t3[i]))
+		} else {
+			m = append(m, NewTriangle3(b3[i], b3[j], t3[i]))
+			m = append(m, NewTriangle3(b3[j], t3[j], t3[i]))
+		}
+	}
+	// end caps
+	for _, f := range triangulate_polygon(b) {
+		m = append(m, NewTriangle3(b3[f[0]], b3[f[2]], b3[f[1]]))
+	}
+	for _, f := range triangulate_polygon(t) {
+		m = append(m, NewTriangle3(t3[f[0]], t3[f[1]], t3[f[2]]))
+	}
+	return NewMesh(m)
+}
+
+//-----------------------------------------------------------------------------
@@ -133,7 +133,11 @@ func ms_ToLines(p [4]V2, v [4]float64, x float64) []*Line2_PP {
 			points[i] = ms_Interpolate(p[a], p[b], v[a], v[b], x)
 		}
 	}
-	// create the line segments
+	return ms_Lines(index, points)
+}
+
+// generate the line segments for a square pattern given the edge points
+func ms_Lines(index int, points [4]V2) []*Line2_PP {
 	table := ms_line_table[index]
 	count := len(table) / 2
 	result := make([]*Line2_PP, count)
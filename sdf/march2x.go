@@ -6,6 +6,11 @@ Marching Squares Quadtree
 Convert an SDF2 boundary to a set of line segments.
 Uses quadtree space subdivision.
 
+The adaptive version stops subdividing where the boundary is straight. The
+edge points of a large square are found at the smallest square size, so
+they match the points of smaller neighbouring squares and the lines join
+up across changes in square size (no T-junction cracks).
+
 */
 //-----------------------------------------------------------------------------
 
@@ -33,6 +38,7 @@ type dcache2 struct {
 	s          SDF2            // the SDF2 to be rendered
 	cache      map[V2i]float64 // cache of distances
 	lock       sync.RWMutex    // lock the the cache during reads/writes
+	tol        float64         // straightness tolerance for adaptive squares, 0 = never adapt
 }
 
 func newDcache2(s SDF2, origin V2, resolution float64, n uint) *dcache2 {
@@ -105,6 +111,11 @@ func (dc *dcache2) processSquare(c *square, output chan<- *Line2_PP) {
 			for _, l := range ms_ToLines(corners, values, 0) {
 				output <- l
 			}
+		} else if lines, ok := dc.straightLines(c); ok {
+			// the boundary is straight, no need to subdivide
+			for _, l := range lines {
+				output <- l
+			}
 		} else {
 			// process the sub squares
 			n := c.n - 1
@@ -118,6 +129,103 @@ func (dc *dcache2) processSquare(c *square, output chan<- *Line2_PP) {
 	}
 }
 
+// crossing walks the smallest square vertices along the edge a-b (a grid
+// line) and returns the boundary point on the edge and the number of
+// boundary crossings.
+func (dc *dcache2) crossing(a, b V2i) (V2, int) {
+	dx, dy := b[0]-a[0], b[1]-a[1]
+	// number of smallest square sides along the edge (one of dx, dy is 0)
+	n := (dx + dy) / 2
+	if n < 0 {
+		n = -n
+	}
+	step := V2i{dx / n, dy / n}
+	var p V2
+	count := 0
+	p0, d0 := dc.evaluate(a)
+	for i := 0; i < n; i++ {
+		a = a.Add(step)
+		p1, d1 := dc.evaluate(a)
+		if (d0 < 0) != (d1 < 0) {
+			p = ms_Interpolate(p0, p1, d0, d1, 0)
+			count++
+		}
+		p0, d0 = p1, d1
+	}
+	return p, count
+}
+
+// straightLines returns the line for a square the boundary crosses in a
+// straight line (within the tolerance), or false if the square needs to be
+// subdivided. The distance field must look like the distance to the line at
+// the corners and the center of the square, so a square with other parts of
+// the boundary inside it is subdivided.
+func (dc *dcache2) straightLines(c *square) ([]*Line2_PP, bool) {
+	if dc.tol <= 0 {
+		return nil, false
+	}
+	s := 1 << c.n
+	vi := [4]V2i{c.v, c.v.Add(V2i{s, 0}), c.v.Add(V2i{s, s}), c.v.Add(V2i{0, s})}
+	var p [4]V2
+	var d [4]float64
+	index := 0
+	for i := range vi {
+		p[i], d[i] = dc.evaluate(vi[i])
+		if d[i] < 0 {
+			index |= 1 << uint(i)
+		}
+	}
+	// one crossing on each of two edges
+	var points [4]V2
+	var ends []V2
+	for i := 0; i < 4; i++ {
+		a := ms_pair_table[i][0]
+		b := ms_pair_table[i][1]
+		q, n := dc.crossing(vi[a], vi[b])
+		if n > 1 {
+			return nil, false
+		}
+		if n == 1 {
+			points[i] = q
+			ends = append(ends, q)
+		}
+	}
+	if len(ends) != 2 || ends[0] == ends[1] {
+		return nil, false
+	}
+	// the line must match the distance field
+	n := ends[1].Sub(ends[0]).Normalize()
+	n = V2{n.Y, -n.X}
+	k := 1.0
+	i := 0
+	for j := range d {
+		if Abs(d[j]) > Abs(d[i]) {
+			i = j
+		}
+	}
+	if n.Dot(p[i].Sub(ends[0]))*d[i] < 0 {
+		// the normal points inwards
+		k = -1
+	}
+	check := func(q V2, dq float64) bool {
+		return Abs(k*n.Dot(q.Sub(ends[0]))-dq) <= dc.tol
+	}
+	for j := range p {
+		if !check(p[j], d[j]) {
+			return nil, false
+		}
+	}
+	pc, dcenter := dc.evaluate(c.v.AddScalar(s / 2))
+	if !check(pc, dcenter) {
+		return nil, false
+	}
+	mid := ends[0].Add(ends[1]).MulScalar(0.5)
+	if Abs(dc.s.Evaluate(mid)) > dc.tol {
+		return nil, false
+	}
+	return ms_Lines(index, points), true
+}
+
 //-----------------------------------------------------------------------------
 
 // marchingSquaresQuadtree generates line segments for an SDF2 using quadtree subdivision.
@@ -139,3 +247,37 @@ func marchingSquaresQuadtree(s SDF2, resolution float64, output chan<- *Line2_PP
 }
 
 //-----------------------------------------------------------------------------
+
+// MarchingSquaresAdaptive returns the line segments for the boundary of an
+// SDF2 using adaptive quadtree subdivision. Squares far from the boundary are
+// skipped and squares the boundary crosses in a (nearly) straight line are
+// not subdivided, so only the curved parts of the boundary are sampled at the
+// full resolution. The lines deviate from the lines of a uniform grid by up
+// to 0.1 * resolution. The SDF2 should be a distance field (or close to one)
+// for squares to be kept large, other SDF2s are sampled at the full
+// resolution near the boundary.
+func MarchingSquaresAdaptive(s SDF2, resolution float64) []*Line2_PP {
+	bb := s.BoundingBox()
+	bb = bb.ScaleAboutCenter(1.01)
+	longAxis := bb.Size().MaxComponent()
+	tol := 0.1 * resolution
+	resolution = 0.5 * resolution
+	levels := uint(math.Ceil(math.Log2(longAxis/resolution))) + 1
+	dc := newDcache2(s, bb.Min, resolution, levels)
+	dc.tol = tol
+	output := make(chan *Line2_PP)
+	var lines []*Line2_PP
+	done := make(chan bool)
+	go func() {
+		for l := range output {
+			lines = append(lines, l)
+		}
+		done <- true
+	}()
+	dc.processSquare(&square{V2i{0, 0}, levels - 1}, output)
+	close(output)
+	<-done
+	return lines
+}
+
+//-----------------------------------------------------------------------------
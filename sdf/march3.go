@@ -35,13 +35,16 @@ func NewLayerYZ(base, inc V3, steps V3i) *LayerYZ {
 
 // evalReq is used for processing evaluations in parallel.
 //
-// A slice of V3 is run through `fn`; the result of which
-// is stored in the corresponding index of the `out` slice.
+// A slice of V3 is run through `fn` (or `batch` for a BatchSDF3); the result
+// of which is stored in the corresponding index of the `out` slice.
+// The results don't depend on the order in which the workers run,
+// so the generated mesh is the same for every run.
 type evalReq struct {
-	out []float64
-	p   []V3
-	fn  func(V3) float64
-	wg  *sync.WaitGroup
+	out   []float64
+	p     []V3
+	fn    func(V3) float64
+	batch func([]V3) []float64
+	wg    *sync.WaitGroup
 }
 
 var evalProcessCh = make(chan evalReq, 100)
@@ -52,8 +55,12 @@ func init() {
 			var i int
 			var p V3
 			for r := range evalProcessCh {
-				for i, p = range r.p {
-					r.out[i] = r.fn(p)
+				if r.batch != nil {
+					copy(r.out, r.batch(r.p))
+				} else {
+					for i, p = range r.p {
+						r.out[i] = r.fn(p)
+					}
 				}
 				r.wg.Done()
 			}
@@ -86,6 +93,9 @@ func (l *LayerYZ) Evaluate(sdf SDF3, x int) {
 		fn:  sdf.Evaluate,
 		out: l.val1,
 	}
+	if b, ok := sdf.(BatchSDF3); ok {
+		eReq.batch = b.EvaluateBatch
+	}
 
 	// evaluate the layer
 	p.Y = l.base.Y
@@ -130,12 +140,19 @@ func (l *LayerYZ) Get(x, y, z int) float64 {
 
 //-----------------------------------------------------------------------------
 
-func MarchingCubes(sdf SDF3, box Box3, step float64) []*Triangle3 {
+// Cell3 is a marching cubes cell with the SDF3 evaluated at its corners.
+// The corners are in the order used by the marching cubes tables.
+type Cell3 struct {
+	Index  V3i        // grid index of the cell
+	Corner [8]V3      // corner positions
+	Value  [8]float64 // distance values at the corners
+}
 
-	var triangles []*Triangle3
+// gridCells3 calls visit for each cell of a grid over a box.
+// The cell is reused between calls.
+func gridCells3(sdf SDF3, box Box3, steps V3i, visit func(c *Cell3)) {
 	size := box.Size()
 	base := box.Min
-	steps := size.DivScalar(step).Ceil().ToV3i()
 	inc := size.Div(steps.ToV3())
 
 	// create the SDF layer cache
@@ -146,6 +163,7 @@ func MarchingCubes(sdf SDF3, box Box3, step float64) []*Triangle3 {
 	nx, ny, nz := steps[0], steps[1], steps[2]
 	dx, dy, dz := inc.X, inc.Y, inc.Z
 
+	var c Cell3
 	var p V3
 	p.X = base.X
 	for x := 0; x < nx; x++ {
@@ -158,7 +176,8 @@ func MarchingCubes(sdf SDF3, box Box3, step float64) []*Triangle3 {
 			for z := 0; z < nz; z++ {
 				x0, y0, z0 := p.X, p.Y, p.Z
 				x1, y1, z1 := x0+dx, y0+dy, z0+dz
-				corners := [8]V3{
+				c.Index = V3i{x, y, z}
+				c.Corner = [8]V3{
 					{x0, y0, z0},
 					{x1, y0, z0},
 					{x1, y1, z0},
@@ -167,7 +186,7 @@ func MarchingCubes(sdf SDF3, box Box3, step float64) []*Triangle3 {
 					{x1, y0, z1},
 					{x1, y1, z1},
 					{x0, y1, z1}}
-				values := [8]float64{
+				c.Value = [8]float64{
 					l.Get(0, y, z),
 					l.Get(1, y, z),
 					l.Get(1, y+1, z),
@@ -176,20 +195,126 @@ func MarchingCubes(sdf SDF3, box Box3, step float64) []*Triangle3 {
 					l.Get(1, y, z+1),
 					l.Get(1, y+1, z+1),
 					l.Get(0, y+1, z+1)}
-				triangles = append(triangles, mc_ToTriangles(corners, values, 0)...)
+				visit(&c)
 				p.Z += dz
 			}
 			p.Y += dy
 		}
 		p.X += dx
 	}
+}
 
+// RenderGrid3 evaluates an SDF3 on a grid of resolution[0] x resolution[1] x resolution[2]
+// cells covering its bounding box, and calls visit for each cell.
+// This is the sampling used by the marching cubes mesher, exposed for custom
+// per-cell processing (e.g. voxelization). The cell passed to visit is reused
+// and must be copied if it's retained.
+func RenderGrid3(s SDF3, resolution V3i, visit func(c *Cell3)) {
+	// make sure the boundaries aren't on the object surface
+	bb := s.BoundingBox().ScaleAboutCenter(1.01)
+	gridCells3(s, bb, resolution, visit)
+}
+
+// ForEachTriangle runs marching cubes over the same grid as RenderGrid3 and
+// calls fn for each triangle of the mesh as it's generated. The mesh isn't
+// kept, so the memory used doesn't depend on the size of the mesh, e.g. for
+// streaming exports or analysis (area, overhangs) of huge meshes.
+func ForEachTriangle(s SDF3, resolution V3i, fn func(a, b, c V3)) {
+	RenderGrid3(s, resolution, func(c *Cell3) {
+		for _, t := range mc_ToTriangles(c.Corner, c.Value, 0, mc_Interpolate) {
+			fn(t.V[0], t.V[1], t.V[2])
+		}
+	})
+}
+
+func MarchingCubes(sdf SDF3, box Box3, step float64) []*Triangle3 {
+	var triangles []*Triangle3
+	marchingCubesGrid(sdf, box, step, func(t *Triangle3) {
+		triangles = append(triangles, t)
+	})
 	return triangles
 }
 
+// marchingCubesGrid calls emit for each triangle of the mesh in grid order.
+// The grid is processed an x layer at a time, only two layers of distances
+// are kept, so the memory used doesn't depend on the size of the mesh.
+func marchingCubesGrid(sdf SDF3, box Box3, step float64, emit func(t *Triangle3)) {
+	steps := box.Size().DivScalar(step).Ceil().ToV3i()
+	gridCells3(sdf, box, steps, func(c *Cell3) {
+		for _, t := range mc_ToTriangles(c.Corner, c.Value, 0, mc_Interpolate) {
+			emit(t)
+		}
+	})
+}
+
+// marchingCubesTiled calls emit for each triangle of the mesh, tile by tile.
+// The grid is split into tiles[0] x tiles[1] x tiles[2] tiles, only the
+// distances for one tile are kept. The grid positions are worked out from
+// the global grid indices, so the samples on the shared faces of adjacent
+// tiles are the same and the mesh is watertight across the seams.
+func marchingCubesTiled(sdf SDF3, box Box3, step float64, tiles V3i, emit func(t *Triangle3)) {
+	steps := box.Size().DivScalar(step).Ceil().ToV3i()
+	pos := func(x, y, z int) V3 {
+		return box.Min.Add(V3{float64(x), float64(y), float64(z)}.MulScalar(step))
+	}
+	for tx := 0; tx < tiles[0]; tx++ {
+		for ty := 0; ty < tiles[1]; ty++ {
+			for tz := 0; tz < tiles[2]; tz++ {
+				// the cells of this tile
+				lo := V3i{steps[0] * tx / tiles[0], steps[1] * ty / tiles[1], steps[2] * tz / tiles[2]}
+				hi := V3i{steps[0] * (tx + 1) / tiles[0], steps[1] * (ty + 1) / tiles[1], steps[2] * (tz + 1) / tiles[2]}
+				nx, ny, nz := hi[0]-lo[0], hi[1]-lo[1], hi[2]-lo[2]
+				// evaluate the SDF at the cell corners
+				idx := func(x, y, z int) int {
+					return (x*(ny+1)+y)*(nz+1) + z
+				}
+				values := make([]float64, (nx+1)*(ny+1)*(nz+1))
+				for x := 0; x <= nx; x++ {
+					for y := 0; y <= ny; y++ {
+						for z := 0; z <= nz; z++ {
+							values[idx(x, y, z)] = sdf.Evaluate(pos(lo[0]+x, lo[1]+y, lo[2]+z))
+						}
+					}
+				}
+				// process the cells
+				for x := 0; x < nx; x++ {
+					for y := 0; y < ny; y++ {
+						for z := 0; z < nz; z++ {
+							x0, y0, z0 := lo[0]+x, lo[1]+y, lo[2]+z
+							corners := [8]V3{
+								pos(x0, y0, z0),
+								pos(x0+1, y0, z0),
+								pos(x0+1, y0+1, z0),
+								pos(x0, y0+1, z0),
+								pos(x0, y0, z0+1),
+								pos(x0+1, y0, z0+1),
+								pos(x0+1, y0+1, z0+1),
+								pos(x0, y0+1, z0+1)}
+							v := [8]float64{
+								values[idx(x, y, z)],
+								values[idx(x+1, y, z)],
+								values[idx(x+1, y+1, z)],
+								values[idx(x, y+1, z)],
+								values[idx(x, y, z+1)],
+								values[idx(x+1, y, z+1)],
+								values[idx(x+1, y+1, z+1)],
+								values[idx(x, y+1, z+1)]}
+							for _, t := range mc_ToTriangles(corners, v, 0, mc_Interpolate) {
+								emit(t)
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
 //-----------------------------------------------------------------------------
 
-func mc_ToTriangles(p [8]V3, v [8]float64, x float64) []*Triangle3 {
+// mc_ToTriangles returns the triangles for a cube with corners p and corner
+// distances v. The vertices on the cube edges are placed by interp.
+func mc_ToTriangles(p [8]V3, v [8]float64, x float64, interp mc_InterpFunc) []*Triangle3 {
 	// which of the 0..255 patterns do we have?
 	index := 0
 	for i := 0; i < 8; i++ {
@@ -208,7 +333,7 @@ func mc_ToTriangles(p [8]V3, v [8]float64, x float64) []*Triangle3 {
 		if mc_edge_table[index]&bit != 0 {
 			a := mc_pair_table[i][0]
 			b := mc_pair_table[i][1]
-			points[i] = mc_Interpolate(p[a], p[b], v[a], v[b], x)
+			points[i] = interp(p[a], p[b], v[a], v[b], x)
 		}
 	}
 	// create the triangles
@@ -227,7 +352,24 @@ func mc_ToTriangles(p [8]V3, v [8]float64, x float64) []*Triangle3 {
 
 //-----------------------------------------------------------------------------
 
+// mc_InterpFunc returns the point on the edge p1-p2 where the distance is x,
+// given the distances v1 and v2 at the ends of the edge.
+type mc_InterpFunc func(p1, p2 V3, v1, v2, x float64) V3
+
+// mc_Canonical orders the ends of an edge.
+// An edge is shared by up to 4 cubes, each of which may see it in a
+// different direction. Interpolate from a canonical end so the point is
+// bit-identical for all of them and the mesh can be welded exactly.
+func mc_Canonical(p1, p2 V3, v1, v2 float64) (V3, V3, float64, float64) {
+	if p2.X < p1.X || (p2.X == p1.X && (p2.Y < p1.Y || (p2.Y == p1.Y && p2.Z < p1.Z))) {
+		return p2, p1, v2, v1
+	}
+	return p1, p2, v1, v2
+}
+
+// mc_Interpolate places the point by linear interpolation of the distances.
 func mc_Interpolate(p1, p2 V3, v1, v2, x float64) V3 {
+	p1, p2, v1, v2 = mc_Canonical(p1, p2, v1, v2)
 	if Abs(x-v1) < EPS {
 		return p1
 	}
@@ -245,6 +387,36 @@ func mc_Interpolate(p1, p2 V3, v1, v2, x float64) V3 {
 	}
 }
 
+// mc_Newton returns an interpolation function that starts from the linear
+// interpolation and takes n Newton steps along the edge with the distances
+// of s, so the point is (nearly) on the surface. The derivative along the
+// edge is a central difference, each step is 3 evaluations of s. The point
+// is kept on the edge.
+func mc_Newton(s SDF3, n int) mc_InterpFunc {
+	if n <= 0 {
+		return mc_Interpolate
+	}
+	const h = 1e-3 // difference step as a fraction of the edge length
+	return func(p1, p2 V3, v1, v2, x float64) V3 {
+		p1, p2, v1, v2 = mc_Canonical(p1, p2, v1, v2)
+		if Abs(x-v1) < EPS || Abs(x-v2) < EPS || Abs(v1-v2) < EPS {
+			return mc_Interpolate(p1, p2, v1, v2, x)
+		}
+		d := p2.Sub(p1)
+		t := (x - v1) / (v2 - v1)
+		for i := 0; i < n; i++ {
+			p := p1.Add(d.MulScalar(t))
+			f := s.Evaluate(p) - x
+			df := (s.Evaluate(p.Add(d.MulScalar(h))) - s.Evaluate(p.Sub(d.MulScalar(h)))) / (2 * h)
+			if Abs(df) < EPS {
+				break
+			}
+			t = Clamp(t-f/df, 0, 1)
+		}
+		return p1.Add(d.MulScalar(t))
+	}
+}
+
 //-----------------------------------------------------------------------------
 
 // These are the vertex pairs for the edges
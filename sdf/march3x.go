@@ -33,11 +33,14 @@ type dcache3 struct {
 	resolution float64         // size of smallest octree cube
 	hdiag      []float64       // lookup table of cube half diagonals
 	s          SDF3            // the SDF3 to be rendered
+	iso        float64         // iso level of the rendered surface
+	interp     mc_InterpFunc   // places the vertices on the cube edges
 	cache      map[V3i]float64 // cache of distances
 	lock       sync.RWMutex    // lock the the cache during reads/writes
+	empty      int             // number of empty cubes
 }
 
-func newDcache3(s SDF3, origin V3, resolution float64, n uint) *dcache3 {
+func newDcache3(s SDF3, origin V3, resolution, iso float64, newton int, n uint) *dcache3 {
 	// TODO heuristic for initial cache size. Maybe k * (1 << n)^3
 	// Avoiding any resizing of the map seems to be worth 2-5% of speedup.
 	dc := dcache3{
@@ -45,6 +48,8 @@ func newDcache3(s SDF3, origin V3, resolution float64, n uint) *dcache3 {
 		resolution: resolution,
 		hdiag:      make([]float64, n),
 		s:          s,
+		iso:        iso,
+		interp:     mc_Newton(s, newton),
 		cache:      make(map[V3i]float64),
 	}
 	// build a lut for cube half diagonal lengths
@@ -91,7 +96,11 @@ func (dc *dcache3) isEmpty(c *cube) bool {
 	s := 1 << (c.n - 1) // half side
 	_, d := dc.evaluate(c.v.AddScalar(s))
 	// compare to the center/corner distance
-	return Abs(d) >= dc.hdiag[c.n]
+	if Abs(d-dc.iso) >= dc.hdiag[c.n] {
+		dc.empty++
+		return true
+	}
+	return false
 }
 
 // Process a cube. Generate triangles, or more cubes.
@@ -110,7 +119,7 @@ func (dc *dcache3) processCube(c *cube, output chan<- *Triangle3) {
 			corners := [8]V3{c0, c1, c2, c3, c4, c5, c6, c7}
 			values := [8]float64{d0, d1, d2, d3, d4, d5, d6, d7}
 			// output the triangle(s) for this cube
-			for _, t := range mc_ToTriangles(corners, values, 0) {
+			for _, t := range mc_ToTriangles(corners, values, dc.iso, dc.interp) {
 				output <- t
 			}
 		} else {
@@ -132,12 +141,14 @@ func (dc *dcache3) processCube(c *cube, output chan<- *Triangle3) {
 
 //-----------------------------------------------------------------------------
 
-// marchingCubesOctree generates a triangle mesh for an SDF3 using octree subdivision.
-func marchingCubesOctree(s SDF3, resolution float64, output chan<- *Triangle3) {
-	// Scale the bounding box about the center to make sure the boundaries
-	// aren't on the object surface.
-	bb := s.BoundingBox()
-	bb = bb.ScaleAboutCenter(1.01)
+// marchingCubesOctree generates a triangle mesh for the iso surface of
+// an SDF3 within the box bb using octree subdivision.
+// The grid origin is bb.Min, the bounding box shouldn't have boundaries on
+// the object surface. The vertices are placed with newton Newton steps along
+// the cube edges (0 is linear interpolation, see mc_Newton). Return the number
+// of SDF3 evaluations and empty cubes. The evaluations for the Newton steps
+// aren't counted.
+func marchingCubesOctree(s SDF3, bb Box3, resolution, iso float64, newton int, output chan<- *Triangle3) (int, int) {
 	longAxis := bb.Size().MaxComponent()
 	// We want to test the smallest cube (side == resolution) for emptiness
 	// so the level = 0 cube is at half resolution.
@@ -145,9 +156,10 @@ func marchingCubesOctree(s SDF3, resolution float64, output chan<- *Triangle3) {
 	// how many cube levels for the octree?
 	levels := uint(math.Ceil(math.Log2(longAxis/resolution))) + 1
 	// create the distance cache
-	dc := newDcache3(s, bb.Min, resolution, levels)
+	dc := newDcache3(s, bb.Min, resolution, iso, newton, levels)
 	// process the octree, start at the top level
 	dc.processCube(&cube{V3i{0, 0, 0}, levels - 1}, output)
+	return len(dc.cache), dc.empty
 }
 
 //-----------------------------------------------------------------------------
@@ -0,0 +1,336 @@
+//-----------------------------------------------------------------------------
+/*
+
+Material Regions
+
+An SDF3 can be tagged with a material id. When the model is rendered each
+triangle of the mesh is assigned the material of the nearest tagged
+region, so a multi-material model can be written as one object per
+material.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "sort"
+
+//-----------------------------------------------------------------------------
+
+// MaterialSDF3 tags an SDF3 with a material id.
+type MaterialSDF3 struct {
+	sdf SDF3
+	id  int
+	bb  Box3
+}
+
+// Material3D tags an SDF3 with a material id, the id should be > 0.
+// Untagged parts of a model get the material of the nearest tagged region
+// (see SplitMaterials), material 0 is only used for a model with no tags.
+func Material3D(sdf SDF3, id int) SDF3 {
+	if sdf == nil {
+		return nil
+	}
+	if id <= 0 {
+		panic("material id <= 0")
+	}
+	s := MaterialSDF3{}
+	s.sdf = sdf
+	s.id = id
+	s.bb = sdf.BoundingBox()
+	return &s
+}
+
+// Return the minimum distance to the object.
+func (s *MaterialSDF3) Evaluate(p V3) float64 {
+	return s.sdf.Evaluate(p)
+}
+
+// Return the bounding box.
+func (s *MaterialSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+
+// materialRegion is a tagged region in the coordinates of the root SDF3.
+type materialRegion struct {
+	id int
+	s  SDF3
+}
+
+// materialRegions returns the material tagged regions within an SDF3.
+func materialRegions(s SDF3) []materialRegion {
+	var regions []materialRegion
+	for _, r := range taggedRegions(s, isMaterial) {
+		regions = append(regions, materialRegion{r.tag.(*MaterialSDF3).id, r.s})
+	}
+	return regions
+}
+
+// isMaterial returns true if an SDF3 is a material tag.
+func isMaterial(s SDF3) bool {
+	_, ok := s.(*MaterialSDF3)
+	return ok
+}
+
+//-----------------------------------------------------------------------------
+
+// taggedRegion is a tagged SDF3 in the coordinates of the root SDF3.
+type taggedRegion struct {
+	tag SDF3 // the tagged SDF3
+	s   SDF3 // the tagged SDF3 as seen from the root
+}
+
+// taggedRegions returns the regions within an SDF3 that are tagged, i.e.
+// the SDF3s for which tagged returns true (see Material3D and Color3D).
+// Regions below single child SDF3s (transforms, offsets, warps, see
+// wrapper3) are wrapped in copies of them so they can be evaluated in the
+// coordinates of s. Tags within tagged regions, and within subtracted
+// SDF3s, are ignored. Tags of other kinds are passed through, so material
+// and color tags can be mixed.
+func taggedRegions(s SDF3, tagged func(SDF3) bool) []taggedRegion {
+	var regions []taggedRegion
+	if tagged(s) {
+		return append(regions, taggedRegion{s, s})
+	}
+	// wrap the regions of a child SDF3 with a copy of the parent
+	wrap := func(child SDF3, parent func(SDF3) SDF3) {
+		for _, r := range taggedRegions(child, tagged) {
+			regions = append(regions, taggedRegion{r.tag, parent(r.s)})
+		}
+	}
+	switch t := s.(type) {
+	case *UnionSDF3:
+		for _, x := range t.sdf {
+			regions = append(regions, taggedRegions(x, tagged)...)
+		}
+	case *UnionManySDF3:
+		for _, x := range t.sdf {
+			regions = append(regions, taggedRegions(x, tagged)...)
+		}
+	case *DifferenceSDF3:
+		regions = append(regions, taggedRegions(t.s0, tagged)...)
+	case *IntersectionSDF3:
+		regions = append(regions, taggedRegions(t.s0, tagged)...)
+		regions = append(regions, taggedRegions(t.s1, tagged)...)
+	case *XorSDF3:
+		regions = append(regions, taggedRegions(t.s0, tagged)...)
+		regions = append(regions, taggedRegions(t.s1, tagged)...)
+	case wrapper3:
+		wrap(t.unwrap(), t.rewrap)
+	}
+	return regions
+}
+
+//-----------------------------------------------------------------------------
+
+// wrapper3 is an SDF3 with one SDF3 child, see taggedRegions. rewrap
+// returns a copy of the SDF3 with another child, or the child itself for
+// SDF3s that don't change the distance (e.g. tags).
+type wrapper3 interface {
+	unwrap() SDF3
+	rewrap(x SDF3) SDF3
+}
+
+func (s *MaterialSDF3) unwrap() SDF3 {
+	return s.sdf
+}
+
+func (s *MaterialSDF3) rewrap(x SDF3) SDF3 {
+	return x
+}
+
+func (s *ColorSDF3) unwrap() SDF3 {
+	return s.sdf
+}
+
+func (s *ColorSDF3) rewrap(x SDF3) SDF3 {
+	return x
+}
+
+func (s *CountedSDF3) unwrap() SDF3 {
+	return s.sdf
+}
+
+func (s *CountedSDF3) rewrap(x SDF3) SDF3 {
+	return x
+}
+
+func (s *TransformSDF3) unwrap() SDF3 {
+	return s.sdf
+}
+
+func (s *TransformSDF3) rewrap(x SDF3) SDF3 {
+	c := *s
+	c.sdf = x
+	return &c
+}
+
+func (s *ScaleUniformSDF3) unwrap() SDF3 {
+	return s.sdf
+}
+
+func (s *ScaleUniformSDF3) rewrap(x SDF3) SDF3 {
+	c := *s
+	c.sdf = x
+	return &c
+}
+
+func (s *AffineWarpSDF3) unwrap() SDF3 {
+	return s.sdf
+}
+
+func (s *AffineWarpSDF3) rewrap(x SDF3) SDF3 {
+	c := *s
+	c.sdf = x
+	return &c
+}
+
+func (s *ScaleDistanceSDF3) unwrap() SDF3 {
+	return s.sdf
+}
+
+func (s *ScaleDistanceSDF3) rewrap(x SDF3) SDF3 {
+	c := *s
+	c.sdf = x
+	return &c
+}
+
+func (s *OffsetSDF3) unwrap() SDF3 {
+	return s.sdf
+}
+
+func (s *OffsetSDF3) rewrap(x SDF3) SDF3 {
+	c := *s
+	c.sdf = x
+	return &c
+}
+
+func (s *ShellSDF3) unwrap() SDF3 {
+	return s.sdf
+}
+
+func (s *ShellSDF3) rewrap(x SDF3) SDF3 {
+	c := *s
+	c.sdf = x
+	return &c
+}
+
+func (s *CutSDF3) unwrap() SDF3 {
+	return s.sdf
+}
+
+func (s *CutSDF3) rewrap(x SDF3) SDF3 {
+	c := *s
+	c.sdf = x
+	return &c
+}
+
+func (s *ClipSDF3) unwrap() SDF3 {
+	return s.sdf
+}
+
+func (s *ClipSDF3) rewrap(x SDF3) SDF3 {
+	c := *s
+	c.sdf = x
+	return &c
+}
+
+func (s *ArraySDF3) unwrap() SDF3 {
+	return s.sdf
+}
+
+func (s *ArraySDF3) rewrap(x SDF3) SDF3 {
+	c := *s
+	c.sdf = x
+	return &c
+}
+
+func (s *RotateUnionSDF3) unwrap() SDF3 {
+	return s.sdf
+}
+
+func (s *RotateUnionSDF3) rewrap(x SDF3) SDF3 {
+	c := *s
+	c.sdf = x
+	return &c
+}
+
+func (s *RotateCopySDF3) unwrap() SDF3 {
+	return s.sdf
+}
+
+func (s *RotateCopySDF3) rewrap(x SDF3) SDF3 {
+	c := *s
+	c.sdf = x
+	return &c
+}
+
+func (s *VoronoiTextureSDF3) unwrap() SDF3 {
+	return s.sdf
+}
+
+func (s *VoronoiTextureSDF3) rewrap(x SDF3) SDF3 {
+	c := *s
+	c.sdf = x
+	return &c
+}
+
+func (s *KnurlTextureSDF3) unwrap() SDF3 {
+	return s.sdf
+}
+
+func (s *KnurlTextureSDF3) rewrap(x SDF3) SDF3 {
+	c := *s
+	c.sdf = x
+	return &c
+}
+
+//-----------------------------------------------------------------------------
+
+// MaterialMesh is the part of a mesh with a given material.
+type MaterialMesh struct {
+	Material int
+	Mesh     *Mesh
+}
+
+// SplitMaterials splits a mesh rendered from s by material.
+// Each triangle is given the material of the tagged region nearest to its
+// centroid (smallest absolute distance). Where tagged regions overlap the
+// surface within the overlap is assigned to whichever region surface is
+// closer, with ties going to the region found first in the SDF3 tree.
+// If s has no tagged regions the whole mesh has material 0.
+// The parts are returned in material id order. Note that each part is
+// an open surface that ends where the material changes.
+func SplitMaterials(s SDF3, m *Mesh) []*MaterialMesh {
+	regions := materialRegions(s)
+	if len(regions) == 0 {
+		return []*MaterialMesh{{0, m}}
+	}
+	parts := make(map[int][]*Triangle3)
+	for _, t := range m.Triangles {
+		c := t.V[0].Add(t.V[1]).Add(t.V[2]).DivScalar(3)
+		id := regions[0].id
+		dmin := Abs(regions[0].s.Evaluate(c))
+		for _, r := range regions[1:] {
+			if d := Abs(r.s.Evaluate(c)); d < dmin {
+				dmin = d
+				id = r.id
+			}
+		}
+		parts[id] = append(parts[id], t)
+	}
+	ids := make([]int, 0, len(parts))
+	for id := range parts {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	result := make([]*MaterialMesh, len(ids))
+	for i, id := range ids {
+		result[i] = &MaterialMesh{id, NewMesh(parts[id])}
+	}
+	return result
+}
+
+//-----------------------------------------------------------------------------
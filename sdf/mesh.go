@@ -0,0 +1,895 @@
+//-----------------------------------------------------------------------------
+/*
+
+Triangle Mesh Processing
+
+Rendering produces a triangle soup, each triangle with its own copy of its
+vertices. The marching cubes implementations interpolate shared edges in a
+consistent order so the copies are bit-identical, which lets the mesh be
+welded back together with exact vertex comparisons.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+)
+
+//-----------------------------------------------------------------------------
+
+// Mesh is a triangle mesh.
+type Mesh struct {
+	Triangles []*Triangle3
+}
+
+// NewMesh returns a mesh of triangles.
+func NewMesh(triangles []*Triangle3) *Mesh {
+	return &Mesh{Triangles: triangles}
+}
+
+// Vertices returns the distinct vertices of the mesh.
+func (m *Mesh) Vertices() V3Set {
+	return V3Set(newMeshIndex(m.Triangles).v)
+}
+
+// NumTriangles returns the number of triangles in the mesh.
+func (m *Mesh) NumTriangles() int {
+	return len(m.Triangles)
+}
+
+// NumVertices returns the number of distinct vertices in the mesh.
+func (m *Mesh) NumVertices() int {
+	return len(newMeshIndex(m.Triangles).v)
+}
+
+// BoundingBox returns the bounding box of the mesh (the zero box if the mesh
+// is empty).
+func (m *Mesh) BoundingBox() Box3 {
+	if len(m.Triangles) == 0 {
+		return Box3{}
+	}
+	bb := Box3{m.Triangles[0].V[0], m.Triangles[0].V[0]}
+	for _, t := range m.Triangles {
+		for _, v := range t.V {
+			bb.Min = bb.Min.Min(v)
+			bb.Max = bb.Max.Max(v)
+		}
+	}
+	return bb
+}
+
+// Transform returns a copy of the mesh transformed by a matrix. If the
+// matrix is a reflection (e.g. a mirror) the triangles are rewound, so the
+// normals still point out of the mesh.
+func (m *Mesh) Transform(a M44) *Mesh {
+	flip := a.Determinant() < 0
+	triangles := make([]*Triangle3, len(m.Triangles))
+	for i, t := range m.Triangles {
+		v0, v1, v2 := a.MulPosition(t.V[0]), a.MulPosition(t.V[1]), a.MulPosition(t.V[2])
+		if flip {
+			v1, v2 = v2, v1
+		}
+		triangles[i] = NewTriangle3(v0, v1, v2)
+	}
+	return NewMesh(triangles)
+}
+
+// Decimate returns the mesh reduced to (approximately) n triangles.
+func (m *Mesh) Decimate(n int) *Mesh {
+	return NewMesh(DecimateMesh(m.Triangles, n))
+}
+
+// Smooth returns the mesh with Taubin smoothing applied.
+func (m *Mesh) Smooth(iterations int, lambda float64) *Mesh {
+	return NewMesh(SmoothMesh(m.Triangles, iterations, lambda))
+}
+
+// IsManifold returns true if the mesh is manifold, see IsManifold.
+func (m *Mesh) IsManifold() (bool, []Edge3) {
+	return IsManifold(m.Triangles)
+}
+
+// IsWatertight returns true if the mesh is watertight, see IsWatertight.
+func (m *Mesh) IsWatertight() bool {
+	return IsWatertight(m.Triangles)
+}
+
+// SaveSTL writes the mesh to an STL file.
+func (m *Mesh) SaveSTL(path string) error {
+	return SaveSTL(path, m.Triangles)
+}
+
+// SaveSTLUnits writes the mesh with the given model units to an STL file.
+func (m *Mesh) SaveSTLUnits(path string, units STLUnits) error {
+	return SaveSTLUnits(path, m.Triangles, units)
+}
+
+// SaveSTLGradient writes the mesh to an STL file with the normals of s, see
+// SaveSTLGradient.
+func (m *Mesh) SaveSTLGradient(path string, s SDF3) error {
+	return SaveSTLGradient(path, m.Triangles, s)
+}
+
+// SaveOBJ writes the mesh to an OBJ file, see SaveOBJ.
+func (m *Mesh) SaveOBJ(path string, s SDF3) error {
+	return SaveOBJ(path, m.Triangles, s)
+}
+
+// SavePLY writes the mesh to a PLY file, see SavePLY.
+func (m *Mesh) SavePLY(path string, s SDF3) error {
+	return SavePLY(path, m.Triangles, s)
+}
+
+//-----------------------------------------------------------------------------
+
+// meshIndex is an indexed triangle mesh with shared vertices.
+type meshIndex struct {
+	v []V3     // vertices
+	f [][3]int // faces, indices into v
+}
+
+// newMeshIndex welds a triangle mesh into an indexed mesh.
+// Degenerate triangles (with repeated vertices) are dropped.
+func newMeshIndex(mesh []*Triangle3) *meshIndex {
+	m := meshIndex{}
+	index := make(map[V3]int)
+	m.f = make([][3]int, 0, len(mesh))
+	for _, t := range mesh {
+		var f [3]int
+		for i, v := range t.V {
+			j, ok := index[v]
+			if !ok {
+				j = len(m.v)
+				index[v] = j
+				m.v = append(m.v, v)
+			}
+			f[i] = j
+		}
+		if f[0] == f[1] || f[1] == f[2] || f[2] == f[0] {
+			continue
+		}
+		m.f = append(m.f, f)
+	}
+	return &m
+}
+
+// triangles returns the triangles of an indexed mesh.
+func (m *meshIndex) triangles() []*Triangle3 {
+	mesh := make([]*Triangle3, len(m.f))
+	for i, f := range m.f {
+		mesh[i] = NewTriangle3(m.v[f[0]], m.v[f[1]], m.v[f[2]])
+	}
+	return mesh
+}
+
+//-----------------------------------------------------------------------------
+// Mesh Validation
+
+// Edge3 is a 3D line segment.
+type Edge3 [2]V3
+
+// meshEdge is an undirected edge between two vertex indices (a < b).
+type meshEdge [2]int
+
+func newMeshEdge(a, b int) meshEdge {
+	if a > b {
+		return meshEdge{b, a}
+	}
+	return meshEdge{a, b}
+}
+
+// edgeCounts returns the number of times each undirected edge is used.
+// The count of each directed edge a->b where a < b is returned separately.
+func (m *meshIndex) edgeCounts() (map[meshEdge]int, map[meshEdge]int) {
+	count := make(map[meshEdge]int)
+	forward := make(map[meshEdge]int)
+	for _, f := range m.f {
+		for i := 0; i < 3; i++ {
+			a, b := f[i], f[(i+1)%3]
+			e := newMeshEdge(a, b)
+			count[e]++
+			if a < b {
+				forward[e]++
+			}
+		}
+	}
+	return count, forward
+}
+
+// IsManifold returns true if every edge of the mesh is shared by exactly
+// two triangles. Any edges that are not are returned.
+func IsManifold(mesh []*Triangle3) (bool, []Edge3) {
+	m := newMeshIndex(mesh)
+	count, _ := m.edgeCounts()
+	var bad []Edge3
+	for e, n := range count {
+		if n != 2 {
+			bad = append(bad, Edge3{m.v[e[0]], m.v[e[1]]})
+		}
+	}
+	return len(bad) == 0, bad
+}
+
+// IsWatertight returns true if the mesh is manifold and consistently
+// oriented, i.e. each edge is used once in each direction, so the mesh
+// encloses a volume.
+func IsWatertight(mesh []*Triangle3) bool {
+	m := newMeshIndex(mesh)
+	count, forward := m.edgeCounts()
+	for e, n := range count {
+		if n != 2 || forward[e] != 1 {
+			return false
+		}
+	}
+	return true
+}
+
+//-----------------------------------------------------------------------------
+// Mesh Decimation
+
+// quadric is a symmetric 4x4 error quadric (Garland & Heckbert).
+// It's stored as the upper triangle: a2 ab ac ad b2 bc bd c2 cd d2
+type quadric [10]float64
+
+// planeQuadric returns the quadric for the plane n.x + d = 0 scaled by k.
+func planeQuadric(n V3, d, k float64) quadric {
+	a, b, c := n.X, n.Y, n.Z
+	return quadric{
+		k * a * a, k * a * b, k * a * c, k * a * d,
+		k * b * b, k * b * c, k * b * d,
+		k * c * c, k * c * d,
+		k * d * d,
+	}
+}
+
+func (q quadric) add(r quadric) quadric {
+	for i := range q {
+		q[i] += r[i]
+	}
+	return q
+}
+
+// eval returns the squared distance error of a point.
+func (q quadric) eval(v V3) float64 {
+	x, y, z := v.X, v.Y, v.Z
+	return q[0]*x*x + 2*q[1]*x*y + 2*q[2]*x*z + 2*q[3]*x +
+		q[4]*y*y + 2*q[5]*y*z + 2*q[6]*y +
+		q[7]*z*z + 2*q[8]*z +
+		q[9]
+}
+
+// decimateCollapse is a candidate edge collapse.
+type decimateCollapse struct {
+	cost   float64
+	a, b   int // vertices
+	va, vb int // vertex versions when the candidate was made
+	p      V3  // position of the collapsed vertex
+}
+
+// decimateHeap is a min-heap of edge collapses.
+type decimateHeap []*decimateCollapse
+
+func (h decimateHeap) Len() int            { return len(h) }
+func (h decimateHeap) Less(i, j int) bool  { return h[i].cost < h[j].cost }
+func (h decimateHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *decimateHeap) Push(x interface{}) { *h = append(*h, x.(*decimateCollapse)) }
+func (h *decimateHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// decimator holds the mesh state during decimation.
+type decimator struct {
+	m      *meshIndex
+	q      []quadric // vertex quadrics
+	vf     [][]int   // faces using each vertex (may include dead faces)
+	ver    []int     // vertex versions, bumped when a vertex changes
+	fAlive []bool
+	nFaces int
+	h      decimateHeap
+}
+
+func newDecimator(m *meshIndex) *decimator {
+	d := decimator{m: m}
+	d.q = make([]quadric, len(m.v))
+	d.vf = make([][]int, len(m.v))
+	d.ver = make([]int, len(m.v))
+	d.fAlive = make([]bool, len(m.f))
+	d.nFaces = len(m.f)
+	for i, f := range m.f {
+		d.fAlive[i] = true
+		for _, j := range f {
+			d.vf[j] = append(d.vf[j], i)
+		}
+		t := Triangle3{[3]V3{m.v[f[0]], m.v[f[1]], m.v[f[2]]}}
+		e := t.V[1].Sub(t.V[0]).Cross(t.V[2].Sub(t.V[0]))
+		area := 0.5 * e.Length()
+		if area == 0 {
+			// no plane, but the face is remapped by collapses
+			continue
+		}
+		n := e.Normalize()
+		q := planeQuadric(n, -n.Dot(t.V[0]), area)
+		for _, j := range f {
+			d.q[j] = d.q[j].add(q)
+		}
+	}
+	return &d
+}
+
+// faces returns the live faces using a vertex.
+func (d *decimator) faces(a int) []int {
+	live := d.vf[a][:0]
+	for _, i := range d.vf[a] {
+		if d.fAlive[i] {
+			live = append(live, i)
+		}
+	}
+	d.vf[a] = live
+	return live
+}
+
+// neighbours returns the vertices adjacent to a vertex.
+func (d *decimator) neighbours(a int) map[int]bool {
+	n := make(map[int]bool)
+	for _, i := range d.faces(a) {
+		for _, j := range d.m.f[i] {
+			if j != a {
+				n[j] = true
+			}
+		}
+	}
+	return n
+}
+
+// push adds the best collapse of edge a-b to the heap.
+func (d *decimator) push(a, b int) {
+	q := d.q[a].add(d.q[b])
+	pa := d.m.v[a]
+	pb := d.m.v[b]
+	c := &decimateCollapse{a: a, b: b, va: d.ver[a], vb: d.ver[b]}
+	c.cost = q.eval(pa)
+	c.p = pa
+	if x := q.eval(pb); x < c.cost {
+		c.cost = x
+		c.p = pb
+	}
+	pm := pa.Add(pb).MulScalar(0.5)
+	if x := q.eval(pm); x < c.cost {
+		c.cost = x
+		c.p = pm
+	}
+	heap.Push(&d.h, c)
+}
+
+// collapse merges vertex b into vertex a at position p.
+// It returns false if the collapse would damage the mesh.
+func (d *decimator) collapse(a, b int, p V3) bool {
+	// Link condition: the edge must have exactly 2 common neighbours,
+	// otherwise the collapse makes the mesh non-manifold.
+	na := d.neighbours(a)
+	nb := d.neighbours(b)
+	common := 0
+	for j := range nb {
+		if na[j] {
+			common++
+		}
+	}
+	if common != 2 {
+		return false
+	}
+	// the collapse must not flip or degenerate any remaining face
+	for _, v := range [2]int{a, b} {
+		for _, i := range d.faces(v) {
+			f := d.m.f[i]
+			if (f[0] == a || f[1] == a || f[2] == a) && (f[0] == b || f[1] == b || f[2] == b) {
+				// this face is removed
+				continue
+			}
+			var t0, t1 [3]V3
+			for k, j := range f {
+				t0[k] = d.m.v[j]
+				t1[k] = t0[k]
+				if j == v {
+					t1[k] = p
+				}
+			}
+			n0 := t0[1].Sub(t0[0]).Cross(t0[2].Sub(t0[0]))
+			n1 := t1[1].Sub(t1[0]).Cross(t1[2].Sub(t1[0]))
+			if n1.Length2() < EPSILON*n0.Length2() || n0.Dot(n1) <= 0 {
+				return false
+			}
+		}
+	}
+	// do the collapse
+	d.m.v[a] = p
+	d.q[a] = d.q[a].add(d.q[b])
+	for _, i := range d.faces(b) {
+		f := &d.m.f[i]
+		if f[0] == a || f[1] == a || f[2] == a {
+			d.fAlive[i] = false
+			d.nFaces--
+			continue
+		}
+		for k := range f {
+			if f[k] == b {
+				f[k] = a
+			}
+		}
+		d.vf[a] = append(d.vf[a], i)
+	}
+	d.vf[b] = nil
+	d.ver[a]++
+	d.ver[b]++
+	for j := range d.neighbours(a) {
+		d.push(a, j)
+	}
+	return true
+}
+
+// DecimateMesh reduces the number of triangles in a mesh to (approximately)
+// targetTriangles. Edges are collapsed in order of least quadric error, so
+// flat regions are simplified first and sharp features are kept. The
+// mesh should be closed and manifold, as produced by the renderers.
+// It stops early if no further collapses are possible.
+func DecimateMesh(mesh []*Triangle3, targetTriangles int) []*Triangle3 {
+	d := newDecimator(newMeshIndex(mesh))
+	count, _ := d.m.edgeCounts()
+	for e := range count {
+		d.push(e[0], e[1])
+	}
+	for d.nFaces > targetTriangles && d.h.Len() > 0 {
+		c := heap.Pop(&d.h).(*decimateCollapse)
+		if c.va != d.ver[c.a] || c.vb != d.ver[c.b] {
+			// stale candidate
+			continue
+		}
+		d.collapse(c.a, c.b, c.p)
+	}
+	// keep the live faces
+	f := d.m.f[:0]
+	for i, x := range d.m.f {
+		if d.fAlive[i] {
+			f = append(f, x)
+		}
+	}
+	d.m.f = f
+	return d.m.triangles()
+}
+
+//-----------------------------------------------------------------------------
+// Mesh Smoothing
+
+// neighbours returns the adjacent vertices for each vertex of the mesh.
+func (m *meshIndex) neighbours() [][]int {
+	set := make([]map[int]bool, len(m.v))
+	for i := range set {
+		set[i] = make(map[int]bool)
+	}
+	for _, f := range m.f {
+		for i := 0; i < 3; i++ {
+			a, b := f[i], f[(i+1)%3]
+			set[a][b] = true
+			set[b][a] = true
+		}
+	}
+	n := make([][]int, len(m.v))
+	for i := range set {
+		for j := range set[i] {
+			n[i] = append(n[i], j)
+		}
+	}
+	return n
+}
+
+// laplacian moves each vertex a fraction k of the way to the centroid of its neighbours.
+func (m *meshIndex) laplacian(n [][]int, k float64) {
+	v := make([]V3, len(m.v))
+	for i, p := range m.v {
+		if len(n[i]) == 0 {
+			v[i] = p
+			continue
+		}
+		var c V3
+		for _, j := range n[i] {
+			c = c.Add(m.v[j])
+		}
+		c = c.DivScalar(float64(len(n[i])))
+		v[i] = p.Add(c.Sub(p).MulScalar(k))
+	}
+	m.v = v
+}
+
+// SmoothMesh smooths the vertex positions of a mesh using Taubin's
+// lambda/mu method. Each iteration is a Laplacian smoothing step with
+// factor lambda (0 < lambda < 1, e.g. 0.5) followed by an inflating step
+// with a negative factor mu. Unlike plain Laplacian smoothing this removes
+// high frequency bumps without shrinking the model.
+func SmoothMesh(mesh []*Triangle3, iterations int, lambda float64) []*Triangle3 {
+	// pass band frequency
+	const kpb = 0.1
+	mu := 1 / (kpb - 1/lambda)
+	m := newMeshIndex(mesh)
+	n := m.neighbours()
+	for i := 0; i < iterations; i++ {
+		m.laplacian(n, lambda)
+		m.laplacian(n, mu)
+	}
+	return m.triangles()
+}
+
+//-----------------------------------------------------------------------------
+// Mesh Orientation
+
+// FlipNormals returns the triangles of a mesh with the winding reversed, so
+// the normals point the other way.
+func FlipNormals(mesh []*Triangle3) []*Triangle3 {
+	flipped := make([]*Triangle3, len(mesh))
+	for i, t := range mesh {
+		flipped[i] = NewTriangle3(t.V[0], t.V[2], t.V[1])
+	}
+	return flipped
+}
+
+// OrientMesh returns a mesh with the triangles rewound to a consistent
+// outward winding (counter-clockwise seen from outside), e.g. to repair an
+// imported mesh. The winding is made consistent within each connected part
+// of the mesh by a flood fill across shared edges. Each part is then turned
+// so that its volume is positive, unless it's inside an odd number of the
+// other parts (e.g. the surface of a cavity), which are turned inside out.
+// Degenerate triangles are dropped. Non-manifold edges (with more than two
+// triangles) are followed in any order, so the winding of such meshes may
+// still be inconsistent.
+func OrientMesh(mesh []*Triangle3) []*Triangle3 {
+	m := newMeshIndex(mesh)
+	edges := make(map[meshEdge][]int)
+	for i, f := range m.f {
+		for j := 0; j < 3; j++ {
+			e := newMeshEdge(f[j], f[(j+1)%3])
+			edges[e] = append(edges[e], i)
+		}
+	}
+	flip := func(i int) {
+		m.f[i][1], m.f[i][2] = m.f[i][2], m.f[i][1]
+	}
+	// has returns true if face i has the directed edge a->b
+	has := func(i, a, b int) bool {
+		f := m.f[i]
+		return (f[0] == a && f[1] == b) || (f[1] == a && f[2] == b) || (f[2] == a && f[0] == b)
+	}
+	// flood fill the connected parts
+	var parts [][]int
+	visited := make([]bool, len(m.f))
+	for seed := range m.f {
+		if visited[seed] {
+			continue
+		}
+		visited[seed] = true
+		part := []int{seed}
+		for k := 0; k < len(part); k++ {
+			f := m.f[part[k]]
+			for j := 0; j < 3; j++ {
+				a, b := f[j], f[(j+1)%3]
+				for _, i := range edges[newMeshEdge(a, b)] {
+					if visited[i] {
+						continue
+					}
+					// a neighbour shares the edge in the opposite direction
+					if has(i, a, b) {
+						flip(i)
+					}
+					visited[i] = true
+					part = append(part, i)
+				}
+			}
+		}
+		parts = append(parts, part)
+	}
+	// turn each part outwards
+	volume := func(part []int) float64 {
+		v := 0.0
+		for _, i := range part {
+			f := m.f[i]
+			v += m.v[f[0]].Dot(m.v[f[1]].Cross(m.v[f[2]]))
+		}
+		return v
+	}
+	triangles := func(part []int) []*Triangle3 {
+		t := make([]*Triangle3, len(part))
+		for k, i := range part {
+			t[k] = NewTriangle3(m.v[m.f[i][0]], m.v[m.f[i][1]], m.v[m.f[i][2]])
+		}
+		return t
+	}
+	for _, part := range parts {
+		if volume(part) < 0 {
+			for _, i := range part {
+				flip(i)
+			}
+		}
+	}
+	if len(parts) > 1 {
+		// turn the parts inside an odd number of parts inside out
+		sdf := make([]SDF3, len(parts))
+		for i, part := range parts {
+			sdf[i], _ = mesh3D(triangles(part))
+		}
+		var inside []bool
+		for i, part := range parts {
+			p := m.v[m.f[part[0]][0]]
+			n := 0
+			for j := range parts {
+				if j != i && sdf[j] != nil && sdf[j].Evaluate(p) < 0 {
+					n++
+				}
+			}
+			inside = append(inside, n%2 == 1)
+		}
+		for i, part := range parts {
+			if inside[i] {
+				for _, k := range part {
+					flip(k)
+				}
+			}
+		}
+	}
+	return m.triangles()
+}
+
+//-----------------------------------------------------------------------------
+// Mesh SDF3
+
+// MeshSDF3 is an SDF3 for a closed triangle mesh.
+type MeshSDF3 struct {
+	bvh     *bvhNode
+	winding *windingNode // the sign is from the winding number (if not nil)
+	bb      Box3
+}
+
+// meshTriangle is a triangle of a MeshSDF3. The distance to a triangle is
+// unsigned, the sign is from the pseudonormal of the nearest feature (face,
+// edge or vertex) of the nearest triangle.
+type meshTriangle struct {
+	v  [3]V3
+	n  V3    // face normal
+	ne [3]V3 // edge pseudonormals, edge i is v[i] to v[(i+1)%3]
+	nv [3]V3 // vertex pseudonormals (angle weighted)
+	bb Box3
+}
+
+// Mesh3D returns an SDF3 for a closed triangle mesh (e.g. from LoadSTL or
+// LoadOBJ). The triangles are rewound to a consistent outward winding first
+// (see OrientMesh), so meshes with inward facing or mixed normals give the
+// right sign. The distance is exact (to the mesh), the sign is worked out
+// from the angle weighted pseudonormals, so it's robust for closed manifold
+// meshes. The triangles are kept in a bounding volume hierarchy, so the
+// evaluation time is O(log n) in the number of triangles.
+func Mesh3D(mesh []*Triangle3) (SDF3, error) {
+	return mesh3D(OrientMesh(mesh))
+}
+
+// mesh3D returns the SDF3 for a mesh that is wound counter-clockwise seen
+// from outside.
+func mesh3D(mesh []*Triangle3) (SDF3, error) {
+	m := newMeshIndex(mesh)
+	// face normals, without the zero area triangles
+	var faces [][3]int
+	var fn []V3
+	for _, f := range m.f {
+		n := m.v[f[1]].Sub(m.v[f[0]]).Cross(m.v[f[2]].Sub(m.v[f[0]]))
+		if n.Length() == 0 {
+			continue
+		}
+		faces = append(faces, f)
+		fn = append(fn, n.Normalize())
+	}
+	if len(faces) == 0 {
+		return nil, fmt.Errorf("mesh has no triangles")
+	}
+	// vertex and edge pseudonormals
+	nv := make([]V3, len(m.v))
+	ne := make(map[meshEdge]V3)
+	for i, f := range faces {
+		for j := 0; j < 3; j++ {
+			a, b, c := m.v[f[j]], m.v[f[(j+1)%3]], m.v[f[(j+2)%3]]
+			cos := b.Sub(a).Normalize().Dot(c.Sub(a).Normalize())
+			nv[f[j]] = nv[f[j]].Add(fn[i].MulScalar(math.Acos(Clamp(cos, -1, 1))))
+			e := newMeshEdge(f[j], f[(j+1)%3])
+			ne[e] = ne[e].Add(fn[i])
+		}
+	}
+	triangles := make([]SDF3, len(faces))
+	for i, f := range faces {
+		t := meshTriangle{}
+		t.n = fn[i]
+		for j := 0; j < 3; j++ {
+			t.v[j] = m.v[f[j]]
+			t.nv[j] = nv[f[j]]
+			t.ne[j] = ne[newMeshEdge(f[j], f[(j+1)%3])]
+		}
+		t.bb = Box3{t.v[0].Min(t.v[1]).Min(t.v[2]), t.v[0].Max(t.v[1]).Max(t.v[2])}
+		triangles[i] = &t
+	}
+	s := MeshSDF3{}
+	s.bvh = newBVH(triangles)
+	s.bb = s.bvh.bb
+	return &s, nil
+}
+
+// Return the minimum distance to the object.
+func (s *MeshSDF3) Evaluate(p V3) float64 {
+	d, near := s.bvh.nearest(p, math.Inf(1), nil)
+	if s.winding != nil {
+		if s.winding.winding(p) > 0.5 {
+			return -d
+		}
+		return d
+	}
+	q, n := near.(*meshTriangle).closest(p)
+	if p.Sub(q).Dot(n) < 0 {
+		return -d
+	}
+	return d
+}
+
+// Return the bounding box.
+func (s *MeshSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+// Return the unsigned distance to the triangle.
+func (t *meshTriangle) Evaluate(p V3) float64 {
+	q, _ := t.closest(p)
+	return p.Sub(q).Length()
+}
+
+// Return the bounding box.
+func (t *meshTriangle) BoundingBox() Box3 {
+	return t.bb
+}
+
+// closest returns the closest point on the triangle to p, and the
+// pseudonormal of the feature it's on (see Ericson, Real-Time Collision
+// Detection, 5.1.5).
+func (t *meshTriangle) closest(p V3) (V3, V3) {
+	a, b, c := t.v[0], t.v[1], t.v[2]
+	ab := b.Sub(a)
+	ac := c.Sub(a)
+	ap := p.Sub(a)
+	d1 := ab.Dot(ap)
+	d2 := ac.Dot(ap)
+	if d1 <= 0 && d2 <= 0 {
+		return a, t.nv[0]
+	}
+	bp := p.Sub(b)
+	d3 := ab.Dot(bp)
+	d4 := ac.Dot(bp)
+	if d3 >= 0 && d4 <= d3 {
+		return b, t.nv[1]
+	}
+	vc := d1*d4 - d3*d2
+	if vc <= 0 && d1 >= 0 && d3 <= 0 {
+		return a.Add(ab.MulScalar(d1 / (d1 - d3))), t.ne[0]
+	}
+	cp := p.Sub(c)
+	d5 := ab.Dot(cp)
+	d6 := ac.Dot(cp)
+	if d6 >= 0 && d5 <= d6 {
+		return c, t.nv[2]
+	}
+	vb := d5*d2 - d1*d6
+	if vb <= 0 && d2 >= 0 && d6 <= 0 {
+		return a.Add(ac.MulScalar(d2 / (d2 - d6))), t.ne[2]
+	}
+	va := d3*d6 - d5*d4
+	if va <= 0 && d4-d3 >= 0 && d5-d6 >= 0 {
+		w := (d4 - d3) / ((d4 - d3) + (d5 - d6))
+		return b.Add(c.Sub(b).MulScalar(w)), t.ne[1]
+	}
+	k := 1 / (va + vb + vc)
+	return a.Add(ab.MulScalar(vb * k)).Add(ac.MulScalar(vc * k)), t.n
+}
+
+//-----------------------------------------------------------------------------
+// Winding Numbers
+
+// MeshWinding3D returns an SDF3 for a triangle mesh as for Mesh3D, but the
+// sign is from the generalized winding number of the mesh (Jacobson et al.
+// 2013), i.e. a point is inside if the mesh winds around it more than half a
+// turn. The winding number degrades gracefully, so the sign is still right
+// for meshes with small gaps, overlaps or self-intersections (e.g. imperfect
+// STL files), where the sign of Mesh3D breaks down near the defects.
+// The winding number of far parts of the mesh is approximated from the BVH
+// nodes (Barill et al. 2018), so a query is still O(log n), but it visits
+// more of the tree than a distance query, so this evaluates a few times
+// slower than Mesh3D.
+func MeshWinding3D(mesh []*Triangle3) (SDF3, error) {
+	x, err := Mesh3D(mesh)
+	if err != nil {
+		return nil, err
+	}
+	s := x.(*MeshSDF3)
+	s.winding = newWindingNode(s.bvh)
+	return s, nil
+}
+
+// windingNode has the dipole approximation of the triangles below a BVH node.
+type windingNode struct {
+	bvh         *bvhNode
+	left, right *windingNode
+	c           V3      // area weighted center
+	n           V3      // sum of the area weighted normals
+	r           float64 // radius of the node about c
+}
+
+// nodes closer than this (times the radius) are evaluated exactly, the
+// dipole approximation of the others is good to a few percent
+const windingBeta = 2.0
+
+// newWindingNode returns the winding number tree for a BVH of mesh triangles.
+func newWindingNode(b *bvhNode) *windingNode {
+	w := windingNode{bvh: b}
+	area := 0.0
+	if b.sdf != nil {
+		for _, x := range b.sdf {
+			t := x.(*meshTriangle)
+			n := t.v[1].Sub(t.v[0]).Cross(t.v[2].Sub(t.v[0])).MulScalar(0.5)
+			a := n.Length()
+			w.n = w.n.Add(n)
+			w.c = w.c.Add(t.v[0].Add(t.v[1]).Add(t.v[2]).MulScalar(a / 3))
+			area += a
+		}
+	} else {
+		w.left = newWindingNode(b.left)
+		w.right = newWindingNode(b.right)
+		al, ar := w.left.n.Length(), w.right.n.Length()
+		w.n = w.left.n.Add(w.right.n)
+		w.c = w.left.c.MulScalar(al).Add(w.right.c.MulScalar(ar))
+		area = al + ar
+	}
+	if area > 0 {
+		w.c = w.c.DivScalar(area)
+	} else {
+		w.c = b.bb.Center()
+	}
+	for _, v := range b.bb.Vertices() {
+		w.r = Max(w.r, v.Sub(w.c).Length())
+	}
+	return &w
+}
+
+// winding returns the winding number of the triangles below the node about p.
+func (w *windingNode) winding(p V3) float64 {
+	if d := w.c.Sub(p); d.Length() > windingBeta*w.r {
+		// far away, use the dipole approximation
+		l := d.Length()
+		return w.n.Dot(d) / (4 * PI * l * l * l)
+	}
+	if w.bvh.sdf != nil {
+		k := 0.0
+		for _, x := range w.bvh.sdf {
+			k += x.(*meshTriangle).solidAngle(p)
+		}
+		return k / (4 * PI)
+	}
+	return w.left.winding(p) + w.right.winding(p)
+}
+
+// solidAngle returns the signed solid angle of the triangle seen from p, > 0
+// if p is behind the triangle (van Oosterom and Strackee).
+func (t *meshTriangle) solidAngle(p V3) float64 {
+	a, b, c := t.v[0].Sub(p), t.v[1].Sub(p), t.v[2].Sub(p)
+	la, lb, lc := a.Length(), b.Length(), c.Length()
+	num := a.Dot(b.Cross(c))
+	den := la*lb*lc + a.Dot(b)*lc + b.Dot(c)*la + c.Dot(a)*lb
+	return 2 * math.Atan2(num, den)
+}
+
+//-----------------------------------------------------------------------------
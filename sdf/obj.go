@@ -0,0 +1,195 @@
+//-----------------------------------------------------------------------------
+/*
+
+OBJ Save and Load
+
+Wavefront OBJ is a text format with a shared vertex list. Optionally the
+vertex normals are written. These are taken from the gradient of the SDF3
+at each vertex, so the model shades smoothly without averaging the face
+normals of the mesh.
+
+Loading only reads the vertices and faces, which are enough for an SDF3 of
+the mesh (see Mesh3D).
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+//-----------------------------------------------------------------------------
+
+// normal_eps returns a step size for the normals of an SDF3 that is small
+// relative to the object.
+func normal_eps(s SDF3) float64 {
+	return 1e-5 * s.BoundingBox().Size().MaxComponent()
+}
+
+// vertexNormals returns the normals of an SDF3 at a set of vertices.
+func vertexNormals(s SDF3, v []V3) []V3 {
+	eps := normal_eps(s)
+	n := make([]V3, len(v))
+	for i := range v {
+		n[i] = Normal3(s, v[i], eps)
+	}
+	return n
+}
+
+// writeOBJ writes an indexed mesh (with optional vertex normals) as OBJ.
+// The numbers are written with decimals decimal places (see ftoa).
+func writeOBJ(w io.Writer, m *meshIndex, normals []V3, decimals int) error {
+	buf := bufio.NewWriter(w)
+	for _, v := range m.v {
+		fmt.Fprintf(buf, "v %s %s %s\n", ftoa(v.X, decimals), ftoa(v.Y, decimals), ftoa(v.Z, decimals))
+	}
+	for _, n := range normals {
+		fmt.Fprintf(buf, "vn %s %s %s\n", ftoa(n.X, decimals), ftoa(n.Y, decimals), ftoa(n.Z, decimals))
+	}
+	for _, f := range m.f {
+		// OBJ indices start at 1
+		a, b, c := f[0]+1, f[1]+1, f[2]+1
+		if normals != nil {
+			fmt.Fprintf(buf, "f %d//%d %d//%d %d//%d\n", a, a, b, b, c, c)
+		} else {
+			fmt.Fprintf(buf, "f %d %d %d\n", a, b, c)
+		}
+	}
+	return buf.Flush()
+}
+
+// SaveOBJ writes a triangle mesh to an OBJ file.
+// If s is not nil the vertex normals are written, these are the normals of
+// s at each vertex (s should be the SDF3 the mesh was rendered from).
+func SaveOBJ(path string, mesh []*Triangle3, s SDF3) error {
+	return saveOBJ(path, mesh, s, Z_UP, 0)
+}
+
+// saveOBJ writes a triangle mesh in the model axes to an OBJ file with the
+// given up axis and decimal places.
+func saveOBJ(path string, mesh []*Triangle3, s SDF3, up UpAxis, decimals int) error {
+	m := newMeshIndex(mesh)
+	var normals []V3
+	if s != nil {
+		normals = vertexNormals(s, m.v)
+	}
+	for i := range m.v {
+		m.v[i] = up.output(m.v[i])
+	}
+	for i := range normals {
+		normals[i] = up.output(normals[i])
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return writeOBJ(f, m, normals, decimals)
+}
+
+//-----------------------------------------------------------------------------
+
+// RenderOBJ renders an SDF3 as an OBJ file with vertex normals (octree sampling).
+func RenderOBJ(
+	s SDF3, //sdf3 to render
+	mesh_cells int, //number of cells on the longest axis. e.g 200
+	path string, //path to filename
+) {
+	fmt.Printf("rendering %s (%d cells)\n", path, mesh_cells)
+	m := RenderMesh(s, mesh_cells)
+	if err := SaveOBJ(path, m.Triangles, s); err != nil {
+		fmt.Printf("%s", err)
+	}
+}
+
+//-----------------------------------------------------------------------------
+// OBJ Load
+
+// objIndex returns the vertex index (from 0) for an OBJ face vertex, e.g.
+// "3", "3/1", "3//2" or "3/1/2". Negative indices are relative to the end
+// of the n vertices read so far.
+func objIndex(s string, n int) (int, error) {
+	if k := strings.IndexByte(s, '/'); k >= 0 {
+		s = s[:k]
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	if i < 0 {
+		i += n
+	} else {
+		i--
+	}
+	if i < 0 || i >= n {
+		return 0, fmt.Errorf("vertex %s out of range", s)
+	}
+	return i, nil
+}
+
+// ParseOBJ parses the triangles of an OBJ file.
+// Polygonal faces are split into a fan of triangles. Texture coordinates,
+// normals, groups and materials are ignored.
+func ParseOBJ(data []byte) ([]*Triangle3, error) {
+	var v []V3
+	var mesh []*Triangle3
+	for i, l := range strings.Split(string(data), "\n") {
+		f := strings.Fields(l)
+		if len(f) == 0 {
+			continue
+		}
+		switch f[0] {
+		case "v":
+			if len(f) < 4 {
+				return nil, fmt.Errorf("obj line %d: vertex has %d coordinates", i+1, len(f)-1)
+			}
+			var x [3]float64
+			for j := range x {
+				var err error
+				if x[j], err = strconv.ParseFloat(f[j+1], 64); err != nil {
+					return nil, fmt.Errorf("obj line %d: %s", i+1, err)
+				}
+			}
+			v = append(v, V3{x[0], x[1], x[2]})
+		case "f":
+			if len(f) < 4 {
+				return nil, fmt.Errorf("obj line %d: face has %d vertices", i+1, len(f)-1)
+			}
+			idx := make([]int, len(f)-1)
+			for j := range idx {
+				var err error
+				if idx[j], err = objIndex(f[j+1], len(v)); err != nil {
+					return nil, fmt.Errorf("obj line %d: %s", i+1, err)
+				}
+			}
+			for j := 1; j < len(idx)-1; j++ {
+				mesh = append(mesh, NewTriangle3(v[idx[0]], v[idx[j]], v[idx[j+1]]))
+			}
+		}
+	}
+	return mesh, nil
+}
+
+// LoadOBJ reads an OBJ file (e.g. exported from Blender) as an SDF3.
+// See ParseOBJ and Mesh3D.
+func LoadOBJ(fname string) (SDF3, error) {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	mesh, err := ParseOBJ(data)
+	if err != nil {
+		return nil, err
+	}
+	return Mesh3D(mesh)
+}
+
+//-----------------------------------------------------------------------------
@@ -3,14 +3,18 @@
 
 2D Rendering Code
 
+PNG images of SDF2s, and shaded PNG previews of SDF3s.
+
 */
 //-----------------------------------------------------------------------------
 
 package sdf
 
 import (
+	"fmt"
 	"image"
 	"image/color"
+	"image/draw"
 	"image/png"
 	"os"
 
@@ -110,3 +114,129 @@ func (d *PNG) Save() error {
 }
 
 //-----------------------------------------------------------------------------
+
+// RenderPNG2 renders an SDF2 as an anti-aliased PNG image.
+// The inside of the shape is filled black on a white background. Pixels
+// on the boundary are shaded by their coverage, estimated from the
+// distance at the pixel center. The bounding box is fitted (with a small
+// margin) to the image and the pixels are square.
+// See PNG.RenderSDF2 for a gray scale visualization of the distance field.
+func RenderPNG2(
+	s SDF2, //sdf2 to render
+	width, height int, //image size in pixels
+	path string, //path to filename
+) {
+	// work out the pixel size
+	bb := s.BoundingBox().ScaleAboutCenter(1.05)
+	size := bb.Size()
+	pixel := Max(size.X/float64(width), size.Y/float64(height))
+	// top left corner of the image
+	ofs := bb.Center().Sub(V2{float64(width), -float64(height)}.MulScalar(0.5 * pixel))
+
+	fmt.Printf("rendering %s (%dx%d, resolution %.2f)\n", path, width, height, pixel)
+
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			p := ofs.Add(V2{float64(x) + 0.5, -(float64(y) + 0.5)}.MulScalar(pixel))
+			coverage := Clamp(0.5-s.Evaluate(p)/pixel, 0, 1)
+			img.SetGray(x, y, color.Gray{uint8(255 * (1 - coverage))})
+		}
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		fmt.Printf("%s", err)
+		return
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		fmt.Printf("%s", err)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// RenderPreviewPNG3 renders a shaded preview image of an SDF3 without meshing it.
+// The view is an orthographic projection looking along direction dir, framed
+// on the bounding box. Rays are sphere traced to the surface and shaded by
+// the surface normal (Lambert, with the light behind the viewer) on a black
+// background. If the SDF3 has color tags (see Color3D) each surface point is
+// shaded with the color of the nearest tagged region, otherwise the image is
+// gray scale.
+// Sphere tracing steps along each ray by the distance value, so the SDF3
+// must never over-estimate the distance to the surface. Exact SDFs and
+// SDFs that are a lower bound are fine, but distorted fields (e.g. some
+// non-uniform scaling, or blend functions that inflate distances) can make
+// rays step through thin parts of the surface.
+func RenderPreviewPNG3(
+	s SDF3, //sdf3 to render
+	width, height int, //image size in pixels
+	dir V3, //view direction
+	path string, //path to filename
+) {
+	// camera basis vectors
+	dir = dir.Normalize()
+	up := V3{0, 0, 1}
+	if Abs(dir.Z) > 0.99 {
+		up = V3{0, 1, 0}
+	}
+	right := dir.Cross(up).Normalize()
+	up = right.Cross(dir)
+
+	// frame the bounding sphere of the bounding box
+	bb := s.BoundingBox()
+	center := bb.Center()
+	radius := 0.5 * bb.Size().Length() * 1.05
+	pixel := 2 * radius / Min(float64(width), float64(height))
+	// surface hit distance and gradient step
+	eps := 0.1 * pixel
+
+	fmt.Printf("rendering %s (%dx%d, resolution %.2f)\n", path, width, height, pixel)
+
+	regions := colorRegions(s)
+	var img draw.Image
+	if len(regions) > 0 {
+		img = image.NewRGBA(image.Rect(0, 0, width, height))
+		draw.Draw(img, img.Bounds(), image.Black, image.Point{}, draw.Src)
+	} else {
+		img = image.NewGray(image.Rect(0, 0, width, height))
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			u := (float64(x) + 0.5 - 0.5*float64(width)) * pixel
+			v := (0.5*float64(height) - float64(y) - 0.5) * pixel
+			// the ray starts on the near side of the bounding sphere
+			p := center.Add(right.MulScalar(u)).Add(up.MulScalar(v)).Sub(dir.MulScalar(radius))
+			t := 0.0
+			for i := 0; i < 256 && t < 2*radius; i++ {
+				d := s.Evaluate(p.Add(dir.MulScalar(t)))
+				if d < eps {
+					q := p.Add(dir.MulScalar(t))
+					n := Normal3(s, q, eps)
+					k := 0.1 + 0.9*Max(0, -n.Dot(dir))
+					if len(regions) > 0 {
+						c := colorAt(regions, q)
+						img.Set(x, y, color.RGBA{uint8(float64(c[0]) * k), uint8(float64(c[1]) * k), uint8(float64(c[2]) * k), 255})
+					} else {
+						img.Set(x, y, color.Gray{uint8(255 * k)})
+					}
+					break
+				}
+				t += d
+			}
+		}
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		fmt.Printf("%s", err)
+		return
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		fmt.Printf("%s", err)
+	}
+}
+
+//-----------------------------------------------------------------------------
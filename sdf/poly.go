@@ -293,6 +293,20 @@ func NewPolygon() *Polygon {
 	return &Polygon{}
 }
 
+// CirclePolygon returns a closed polygon with n segments approximating a
+// circle (see CircleSegments for the n to use for a tolerance).
+func CirclePolygon(c V2, r float64, n int) *Polygon {
+	if n < 3 {
+		panic("n < 3")
+	}
+	v := Nagon(n, r)
+	v.MulVertices(Translate2d(c))
+	p := NewPolygon()
+	p.AddV2Set(v)
+	p.Close()
+	return p
+}
+
 // Add a V2 vertex to a polygon.
 func (p *Polygon) AddV2(x V2) *PV {
 	v := PV{}
@@ -371,6 +385,59 @@ func (p *Polygon) Render(path string) error {
 
 //-----------------------------------------------------------------------------
 
+// PolygonArea2D returns the signed area of a closed polygon (shoelace
+// formula). The area is > 0 for counter-clockwise vertices, < 0 for clockwise.
+func PolygonArea2D(vertices []V2) float64 {
+	a := 0.0
+	for i := range vertices {
+		p0 := vertices[i]
+		p1 := vertices[(i+1)%len(vertices)]
+		a += p0.X*p1.Y - p1.X*p0.Y
+	}
+	return 0.5 * a
+}
+
+// PolygonCentroid2D returns the centroid (center of area) of a closed
+// polygon. A polygon with no area gives the mean of the vertices.
+func PolygonCentroid2D(vertices []V2) V2 {
+	a := 0.0
+	var c V2
+	for i := range vertices {
+		p0 := vertices[i]
+		p1 := vertices[(i+1)%len(vertices)]
+		k := p0.X*p1.Y - p1.X*p0.Y
+		a += k
+		c = c.Add(p0.Add(p1).MulScalar(k))
+	}
+	if a == 0 {
+		for _, v := range vertices {
+			c = c.Add(v)
+		}
+		return c.DivScalar(float64(len(vertices)))
+	}
+	return c.DivScalar(3 * a)
+}
+
+//-----------------------------------------------------------------------------
+
+// CircleSegments returns the number of segments for a polygon approximating
+// a circle so that no point of the polygon is more than tolerance inside the
+// circle. e.g. for a circular hole that mills round.
+func CircleSegments(radius, tolerance float64) int {
+	if tolerance <= 0 {
+		panic("tolerance <= 0")
+	}
+	if tolerance >= radius {
+		return 3
+	}
+	// the sagitta of each segment is r * (1 - cos(theta/2))
+	n := int(math.Ceil(PI / math.Acos(1-tolerance/radius)))
+	if n < 3 {
+		n = 3
+	}
+	return n
+}
+
 // Return the vertices of a N sided regular polygon
 func Nagon(n int, radius float64) V2Set {
 	if n < 3 {
@@ -387,3 +454,237 @@ func Nagon(n int, radius float64) V2Set {
 }
 
 //-----------------------------------------------------------------------------
+
+// DistanceToSegment2D returns the distance from a point to the line segment
+// a-b, and the nearest point on the segment.
+func DistanceToSegment2D(p, a, b V2) (float64, V2) {
+	ab := b.Sub(a)
+	l2 := ab.Dot(ab)
+	if l2 == 0 {
+		return p.Sub(a).Length(), a
+	}
+	t := Clamp(p.Sub(a).Dot(ab)/l2, 0, 1)
+	q := a.Add(ab.MulScalar(t))
+	return p.Sub(q).Length(), q
+}
+
+// NearestOnPolyline returns the distance from a point to an open polyline,
+// the nearest point on the polyline and the index of the segment it's on
+// (segment i is vertices[i] to vertices[i+1]).
+func NearestOnPolyline(p V2, vertices []V2) (float64, V2, int) {
+	if len(vertices) == 0 {
+		panic("no vertices")
+	}
+	if len(vertices) == 1 {
+		return p.Sub(vertices[0]).Length(), vertices[0], 0
+	}
+	dmin := math.Inf(1)
+	var q V2
+	idx := 0
+	for i := 0; i < len(vertices)-1; i++ {
+		d, x := DistanceToSegment2D(p, vertices[i], vertices[i+1])
+		if d < dmin {
+			dmin, q, idx = d, x, i
+		}
+	}
+	return dmin, q, idx
+}
+
+// Return the distance from a point to the line segment a-b.
+func segment_distance(p, a, b V2) float64 {
+	d, _ := DistanceToSegment2D(p, a, b)
+	return d
+}
+
+// Return true if the line segments a0-a1 and b0-b1 cross or touch.
+func segments_intersect(a0, a1, b0, b1 V2) bool {
+	cross := func(o, a, b V2) float64 {
+		return (a.X-o.X)*(b.Y-o.Y) - (a.Y-o.Y)*(b.X-o.X)
+	}
+	d0 := cross(b0, b1, a0)
+	d1 := cross(b0, b1, a1)
+	d2 := cross(a0, a1, b0)
+	d3 := cross(a0, a1, b1)
+	if ((d0 > 0 && d1 < 0) || (d0 < 0 && d1 > 0)) && ((d2 > 0 && d3 < 0) || (d2 < 0 && d3 > 0)) {
+		return true
+	}
+	// collinear cases
+	on := func(p, a, b V2) bool {
+		return p.X >= Min(a.X, b.X) && p.X <= Max(a.X, b.X) && p.Y >= Min(a.Y, b.Y) && p.Y <= Max(a.Y, b.Y)
+	}
+	return (d0 == 0 && on(a0, b0, b1)) || (d1 == 0 && on(a1, b0, b1)) ||
+		(d2 == 0 && on(b0, a0, a1)) || (d3 == 0 && on(b1, a0, a1))
+}
+
+// Return the index of the vertex in v[i+1:j] furthest from the line v[i]-v[j].
+func furthest_vertex(v []V2, i, j int) (int, float64) {
+	imax := -1
+	dmax := 0.0
+	for k := i + 1; k < j; k++ {
+		d := segment_distance(v[k%len(v)], v[i%len(v)], v[j%len(v)])
+		if d > dmax {
+			dmax = d
+			imax = k
+		}
+	}
+	return imax, dmax
+}
+
+// Douglas-Peucker simplification of the polyline v[i]...v[j].
+// The kept vertices are marked in keep, indices wrap around the end of v.
+func simplify_dp(v []V2, i, j int, tol float64, keep []bool) {
+	k, d := furthest_vertex(v, i, j)
+	if k < 0 || d <= tol {
+		return
+	}
+	keep[k%len(v)] = true
+	simplify_dp(v, i, k, tol, keep)
+	simplify_dp(v, k, j, tol, keep)
+}
+
+// Simplify2D simplifies a closed polygon with the Douglas-Peucker algorithm.
+// Every removed vertex is within tol of the simplified outline, so corners
+// that stand out by more than tol are kept. The polygon is closed, the edge
+// between the last and first vertex is simplified like any other. Where the
+// simplified polygon would self-intersect, some removed vertices are put back
+// so the simplified polygon has the same topology as the original.
+func Simplify2D(vertices []V2, tol float64) []V2 {
+	v := vertices
+	// drop a closing vertex
+	if len(v) > 1 && v[0].Equals(v[len(v)-1], TOLERANCE) {
+		v = v[:len(v)-1]
+	}
+	n := len(v)
+	if tol <= 0 || n <= 3 {
+		return v
+	}
+	// split the polygon at the vertex furthest from the first vertex
+	imax := 0
+	dmax := 0.0
+	for i := range v {
+		if d := v[i].Sub(v[0]).Length(); d > dmax {
+			dmax = d
+			imax = i
+		}
+	}
+	if imax == 0 {
+		return v
+	}
+	keep := make([]bool, n)
+	keep[0] = true
+	keep[imax] = true
+	simplify_dp(v, 0, imax, tol, keep)
+	simplify_dp(v, imax, n, tol, keep)
+	for {
+		var idx []int
+		for i := range v {
+			if keep[i] {
+				idx = append(idx, i)
+			}
+		}
+		m := len(idx)
+		// find an edge crossing a non-adjacent edge
+		fixed := false
+		for a := 0; a < m && !fixed; a++ {
+			a0, a1 := idx[a], idx[(a+1)%m]
+			for b := a + 2; b < m; b++ {
+				if a == 0 && b == m-1 {
+					// adjacent via the closing edge
+					continue
+				}
+				b0, b1 := idx[b], idx[(b+1)%m]
+				if !segments_intersect(v[a0], v[a1], v[b0], v[b1]) {
+					continue
+				}
+				// put back the furthest removed vertex of a crossing edge
+				for _, e := range [][2]int{{a0, a1}, {b0, b1}} {
+					j := e[1]
+					if j <= e[0] {
+						j += n
+					}
+					if k, _ := furthest_vertex(v, e[0], j); k >= 0 {
+						keep[k%n] = true
+						simplify_dp(v, e[0], k, tol, keep)
+						simplify_dp(v, k, j, tol, keep)
+						fixed = true
+					}
+				}
+				break
+			}
+		}
+		if !fixed {
+			if m < 3 {
+				// too simple to be a polygon
+				return v
+			}
+			s := make([]V2, m)
+			for i, k := range idx {
+				s[i] = v[k]
+			}
+			return s
+		}
+	}
+}
+
+// SimplifySDF2 returns a polygon SDF2 simplified to within tol.
+// See Simplify2D.
+func SimplifySDF2(s SDF2, tol float64) SDF2 {
+	p, ok := s.(*PolySDF2)
+	if !ok {
+		panic("not a Polygon2D")
+	}
+	return Polygon2D(Simplify2D(p.Vertices(), tol))
+}
+
+//-----------------------------------------------------------------------------
+
+// Resample2D returns n vertices at equal arc-length intervals along a
+// polygon. The first vertex is kept. A closed polygon includes the edge from
+// the last vertex back to the first and the n vertices divide the perimeter
+// evenly. An open polygon also keeps the last vertex. Sharp corners that fall
+// between the new vertices are cut off.
+func Resample2D(vertices []V2, n int, closed bool) []V2 {
+	if n < 2 {
+		panic("n < 2")
+	}
+	v := vertices
+	if len(v) < 2 {
+		panic("len(vertices) < 2")
+	}
+	if closed {
+		// add the closing vertex (if necessary)
+		if !v[0].Equals(v[len(v)-1], TOLERANCE) {
+			v = append(v[:len(v):len(v)], v[0])
+		}
+	}
+	// cumulative length at each vertex
+	l := make([]float64, len(v))
+	for i := 1; i < len(v); i++ {
+		l[i] = l[i-1] + v[i].Sub(v[i-1]).Length()
+	}
+	total := l[len(l)-1]
+	step := total / float64(n)
+	if !closed {
+		step = total / float64(n-1)
+	}
+	r := make([]V2, n)
+	j := 0
+	for i := range r {
+		x := float64(i) * step
+		// find the segment containing x
+		for j < len(v)-2 && l[j+1] < x {
+			j++
+		}
+		k := 0.0
+		if dl := l[j+1] - l[j]; dl > 0 {
+			k = Clamp((x-l[j])/dl, 0, 1)
+		}
+		r[i] = v[j].Add(v[j+1].Sub(v[j]).MulScalar(k))
+	}
+	if !closed {
+		r[n-1] = v[len(v)-1]
+	}
+	return r
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,151 @@
+//-----------------------------------------------------------------------------
+/*
+
+SDF3 Probes
+
+A probe explains the distance of an SDF3 at a point, e.g. to debug a boolean
+that doesn't look right. Operators that pick the distance of one of their
+children (unions, differences, intersections) report the child that decided
+the result, and operators that wrap a single child pass the probe through,
+so the probe follows the decisive branch from the root down to the SDF3
+(normally a primitive) that determined the distance.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+//-----------------------------------------------------------------------------
+
+// decider is an SDF3 operator that can report the child that determined its
+// distance at p, and p in the coordinates of that child.
+type decider interface {
+	decisive(p V3) (SDF3, V3)
+}
+
+func (s *UnionSDF3) decisive(p V3) (SDF3, V3) {
+	// the nearest child (for a smooth union the blend mixes the nearest ones)
+	var near SDF3
+	d := math.MaxFloat64
+	for _, x := range s.sdf {
+		if v := x.Evaluate(p); v < d {
+			d = v
+			near = x
+		}
+	}
+	return near, p
+}
+
+func (s *UnionManySDF3) decisive(p V3) (SDF3, V3) {
+	var near SDF3
+	d := math.MaxFloat64
+	for _, x := range s.rest {
+		if v := x.Evaluate(p); v < d {
+			d = v
+			near = x
+		}
+	}
+	if s.bvh != nil {
+		_, near = s.bvh.nearest(p, d, near)
+	}
+	return near, p
+}
+
+func (s *DifferenceSDF3) decisive(p V3) (SDF3, V3) {
+	if s.s0.Evaluate(p) >= -s.s1.Evaluate(p) {
+		return s.s0, p
+	}
+	return s.s1, p
+}
+
+func (s *IntersectionSDF3) decisive(p V3) (SDF3, V3) {
+	if s.s0.Evaluate(p) >= s.s1.Evaluate(p) {
+		return s.s0, p
+	}
+	return s.s1, p
+}
+
+func (s *TransformSDF3) decisive(p V3) (SDF3, V3) {
+	return s.sdf, s.inverse.MulPosition(p)
+}
+
+func (s *ScaleUniformSDF3) decisive(p V3) (SDF3, V3) {
+	return s.sdf, p.MulScalar(s.inv_k)
+}
+
+func (s *OffsetSDF3) decisive(p V3) (SDF3, V3) {
+	return s.sdf, p
+}
+
+func (s *ShellSDF3) decisive(p V3) (SDF3, V3) {
+	return s.sdf, p
+}
+
+func (s *MaterialSDF3) decisive(p V3) (SDF3, V3) {
+	return s.sdf, p
+}
+
+func (s *ColorSDF3) decisive(p V3) (SDF3, V3) {
+	return s.sdf, p
+}
+
+func (s *CountedSDF3) decisive(p V3) (SDF3, V3) {
+	return s.sdf, p
+}
+
+//-----------------------------------------------------------------------------
+
+// ProbeStep is a node on the decisive branch of a probe.
+type ProbeStep struct {
+	SDF      SDF3    // the node
+	P        V3      // the probe point in the coordinates of the node
+	Distance float64 // the distance of the node at P
+}
+
+// Probe is the result of probing an SDF3 at a point.
+type Probe struct {
+	Distance float64     // distance of the SDF3 at the point
+	Normal   V3          // estimated unit normal at the point
+	Path     []ProbeStep // the decisive branch, from the root down
+}
+
+// Probe3D probes an SDF3 at a point.
+// The normal is estimated by central differences (see Normal3).
+func Probe3D(s SDF3, p V3) *Probe {
+	r := Probe{}
+	r.Distance = s.Evaluate(p)
+	r.Normal = Normal3(s, p, normal_eps(s))
+	x, q := s, p
+	for x != nil {
+		r.Path = append(r.Path, ProbeStep{x, q, x.Evaluate(q)})
+		d, ok := x.(decider)
+		if !ok {
+			break
+		}
+		x, q = d.decisive(q)
+	}
+	return &r
+}
+
+// Decisive returns the SDF3 at the end of the decisive branch.
+func (r *Probe) Decisive() SDF3 {
+	return r.Path[len(r.Path)-1].SDF
+}
+
+// String returns a readable description of the probe.
+func (r *Probe) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "distance %g normal %v\n", r.Distance, r.Normal)
+	for i, x := range r.Path {
+		fmt.Fprintf(&b, "%s%T at %v distance %g\n", strings.Repeat("  ", i), x.SDF, x.P, x.Distance)
+	}
+	return b.String()
+}
+
+//-----------------------------------------------------------------------------
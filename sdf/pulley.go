@@ -0,0 +1,88 @@
+//-----------------------------------------------------------------------------
+/*
+
+Timing Belt Pulleys
+
+The tooth grooves are approximated with circular arcs. The pitch line of
+the belt is outside the pulley, so the outside diameter of the pulley is
+less than the pitch diameter by twice the pitch line offset.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+//-----------------------------------------------------------------------------
+// Belt Database - lookup standard belt profiles by name
+
+type BeltParameters struct {
+	Name         string  // name of belt profile
+	Pitch        float64 // tooth to tooth distance along the belt
+	PitchOffset  float64 // distance from the pitch line to the pulley
+	GrooveDepth  float64 // depth of the pulley groove
+	GrooveRadius float64 // radius of the pulley groove
+}
+
+type BeltDatabase map[string]*BeltParameters
+
+var belt_db = Init_BeltLookup()
+
+// Add adds a belt profile to the belt database.
+func (m BeltDatabase) Add(
+	name string, // belt profile name
+	pitch float64, // tooth pitch
+	offset float64, // pitch line offset
+	depth float64, // groove depth
+	radius float64, // groove radius
+) {
+	m[name] = &BeltParameters{name, pitch, offset, depth, radius}
+}
+
+func Init_BeltLookup() BeltDatabase {
+	m := make(BeltDatabase)
+	m.Add("GT2", 2, 0.254, 0.75, 0.555)
+	m.Add("GT2_3mm", 3, 0.381, 1.14, 0.85)
+	m.Add("HTD_3M", 3, 0.381, 1.22, 0.86)
+	m.Add("HTD_5M", 5, 0.5715, 2.06, 1.49)
+	return m
+}
+
+// lookup the parameters for a belt profile
+func BeltLookup(name string) *BeltParameters {
+	b, ok := belt_db[name]
+	if !ok {
+		panic("belt profile not found")
+	}
+	return b
+}
+
+// Pitch Diameter of a pulley with a given number of teeth.
+func (b *BeltParameters) PitchDiameter(teeth int) float64 {
+	return float64(teeth) * b.Pitch / PI
+}
+
+// Outside Diameter of a pulley with a given number of teeth.
+func (b *BeltParameters) OutsideDiameter(teeth int) float64 {
+	return b.PitchDiameter(teeth) - 2*b.PitchOffset
+}
+
+//-----------------------------------------------------------------------------
+
+// TimingPulley2D returns the 2D profile for a timing belt pulley.
+// Unknown profile names panic, see BeltLookup.
+func TimingPulley2D(
+	profile string, // belt profile name, e.g. "GT2", "HTD_5M"
+	teeth int, // number of pulley teeth
+) SDF2 {
+	b := BeltLookup(profile)
+	if teeth < 3 {
+		panic("teeth < 3")
+	}
+	r := b.OutsideDiameter(teeth) / 2
+	// the groove circle is centered so it cuts GrooveDepth into the pulley
+	groove := Circle2D(b.GrooveRadius)
+	groove = Transform2D(groove, Translate2d(V2{r + b.GrooveRadius - b.GrooveDepth, 0}))
+	return Difference2D(Circle2D(r), RotateCopy2D(groove, teeth))
+}
+
+//-----------------------------------------------------------------------------
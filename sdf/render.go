@@ -13,24 +13,508 @@ package sdf
 
 import (
 	"fmt"
+	"math"
+	"runtime"
 	"sync"
+	"time"
 )
 
 //-----------------------------------------------------------------------------
 
+// sampleBox3 returns a sampling region for the bounding box bb that is a
+// whole number of cells of size inc, with an extra cell of margin.
+func sampleBox3(bb Box3, inc float64) Box3 {
+	size := bb.Size().DivScalar(inc)
+	size = size.Ceil().AddScalar(1)
+	return NewBox3(bb.Center(), size.MulScalar(inc))
+}
+
+// RenderParms are the parameters for rendering an SDF3 as a triangle mesh.
+type RenderParms struct {
+	MeshCells int          // number of cells on the longest axis, e.g. 200
+	CellSize  float64      // cell size in model units, used instead of MeshCells if > 0
+	IsoLevel  float64      // render the surface where the distance is IsoLevel (> 0 is outside the object)
+	Pad       float64      // extra space around the bounding box (model units)
+	Snap      bool         // snap the sampling grid to Anchor
+	Anchor    V3           // a world point on the sampling grid (if Snap)
+	Stats     *RenderStats // if not nil, filled in with the statistics of a render
+	Newton    int          // Newton steps to place each vertex on the surface (0 is linear interpolation)
+	Up        UpAxis       // up axis of the output mesh (default Z_UP)
+	Check     bool         // check for features too thin for the cell size before rendering to a file
+	Decimate  int          // reduce the mesh to about this many triangles (see DecimateMesh), 0 keeps them all
+	AxisCells V3i          // number of cells per axis, for cells that aren't cubes (grid sampling)
+	AxisSize  V3           // cell size per axis in model units, used instead of AxisCells if > 0
+	Precision int          // decimal places of the numbers in text files (OBJ, PLY), 0 writes them with %g
+}
+
+// UpAxis is the up axis of an output mesh.
+type UpAxis int
+
+const (
+	Z_UP UpAxis = iota // as modelled, the usual for slicers and CAD
+	Y_UP               // model +Z is output as +Y (and +Y as -Z), the usual for Blender and many viewers
+)
+
+// output maps a model point (or normal) to the output axes. Y_UP is a
+// rotation about the X axis, so the winding of the triangles is kept.
+func (a UpAxis) output(v V3) V3 {
+	if a == Y_UP {
+		return V3{v.X, v.Z, -v.Y}
+	}
+	return v
+}
+
+// RenderQuality is a preset for the render settings, see RenderQualityParms.
+type RenderQuality int
+
+const (
+	QUALITY_DRAFT  RenderQuality = iota // quick previews
+	QUALITY_NORMAL                      // the defaults, good for most prints
+	QUALITY_FINE                        // smoother curves and surfaces
+	QUALITY_ULTRA                       // final renders of small detailed parts
+)
+
+var renderQualities = [...]struct {
+	cells    int     // MeshCells
+	newton   int     // Newton
+	flatness float64 // RenderQualityFlatness
+}{
+	QUALITY_DRAFT:  {50, 0, 0.1},
+	QUALITY_NORMAL: {100, 0, 0.02},
+	QUALITY_FINE:   {200, 1, 0.01},
+	QUALITY_ULTRA:  {400, 2, 0.002},
+}
+
+// RenderQualityParms returns the render parameters (the resolution and the
+// Newton steps) of a quality preset, so the settings don't have to be tuned
+// one by one. Any setting can still be overridden by changing the returned
+// parameters. The render welds vertices exactly, so there's no welding
+// tolerance to set. Polygon simplification is in model units, so it isn't
+// part of the presets.
+func RenderQualityParms(q RenderQuality) *RenderParms {
+	if q < QUALITY_DRAFT || q > QUALITY_ULTRA {
+		panic("bad render quality")
+	}
+	x := renderQualities[q]
+	return &RenderParms{MeshCells: x.cells, Newton: x.newton}
+}
+
+// RenderQualityFlatness returns the bezier flatness of a quality preset.
+// The curves are sampled when the model is built, so pass it to
+// Bezier.SetFlatness, or set BezierFlatness (for all curves and text)
+// before building the model.
+func RenderQualityFlatness(q RenderQuality) float64 {
+	if q < QUALITY_DRAFT || q > QUALITY_ULTRA {
+		panic("bad render quality")
+	}
+	return renderQualities[q].flatness
+}
+
+// RenderStats are the statistics of a render, see RenderParms.Stats.
+type RenderStats struct {
+	Triangles   int           // number of triangles
+	Vertices    int           // number of distinct vertices
+	Evaluations int           // number of SDF3 evaluations
+	EmptyCubes  int           // number of octree cubes skipped as empty
+	Time        time.Duration // wall-clock time of the render
+}
+
+func (r RenderStats) String() string {
+	return fmt.Sprintf("%d triangles, %d vertices, %d evaluations, %d empty cubes, %v",
+		r.Triangles, r.Vertices, r.Evaluations, r.EmptyCubes, r.Time)
+}
+
+// FEATURE_CELLS is the wall thickness (in cells) below which a feature is
+// reported as thin by CheckFeatures.
+const FEATURE_CELLS = 2.0
+
+// FeatureReport is the result of CheckFeatures.
+type FeatureReport struct {
+	CellSize   float64 // marching cubes cell size
+	MinFeature float64 // thinnest wall found (+Inf if none)
+	At         V3      // surface point of the thinnest wall
+	Thin       int     // number of surface samples on walls thinner than FEATURE_CELLS cells
+	Samples    int     // number of surface samples
+}
+
+// Warning returns a warning about the thin features, or "" if there are none.
+func (r *FeatureReport) Warning() string {
+	if r.Thin == 0 {
+		return ""
+	}
+	return fmt.Sprintf("warning: %d of %d surface samples are on walls thinner than %d cells, the thinnest is %g at %v (cell size %g), use a cell size of %g or less\n",
+		r.Thin, r.Samples, int(FEATURE_CELLS), r.MinFeature, r.At, r.CellSize, r.MinFeature/FEATURE_CELLS)
+}
+
+// CheckFeatures checks an SDF3 for features that are too thin to render
+// with the cell size. Walls thinner than a cell can vanish from the mesh,
+// walls of a few cells are distorted. The wall thicknesses are estimated as
+// by MinWallThickness3D, on a grid with the cell size, so this takes about as
+// long as a grid render. Features much thinner than a cell may be missed.
+func (k *RenderParms) CheckFeatures(s SDF3) *FeatureReport {
+	resolution := k.resolution(s)
+	r := FeatureReport{CellSize: resolution, MinFeature: math.Inf(1)}
+	cells := s.BoundingBox().Size().DivScalar(resolution).Ceil().ToV3i()
+	wallSamples3(s, cells, func(p V3, t float64) {
+		r.Samples++
+		if t < FEATURE_CELLS*resolution {
+			r.Thin++
+		}
+		if t < r.MinFeature {
+			r.MinFeature = t
+			r.At = p
+		}
+	})
+	return &r
+}
+
+// checkFeatures prints the thin features warning if Check is set.
+func (k *RenderParms) checkFeatures(s SDF3) {
+	if k.Check {
+		fmt.Print(k.CheckFeatures(s).Warning())
+	}
+}
+
+// axisCells returns the cells per axis and the region sampled by the grid
+// for a render with cells that aren't cubes, ok is false if the cells are
+// cubes. With AxisSize the region is a whole number of cells, so the cells
+// are exactly the size asked for.
+func (k *RenderParms) axisCells(s SDF3) (cells V3i, bb Box3, ok bool) {
+	bb = k.bbox(s).ScaleAboutCenter(1.01)
+	if k.AxisSize.X > 0 && k.AxisSize.Y > 0 && k.AxisSize.Z > 0 {
+		cells = bb.Size().Div(k.AxisSize).Ceil().ToV3i()
+		return cells, NewBox3(bb.Center(), cells.ToV3().Mul(k.AxisSize)), true
+	}
+	if k.AxisCells[0] > 0 && k.AxisCells[1] > 0 && k.AxisCells[2] > 0 {
+		return k.AxisCells, bb, true
+	}
+	return V3i{}, bb, false
+}
+
+// resolution returns the marching cubes cell size for an SDF3.
+// For cells that aren't cubes it's the smallest side of a cell.
+func (k *RenderParms) resolution(s SDF3) float64 {
+	if cells, bb, ok := k.axisCells(s); ok {
+		return bb.Size().Div(cells.ToV3()).MinComponent()
+	}
+	if k.CellSize > 0 {
+		return k.CellSize
+	}
+	return k.bbox(s).Size().MaxComponent() / float64(k.MeshCells)
+}
+
+// bbox returns the region containing the surface to be rendered.
+// The Pad is for SDF3s with bounding boxes that don't quite contain the
+// surface (e.g. a smooth union that bulges), which would otherwise be
+// clipped leaving holes in the mesh. The bounding box is always scaled up
+// by 1% for the rendering, Pad adds to that.
+func (k *RenderParms) bbox(s SDF3) Box3 {
+	bb := s.BoundingBox()
+	pad := k.Pad
+	if k.IsoLevel > 0 {
+		// the surface is outside the bounding box of the object
+		pad += k.IsoLevel
+	}
+	if pad > 0 {
+		bb = bb.Expand(pad)
+	}
+	return bb
+}
+
+// grid returns the region sampled by marching cubes. The grid origin is
+// grid.Min. Normally the grid is anchored to the bounding box of the SDF3,
+// so it moves with the bounding box and the cell size. With Snap the grid
+// lines are on Anchor + k * resolution / 2 (the octree samples at half the
+// cell size), so renders at different cell sizes with the same anchor share
+// the grid lines that coincide, e.g. when one cell size is a power of 2
+// times the other. This doesn't make the meshes the same, the vertices
+// between shared grid lines are still different.
+func (k *RenderParms) grid(s SDF3) Box3 {
+	// Scale the bounding box about the center to make sure the boundaries
+	// aren't on the object surface.
+	bb := k.bbox(s).ScaleAboutCenter(1.01)
+	if !k.Snap {
+		return bb
+	}
+	inc := 0.5 * k.resolution(s)
+	min := bb.Min.Sub(k.Anchor).DivScalar(inc).Floor().MulScalar(inc).Add(k.Anchor)
+	max := bb.Max.Sub(k.Anchor).DivScalar(inc).Ceil().MulScalar(inc).Add(k.Anchor)
+	return Box3{min, max}
+}
+
+// RenderMesh renders an SDF3 as a triangle mesh (octree sampling).
+// The octree needs cubic cells, so with AxisCells or AxisSize the mesh is
+// rendered on a grid with the cells asked for, e.g. coarse along the length
+// of a tall thin part and fine across it. The vertices are interpolated
+// along the cell edges and the normals (see RenderOBJ) come from the SDF3,
+// so neither depends on the shape of the cells. The triangles are in octree
+// traversal order, so rendering the same SDF3 with the same parameters
+// always gives the same mesh. If Stats is set it's filled in with the
+// statistics of the render. The mesh is output with the Up axis.
+func (k *RenderParms) RenderMesh(s SDF3) *Mesh {
+	m := k.renderMesh(s)
+	if k.Up != Z_UP {
+		for _, t := range m.Triangles {
+			for i := range t.V {
+				t.V[i] = k.Up.output(t.V[i])
+			}
+		}
+	}
+	return m
+}
+
+// renderMesh renders an SDF3 as a triangle mesh in the model axes.
+func (k *RenderParms) renderMesh(s SDF3) *Mesh {
+	start := time.Now()
+	// collect the triangles from the marching cubes output
+	output := make(chan *Triangle3)
+	done := make(chan []*Triangle3)
+	go func() {
+		var mesh []*Triangle3
+		for t := range output {
+			mesh = append(mesh, t)
+		}
+		done <- mesh
+	}()
+	// run marching cubes to generate the triangle mesh
+	var evals, empty int
+	if cells, bb, ok := k.axisCells(s); ok {
+		interp := mc_Newton(s, k.Newton)
+		gridCells3(s, bb, cells, func(c *Cell3) {
+			for _, t := range mc_ToTriangles(c.Corner, c.Value, k.IsoLevel, interp) {
+				output <- t
+			}
+		})
+		evals = (cells[0] + 1) * (cells[1] + 1) * (cells[2] + 1)
+	} else {
+		evals, empty = marchingCubesOctree(s, k.grid(s), k.resolution(s), k.IsoLevel, k.Newton, output)
+	}
+	close(output)
+	m := NewMesh(<-done)
+	if k.Decimate > 0 {
+		m = m.Decimate(k.Decimate)
+	}
+	if k.Stats != nil {
+		*k.Stats = RenderStats{
+			Triangles:   len(m.Triangles),
+			Vertices:    len(newMeshIndex(m.Triangles).v),
+			Evaluations: evals,
+			EmptyCubes:  empty,
+			Time:        time.Since(start),
+		}
+	}
+	return m
+}
+
+// RenderSTL renders an SDF3 as an STL file (octree sampling).
+func (k *RenderParms) RenderSTL(s SDF3, path string) {
+	resolution := k.resolution(s)
+	cells := k.cellCounts(s)
+	fmt.Printf("rendering %s (%dx%dx%d, resolution %.2f)\n", path, cells[0], cells[1], cells[2], resolution)
+	k.checkFeatures(s)
+	m := k.RenderMesh(s)
+	if err := m.SaveSTL(path); err != nil {
+		fmt.Printf("%s", err)
+	}
+}
+
+// RenderOBJ renders an SDF3 as an OBJ file with vertex normals (octree sampling).
+func (k *RenderParms) RenderOBJ(s SDF3, path string) {
+	resolution := k.resolution(s)
+	cells := k.cellCounts(s)
+	fmt.Printf("rendering %s (%dx%dx%d, resolution %.2f)\n", path, cells[0], cells[1], cells[2], resolution)
+	k.checkFeatures(s)
+	// the normals are worked out in the model axes
+	m := k.renderMesh(s)
+	if err := saveOBJ(path, m.Triangles, s, k.Up, k.Precision); err != nil {
+		fmt.Printf("%s", err)
+	}
+}
+
+// RenderPLY renders an SDF3 as a PLY file with vertex colors (octree sampling).
+// The mesh is in the model axes.
+func (k *RenderParms) RenderPLY(s SDF3, path string) {
+	resolution := k.resolution(s)
+	cells := k.cellCounts(s)
+	fmt.Printf("rendering %s (%dx%dx%d, resolution %.2f)\n", path, cells[0], cells[1], cells[2], resolution)
+	k.checkFeatures(s)
+	m := k.renderMesh(s)
+	if err := savePLY(path, m.Triangles, s, k.Precision); err != nil {
+		fmt.Printf("%s", err)
+	}
+}
+
+// cellCounts returns the number of cells per axis for a render.
+func (k *RenderParms) cellCounts(s SDF3) V3i {
+	if cells, _, ok := k.axisCells(s); ok {
+		return cells
+	}
+	return cellCounts3(k.bbox(s), k.resolution(s))
+}
+
+// cellCounts3 returns the number of cells per axis for a bounding box and cell size.
+func cellCounts3(bb Box3, resolution float64) V3i {
+	return bb.Size().DivScalar(resolution).Round().ToV3i()
+}
+
+//-----------------------------------------------------------------------------
+
+// RenderMesh renders an SDF3 as a triangle mesh (octree sampling).
+func RenderMesh(
+	s SDF3, //sdf3 to render
+	mesh_cells int, //number of cells on the longest axis. e.g 200
+) *Mesh {
+	k := RenderParms{MeshCells: mesh_cells}
+	return k.RenderMesh(s)
+}
+
 // Render an SDF3 as an STL file (octree sampling)
 func RenderSTL(
 	s SDF3, //sdf3 to render
 	mesh_cells int, //number of cells on the longest axis. e.g 200
 	path string, //path to filename
 ) {
+	k := RenderParms{MeshCells: mesh_cells}
+	k.RenderSTL(s, path)
+}
 
-	// work out the sampling resolution to use
-	bb_size := s.BoundingBox().Size()
-	resolution := bb_size.MaxComponent() / float64(mesh_cells)
-	cells := bb_size.DivScalar(resolution).ToV3i()
+// RenderSTLBySize renders an SDF3 as an STL file with a given cell size (octree sampling).
+// The cell size is in model units, so the dimensional resolution of the
+// output doesn't depend on the size of the part.
+func RenderSTLBySize(
+	s SDF3, //sdf3 to render
+	cellSize float64, //size of the marching cubes cells, e.g 0.1mm
+	path string, //path to filename
+) {
+	k := RenderParms{CellSize: cellSize}
+	k.RenderSTL(s, path)
+}
 
-	fmt.Printf("rendering %s (%dx%dx%d, resolution %.2f)\n", path, cells[0], cells[1], cells[2], resolution)
+// RenderSTLIso renders the iso surface of an SDF3 as an STL file (octree sampling).
+// The surface is where the distance is iso. An iso > 0 gives an outward
+// offset of the object surface, < 0 an inward offset.
+func RenderSTLIso(
+	s SDF3, //sdf3 to render
+	mesh_cells int, //number of cells on the longest axis. e.g 200
+	iso float64, //iso level of the rendered surface
+	path string, //path to filename
+) {
+	k := RenderParms{MeshCells: mesh_cells, IsoLevel: iso}
+	k.RenderSTL(s, path)
+}
+
+// RenderAssemblyMesh renders each part of an assembly as a separate mesh
+// (octree sampling). The parts are meshed independently, so parts that do
+// not touch don't need to be unioned. All parts use the same cell size.
+func RenderAssemblyMesh(
+	parts []SDF3, //parts to render
+	resolution float64, //size of the marching cubes cells, e.g 0.1mm
+) []*Mesh {
+	k := RenderParms{CellSize: resolution}
+	meshes := make([]*Mesh, len(parts))
+	for i, s := range parts {
+		meshes[i] = k.RenderMesh(s)
+	}
+	return meshes
+}
+
+// RenderAssemblySTL renders the parts of an assembly as one STL file (octree sampling).
+// Each part is meshed separately (see RenderAssemblyMesh) and the triangles
+// are concatenated. Use RenderAssemblyMesh and SaveSTL for a file per part.
+func RenderAssemblySTL(
+	parts []SDF3, //parts to render
+	resolution float64, //size of the marching cubes cells, e.g 0.1mm
+	path string, //path to filename
+) {
+	fmt.Printf("rendering %s (%d parts, resolution %.2f)\n", path, len(parts), resolution)
+	var mesh []*Triangle3
+	for _, m := range RenderAssemblyMesh(parts, resolution) {
+		mesh = append(mesh, m.Triangles...)
+	}
+	if err := SaveSTL(path, mesh); err != nil {
+		fmt.Printf("%s", err)
+	}
+}
+
+// RenderSweep renders a parametric model across a range of parameter values
+// (octree sampling), e.g. to print several versions with different wall
+// thicknesses. The model for value i is gen(values[i]), it's written to the
+// STL file fmt.Sprintf(namePattern, i), e.g. with the pattern "wall_%02d.stl".
+// With parallel set the models are generated and rendered concurrently (one
+// per CPU), gen must then be safe to call from concurrent goroutines.
+func RenderSweep(
+	gen func(p float64) SDF3, //generator for the model with parameter p
+	values []float64, //parameter values
+	resolution float64, //size of the marching cubes cells, e.g 0.1mm
+	namePattern string, //path pattern for the file names
+	parallel bool, //render the models concurrently
+) {
+	render := func(i int) {
+		path := fmt.Sprintf(namePattern, i)
+		fmt.Printf("rendering %s (value %g, resolution %.2f)\n", path, values[i], resolution)
+		k := RenderParms{CellSize: resolution}
+		if err := k.RenderMesh(gen(values[i])).SaveSTL(path); err != nil {
+			fmt.Printf("%s", err)
+		}
+	}
+	if !parallel {
+		for i := range values {
+			render(i)
+		}
+		return
+	}
+	var wg sync.WaitGroup
+	sem := make(chan bool, runtime.NumCPU())
+	for i := range values {
+		wg.Add(1)
+		sem <- true
+		go func(i int) {
+			defer wg.Done()
+			render(i)
+			<-sem
+		}(i)
+	}
+	wg.Wait()
+}
+
+// Render an SDF3 as an STL file.
+func RenderSTL_Slow(
+	s SDF3, //sdf3 to render
+	mesh_cells int, //number of cells on the longest axis. e.g 200
+	path string, //path to filename
+) {
+	// work out the region we will sample
+	bb0 := s.BoundingBox()
+	mesh_inc := bb0.Size().MaxComponent() / float64(mesh_cells)
+	bb := sampleBox3(bb0, mesh_inc)
+	cells := bb.Size().DivScalar(mesh_inc).ToV3i()
+
+	fmt.Printf("rendering %s (%dx%dx%d)\n", path, cells[0], cells[1], cells[2])
+
+	// run marching cubes to generate the triangle mesh
+	m := NewMesh(MarchingCubes(s, bb, mesh_inc))
+	err := m.SaveSTL(path)
+	if err != nil {
+		fmt.Printf("%s", err)
+	}
+}
+
+// RenderSTLStream renders an SDF3 as an STL file (grid sampling).
+// The mesh is the same as RenderSTL_Slow, but the triangles are written to
+// the file as they are generated, so the memory used is bounded for huge
+// meshes. The triangle count in the header is written at the end.
+func RenderSTLStream(
+	s SDF3, //sdf3 to render
+	mesh_cells int, //number of cells on the longest axis. e.g 200
+	path string, //path to filename
+) {
+	// work out the region we will sample
+	bb0 := s.BoundingBox()
+	mesh_inc := bb0.Size().MaxComponent() / float64(mesh_cells)
+	bb := sampleBox3(bb0, mesh_inc)
+	cells := bb.Size().DivScalar(mesh_inc).ToV3i()
+
+	fmt.Printf("rendering %s (%dx%dx%d)\n", path, cells[0], cells[1], cells[2])
 
 	// write the triangles to an STL file
 	var wg sync.WaitGroup
@@ -41,7 +525,9 @@ func RenderSTL(
 	}
 
 	// run marching cubes to generate the triangle mesh
-	marchingCubesOctree(s, resolution, output)
+	marchingCubesGrid(s, bb, mesh_inc, func(t *Triangle3) {
+		output <- t
+	})
 
 	// stop the STL writer reading on the channel
 	close(output)
@@ -49,30 +535,43 @@ func RenderSTL(
 	wg.Wait()
 }
 
-// Render an SDF3 as an STL file.
-func RenderSTL_Slow(
+// RenderSTLTiled renders an SDF3 as an STL file a tile at a time (grid sampling).
+// The sampling grid is split into tiles and the triangles are written to
+// the file as each tile is meshed, so only the distances for one tile are
+// held in memory. Adjacent tiles share the samples on their common faces,
+// so the mesh is watertight and is the same as the mesh for a single tile
+// (the triangle order is different).
+func RenderSTLTiled(
 	s SDF3, //sdf3 to render
-	mesh_cells int, //number of cells on the longest axis. e.g 200
+	resolution float64, //size of the marching cubes cells, e.g 0.1mm
+	tiles V3i, //number of tiles on each axis
 	path string, //path to filename
 ) {
-	// work out the region we will sample
-	bb0 := s.BoundingBox()
-	bb0_size := bb0.Size()
-	mesh_inc := bb0_size.MaxComponent() / float64(mesh_cells)
-	bb1_size := bb0_size.DivScalar(mesh_inc)
-	bb1_size = bb1_size.Ceil().AddScalar(1)
-	cells := bb1_size.ToV3i()
-	bb1_size = bb1_size.MulScalar(mesh_inc)
-	bb := NewBox3(bb0.Center(), bb1_size)
+	if tiles[0] < 1 || tiles[1] < 1 || tiles[2] < 1 {
+		panic("tiles < 1")
+	}
+	bb := sampleBox3(s.BoundingBox(), resolution)
+	cells := bb.Size().DivScalar(resolution).ToV3i()
 
-	fmt.Printf("rendering %s (%dx%dx%d)\n", path, cells[0], cells[1], cells[2])
+	fmt.Printf("rendering %s (%dx%dx%d, %dx%dx%d tiles)\n", path, cells[0], cells[1], cells[2], tiles[0], tiles[1], tiles[2])
 
-	// run marching cubes to generate the triangle mesh
-	m := MarchingCubes(s, bb, mesh_inc)
-	err := SaveSTL(path, m)
+	// write the triangles to an STL file
+	var wg sync.WaitGroup
+	output, err := WriteSTL(&wg, path)
 	if err != nil {
 		fmt.Printf("%s", err)
+		return
 	}
+
+	// run marching cubes to generate the triangle mesh
+	marchingCubesTiled(s, bb, resolution, tiles, func(t *Triangle3) {
+		output <- t
+	})
+
+	// stop the STL writer reading on the channel
+	close(output)
+	// wait for the file write to complete
+	wg.Wait()
 }
 
 //-----------------------------------------------------------------------------
@@ -0,0 +1,158 @@
+//-----------------------------------------------------------------------------
+/*
+
+OpenSCAD Export
+
+The operator tree of an SDF3 is written as OpenSCAD code, so a model can be
+edited downstream. The primitives (spheres, boxes, cylinders, cones), the
+booleans and the rigid transforms are written as their OpenSCAD equivalents.
+Rounded primitives are the minkowski sum of the inset primitive and a sphere,
+which is exactly how their distance is defined.
+
+Other nodes (e.g. warps, extrusions of SDF2s, user defined SDF3s) have no
+OpenSCAD equivalent, so a comment naming the node is written in their place.
+Smooth blends are written as the plain boolean, with a comment.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+//-----------------------------------------------------------------------------
+
+type scadWriter struct {
+	w        *bufio.Writer
+	depth    int
+	decimals int // decimal places of the numbers (see ftoa)
+}
+
+// ftoa returns a number as OpenSCAD code.
+func (x *scadWriter) ftoa(v float64) string {
+	return ftoa(v, x.decimals)
+}
+
+// line writes an indented line of OpenSCAD code.
+func (x *scadWriter) line(format string, a ...interface{}) {
+	x.w.WriteString(strings.Repeat("  ", x.depth))
+	fmt.Fprintf(x.w, format, a...)
+	x.w.WriteString("\n")
+}
+
+// block writes an OpenSCAD operator with the SDF3s it applies to.
+func (x *scadWriter) block(op string, sdf ...SDF3) {
+	x.line("%s {", op)
+	x.depth++
+	for _, s := range sdf {
+		x.node(s)
+	}
+	x.depth--
+	x.line("}")
+}
+
+// rounded writes a primitive rounded by r.
+func (x *scadWriter) rounded(primitive string, r float64) {
+	if r == 0 {
+		x.line("%s;", primitive)
+		return
+	}
+	x.line("minkowski() {")
+	x.depth++
+	x.line("%s;", primitive)
+	x.line("sphere(r = %s);", x.ftoa(r))
+	x.depth--
+	x.line("}")
+}
+
+// isFunc returns true if two functions are the same function.
+func isFunc(a, b interface{}) bool {
+	return reflect.ValueOf(a).Pointer() == reflect.ValueOf(b).Pointer()
+}
+
+// node writes the OpenSCAD code for an SDF3.
+func (x *scadWriter) node(sdf SDF3) {
+	switch s := sdf.(type) {
+	case *SphereSDF3:
+		x.line("sphere(r = %s);", x.ftoa(s.radius))
+	case *BoxSDF3:
+		x.rounded(fmt.Sprintf("cube(%s, center = true)", x.v3(s.size.MulScalar(2))), s.round)
+	case *CylinderSDF3:
+		x.rounded(fmt.Sprintf("cylinder(h = %s, r = %s, center = true)", x.ftoa(2*s.height), x.ftoa(s.radius)), s.round)
+	case *ConeSDF3:
+		x.rounded(fmt.Sprintf("cylinder(h = %s, r1 = %s, r2 = %s, center = true)", x.ftoa(2*s.height), x.ftoa(s.r0), x.ftoa(s.r1)), s.round)
+	case *UnionSDF3:
+		if !isFunc(s.min, Min) {
+			x.line("// smooth blend written as a union")
+		}
+		x.block("union()", s.sdf...)
+	case *UnionManySDF3:
+		x.block("union()", s.sdf...)
+	case *DifferenceSDF3:
+		if !isFunc(s.max, Max) {
+			x.line("// smooth blend written as a difference")
+		}
+		x.block("difference()", s.s0, s.s1)
+	case *IntersectionSDF3:
+		if !isFunc(s.max, Max) {
+			x.line("// smooth blend written as an intersection")
+		}
+		x.block("intersection()", s.s0, s.s1)
+	case *TransformSDF3:
+		m := s.matrix
+		if m.x00 == 1 && m.x01 == 0 && m.x02 == 0 &&
+			m.x10 == 0 && m.x11 == 1 && m.x12 == 0 &&
+			m.x20 == 0 && m.x21 == 0 && m.x22 == 1 {
+			x.block(fmt.Sprintf("translate(%s)", x.v3(V3{m.x03, m.x13, m.x23})), s.sdf)
+		} else {
+			row := func(a, b, c, d float64) string {
+				return fmt.Sprintf("[%s, %s, %s, %s]", x.ftoa(a), x.ftoa(b), x.ftoa(c), x.ftoa(d))
+			}
+			x.block(fmt.Sprintf("multmatrix([%s, %s, %s, %s])",
+				row(m.x00, m.x01, m.x02, m.x03),
+				row(m.x10, m.x11, m.x12, m.x13),
+				row(m.x20, m.x21, m.x22, m.x23),
+				row(m.x30, m.x31, m.x32, m.x33)), s.sdf)
+		}
+	case *ScaleUniformSDF3:
+		x.block(fmt.Sprintf("scale(%s)", x.ftoa(s.k)), s.sdf)
+	case *ColorSDF3:
+		x.block(fmt.Sprintf("color([%s, %s, %s])", x.ftoa(float64(s.rgb[0])/255), x.ftoa(float64(s.rgb[1])/255), x.ftoa(float64(s.rgb[2])/255)), s.sdf)
+	case *MaterialSDF3:
+		x.line("// material %d", s.id)
+		x.node(s.sdf)
+	case *CountedSDF3:
+		x.node(s.sdf)
+	case nil:
+		x.line("// nil")
+	default:
+		bb := sdf.BoundingBox()
+		x.line("// unsupported %T, bounding box %s to %s", sdf, x.v3(bb.Min), x.v3(bb.Max))
+	}
+}
+
+// v3 returns an OpenSCAD vector.
+func (x *scadWriter) v3(v V3) string {
+	return fmt.Sprintf("[%s, %s, %s]", x.ftoa(v.X), x.ftoa(v.Y), x.ftoa(v.Z))
+}
+
+//-----------------------------------------------------------------------------
+
+// ExportSCAD writes the operator tree of an SDF3 as OpenSCAD code.
+// Nodes with no OpenSCAD equivalent are written as comments, see above.
+// The numbers are rounded to decimals decimal places with trailing zeros
+// dropped, decimals <= 0 writes them with %g.
+func ExportSCAD(s SDF3, w io.Writer, decimals int) error {
+	x := scadWriter{w: bufio.NewWriter(w), decimals: decimals}
+	x.line("// generated by sdfx")
+	x.node(s)
+	return x.w.Flush()
+}
+
+//-----------------------------------------------------------------------------
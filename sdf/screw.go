@@ -164,6 +164,64 @@ func (t *ThreadParameters) Hex_Height() float64 {
 	return hex_h
 }
 
+//-----------------------------------------------------------------------------
+// Fastener Database - lookup standard nut and cap screw sizes by thread
+
+type FastenerParameters struct {
+	Name           string  // name of the thread, e.g. "M3"
+	Clearance      float64 // clearance hole diameter (ISO 273 medium)
+	Nut_Flat2Flat  float64 // hex nut flat to flat distance (ISO 4032)
+	Nut_Height     float64 // hex nut height (ISO 4032)
+	CapHead_Dia    float64 // socket cap screw head diameter (ISO 4762)
+	CapHead_Height float64 // socket cap screw head height (ISO 4762)
+}
+
+type FastenerDatabase map[string]*FastenerParameters
+
+var fastener_db = Init_FastenerLookup()
+
+// Add adds a fastener size to the fastener database.
+func (m FastenerDatabase) Add(
+	name string, // thread name
+	clearance float64, // clearance hole diameter
+	nut_f2f float64, // nut flat to flat distance
+	nut_h float64, // nut height
+	cap_dia float64, // cap head diameter
+	cap_h float64, // cap head height
+) {
+	m[name] = &FastenerParameters{name, clearance, nut_f2f, nut_h, cap_dia, cap_h}
+}
+
+func Init_FastenerLookup() FastenerDatabase {
+	m := make(FastenerDatabase)
+	m.Add("M3", 3.4, 5.5, 2.4, 5.5, 3)
+	m.Add("M4", 4.5, 7, 3.2, 7, 4)
+	m.Add("M5", 5.5, 8, 4.7, 8.5, 5)
+	m.Add("M6", 6.6, 10, 5.2, 10, 6)
+	m.Add("M8", 9, 13, 6.8, 13, 8)
+	m.Add("M10", 11, 16, 8.4, 16, 10)
+	return m
+}
+
+// lookup the parameters for a fastener by thread name
+func FastenerLookup(name string) *FastenerParameters {
+	f, ok := fastener_db[name]
+	if !ok {
+		panic("fastener name not found")
+	}
+	return f
+}
+
+// Return the pocket for a captive hex nut (see HexNutPocket3D).
+func (f *FastenerParameters) NutPocket3D() SDF3 {
+	return HexNutPocket3D(f.Nut_Flat2Flat, f.Nut_Height)
+}
+
+// Return the recess for a socket cap screw (see SocketCapHeadPocket3D).
+func (f *FastenerParameters) CapHeadPocket3D() SDF3 {
+	return SocketCapHeadPocket3D(f.Clearance, f.CapHead_Dia, f.CapHead_Height)
+}
+
 //-----------------------------------------------------------------------------
 // Thread Profiles
 
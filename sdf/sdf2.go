@@ -11,10 +11,23 @@ package sdf
 import (
 	"errors"
 	"math"
+	"sync"
 )
 
 //-----------------------------------------------------------------------------
 
+// SDF2 is the interface for a 2D signed distance function.
+//
+// Evaluate returns the signed distance from p to the surface, < 0 inside
+// and > 0 outside. It need not be exact, but it must not change faster than
+// the distance itself (i.e. be 1-Lipschitz), since renderers and ray
+// marchers use it as a bound on how far they can step. Evaluate is called
+// concurrently from multiple goroutines, so it must not modify shared state.
+//
+// BoundingBox returns a box that contains the whole surface. Renderers only
+// sample within it.
+//
+// See MustBeSDF2 and ValidateSDF2 for checking user defined SDF2s.
 type SDF2 interface {
 	Evaluate(p V2) float64
 	BoundingBox() Box2
@@ -23,12 +36,16 @@ type SDF2 interface {
 //-----------------------------------------------------------------------------
 // SDF2 Evaluation Caching
 
+// SDF2Cache may be shared by concurrent evaluations, so access is locked.
 type SDF2Cache struct {
 	cache map[V2]float64
 	hits  uint
+	lock  sync.Mutex
 }
 
 func (c *SDF2Cache) lookup(p V2) (float64, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
 	if d, ok := c.cache[p]; ok {
 		c.hits += 1
 		return d, nil
@@ -37,7 +54,9 @@ func (c *SDF2Cache) lookup(p V2) (float64, error) {
 }
 
 func (c *SDF2Cache) store(p V2, d float64) {
+	c.lock.Lock()
 	c.cache[p] = d
+	c.lock.Unlock()
 }
 
 func cache_setup() *SDF2Cache {
@@ -49,6 +68,8 @@ func cache_setup() *SDF2Cache {
 //-----------------------------------------------------------------------------
 // Basic SDF Functions
 
+// Return the exact signed distance to a box of half size s centered on the
+// origin, length(max(q, 0)) + min(max(q.x, q.y), 0) where q = |p| - s.
 func sdf_box2d(p, s V2) float64 {
 	p = p.Abs()
 	d := p.Sub(s)
@@ -62,6 +83,14 @@ func sdf_box2d(p, s V2) float64 {
 	return d.X
 }
 
+// Normal2 returns the unit normal of an SDF2 at p.
+// The gradient is estimated by central differences with step size eps.
+func Normal2(s SDF2, p V2, eps float64) V2 {
+	dx := s.Evaluate(p.Add(V2{eps, 0})) - s.Evaluate(p.Sub(V2{eps, 0}))
+	dy := s.Evaluate(p.Add(V2{0, eps})) - s.Evaluate(p.Sub(V2{0, eps}))
+	return V2{dx, dy}.Normalize()
+}
+
 //-----------------------------------------------------------------------------
 // 2D Circle
 
@@ -86,6 +115,168 @@ func (s *CircleSDF2) BoundingBox() Box2 {
 	return s.bb
 }
 
+//-----------------------------------------------------------------------------
+// 2D Annulus
+
+type AnnulusSDF2 struct {
+	r     float64 // mid radius
+	width float64 // half width
+	bb    Box2
+}
+
+// Annulus2D returns an SDF2 for a ring between an inner and outer radius.
+// The distance is exact, unlike the difference of two circles.
+func Annulus2D(innerR, outerR float64) SDF2 {
+	if innerR < 0 {
+		panic("innerR < 0")
+	}
+	if outerR <= innerR {
+		panic("outerR <= innerR")
+	}
+	s := AnnulusSDF2{}
+	s.r = 0.5 * (innerR + outerR)
+	s.width = 0.5 * (outerR - innerR)
+	d := V2{outerR, outerR}
+	s.bb = Box2{d.Negate(), d}
+	return &s
+}
+
+// Return the minimum distance to the annulus.
+func (s *AnnulusSDF2) Evaluate(p V2) float64 {
+	return Abs(p.Length()-s.r) - s.width
+}
+
+// Return the bounding box.
+func (s *AnnulusSDF2) BoundingBox() Box2 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+// 2D Sector
+
+type SectorSDF2 struct {
+	radius   float64
+	half     float64 // half angle
+	cos, sin float64 // of the mid angle
+	end      V2      // end of the arc, with the sector rotated onto the +X axis
+	bb       Box2
+}
+
+// Sector2D returns an SDF2 for a sector (pie slice) of a disk, from
+// startAngle counterclockwise to endAngle (radians). The sector can be
+// reflex (more than PI), endAngle - startAngle = 2*PI is the whole disk.
+// The distance is exact.
+func Sector2D(radius, startAngle, endAngle float64) SDF2 {
+	if radius <= 0 {
+		panic("radius <= 0")
+	}
+	span := endAngle - startAngle
+	if span <= 0 || span > 2*PI {
+		panic("endAngle - startAngle not in (0, 2*PI]")
+	}
+	s := SectorSDF2{}
+	s.radius = radius
+	s.half = 0.5 * span
+	mid := startAngle + s.half
+	s.cos, s.sin = math.Cos(mid), math.Sin(mid)
+	s.end = PolarToXY(radius, s.half)
+	// the center, the ends of the arc and the axis points on the arc
+	points := V2Set{{0, 0}, PolarToXY(radius, startAngle), PolarToXY(radius, endAngle)}
+	for k := math.Ceil(startAngle / (0.5 * PI)); k*0.5*PI <= endAngle; k++ {
+		points = append(points, PolarToXY(radius, k*0.5*PI))
+	}
+	s.bb = Box2{points.Min(), points.Max()}
+	return &s
+}
+
+// Return the minimum distance to the sector.
+func (s *SectorSDF2) Evaluate(p V2) float64 {
+	// rotate the sector onto the +X axis, it's symmetric about the axis
+	q := V2{p.X*s.cos + p.Y*s.sin, Abs(p.Y*s.cos - p.X*s.sin)}
+	l := q.Length()
+	in := math.Atan2(q.Y, q.X) <= s.half
+	// distance to the arc
+	var d float64
+	if in {
+		d = Abs(l - s.radius)
+	} else {
+		d = q.Sub(s.end).Length()
+	}
+	// distance to the straight sides (none for a whole disk)
+	if s.half < PI {
+		side, _ := DistanceToSegment2D(q, V2{0, 0}, s.end)
+		d = Min(d, side)
+	}
+	if in && l < s.radius {
+		return -d
+	}
+	return d
+}
+
+// Return the bounding box.
+func (s *SectorSDF2) BoundingBox() Box2 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+// 2D Disk Segment
+
+type DiskSegmentSDF2 struct {
+	radius float64
+	chord  float64 // distance from the center to the chord
+	end    V2      // +X end of the chord
+	bb     Box2
+}
+
+// DiskSegment2D returns an SDF2 for a segment of a disk, the part of the
+// disk above (+Y) a chord at y = chord. A chord of 0 is a half disk, a
+// negative chord keeps more than half the disk. The distance is exact.
+func DiskSegment2D(radius, chord float64) SDF2 {
+	if radius <= 0 {
+		panic("radius <= 0")
+	}
+	if Abs(chord) >= radius {
+		panic("abs(chord) >= radius")
+	}
+	s := DiskSegmentSDF2{}
+	s.radius = radius
+	s.chord = chord
+	s.end = V2{math.Sqrt(radius*radius - chord*chord), chord}
+	w := s.end.X
+	if chord < 0 {
+		// the widest part of the disk is kept
+		w = radius
+	}
+	s.bb = Box2{V2{-w, chord}, V2{w, radius}}
+	return &s
+}
+
+// Return the minimum distance to the disk segment.
+func (s *DiskSegmentSDF2) Evaluate(p V2) float64 {
+	// symmetric about the Y axis
+	q := V2{Abs(p.X), p.Y}
+	l := q.Length()
+	// distance to the arc, the nearest point on the circle is radial
+	var d float64
+	if l == 0 || q.Y*s.radius >= s.chord*l {
+		d = Abs(l - s.radius)
+	} else {
+		d = q.Sub(s.end).Length()
+	}
+	// distance to the chord
+	chord, _ := DistanceToSegment2D(q, V2{0, s.chord}, s.end)
+	d = Min(d, chord)
+	if l < s.radius && q.Y > s.chord {
+		return -d
+	}
+	return d
+}
+
+// Return the bounding box.
+func (s *DiskSegmentSDF2) BoundingBox() Box2 {
+	return s.bb
+}
+
 //-----------------------------------------------------------------------------
 
 // Multiple Circles
@@ -179,6 +370,176 @@ func (s *LineSDF2) BoundingBox() Box2 {
 	return s.bb
 }
 
+// Stadium2D returns a rectangle with semicircular ends (a slot).
+// The stadium is along the x-axis, length is the overall length.
+func Stadium2D(length, radius float64) SDF2 {
+	if radius <= 0 {
+		panic("radius <= 0")
+	}
+	if length < 2*radius {
+		panic("length < 2 * radius")
+	}
+	return Line2D(length-2*radius, radius)
+}
+
+//-----------------------------------------------------------------------------
+// 2D Regular Polygon
+
+type RegularPolygonSDF2 struct {
+	n       int     // number of sides
+	theta   float64 // angle of each sector
+	apothem float64 // center to edge distance
+	half    float64 // half side length
+	bb      Box2
+}
+
+// RegularPolygon2D returns a regular polygon with n sides and a
+// circumradius r (see Nagon). There is a vertex on the +x axis.
+func RegularPolygon2D(n int, r float64) SDF2 {
+	if n < 3 {
+		panic("n < 3")
+	}
+	if r <= 0 {
+		panic("r <= 0")
+	}
+	s := RegularPolygonSDF2{}
+	s.n = n
+	s.theta = TAU / float64(n)
+	s.apothem = r * math.Cos(PI/float64(n))
+	s.half = r * math.Sin(PI/float64(n))
+	v := Nagon(n, r)
+	s.bb = Box2{v.Min(), v.Max()}
+	return &s
+}
+
+// Return the minimum distance to the regular polygon.
+func (s *RegularPolygonSDF2) Evaluate(p V2) float64 {
+	// fold the point into the sector of one edge, the edge normal is the +x axis
+	phi := math.Atan2(p.Y, p.X) - s.theta/2
+	phi -= s.theta * math.Round(phi/s.theta)
+	l := p.Length()
+	q := V2{l * math.Cos(phi), Abs(l * math.Sin(phi))}
+	if q.Y <= s.half {
+		return q.X - s.apothem
+	}
+	// outside, nearest to the vertex
+	return q.Sub(V2{s.apothem, s.half}).Length()
+}
+
+// Return the bounding box.
+func (s *RegularPolygonSDF2) BoundingBox() Box2 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+// 2D Star
+
+type StarSDF2 struct {
+	theta float64 // angle from a point to the adjacent inner vertex
+	a, b  V2      // point and inner vertex of one edge
+	ab    V2      // unit edge vector
+	l     float64 // edge length
+	bb    Box2
+}
+
+// Star2D returns a star with n points at radius outerR and inner vertices
+// at radius innerR. There is a point on the +x axis.
+func Star2D(points int, outerR, innerR float64) SDF2 {
+	if points < 2 {
+		panic("points < 2")
+	}
+	if innerR <= 0 || outerR <= innerR {
+		panic("need 0 < innerR < outerR")
+	}
+	s := StarSDF2{}
+	s.theta = PI / float64(points)
+	s.a = V2{outerR, 0}
+	s.b = PolarToXY(innerR, s.theta)
+	e := s.b.Sub(s.a)
+	s.l = e.Length()
+	s.ab = e.DivScalar(s.l)
+	// the outline and the bounding box
+	v := make(V2Set, 2*points)
+	for i := range v {
+		r := outerR
+		if i%2 == 1 {
+			r = innerR
+		}
+		v[i] = PolarToXY(r, float64(i)*s.theta)
+	}
+	s.bb = Box2{v.Min(), v.Max()}
+	return &s
+}
+
+// Return the minimum distance to the star.
+func (s *StarSDF2) Evaluate(p V2) float64 {
+	// fold the point into the half sector between a point and an inner vertex
+	sector := 2 * s.theta
+	phi := math.Atan2(p.Y, p.X)
+	phi = Abs(phi - sector*math.Round(phi/sector))
+	p = PolarToXY(p.Length(), phi)
+	// distance to the edge
+	ap := p.Sub(s.a)
+	t := Clamp(ap.Dot(s.ab), 0, s.l)
+	d := ap.Sub(s.ab.MulScalar(t)).Length()
+	// inside is on the same side of the edge as the origin
+	if s.ab.X*ap.Y-s.ab.Y*ap.X > 0 {
+		return -d
+	}
+	return d
+}
+
+// Return the bounding box.
+func (s *StarSDF2) BoundingBox() Box2 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+// 2D Cross
+
+type CrossSDF2 struct {
+	b  V2 // half arm length, half thickness
+	bb Box2
+}
+
+// Cross2D returns a plus shaped cross with arms along the x and y axes.
+// arm is the overall length of each bar and thickness its width.
+func Cross2D(arm, thickness float64) SDF2 {
+	if thickness <= 0 || arm < thickness {
+		panic("need 0 < thickness <= arm")
+	}
+	s := CrossSDF2{}
+	s.b = V2{arm / 2, thickness / 2}
+	s.bb = Box2{V2{-s.b.X, -s.b.X}, V2{s.b.X, s.b.X}}
+	return &s
+}
+
+// Return the minimum distance to the cross.
+func (s *CrossSDF2) Evaluate(p V2) float64 {
+	// fold the point into the x >= y >= 0 octant
+	p = p.Abs()
+	if p.Y > p.X {
+		p = V2{p.Y, p.X}
+	}
+	q := p.Sub(s.b)
+	k := Max(q.X, q.Y)
+	w := q
+	if k <= 0 {
+		// inside, the nearest edge may be on the other arm
+		w = V2{s.b.Y - p.X, -k}
+	}
+	d := w.Max(V2{0, 0}).Length()
+	if k < 0 {
+		return -d
+	}
+	return d
+}
+
+// Return the bounding box.
+func (s *CrossSDF2) BoundingBox() Box2 {
+	return s.bb
+}
+
 //-----------------------------------------------------------------------------
 
 type OffsetSDF2 struct {
@@ -193,8 +554,7 @@ func Offset2D(sdf SDF2, offset float64) SDF2 {
 	s.sdf = sdf
 	s.offset = offset
 	// work out the bounding box
-	bb := sdf.BoundingBox()
-	s.bb = NewBox2(bb.Center(), bb.Size().AddScalar(2*offset))
+	s.bb = sdf.BoundingBox().Expand(offset)
 	return &s
 }
 
@@ -206,6 +566,35 @@ func (s *OffsetSDF2) BoundingBox() Box2 {
 	return s.bb
 }
 
+//-----------------------------------------------------------------------------
+
+type ShellSDF2 struct {
+	sdf   SDF2
+	delta float64 // half shell thickness
+	bb    Box2
+}
+
+// Shell an SDF2 - a shell of the given thickness centered on the surface.
+func Shell2D(sdf SDF2, thickness float64) SDF2 {
+	if thickness <= 0 {
+		panic("thickness <= 0")
+	}
+	s := ShellSDF2{}
+	s.sdf = sdf
+	s.delta = 0.5 * thickness
+	// work out the bounding box
+	s.bb = sdf.BoundingBox().Expand(s.delta)
+	return &s
+}
+
+func (s *ShellSDF2) Evaluate(p V2) float64 {
+	return Abs(s.sdf.Evaluate(p)) - s.delta
+}
+
+func (s *ShellSDF2) BoundingBox() Box2 {
+	return s.bb
+}
+
 //-----------------------------------------------------------------------------
 // Cut an SDF2 along a line
 
@@ -237,6 +626,87 @@ func (s *CutSDF2) BoundingBox() Box2 {
 	return s.bb
 }
 
+//-----------------------------------------------------------------------------
+// 2D Archimedean Spiral
+
+type SpiralSDF2 struct {
+	r0, r1    float64 // start and end radius
+	theta     float64 // total angle of the spiral
+	b         float64 // radius increase per radian
+	thickness float64 // half arm thickness
+	bb        Box2
+}
+
+// Spiral2D returns a thick Archimedean spiral, r = startR + b * theta.
+// The spiral starts on the x-axis and turns counter-clockwise. The ends of
+// the arm are rounded. If the arm spacing is less than the thickness the
+// adjacent arms merge.
+func Spiral2D(startR, endR, turns, thickness float64) SDF2 {
+	if startR < 0 || endR < 0 {
+		panic("radius < 0")
+	}
+	if turns <= 0 {
+		panic("turns <= 0")
+	}
+	if thickness <= 0 {
+		panic("thickness <= 0")
+	}
+	s := SpiralSDF2{}
+	s.r0 = startR
+	s.r1 = endR
+	s.theta = TAU * turns
+	s.b = (endR - startR) / s.theta
+	s.thickness = 0.5 * thickness
+	r := Max(startR, endR) + s.thickness
+	s.bb = Box2{V2{-r, -r}, V2{r, r}}
+	return &s
+}
+
+// Return the minimum distance to the spiral.
+func (s *SpiralSDF2) Evaluate(p V2) float64 {
+	rho := p.Length()
+	phi := math.Atan2(p.Y, p.X)
+	if phi < 0 {
+		phi += TAU
+	}
+	// distance to the arm ends
+	d := p.Sub(PolarToXY(s.r0, 0)).Length()
+	d = Min(d, p.Sub(PolarToXY(s.r1, s.theta)).Length())
+	// unwrap the angle to the nearest arms
+	k := 0.0
+	if s.b != 0 {
+		k = math.Round((rho - s.r0 - s.b*phi) / (TAU * s.b))
+	}
+	// outside the outer turn or inside the inner turn the nearest arms are
+	// the first and last turns
+	k = Max(Min(k, math.Floor((s.theta-phi)/TAU)), 0)
+	for i := k - 1; i <= k+1; i++ {
+		// start from the arm end for a partial turn
+		theta := Clamp(phi+TAU*i, 0, s.theta)
+		// refine the angle to the nearest point on the arm (newton's method)
+		for j := 0; j < 16; j++ {
+			sin, cos := math.Sincos(theta)
+			r := s.r0 + s.b*theta
+			c := V2{r * cos, r * sin}.Sub(p)
+			dc := V2{s.b*cos - r*sin, s.b*sin + r*cos}
+			ddc := V2{-2*s.b*sin - r*cos, 2*s.b*cos - r*sin}
+			dg := dc.Dot(dc) + c.Dot(ddc)
+			if dg <= 0 {
+				break
+			}
+			// limit the step so it doesn't jump to another local minimum
+			theta = Clamp(theta-Clamp(c.Dot(dc)/dg, -0.5, 0.5), 0, s.theta)
+		}
+		d = Min(d, p.Sub(PolarToXY(s.r0+s.b*theta, theta)).Length())
+	}
+	return d - s.thickness
+}
+
+// Return the bounding box.
+func (s *SpiralSDF2) BoundingBox() Box2 {
+	return s.bb
+}
+
 //-----------------------------------------------------------------------------
 // 2D Polygon
 
@@ -244,9 +714,15 @@ type PolySDF2 struct {
 	vertex []V2      // vertices
 	vector []V2      // unit line vectors
 	length []float64 // line lengths
+	invert bool      // solid outside (preserved clockwise winding)
 	bb     Box2      // bounding box
 }
 
+// Polygon2D returns an SDF2 for a closed polygon.
+// The vertices may be clockwise or counter-clockwise, inside points are
+// found by winding number, so the distance field (and the normals of any
+// mesh rendered from it) are the same for either order. To use the winding
+// to mark a contour as a hole see SetPreserveWinding.
 func Polygon2D(vertex []V2) SDF2 {
 	s := PolySDF2{}
 
@@ -282,6 +758,32 @@ func Polygon2D(vertex []V2) SDF2 {
 }
 
 func (s *PolySDF2) Evaluate(p V2) float64 {
+	d, wn := s.distance(p)
+	if (wn != 0) != s.invert {
+		// p is inside the polygon
+		return -d
+	}
+	return d
+}
+
+// SetPreserveWinding keeps the winding of the vertices. A counter-clockwise
+// polygon is solid inside, a clockwise polygon is a hole: it's solid outside
+// and empty inside, so the maximum of its distance and the distance to an
+// outer contour (e.g. Intersect3D of the extrusions) cuts the hole.
+// The winding is found from the signed area of the polygon.
+func (s *PolySDF2) SetPreserveWinding(preserve bool) {
+	s.invert = preserve && PolygonArea2D(s.vertex) < 0
+}
+
+// distance returns the (unsigned) distance from p to the polygon and the
+// winding number of the polygon about p, > 0 for counter-clockwise.
+func (s *PolySDF2) distance(p V2) (float64, int) {
+	return s.distanceSkip(p, nil)
+}
+
+// distanceSkip is distance, but the line segments with skip[i] set are not
+// part of the surface. They still count for the winding number.
+func (s *PolySDF2) distanceSkip(p V2, skip []bool) (float64, int) {
 	dd := math.MaxFloat64 // d^2 to polygon (>0)
 	wn := 0               // winding number (inside/outside)
 
@@ -300,7 +802,9 @@ func (s *PolySDF2) Evaluate(p V2) float64 {
 		dn := pa.Dot(V2{s.vector[i].Y, -s.vector[i].X}) // normal distance from p to line
 
 		// Distance to line segment
-		if t < 0 {
+		if skip != nil && skip[i] {
+			// not a surface
+		} else if t < 0 {
 			dd = Min(dd, pa.Length2()) // distance to vertex[0] of line
 		} else if t > s.length[i] {
 			dd = Min(dd, pb.Length2()) // distance to vertex[1] of line
@@ -326,12 +830,7 @@ func (s *PolySDF2) Evaluate(p V2) float64 {
 	}
 
 	// normalise d*d to d
-	d := math.Sqrt(dd)
-	if wn != 0 {
-		// p is inside the polygon
-		return -d
-	}
-	return d
+	return math.Sqrt(dd), wn
 }
 
 func (s *PolySDF2) BoundingBox() Box2 {
@@ -342,6 +841,82 @@ func (s *PolySDF2) Vertices() []V2 {
 	return s.vertex
 }
 
+// Polygon2DWithHoles returns an SDF2 for a closed polygon with holes, e.g.
+// the contours of a washer or a window frame. The fill rule decides what's
+// inside, as for the paths of fonts and SVG art. With FILL_EVEN_ODD the outer
+// contour and the hole contours may each be clockwise or counter-clockwise,
+// so contours from DXF files can be used as is. With FILL_NONZERO a hole has
+// the opposite winding to the outer contour, a contour with the same winding
+// is solid. The rules also differ where contours overlap, e.g. two
+// overlapping counter-clockwise loops are solid where they overlap with
+// FILL_NONZERO and empty with FILL_EVEN_ODD. The distance is to the nearest
+// contour.
+func Polygon2DWithHoles(outer []V2, holes [][]V2, rule FillRule) SDF2 {
+	if len(outer) < 3 {
+		return nil
+	}
+	return polygon_fill(append([][]V2{outer}, holes...), rule)
+}
+
+// FillRule selects the inside of a set of contours (see Polygon2DWithHoles).
+type FillRule int
+
+const (
+	FILL_NONZERO  FillRule = iota // inside where the winding number isn't 0
+	FILL_EVEN_ODD                 // inside where a ray crosses an odd number of contours
+)
+
+// PolyFillSDF2 is a set of contours with a fill rule.
+type PolyFillSDF2 struct {
+	poly []*PolySDF2
+	rule FillRule
+	bb   Box2
+}
+
+// Return an SDF2 for a set of closed contours with a fill rule.
+func polygon_fill(contours [][]V2, rule FillRule) SDF2 {
+	s := PolyFillSDF2{}
+	s.rule = rule
+	for _, v := range contours {
+		if p := Polygon2D(v); p != nil {
+			s.poly = append(s.poly, p.(*PolySDF2))
+		}
+	}
+	if len(s.poly) == 0 {
+		return nil
+	}
+	s.bb = s.poly[0].bb
+	for _, p := range s.poly[1:] {
+		s.bb = s.bb.Extend(p.bb)
+	}
+	return &s
+}
+
+// Return the minimum distance to the contours.
+func (s *PolyFillSDF2) Evaluate(p V2) float64 {
+	dmin := math.MaxFloat64
+	wn := 0
+	for _, x := range s.poly {
+		d, w := x.distance(p)
+		dmin = Min(dmin, d)
+		wn += w
+	}
+	inside := wn != 0
+	if s.rule == FILL_EVEN_ODD {
+		// the parity of the winding number is the parity of the crossings
+		inside = wn%2 != 0
+	}
+	if inside {
+		return -dmin
+	}
+	return dmin
+}
+
+// Return the bounding box.
+func (s *PolyFillSDF2) BoundingBox() Box2 {
+	return s.bb
+}
+
 //-----------------------------------------------------------------------------
 // Transform SDF2 (rotation and translation are distance preserving)
 
@@ -379,7 +954,7 @@ type ScaleUniformSDF2 struct {
 	bb       Box2
 }
 
-// ScaleUniform2D scales an SDF2 by k on all axes.
+// ScaleUniform2D scales an SDF2 by k on all axes, about the origin.
 // Distance is correct with scaling.
 func ScaleUniform2D(sdf SDF2, k float64) SDF2 {
 	m := Scale2d(V2{k, k})
@@ -402,19 +977,42 @@ func (s *ScaleUniformSDF2) BoundingBox() Box2 {
 
 //-----------------------------------------------------------------------------
 
-// Center the origin of an SDF2 on it's bounding box.
+// Center2D moves an SDF2 so the center of it's bounding box is at the origin.
+// It's the bounding box center, not the centroid (center of area), so the
+// bounding box of the result is symmetric about the origin. For most shapes
+// they differ, e.g. for an L shape or a text with descenders.
 func Center2D(s SDF2) SDF2 {
 	ofs := s.BoundingBox().Center().Neg()
 	return Transform2D(s, Translate2d(ofs))
 }
 
-// Center and scale an SDF2 on it's bounding box.
+// CenterAndScale2D centers an SDF2 on it's bounding box (see Center2D) and
+// then scales it by k about the origin (see ScaleUniform2D). The bounding
+// box of the result is symmetric about the origin.
 func CenterAndScale2D(s SDF2, k float64) SDF2 {
 	ofs := s.BoundingBox().Center().Neg()
 	s = Transform2D(s, Translate2d(ofs))
 	return ScaleUniform2D(s, k)
 }
 
+// FitToBox2D scales an SDF2 to fit within a target box and centers it on the
+// target box. With keepAspect the scale is uniform (the largest that fits)
+// and the distance is correct. Otherwise each axis is scaled to fill the
+// target box and distance is *not* preserved.
+func FitToBox2D(s SDF2, target Box2, keepAspect bool) SDF2 {
+	size := target.Size()
+	if size.X <= 0 || size.Y <= 0 {
+		panic("target size <= 0")
+	}
+	k := size.Div(s.BoundingBox().Size())
+	if keepAspect {
+		s = CenterAndScale2D(s, k.MinComponent())
+	} else {
+		s = Transform2D(Center2D(s), Scale2d(k))
+	}
+	return Transform2D(s, Translate2d(target.Center()))
+}
+
 //-----------------------------------------------------------------------------
 // ArraySDF2: Create an X by Y array of a given SDF2
 // num = the array size
@@ -565,6 +1163,29 @@ func (s *RotateCopySDF2) BoundingBox() Box2 {
 	return s.bb
 }
 
+// PolarFold2D folds a point into the first of n angular sectors about the
+// origin, i.e. it's rotated by a multiple of 2pi/n so its angle is in
+// [0, 2pi/n).
+func PolarFold2D(p V2, n int) V2 {
+	if n <= 0 {
+		panic("n <= 0")
+	}
+	theta := TAU / float64(n)
+	phi := math.Atan2(p.Y, p.X)
+	phi -= theta * math.Floor(phi/theta)
+	return PolarToXY(p.Length(), phi)
+}
+
+// PolarRepeat2D repeats an SDF2 n times about the origin.
+// It's the same as RotateCopy2D, the SDF2 should be within the sector
+// -pi/n to pi/n, e.g. a shape on the +x axis.
+func PolarRepeat2D(sdf SDF2, n int) SDF2 {
+	if n <= 0 {
+		panic("n <= 0")
+	}
+	return RotateCopy2D(sdf, n)
+}
+
 //-----------------------------------------------------------------------------
 
 type SliceSDF2 struct {
@@ -721,6 +1342,76 @@ func (s *UnionSDF2) BoundingBox() Box2 {
 	return s.bb
 }
 
+//-----------------------------------------------------------------------------
+// Union of many SDF2s
+
+type UnionManySDF2 struct {
+	sdf  []SDF2
+	bvh  *bvh2Node // tree of the objects that can be skipped by bounding box
+	rest []SDF2    // objects evaluated for every point
+	bb   Box2
+}
+
+// UnionMany2D returns the union of many SDF2 objects.
+// It's the SDF2 version of UnionMany3D: the objects are stored in a flat list
+// (nested UnionMany2D objects are flattened), the bounding boxes are worked
+// out once, and evaluation uses a tree of the bounding boxes to skip exact
+// objects (e.g. circles, polygons and glyphs) that can't be the closest.
+// There's no blending, the distance is the minimum over all the objects.
+func UnionMany2D(sdf ...SDF2) SDF2 {
+	s := UnionManySDF2{}
+	for _, x := range sdf {
+		switch t := x.(type) {
+		case nil:
+			// strip out any nils
+		case *UnionManySDF2:
+			s.sdf = append(s.sdf, t.sdf...)
+		default:
+			s.sdf = append(s.sdf, x)
+		}
+	}
+	if len(s.sdf) == 0 {
+		return nil
+	}
+	if len(s.sdf) == 1 {
+		// only one sdf - not really a union
+		return s.sdf[0]
+	}
+	var bounded []SDF2
+	for _, x := range s.sdf {
+		if boundedSDF2(x) {
+			bounded = append(bounded, x)
+		} else {
+			s.rest = append(s.rest, x)
+		}
+	}
+	if bounded != nil {
+		s.bvh = newBVH2(bounded)
+	}
+	s.bb = s.sdf[0].BoundingBox()
+	for _, x := range s.sdf[1:] {
+		s.bb = s.bb.Extend(x.BoundingBox())
+	}
+	return &s
+}
+
+// Return the minimum distance to the SDF2 union.
+func (s *UnionManySDF2) Evaluate(p V2) float64 {
+	d := math.MaxFloat64
+	for _, x := range s.rest {
+		d = Min(d, x.Evaluate(p))
+	}
+	if s.bvh != nil {
+		d = s.bvh.evaluate(p, d)
+	}
+	return d
+}
+
+// Return the bounding box.
+func (s *UnionManySDF2) BoundingBox() Box2 {
+	return s.bb
+}
+
 //-----------------------------------------------------------------------------
 
 // Difference of SDF2s
@@ -764,6 +1455,42 @@ func (s *DifferenceSDF2) BoundingBox() Box2 {
 
 //-----------------------------------------------------------------------------
 
+// Exclusive or of SDF2s
+type XorSDF2 struct {
+	s0 SDF2
+	s1 SDF2
+	bb Box2
+}
+
+// Xor2D returns the region that is in exactly one of s0 or s1.
+func Xor2D(s0, s1 SDF2) SDF2 {
+	if s0 == nil {
+		return s1
+	}
+	if s1 == nil {
+		return s0
+	}
+	s := XorSDF2{}
+	s.s0 = s0
+	s.s1 = s1
+	s.bb = s0.BoundingBox().Extend(s1.BoundingBox())
+	return &s
+}
+
+// Return the minimum distance to the object.
+func (s *XorSDF2) Evaluate(p V2) float64 {
+	d0 := s.s0.Evaluate(p)
+	d1 := s.s1.Evaluate(p)
+	return Max(Min(d0, d1), -Max(d0, d1))
+}
+
+// Return the bounding box.
+func (s *XorSDF2) BoundingBox() Box2 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+
 // Generate a set of internal mesh points for an SDF2
 func GenerateMesh2D(s SDF2, grid V2i) (V2Set, error) {
 
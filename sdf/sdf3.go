@@ -14,6 +14,20 @@ import (
 
 //-----------------------------------------------------------------------------
 
+// SDF3 is the interface for a 3D signed distance function.
+//
+// Evaluate returns the signed distance from p to the surface, < 0 inside
+// and > 0 outside. It need not be exact, but it must not change faster than
+// the distance itself (i.e. be 1-Lipschitz), since renderers and ray
+// marchers use it as a bound on how far they can step. Evaluate is called
+// concurrently from multiple goroutines, so it must not modify shared state.
+//
+// BoundingBox returns a box that contains the whole surface. Renderers only
+// sample within it. It's called for each node when a model is built, so it
+// should be cheap. The SDF3s in this package work out their box once (at
+// construction) and BoundingBox returns the stored box.
+//
+// See MustBeSDF3 and ValidateSDF3 for checking user defined SDF3s.
 type SDF3 interface {
 	Evaluate(p V3) float64
 	BoundingBox() Box3
@@ -55,20 +69,69 @@ func sdf_box3d(p, s V3) float64 {
 	return d.MaxComponent()
 }
 
+// Normal3 returns the unit normal of an SDF3 at p.
+// The gradient is estimated by central differences with step size eps.
+func Normal3(s SDF3, p V3, eps float64) V3 {
+	dx := s.Evaluate(p.Add(V3{eps, 0, 0})) - s.Evaluate(p.Sub(V3{eps, 0, 0}))
+	dy := s.Evaluate(p.Add(V3{0, eps, 0})) - s.Evaluate(p.Sub(V3{0, eps, 0}))
+	dz := s.Evaluate(p.Add(V3{0, 0, eps})) - s.Evaluate(p.Sub(V3{0, 0, eps}))
+	return V3{dx, dy, dz}.Normalize()
+}
+
+// DistanceToSegment3D returns the distance from a point to the line segment
+// a-b, and the nearest point on the segment.
+func DistanceToSegment3D(p, a, b V3) (float64, V3) {
+	ab := b.Sub(a)
+	l2 := ab.Dot(ab)
+	if l2 == 0 {
+		return p.Sub(a).Length(), a
+	}
+	t := Clamp(p.Sub(a).Dot(ab)/l2, 0, 1)
+	q := a.Add(ab.MulScalar(t))
+	return p.Sub(q).Length(), q
+}
+
 //-----------------------------------------------------------------------------
 
 // Solid of Revolution, SDF2 to SDF3
 type SorSDF3 struct {
 	sdf   SDF2
+	axis  []bool  // polygon profile edges on the axis
 	theta float64 // angle for partial revolutions
 	norm  V2      // pre-calculated normal to theta line
 	bb    Box3
 }
 
 // Return an SDF3 for a solid of revolution.
+// The profile is revolved about the y-axis of the SDF2, which becomes the
+// z-axis of the SDF3. The profile should be in x >= 0. The part of a profile
+// that crosses the axis (x < 0) is ignored, so the solid is that of the
+// profile clipped to x >= 0.
+//
+// A profile with an edge on the axis (e.g. a semicircle for a sphere or a
+// dome) has a zero distance along the axis, inside the solid. The edge isn't
+// a surface of the solid, so for polygon profiles the edges on the axis are
+// left out of the distance, and a cut along the axis (see Cut2D) that keeps
+// x >= 0 is dropped, since the profile at x < 0 is ignored anyway. Otherwise
+// the solid renders the same, but an offset or shell of it would have a
+// hole along the axis through the poles.
 func RevolveTheta3D(sdf SDF2, theta float64) SDF3 {
 	s := SorSDF3{}
+	if c, ok := sdf.(*CutSDF2); ok && c.a.X == 0 && c.n.Equals(V2{-1, 0}, TOLERANCE) {
+		sdf = c.sdf
+	}
 	s.sdf = sdf
+	if p, ok := sdf.(*PolySDF2); ok {
+		s.axis = make([]bool, len(p.vertex)-1)
+		on := false
+		for i := range s.axis {
+			s.axis[i] = Abs(p.vertex[i].X) < TOLERANCE && Abs(p.vertex[i+1].X) < TOLERANCE
+			on = on || s.axis[i]
+		}
+		if !on {
+			s.axis = nil
+		}
+	}
 	// normalize theta
 	s.theta = math.Mod(Abs(theta), TAU)
 	sin := math.Sin(s.theta)
@@ -92,7 +155,8 @@ func RevolveTheta3D(sdf SDF2, theta float64) SDF3 {
 		}
 	}
 	bb := s.sdf.BoundingBox()
-	l := Max(Abs(bb.Min.X), Abs(bb.Max.X))
+	// the profile at x < 0 is not used
+	l := Max(bb.Max.X, 0)
 	vmin := vset.Min().MulScalar(l)
 	vmax := vset.Max().MulScalar(l)
 	s.bb = Box3{V3{vmin.X, vmin.Y, bb.Min.Y}, V3{vmax.X, vmax.Y, bb.Max.Y}}
@@ -100,6 +164,7 @@ func RevolveTheta3D(sdf SDF2, theta float64) SDF3 {
 }
 
 // Return an SDF3 for a solid of revolution.
+// See RevolveTheta3D for the profile requirements.
 func Revolve3D(sdf SDF2) SDF3 {
 	return RevolveTheta3D(sdf, 0)
 }
@@ -107,7 +172,16 @@ func Revolve3D(sdf SDF2) SDF3 {
 // Return the minimum distance to a solid of revolution.
 func (s *SorSDF3) Evaluate(p V3) float64 {
 	x := math.Sqrt(p.X*p.X + p.Y*p.Y)
-	a := s.sdf.Evaluate(V2{x, p.Z})
+	var a float64
+	if s.axis != nil {
+		d, wn := s.sdf.(*PolySDF2).distanceSkip(V2{x, p.Z}, s.axis)
+		a = d
+		if wn != 0 {
+			a = -d
+		}
+	} else {
+		a = s.sdf.Evaluate(V2{x, p.Z})
+	}
 	b := a
 	if s.theta != 0 {
 		// combine two vertical planes to give an intersection wedge
@@ -134,6 +208,7 @@ type ExtrudeSDF3 struct {
 	sdf     SDF2
 	height  float64
 	extrude ExtrudeFunc
+	chamfer float64 // base chamfer
 	bb      Box3
 }
 
@@ -195,7 +270,15 @@ func (s *ExtrudeSDF3) Evaluate(p V3) float64 {
 	// sdf for the extrusion region: z = [-height, height]
 	b := Abs(p.Z) - s.height
 	// return the intersection
-	return Max(a, b)
+	d := Max(a, b)
+	if s.chamfer > 0 {
+		// 45 degree flare from the profile + chamfer at the base to the
+		// profile at chamfer above the base
+		z := p.Z + s.height
+		f := Max((a+z-s.chamfer)*math.Sqrt(0.5), Max(-z, z-s.chamfer))
+		d = Min(d, f)
+	}
+	return d
 }
 
 // Set the evaluation function to control extrusion.
@@ -203,6 +286,25 @@ func (s *ExtrudeSDF3) SetExtrude(extrude ExtrudeFunc) {
 	s.extrude = extrude
 }
 
+// SetBaseChamfer adds an outward 45 degree chamfer of size chamfer to the
+// bottom edge of the extrusion, e.g. for elephant foot compensation or a
+// flare for first layer adhesion on a 3D printer. The bottom of the
+// extrusion is the profile grown by chamfer, the flare ends at chamfer above
+// the bottom and the rest of the extrusion is unchanged. This works for any
+// extrusion of an SDF2, e.g. an extrusion of the SDF2 from TextSDF2.
+func (s *ExtrudeSDF3) SetBaseChamfer(chamfer float64) {
+	if chamfer < 0 {
+		panic("chamfer < 0")
+	}
+	if chamfer > 2*s.height {
+		panic("chamfer > height")
+	}
+	// the flare grows the bounding box
+	g := chamfer - s.chamfer
+	s.bb = Box3{s.bb.Min.Sub(V3{g, g, 0}), s.bb.Max.Add(V3{g, g, 0})}
+	s.chamfer = chamfer
+}
+
 func (s *ExtrudeSDF3) BoundingBox() Box3 {
 	return s.bb
 }
@@ -270,6 +372,219 @@ func (s *ExtrudeRoundedSDF3) BoundingBox() Box3 {
 	return s.bb
 }
 
+//-----------------------------------------------------------------------------
+// Linear extrude an SDF2 with a draft angle.
+// The walls are offset from the SDF2 in proportion to z, so every wall leans
+// by the same angle (unlike ScaleExtrude3D, which scales about the origin).
+
+// Extrude, SDF2 to SDF3 with a draft angle.
+type DraftExtrudeSDF3 struct {
+	sdf    SDF2
+	height float64 // half height
+	tan    float64 // tan(draft)
+	cos    float64 // cos(draft)
+	bb     Box3
+}
+
+// DraftExtrude3D extrudes an SDF2 to height (centered on z = 0) with the
+// walls tapered by a draft angle (radians). The SDF2 is the cross section at
+// z = 0, for draft > 0 the walls lean inwards going up (+z) and outwards going
+// down, for draft < 0 the other way. Features narrower than the inward offset
+// (height/2 * tan(|draft|)) vanish at that end. The distance is exact for
+// straight walls.
+func DraftExtrude3D(sdf SDF2, height, draft float64) SDF3 {
+	if Abs(draft) >= PI/2 {
+		panic("|draft| >= PI/2")
+	}
+	s := DraftExtrudeSDF3{}
+	s.sdf = sdf
+	s.height = height / 2
+	s.tan = math.Tan(draft)
+	s.cos = math.Cos(draft)
+	// work out the bounding box, the wider end sets the size
+	bb := sdf.BoundingBox()
+	k := s.height * Abs(s.tan)
+	s.bb = Box3{V3{bb.Min.X - k, bb.Min.Y - k, -s.height}, V3{bb.Max.X + k, bb.Max.Y + k, s.height}}
+	return &s
+}
+
+// Return the minimum distance to the object.
+func (s *DraftExtrudeSDF3) Evaluate(p V3) float64 {
+	// the walls are planes tilted by the draft angle
+	a := (s.sdf.Evaluate(V2{p.X, p.Y}) + p.Z*s.tan) * s.cos
+	b := Abs(p.Z) - s.height
+	return Max(a, b)
+}
+
+// Return the bounding box.
+func (s *DraftExtrudeSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+// Linear extrude an SDF2 with rounded caps.
+// Unlike ExtrudeRounded3D the outline of the SDF2 is kept, the top and bottom
+// edges are rounded inwards (like a coin).
+
+// Extrude, SDF2 to SDF3 with rounded caps.
+type RoundExtrudeSDF3 struct {
+	sdf    SDF2
+	height float64 // half height
+	round  float64
+	bb     Box3
+}
+
+// RoundExtrude3D extrudes an SDF2 to height (centered on z = 0) with the top
+// and bottom edges rounded by capRadius. A capRadius > height/2 is clamped to
+// height/2, which gives a fully rounded rim. The distance is exact for convex
+// profiles with exact distance functions.
+func RoundExtrude3D(sdf SDF2, height, capRadius float64) SDF3 {
+	if capRadius < 0 {
+		panic("capRadius < 0")
+	}
+	if capRadius == 0 {
+		return Extrude3D(sdf, height)
+	}
+	s := RoundExtrudeSDF3{}
+	s.sdf = sdf
+	s.height = height / 2
+	s.round = Min(capRadius, s.height)
+	// work out the bounding box
+	bb := sdf.BoundingBox()
+	s.bb = Box3{V3{bb.Min.X, bb.Min.Y, -s.height}, V3{bb.Max.X, bb.Max.Y, s.height}}
+	return &s
+}
+
+// Return the minimum distance to the rounded extrusion.
+func (s *RoundExtrudeSDF3) Evaluate(p V3) float64 {
+	// distances to the profile and the top/bottom, both moved in by the rounding
+	a := s.sdf.Evaluate(V2{p.X, p.Y}) + s.round
+	b := Abs(p.Z) - s.height + s.round
+	d := Min(Max(a, b), 0) + V2{Max(a, 0), Max(b, 0)}.Length()
+	return d - s.round
+}
+
+// Return the bounding box.
+func (s *RoundExtrudeSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+// Linear extrude an SDF2 with 45 degree chamfers on the top (and bottom) edges.
+// By default the profile distance is offset directly. With a normal step
+// (see BevelExtrude3D) the top profile is instead offset inwards along its
+// normal as z increases over the chamfer.
+
+// ChamferExtrudeSDF3 is an SDF2 extruded with chamfered edges.
+type ChamferExtrudeSDF3 struct {
+	sdf    SDF2
+	height float64
+	top    float64 // chamfer on the top edge
+	bottom float64 // chamfer on the bottom edge
+	eps    float64 // step size for the profile normal (0 = offset directly)
+	bb     Box3
+}
+
+// profileDepth returns the distance from the boundary to the deepest point
+// of an SDF2, sampled on an n x n grid.
+func profileDepth(sdf SDF2, n int) float64 {
+	bb := sdf.BoundingBox()
+	size := bb.Size()
+	dmin := 0.0
+	for i := 0; i <= n; i++ {
+		for j := 0; j <= n; j++ {
+			p := bb.Min.Add(size.Mul(V2{float64(i), float64(j)}).DivScalar(float64(n)))
+			dmin = Min(dmin, sdf.Evaluate(p))
+		}
+	}
+	return -dmin
+}
+
+func chamferExtrude3D(sdf SDF2, height, top, bottom, eps float64) SDF3 {
+	s := ChamferExtrudeSDF3{}
+	s.sdf = sdf
+	s.height = height / 2
+	s.top = top
+	s.bottom = bottom
+	s.eps = eps
+	// work out the bounding box
+	bb := sdf.BoundingBox()
+	s.bb = Box3{V3{bb.Min.X, bb.Min.Y, -s.height}, V3{bb.Max.X, bb.Max.Y, s.height}}
+	return &s
+}
+
+// clampChamfer limits a chamfer to half the height, and to the depth of the
+// profile, so it can't remove the whole top/bottom face.
+func clampChamfer(sdf SDF2, height, chamfer float64) float64 {
+	if chamfer < 0 {
+		panic("chamfer < 0")
+	}
+	return Min(chamfer, Min(height/2, profileDepth(sdf, 64)))
+}
+
+// ChamferExtrude3D extrudes an SDF2 with a 45 degree chamfer on the top edge.
+// The chamfer is clamped to half the height, and to the depth of the profile.
+func ChamferExtrude3D(sdf SDF2, height, chamfer float64) SDF3 {
+	return chamferExtrude3D(sdf, height, clampChamfer(sdf, height, chamfer), 0, 0)
+}
+
+// DoubleChamferExtrude3D extrudes an SDF2 with a 45 degree chamfer on the top
+// and bottom edges. The chamfer is clamped as for ChamferExtrude3D.
+func DoubleChamferExtrude3D(sdf SDF2, height, chamfer float64) SDF3 {
+	c := clampChamfer(sdf, height, chamfer)
+	return chamferExtrude3D(sdf, height, c, c, 0)
+}
+
+// BevelExtrude3D extrudes an SDF2 with a 45 degree bevel on the top edge.
+// The profile is offset inwards along its normal as z increases over the
+// bevel, so the top face is the profile inset by the bevel distance.
+// eps is the step used to estimate the normal of the profile. It should be
+// smaller than the thinnest feature of the profile.
+func BevelExtrude3D(sdf SDF2, height, bevel, eps float64) SDF3 {
+	if bevel < 0 {
+		panic("bevel < 0")
+	}
+	if bevel > height {
+		panic("bevel > height")
+	}
+	if eps <= 0 {
+		panic("eps <= 0")
+	}
+	return chamferExtrude3D(sdf, height, bevel, 0, eps)
+}
+
+// Return the minimum distance to the chamfered extrusion.
+func (s *ChamferExtrudeSDF3) Evaluate(p V3) float64 {
+	xy := V2{p.X, p.Y}
+	// sdf for the projected 2d surface
+	a := s.sdf.Evaluate(xy)
+	// sdf for the extrusion region: z = [-height, height]
+	b := Abs(p.Z) - s.height
+	d := Max(a, b)
+	// the chamfers are 45 degree cones: distance offset by height
+	if s.top > 0 {
+		z := p.Z - (s.height - s.top)
+		c := a + z
+		if z > 0 && s.eps > 0 {
+			// offset the profile along its normal
+			n := Normal2(s.sdf, xy, s.eps)
+			if !math.IsNaN(n.X) {
+				c = s.sdf.Evaluate(xy.Add(n.MulScalar(z)))
+			}
+		}
+		d = Max(d, c/math.Sqrt2)
+	}
+	if s.bottom > 0 {
+		d = Max(d, (a-p.Z-(s.height-s.bottom))/math.Sqrt2)
+	}
+	return d
+}
+
+// Return the bounding box.
+func (s *ChamferExtrudeSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
 //-----------------------------------------------------------------------------
 // Extrude/Loft (with rounded edges)
 // Blend between sdf0 and sdf1 as we move from bottom to top.
@@ -365,6 +680,47 @@ func (s *BoxSDF3) BoundingBox() Box3 {
 	return s.bb
 }
 
+//-----------------------------------------------------------------------------
+// Box with rounded vertical edges (exact distance field)
+
+type RoundedBoxVertSDF3 struct {
+	size  V2      // half size of the xy box less the rounding
+	h     float64 // half height
+	round float64
+	bb    Box3
+}
+
+// RoundedBoxVert3D returns a box with only its vertical (z axis) edges rounded.
+// The top and bottom faces and their edges are sharp.
+func RoundedBoxVert3D(size V3, round float64) SDF3 {
+	size = size.MulScalar(0.5)
+	if round > Min(size.X, size.Y) {
+		panic("round > min(size.x, size.y) / 2")
+	}
+	s := RoundedBoxVertSDF3{}
+	s.size = V2{size.X, size.Y}.SubScalar(round)
+	s.h = size.Z
+	s.round = round
+	s.bb = Box3{size.Negate(), size}
+	return &s
+}
+
+// Return the minimum distance to the box.
+func (s *RoundedBoxVertSDF3) Evaluate(p V3) float64 {
+	// rounded rectangle in xy, intersected with the z slab
+	a := sdf_box2d(V2{p.X, p.Y}, s.size) - s.round
+	b := Abs(p.Z) - s.h
+	if a > 0 && b > 0 {
+		return math.Sqrt(a*a + b*b)
+	}
+	return Max(a, b)
+}
+
+// Return the bounding box.
+func (s *RoundedBoxVertSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
 //-----------------------------------------------------------------------------
 // Sphere (exact distance field)
 
@@ -405,6 +761,8 @@ type CylinderSDF3 struct {
 }
 
 // Return an SDF3 for a cylinder (rounded edges with round > 0).
+// The distance is exact, it's the distance to a rectangle in the (r, z)
+// plane, so it's right at the rim of the caps too.
 func Cylinder3D(height, radius, round float64) SDF3 {
 	s := CylinderSDF3{}
 	s.height = (height / 2) - round
@@ -431,6 +789,163 @@ func (s *CylinderSDF3) BoundingBox() Box3 {
 	return s.bb
 }
 
+//-----------------------------------------------------------------------------
+// Tube (hollow cylinder)
+
+type TubeSDF3 struct {
+	r     float64 // mid radius of the wall
+	width float64 // half wall thickness
+	h     float64 // half length
+	bb    Box3
+}
+
+// Tube3D returns an SDF3 for a tube (centered on the origin, along the
+// z-axis) with the given inner and outer diameters. The distance is exact,
+// unlike the difference of two cylinders.
+func Tube3D(innerDia, outerDia, length float64) SDF3 {
+	if innerDia < 0 {
+		panic("innerDia < 0")
+	}
+	if outerDia <= innerDia {
+		panic("outerDia <= innerDia")
+	}
+	if length <= 0 {
+		panic("length <= 0")
+	}
+	s := TubeSDF3{}
+	s.r = 0.25 * (innerDia + outerDia)
+	s.width = 0.25 * (outerDia - innerDia)
+	s.h = 0.5 * length
+	d := V3{0.5 * outerDia, 0.5 * outerDia, s.h}
+	s.bb = Box3{d.Negate(), d}
+	return &s
+}
+
+// Return the minimum distance to the tube.
+func (s *TubeSDF3) Evaluate(p V3) float64 {
+	// the wall cross section is a rectangle
+	return sdf_box2d(V2{V2{p.X, p.Y}.Length() - s.r, p.Z}, V2{s.width, s.h})
+}
+
+// Return the bounding box.
+func (s *TubeSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+// Wedge (right triangular prism)
+
+type WedgeSDF3 struct {
+	v  [3]V2 // xz triangle
+	h  float64
+	bb Box3
+}
+
+// Wedge3D returns an SDF3 for a wedge (a ramp or gusset) that fills the
+// lower half (below the diagonal) of a box of the given size, centered on
+// the origin. The right angle is along the -x bottom edge, i.e. the wedge
+// has a bottom face and a -x face, and the slope runs from the top of the
+// -x face down to the +x bottom edge. The distance is exact.
+func Wedge3D(size V3) SDF3 {
+	if size.MinComponent() <= 0 {
+		panic("size <= 0")
+	}
+	s := WedgeSDF3{}
+	x, z := 0.5*size.X, 0.5*size.Z
+	s.v = [3]V2{{-x, -z}, {x, -z}, {-x, z}}
+	s.h = 0.5 * size.Y
+	d := size.MulScalar(0.5)
+	s.bb = Box3{d.Negate(), d}
+	return &s
+}
+
+// Return the minimum distance to the wedge.
+func (s *WedgeSDF3) Evaluate(p V3) float64 {
+	// exact distance to the xz triangle
+	q := V2{p.X, p.Z}
+	d := math.MaxFloat64
+	inside := true
+	for i := range s.v {
+		a, b := s.v[i], s.v[(i+1)%3]
+		x, _ := DistanceToSegment2D(q, a, b)
+		d = Min(d, x)
+		if b.Sub(a).Cross(q.Sub(a)) < 0 {
+			inside = false
+		}
+	}
+	if inside {
+		d = -d
+	}
+	// extruded on the y-axis
+	w := V2{d, Abs(p.Y) - s.h}
+	return Min(Max(w.X, w.Y), 0) + w.MaxScalar(0).Length()
+}
+
+// Return the bounding box.
+func (s *WedgeSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+// Pyramid
+
+type PyramidSDF3 struct {
+	base  V2              // half size of the base
+	h     float64         // half height
+	faces [2]meshTriangle // +x and +y faces
+	n     [2]V3           // +x and +y face normals
+	bb    Box3
+}
+
+// Pyramid3D returns an SDF3 for a pyramid with a rectangular base (size x,
+// y) and the given height. The pyramid is centered on the origin: the base
+// is at z = -height/2 and the apex is at z = height/2. The distance is exact.
+func Pyramid3D(base V2, height float64) SDF3 {
+	if base.X <= 0 || base.Y <= 0 {
+		panic("base <= 0")
+	}
+	if height <= 0 {
+		panic("height <= 0")
+	}
+	s := PyramidSDF3{}
+	s.base = base.MulScalar(0.5)
+	s.h = 0.5 * height
+	bx, by, h := s.base.X, s.base.Y, s.h
+	apex := V3{0, 0, h}
+	s.faces[0].v = [3]V3{{bx, -by, -h}, {bx, by, -h}, apex}
+	s.faces[1].v = [3]V3{{-bx, by, -h}, {bx, by, -h}, apex}
+	s.n[0] = V3{height, 0, bx}.Normalize()
+	s.n[1] = V3{0, height, by}.Normalize()
+	s.bb = Box3{V3{-bx, -by, -h}, V3{bx, by, h}}
+	return &s
+}
+
+// Return the minimum distance to the pyramid.
+func (s *PyramidSDF3) Evaluate(p V3) float64 {
+	// the pyramid is symmetric in x and y
+	p = V3{Abs(p.X), Abs(p.Y), p.Z}
+	// inside a convex solid the distance is to the nearest face plane
+	dx := p.Sub(V3{s.base.X, 0, -s.h}).Dot(s.n[0])
+	dy := p.Sub(V3{0, s.base.Y, -s.h}).Dot(s.n[1])
+	dz := -s.h - p.Z
+	if d := Max(Max(dx, dy), dz); d <= 0 {
+		return d
+	}
+	// outside, the nearest point of the base or the +x/+y faces
+	b := V3{Max(p.X-s.base.X, 0), Max(p.Y-s.base.Y, 0), p.Z + s.h}
+	d := b.Length()
+	for i := range s.faces {
+		q, _ := s.faces[i].closest(p)
+		d = Min(d, p.Sub(q).Length())
+	}
+	return d
+}
+
+// Return the bounding box.
+func (s *PyramidSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
 //-----------------------------------------------------------------------------
 // Cylinders of the same radius and height at various x/y positions
 // (E.g. drilling patterns) are useful enough to warrant their own SDF3 function.
@@ -581,7 +1096,7 @@ type ScaleUniformSDF3 struct {
 	bb       Box3
 }
 
-// ScaleUniform3D scales an SDF3 by k on all axes.
+// ScaleUniform3D scales an SDF3 by k on all axes, about the origin.
 // Distance is correct with scaling.
 func ScaleUniform3D(sdf SDF3, k float64) SDF3 {
 	m := Scale3d(V3{k, k, k})
@@ -602,6 +1117,186 @@ func (s *ScaleUniformSDF3) BoundingBox() Box3 {
 	return s.bb
 }
 
+//-----------------------------------------------------------------------------
+
+// Center3D moves an SDF3 so the center of it's bounding box is at the origin.
+// It's the bounding box center, not the centroid (center of volume), so the
+// bounding box of the result is symmetric about the origin.
+func Center3D(s SDF3) SDF3 {
+	ofs := s.BoundingBox().Center().Neg()
+	return Transform3D(s, Translate3d(ofs))
+}
+
+// CenterAndScale3D centers an SDF3 on it's bounding box (see Center3D) and
+// then scales it by k about the origin (see ScaleUniform3D). The bounding
+// box of the result is symmetric about the origin.
+func CenterAndScale3D(s SDF3, k float64) SDF3 {
+	return ScaleUniform3D(Center3D(s), k)
+}
+
+// FitToBox3D scales an SDF3 to fit within a target box and centers it on the
+// target box. With keepAspect the scale is uniform (the largest that fits)
+// and the distance is correct. Otherwise each axis is scaled to fill the
+// target box and distance is *not* preserved.
+func FitToBox3D(s SDF3, target Box3, keepAspect bool) SDF3 {
+	size := target.Size()
+	if size.X <= 0 || size.Y <= 0 || size.Z <= 0 {
+		panic("target size <= 0")
+	}
+	k := size.Div(s.BoundingBox().Size())
+	if keepAspect {
+		s = CenterAndScale3D(s, k.MinComponent())
+	} else {
+		s = Transform3D(Center3D(s), Scale3d(k))
+	}
+	return Transform3D(s, Translate3d(target.Center()))
+}
+
+//-----------------------------------------------------------------------------
+// Affine Warp of SDF3s (shear, non-uniform scaling - distance is a bound)
+
+type AffineWarpSDF3 struct {
+	sdf     SDF3
+	inverse M44
+	k       float64 // distance scaling
+	bb      Box3
+}
+
+// AffineWarp3D applies a general affine transformation matrix to an SDF3.
+// The distance is scaled by 1/|A| (A is the 3x3 part of the inverse matrix,
+// |A| is the Frobenius norm) which is a lower bound on the smallest singular
+// value of the matrix. The result is a valid bound on the distance, but it's
+// loose by up to the spread of the singular values (times sqrt(3) at most),
+// e.g. a scaling of 1 and 4 on different axes underestimates the distance
+// along the long axis by a factor of >= 4. Meshing is correct at the usual
+// cell sizes, the octree just prunes fewer empty cubes. Ray marching takes
+// proportionally smaller steps.
+func AffineWarp3D(sdf SDF3, m M44) SDF3 {
+	if m.Determinant() == 0 {
+		panic("singular matrix")
+	}
+	s := AffineWarpSDF3{}
+	s.sdf = sdf
+	s.inverse = m.Inverse()
+	a := s.inverse
+	f := math.Sqrt(a.x00*a.x00 + a.x01*a.x01 + a.x02*a.x02 +
+		a.x10*a.x10 + a.x11*a.x11 + a.x12*a.x12 +
+		a.x20*a.x20 + a.x21*a.x21 + a.x22*a.x22)
+	s.k = 1 / f
+	s.bb = m.MulBox(sdf.BoundingBox())
+	return &s
+}
+
+// Return the minimum distance (bound) to the warped SDF3.
+func (s *AffineWarpSDF3) Evaluate(p V3) float64 {
+	return s.sdf.Evaluate(s.inverse.MulPosition(p)) * s.k
+}
+
+// Return the bounding box.
+func (s *AffineWarpSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+// Scaled distance SDF3s
+
+type ScaleDistanceSDF3 struct {
+	sdf SDF3
+	k   float64
+	bb  Box3
+}
+
+// ScaleDistance3D multiplies the distance of an SDF3 by a factor. The object
+// is the same, only the distance changes. This is the standard remedy for
+// warps (e.g. twist, taper, affine) that overestimate the distance, so the
+// octree renderer skips cubes that contain thin parts of the object. A safety
+// factor < 1 that's the inverse of the stretching of the warp restores a
+// conservative bound, at the cost of slower rendering.
+func ScaleDistance3D(sdf SDF3, factor float64) SDF3 {
+	if factor <= 0 {
+		panic("factor <= 0")
+	}
+	s := ScaleDistanceSDF3{}
+	s.sdf = sdf
+	s.k = factor
+	s.bb = sdf.BoundingBox()
+	return &s
+}
+
+// Return the scaled distance to the SDF3.
+func (s *ScaleDistanceSDF3) Evaluate(p V3) float64 {
+	return s.sdf.Evaluate(p) * s.k
+}
+
+// Return the bounding box.
+func (s *ScaleDistanceSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+// Offset SDF3
+
+type OffsetSDF3 struct {
+	sdf    SDF3
+	offset float64
+	bb     Box3
+}
+
+// Offset3D offsets the surface of an SDF3 - it subtracts a constant from
+// the distance function. An offset > 0 grows the object (rounding the
+// edges), < 0 shrinks it. The bounding box is changed by the offset.
+func Offset3D(sdf SDF3, offset float64) SDF3 {
+	s := OffsetSDF3{}
+	s.sdf = sdf
+	s.offset = offset
+	// work out the bounding box
+	s.bb = sdf.BoundingBox().Expand(offset)
+	return &s
+}
+
+// Return the minimum distance to the offset SDF3.
+func (s *OffsetSDF3) Evaluate(p V3) float64 {
+	return s.sdf.Evaluate(p) - s.offset
+}
+
+// Return the bounding box.
+func (s *OffsetSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+// Shell SDF3
+
+type ShellSDF3 struct {
+	sdf   SDF3
+	delta float64 // half shell thickness
+	bb    Box3
+}
+
+// Shell3D returns a shell of the given thickness centered on the surface of
+// an SDF3. The bounding box grows by half the thickness.
+func Shell3D(sdf SDF3, thickness float64) SDF3 {
+	if thickness <= 0 {
+		panic("thickness <= 0")
+	}
+	s := ShellSDF3{}
+	s.sdf = sdf
+	s.delta = 0.5 * thickness
+	// work out the bounding box
+	s.bb = sdf.BoundingBox().Expand(s.delta)
+	return &s
+}
+
+// Return the minimum distance to the shell.
+func (s *ShellSDF3) Evaluate(p V3) float64 {
+	return Abs(s.sdf.Evaluate(p)) - s.delta
+}
+
+// Return the bounding box.
+func (s *ShellSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
 //-----------------------------------------------------------------------------
 // Union of SDF3s
 
@@ -664,6 +1359,98 @@ func (s *UnionSDF3) BoundingBox() Box3 {
 	return s.bb
 }
 
+// UnionSmooth3D returns the smooth union of two SDF3 objects.
+// k is the size of the blend, see SmoothMin for the kinds of blend.
+func UnionSmooth3D(k float64, kind SmoothKind, a, b SDF3) SDF3 {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	s := UnionSDF3{}
+	s.sdf = []SDF3{a, b}
+	s.min = SmoothMin(k, kind)
+	// the blend can move the surface outside the bounding box
+	bb := a.BoundingBox().Extend(b.BoundingBox())
+	g := smoothGrowth(k, kind)
+	s.bb = bb.Expand(g)
+	return &s
+}
+
+//-----------------------------------------------------------------------------
+// Union of many SDF3s
+
+type UnionManySDF3 struct {
+	sdf  []SDF3
+	bvh  *bvhNode // tree of the objects that can be skipped by bounding box
+	rest []SDF3   // objects evaluated for every point
+	bb   Box3
+}
+
+// UnionMany3D returns the union of many SDF3 objects.
+// The objects are stored in a flat list (nested UnionMany3D objects are
+// flattened), so a union of hundreds of objects doesn't create a deep
+// evaluation tree. The distance is the minimum, there's no blending.
+// Evaluation uses a tree of the object bounding boxes to skip exact objects
+// (e.g. spheres, boxes and rigid transforms of them) that can't be the
+// closest. Other objects (e.g. ScaleDistance3D or a blended union) can be
+// closer than their bounding box says, so they are evaluated for every
+// point. The distance is the same as for Union3D.
+func UnionMany3D(sdf ...SDF3) SDF3 {
+	s := UnionManySDF3{}
+	for _, x := range sdf {
+		switch t := x.(type) {
+		case nil:
+			// strip out any nils
+		case *UnionManySDF3:
+			s.sdf = append(s.sdf, t.sdf...)
+		default:
+			s.sdf = append(s.sdf, x)
+		}
+	}
+	if len(s.sdf) == 0 {
+		return nil
+	}
+	if len(s.sdf) == 1 {
+		// only one sdf - not really a union
+		return s.sdf[0]
+	}
+	var bounded []SDF3
+	for _, x := range s.sdf {
+		if boundedSDF3(x) {
+			bounded = append(bounded, x)
+		} else {
+			s.rest = append(s.rest, x)
+		}
+	}
+	if bounded != nil {
+		s.bvh = newBVH(bounded)
+	}
+	s.bb = s.sdf[0].BoundingBox()
+	for _, x := range s.sdf[1:] {
+		s.bb = s.bb.Extend(x.BoundingBox())
+	}
+	return &s
+}
+
+// Return the minimum distance to the SDF3 union.
+func (s *UnionManySDF3) Evaluate(p V3) float64 {
+	d := math.MaxFloat64
+	for _, x := range s.rest {
+		d = Min(d, x.Evaluate(p))
+	}
+	if s.bvh != nil {
+		d = s.bvh.evaluate(p, d)
+	}
+	return d
+}
+
+// Return the bounding box.
+func (s *UnionManySDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
 //-----------------------------------------------------------------------------
 
 // Difference of SDF3s
@@ -705,6 +1492,101 @@ func (s *DifferenceSDF3) BoundingBox() Box3 {
 	return s.bb
 }
 
+// DifferenceClearance3D returns s0 - s1 with a clearance, i.e. s1 is grown
+// by the clearance before it's subtracted. A peg of s1 fits the hole with a
+// gap of clearance all around, so a round hole is 2 * clearance larger in
+// diameter than the peg. A negative clearance gives a hole smaller than the
+// peg (see PressFit3D).
+func DifferenceClearance3D(s0, s1 SDF3, clearance float64) SDF3 {
+	if s1 == nil {
+		return s0
+	}
+	return Difference3D(s0, Offset3D(s1, clearance))
+}
+
+// DifferenceRound3D returns s0 - s1 with the edges where the surfaces of
+// s0 and s1 meet (e.g. the rim of a pocket) rounded to radius r, see
+// RoundMax. Only those edges are rounded, the edges of s1 itself (e.g. the
+// floor of a pocket) are as sharp as s1, round them with s1 (e.g. Box3D).
+func DifferenceRound3D(s0, s1 SDF3, r float64) SDF3 {
+	if r < 0 {
+		panic("r < 0")
+	}
+	s := Difference3D(s0, s1)
+	if d, ok := s.(*DifferenceSDF3); ok && r > 0 {
+		d.SetMax(RoundMax(r))
+	}
+	return s
+}
+
+// PressFit3D returns s0 - s1 for a press fit, the hole is smaller than s1 by
+// the interference all around.
+func PressFit3D(s0, s1 SDF3, interference float64) SDF3 {
+	if interference < 0 {
+		panic("interference < 0")
+	}
+	return DifferenceClearance3D(s0, s1, -interference)
+}
+
+// EmptyDifference is the warning from SafeDifference3D for a difference
+// with nothing left, s1 contains all of s0.
+type EmptyDifference struct {
+	Swapped bool // s1 - s0 isn't empty, the operands may be the wrong way round
+}
+
+func (e *EmptyDifference) Error() string {
+	if e.Swapped {
+		return "the difference is empty, s1 contains s0 (are s0 and s1 swapped?)"
+	}
+	return "the difference is empty, s1 contains s0"
+}
+
+// safeDifferenceCells is the sampling grid size for SafeDifference3D.
+const safeDifferenceCells = 20
+
+// solidOutside samples s0 on a grid over its bounding box. It returns true
+// if a sample is inside s0 and outside s1 (so s0 - s1 isn't empty), and true
+// if any sample is inside s0.
+func solidOutside(s0, s1 SDF3) (bool, bool) {
+	bb := s0.BoundingBox()
+	bb1 := s1.BoundingBox()
+	step := bb.Size().DivScalar(safeDifferenceCells)
+	inside := false
+	for i := 0; i < safeDifferenceCells; i++ {
+		for j := 0; j < safeDifferenceCells; j++ {
+			for k := 0; k < safeDifferenceCells; k++ {
+				p := bb.Min.Add(V3{float64(i) + 0.5, float64(j) + 0.5, float64(k) + 0.5}.Mul(step))
+				if s0.Evaluate(p) >= 0 {
+					continue
+				}
+				inside = true
+				// outside the bounding box of s1 is outside s1
+				if !bb1.Contains(p) || s1.Evaluate(p) > 0 {
+					return true, true
+				}
+			}
+		}
+	}
+	return false, inside
+}
+
+// SafeDifference3D returns s0 - s1 as for Difference3D, and an
+// *EmptyDifference error if nothing is left, e.g. for a user interface to
+// warn about operands that are the wrong way round (the big shape
+// subtracted from the small one). The check samples s0 on a grid, so a
+// sliver of s0 outside s1 that's thinner than the grid may be missed.
+func SafeDifference3D(s0, s1 SDF3) (SDF3, error) {
+	s := Difference3D(s0, s1)
+	if s0 == nil || s1 == nil {
+		return s, nil
+	}
+	if left, inside := solidOutside(s0, s1); left || !inside {
+		return s, nil
+	}
+	swapped, _ := solidOutside(s1, s0)
+	return s, &EmptyDifference{swapped}
+}
+
 //-----------------------------------------------------------------------------
 
 // Intersection of SDF3s
@@ -744,6 +1626,63 @@ func (s *IntersectionSDF3) BoundingBox() Box3 {
 	return s.bb
 }
 
+// Mask3D confines a detail (e.g. a lattice) to the interior of a region.
+// It's the intersection of detail and region: within the region the surface
+// is the detail surface, where the detail meets the boundary of the region it
+// is capped by the region surface, and outside the region there is nothing.
+// It doesn't replace the region, empty parts of the detail are empty. The
+// bounding box is the overlap of the detail and region boxes, so the detail
+// can have a larger (or unbounded) box.
+func Mask3D(detail, region SDF3) SDF3 {
+	s := Intersect3D(detail, region)
+	if s == nil {
+		return nil
+	}
+	a := detail.BoundingBox()
+	b := region.BoundingBox()
+	bb := Box3{a.Min.Max(b.Min), a.Max.Min(b.Max)}
+	// no overlap gives an empty box
+	bb.Max = bb.Max.Max(bb.Min)
+	s.(*IntersectionSDF3).bb = bb
+	return s
+}
+
+//-----------------------------------------------------------------------------
+
+// Exclusive or of SDF3s
+type XorSDF3 struct {
+	s0 SDF3
+	s1 SDF3
+	bb Box3
+}
+
+// Xor3D returns the region that is in exactly one of s0 or s1.
+func Xor3D(s0, s1 SDF3) SDF3 {
+	if s0 == nil {
+		return s1
+	}
+	if s1 == nil {
+		return s0
+	}
+	s := XorSDF3{}
+	s.s0 = s0
+	s.s1 = s1
+	s.bb = s0.BoundingBox().Extend(s1.BoundingBox())
+	return &s
+}
+
+// Return the minimum distance to the object.
+func (s *XorSDF3) Evaluate(p V3) float64 {
+	d0 := s.s0.Evaluate(p)
+	d1 := s.s1.Evaluate(p)
+	return Max(Min(d0, d1), -Max(d0, d1))
+}
+
+// Return the bounding box.
+func (s *XorSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
 //-----------------------------------------------------------------------------
 // Cut an SDF3 along a plane
 
@@ -774,6 +1713,39 @@ func (s *CutSDF3) BoundingBox() Box3 {
 	return s.bb
 }
 
+//-----------------------------------------------------------------------------
+// Clip an SDF3 to a box
+
+type ClipSDF3 struct {
+	sdf    SDF3
+	center V3   // center of the box
+	size   V3   // half size of the box
+	bb     Box3 // bounding box
+}
+
+// Clip3D intersects an SDF3 with an axis aligned box.
+// The box is the bounding box of the result, so this gives a finite
+// region of an infinite SDF3 (e.g. a plane or a repeated pattern) that
+// can be rendered.
+func Clip3D(sdf SDF3, box Box3) SDF3 {
+	s := ClipSDF3{}
+	s.sdf = sdf
+	s.center = box.Center()
+	s.size = box.Size().MulScalar(0.5)
+	s.bb = box
+	return &s
+}
+
+// Return the minimum distance to the clipped SDF3.
+func (s *ClipSDF3) Evaluate(p V3) float64 {
+	return Max(s.sdf.Evaluate(p), sdf_box3d(p.Sub(s.center), s.size))
+}
+
+// Return the bounding box.
+func (s *ClipSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
 //-----------------------------------------------------------------------------
 // ArraySDF3: Create an X by Y by Z array of a given SDF3
 // num = the array size
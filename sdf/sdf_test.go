@@ -5,9 +5,25 @@
 package sdf
 
 import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
 	"fmt"
+	"image/png"
+	"io/ioutil"
 	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/math/fixed"
 )
 
 //-----------------------------------------------------------------------------
@@ -722,3 +738,5969 @@ func Test_Box2_Distances(t *testing.T) {
 }
 
 //-----------------------------------------------------------------------------
+
+func Test_Xor2D(t *testing.T) {
+	s := Xor2D(Circle2D(1), Transform2D(Circle2D(1), Translate2d(V2{1, 0})))
+	tests := []struct {
+		p      V2
+		inside bool
+	}{
+		{V2{-0.5, 0}, true}, // only in the first circle
+		{V2{1.5, 0}, true},  // only in the second circle
+		{V2{0.5, 0}, false}, // in both circles
+		{V2{0.5, 2}, false}, // in neither circle
+	}
+	for _, v := range tests {
+		if (s.Evaluate(v.p) < 0) != v.inside {
+			t.Error("FAIL")
+		}
+	}
+	bb := Box2{V2{-1, -1}, V2{2, 1}}
+	if !s.BoundingBox().Equals(bb, TOLERANCE) {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Interfere3D(t *testing.T) {
+	a := Box3D(V3{1, 1, 1}, 0)
+	res := V3i{10, 10, 10}
+	// touching on the x = 0.5 face
+	b := Transform3D(Box3D(V3{1, 1, 1}, 0), Translate3d(V3{1, 0, 0}))
+	if hit, _ := Interfere3D(a, b, res); hit {
+		t.Error("FAIL")
+	}
+	// overlapping by 0.5 in x
+	c := Transform3D(Box3D(V3{1, 1, 1}, 0), Translate3d(V3{0.5, 0, 0}))
+	hit, p := Interfere3D(a, c, res)
+	if !hit {
+		t.Error("FAIL")
+	}
+	if p.X < 0 || p.X > 0.5 {
+		t.Errorf("FAIL: deepest point %v outside the overlap", p)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_MinWallThickness3D(t *testing.T) {
+	s := Box3D(V3{10, 10, 1}, 0)
+	d, p := MinWallThickness3D(s, V3i{20, 20, 4})
+	if Abs(d-1) > 0.05 {
+		t.Logf("thickness %f at %v\n", d, p)
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Overhangs3D(t *testing.T) {
+	// a 10x10x10 block with a 5mm lip sticking out in +x at the top
+	base := Box3D(V3{10, 10, 10}, 0)
+	lip := Transform3D(Box3D(V3{5, 10, 2}, 0), Translate3d(V3{7.5, 0, 4}))
+	s := Union3D(base, lip)
+	points := Overhangs3D(s, DtoR(45), 0.5)
+	if len(points) == 0 {
+		t.Error("FAIL")
+	}
+	for _, p := range points {
+		// all overhangs are on the underside of the lip
+		if p.X < 5-0.5 || Abs(p.Z-3) > 0.5 {
+			t.Logf("unexpected overhang at %v\n", p)
+			t.Error("FAIL")
+			break
+		}
+	}
+	// the block on its own needs no support
+	if len(Overhangs3D(base, DtoR(45), 0.5)) != 0 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_SetSeed(t *testing.T) {
+	b := Box3{V3{-1, -1, -1}, V3{1, 1, 1}}
+	SetSeed(1234)
+	p0 := b.RandomSet(10)
+	SetSeed(1234)
+	p1 := b.RandomSet(10)
+	for i := range p0 {
+		if p0[i] != p1[i] {
+			t.Error("FAIL")
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_STL_Units(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sdfx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "box.stl")
+
+	// 1 inch box
+	s := Box3D(V3{1, 1, 1}, 0)
+	mesh := MarchingCubes(s, sampleBox3(s.BoundingBox(), 0.25), 0.25)
+	if err := SaveSTLUnits(path, mesh, STL_INCH); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var hdr STLHeader
+	if err := binary.Read(f, binary.LittleEndian, &hdr); err != nil {
+		t.Fatal(err)
+	}
+	if int(hdr.Count) != len(mesh) {
+		t.Error("FAIL")
+	}
+	var max float32
+	for i := 0; i < int(hdr.Count); i++ {
+		var d STLTriangle
+		if err := binary.Read(f, binary.LittleEndian, &d); err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range [][3]float32{d.Vertex1, d.Vertex2, d.Vertex3} {
+			for _, x := range v {
+				if x > max {
+					max = x
+				}
+			}
+		}
+	}
+	// the box goes from -0.5 to 0.5 inches
+	if Abs(float64(max)-0.5*MM_PER_INCH) > 1e-3 {
+		t.Logf("max vertex %f\n", max)
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_IsManifold(t *testing.T) {
+	s := Sphere3D(1)
+	mesh := MarchingCubes(s, sampleBox3(s.BoundingBox(), 0.1), 0.1)
+	if ok, _ := IsManifold(mesh); !ok || !IsWatertight(mesh) {
+		t.Error("FAIL")
+	}
+	// punch a hole in the mesh
+	holed := mesh[1:]
+	ok, edges := IsManifold(holed)
+	if ok || len(edges) != 3 || IsWatertight(holed) {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_DecimateMesh(t *testing.T) {
+	s := Box3D(V3{2, 2, 2}, 0)
+	mesh := MarchingCubes(s, sampleBox3(s.BoundingBox(), 0.1), 0.1)
+	dmesh := DecimateMesh(mesh, 100)
+	if len(dmesh) > len(mesh)/10 {
+		t.Logf("%d -> %d triangles\n", len(mesh), len(dmesh))
+		t.Error("FAIL")
+	}
+	bb := func(m []*Triangle3) Box3 {
+		b := Box3{m[0].V[0], m[0].V[0]}
+		for _, t := range m {
+			for _, v := range t.V {
+				b = b.Extend(Box3{v, v})
+			}
+		}
+		return b
+	}
+	if !bb(dmesh).Equals(bb(mesh), 1e-6) {
+		t.Error("FAIL")
+	}
+	if !IsWatertight(dmesh) {
+		t.Error("FAIL")
+	}
+	// as a render option
+	k := RenderParms{MeshCells: 40, Decimate: 100}
+	if m := k.RenderMesh(s); len(m.Triangles) > 150 || !m.IsWatertight() {
+		t.Error("FAIL")
+	}
+}
+
+func Test_DecimateSliver(t *testing.T) {
+	s := Box3D(V3{2, 2, 2}, 0)
+	mesh := MarchingCubes(s, sampleBox3(s.BoundingBox(), 0.1), 0.1)
+	// split edge a-b of a triangle in the middle of the top face at m, with
+	// a zero area sliver a-b-m between the halves and the neighbour across
+	// a-b, the collapses of the flat face move or remove all of them
+	i := 0
+	for mesh[i].V[0].Add(mesh[i].V[1]).Add(mesh[i].V[2]).MulScalar(1.0/3).Sub(V3{0, 0, 1}).Length() > 0.1 {
+		i++
+	}
+	a, b, c := mesh[i].V[0], mesh[i].V[1], mesh[i].V[2]
+	m := a.Add(b).MulScalar(0.5)
+	mesh[i] = &Triangle3{[3]V3{a, m, c}}
+	mesh = append(mesh, &Triangle3{[3]V3{m, b, c}}, &Triangle3{[3]V3{a, b, m}})
+	if !IsWatertight(mesh) {
+		t.Fatal("FAIL")
+	}
+	dmesh := DecimateMesh(mesh, 100)
+	if len(dmesh) > len(mesh)/10 || !IsWatertight(dmesh) {
+		t.Error("FAIL")
+	}
+	bb := s.BoundingBox().Expand(1e-6)
+	for _, x := range dmesh {
+		for _, v := range x.V {
+			if !bb.Contains(v) {
+				t.Error("FAIL")
+			}
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// bumpySphere is a sphere with a bumpy surface.
+type bumpySphere struct{}
+
+func (s *bumpySphere) Evaluate(p V3) float64 {
+	return p.Length() - 1 + 0.03*math.Sin(25*p.X)*math.Sin(25*p.Y)*math.Sin(25*p.Z)
+}
+
+func (s *bumpySphere) BoundingBox() Box3 {
+	return Box3{V3{-1.1, -1.1, -1.1}, V3{1.1, 1.1, 1.1}}
+}
+
+// normalVariance returns the mean over vertices of the variance of the adjacent face normals.
+func normalVariance(mesh []*Triangle3) float64 {
+	m := newMeshIndex(mesh)
+	normals := make([][]V3, len(m.v))
+	for _, f := range m.f {
+		n := NewTriangle3(m.v[f[0]], m.v[f[1]], m.v[f[2]]).Normal()
+		for _, i := range f {
+			normals[i] = append(normals[i], n)
+		}
+	}
+	total := 0.0
+	for _, ns := range normals {
+		var mean V3
+		for _, n := range ns {
+			mean = mean.Add(n)
+		}
+		mean = mean.DivScalar(float64(len(ns)))
+		v := 0.0
+		for _, n := range ns {
+			v += n.Sub(mean).Length2()
+		}
+		total += v / float64(len(ns))
+	}
+	return total / float64(len(m.v))
+}
+
+func Test_SmoothMesh(t *testing.T) {
+	s := &bumpySphere{}
+	mesh := MarchingCubes(s, sampleBox3(s.BoundingBox(), 0.05), 0.05)
+	smooth := SmoothMesh(mesh, 10, 0.5)
+	v0 := normalVariance(mesh)
+	v1 := normalVariance(smooth)
+	if v1 >= 0.5*v0 {
+		t.Logf("normal variance %f -> %f\n", v0, v1)
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_RenderMesh(t *testing.T) {
+	m := RenderMesh(Sphere3D(1), 20)
+	if len(m.Triangles) == 0 || !m.IsWatertight() {
+		t.Error("FAIL")
+	}
+	for _, v := range m.Vertices() {
+		if Abs(v.Length()-1) > 0.05 {
+			t.Error("FAIL")
+			break
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_CellCounts3(t *testing.T) {
+	// the reported cell counts are the size of the mesh in cells
+	// (0.7 / 0.1 is 6.99...)
+	s := Box3D(V3{0.7, 2.3, 2.9}, 0)
+	k := RenderParms{CellSize: 0.1}
+	cells := k.cellCounts(s)
+	size := k.RenderMesh(s).BoundingBox().Size().DivScalar(0.1)
+	if cells != (V3i{7, 23, 29}) || !cells.ToV3().Equals(size, 1e-6) {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_RenderPNG2(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sdfx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "circle.png")
+
+	RenderPNG2(Circle2D(10), 64, 48, path)
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 64 || img.Bounds().Dy() != 48 {
+		t.Error("FAIL")
+	}
+	// inside at the center, outside in the corner
+	if r, _, _, _ := img.At(32, 24).RGBA(); r != 0 {
+		t.Error("FAIL")
+	}
+	if r, _, _, _ := img.At(0, 0).RGBA(); r != 0xffff {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_RenderPreviewPNG3(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sdfx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sphere.png")
+
+	RenderPreviewPNG3(Sphere3D(1), 40, 40, V3{1, 1, -1}, path)
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the center of the sphere faces the light
+	if r, _, _, _ := img.At(20, 20).RGBA(); r < 0xf000 {
+		t.Error("FAIL")
+	}
+	// the corner is background
+	if r, _, _, _ := img.At(0, 0).RGBA(); r != 0 {
+		t.Error("FAIL")
+	}
+	// the sphere covers a disk
+	covered := 0
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 40; x++ {
+			if r, _, _, _ := img.At(x, y).RGBA(); r != 0 {
+				covered++
+			}
+		}
+	}
+	// frame radius is 1.05 * sqrt(3) spanning 20 pixels
+	r := 20 / (1.05 * math.Sqrt(3))
+	if Abs(float64(covered)-PI*r*r) > 0.1*PI*r*r {
+		t.Logf("covered %d pixels\n", covered)
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_RenderGrid3(t *testing.T) {
+	s := Sphere3D(1)
+	n := 0
+	inside := 0
+	RenderGrid3(s, V3i{4, 5, 6}, func(c *Cell3) {
+		n++
+		if c.Value[0] < 0 && c.Value[6] < 0 {
+			inside++
+		}
+		for i, p := range c.Corner {
+			if Abs(s.Evaluate(p)-c.Value[i]) > 1e-9 {
+				t.Error("FAIL")
+			}
+		}
+	})
+	if n != 4*5*6 || inside == 0 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_IsoLevel(t *testing.T) {
+	for _, iso := range []float64{1, -0.5} {
+		k := RenderParms{MeshCells: 40, IsoLevel: iso}
+		m := k.RenderMesh(Sphere3D(2))
+		if len(m.Triangles) == 0 || !m.IsWatertight() {
+			t.Error("FAIL")
+		}
+		for _, v := range m.Vertices() {
+			if Abs(v.Length()-(2+iso)) > 0.05 {
+				t.Error("FAIL")
+				break
+			}
+		}
+		// the normals point outwards
+		for _, tr := range m.Triangles {
+			if tr.Normal().Dot(tr.V[0]) <= 0 {
+				t.Error("FAIL")
+				break
+			}
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Materials(t *testing.T) {
+	left := Material3D(Transform3D(Box3D(V3{1, 1, 1}, 0), Translate3d(V3{-0.5, 0, 0})), 1)
+	right := Material3D(Transform3D(Box3D(V3{1, 1, 1}, 0), Translate3d(V3{0.5, 0, 0})), 2)
+	s := Union3D(left, right)
+	parts := SplitMaterials(s, RenderMesh(s, 20))
+	if len(parts) != 2 || parts[0].Material != 1 || parts[1].Material != 2 {
+		t.Fatal("FAIL")
+	}
+	// allow for triangles straddling the seam at x = 0 (cell size is 0.1)
+	for _, p := range parts {
+		for _, tr := range p.Mesh.Triangles {
+			x := tr.V[0].Add(tr.V[1]).Add(tr.V[2]).X / 3
+			if (p.Material == 1 && x > 0.1) || (p.Material == 2 && x < -0.1) {
+				t.Error("FAIL")
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := write3mf(&buf, new3mfModel(parts)); err != nil {
+		t.Fatal(err)
+	}
+	z, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil || len(z.File) != 3 {
+		t.Error("FAIL")
+	}
+}
+
+func Test_MaterialWrappers(t *testing.T) {
+	// tags below warps and textures are found
+	box := Box3D(V3{1, 1, 1}, 0)
+	left := ScaleDistance3D(Material3D(Transform3D(box, Translate3d(V3{-0.5, 0, 0})), 1), 0.5)
+	right := AffineWarp3D(KnurlTexture3D(Material3D(box, 2), 0.2, 0.02, KNURL_DIAMOND), Translate3d(V3{0.5, 0, 0}))
+	s := Union3D(left, right)
+	if len(taggedRegions(s, isMaterial)) != 2 {
+		t.Fatal("FAIL")
+	}
+	parts := SplitMaterials(s, RenderMesh(s, 20))
+	if len(parts) != 2 || parts[0].Material != 1 || parts[1].Material != 2 {
+		t.Fatal("FAIL")
+	}
+	for _, p := range parts {
+		for _, tr := range p.Mesh.Triangles {
+			x := tr.V[0].Add(tr.V[1]).Add(tr.V[2]).X / 3
+			if (p.Material == 1 && x > 0.15) || (p.Material == 2 && x < -0.15) {
+				t.Error("FAIL")
+			}
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_AMF(t *testing.T) {
+	a := Material3D(Sphere3D(1), 1)
+	b := Material3D(Transform3D(Sphere3D(1), Translate3d(V3{3, 0, 0})), 2)
+	s := Union3D(a, b)
+	parts := SplitMaterials(s, RenderMesh(s, 20))
+
+	var buf bytes.Buffer
+	if err := writeAmf(&buf, newAmf(parts)); err != nil {
+		t.Fatal(err)
+	}
+	var amf xmlAmf
+	if err := xml.Unmarshal(buf.Bytes(), &amf); err != nil {
+		t.Fatal(err)
+	}
+	if amf.Unit != "millimeter" || len(amf.Materials) != 2 || len(amf.Objects) != 1 {
+		t.Fatal("FAIL")
+	}
+	mesh := amf.Objects[0].Mesh
+	if len(mesh.Volumes) != 2 {
+		t.Fatal("FAIL")
+	}
+	nv := 0
+	for i, p := range parts {
+		m := newMeshIndex(p.Mesh.Triangles)
+		nv += len(m.v)
+		if len(mesh.Volumes[i].Triangles) != len(m.f) || mesh.Volumes[i].MaterialID != amf.Materials[i].ID {
+			t.Error("FAIL")
+		}
+		for _, tr := range mesh.Volumes[i].Triangles {
+			if tr.V1 >= len(mesh.Vertices) || tr.V2 >= len(mesh.Vertices) || tr.V3 >= len(mesh.Vertices) {
+				t.Error("FAIL")
+				break
+			}
+		}
+	}
+	// the spheres are separate, so they share no vertices
+	if len(mesh.Vertices) != nv {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// halfSpace is the infinite region z < 0.
+type halfSpace struct{}
+
+func (s *halfSpace) Evaluate(p V3) float64 {
+	return p.Z
+}
+
+func (s *halfSpace) BoundingBox() Box3 {
+	inf := math.Inf(1)
+	return Box3{V3{-inf, -inf, -inf}, V3{inf, inf, 0}}
+}
+
+func Test_Clip3D(t *testing.T) {
+	box := Box3{V3{-2, -1, -0.5}, V3{2, 1, 0.5}}
+	s := Clip3D(&halfSpace{}, box)
+	if s.BoundingBox() != box {
+		t.Error("FAIL")
+	}
+	m := RenderMesh(s, 40)
+	if !m.IsWatertight() {
+		t.Error("FAIL")
+	}
+	// a slab from the bottom of the box to the plane
+	bb := Box3{V3{-2, -1, -0.5}, V3{2, 1, 0}}
+	for _, v := range m.Vertices() {
+		if v.Sub(bb.Min).MinComponent() < -1e-6 || bb.Max.Sub(v).MinComponent() < -1e-6 {
+			t.Error("FAIL")
+			break
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// spheres returns n spheres scattered through a box.
+func spheres(n int, size float64) []SDF3 {
+	SetSeed(1)
+	bb := Box3{V3{0, 0, 0}, V3{size, size, size}}
+	s := make([]SDF3, n)
+	for i, p := range bb.RandomSet(n) {
+		s[i] = Transform3D(Sphere3D(0.5), Translate3d(p))
+	}
+	return s
+}
+
+func Test_UnionMany3D(t *testing.T) {
+	x := spheres(100, 20)
+	s0 := Union3D(x...)
+	s1 := UnionMany3D(UnionMany3D(x[:50]...), UnionMany3D(x[50:]...))
+	if len(s1.(*UnionManySDF3).sdf) != 100 {
+		t.Error("FAIL")
+	}
+	if s0.BoundingBox() != s1.BoundingBox() {
+		t.Error("FAIL")
+	}
+	bb := s0.BoundingBox().ScaleAboutCenter(1.2)
+	for _, p := range bb.RandomSet(1000) {
+		if s0.Evaluate(p) != s1.Evaluate(p) {
+			t.Error("FAIL")
+		}
+	}
+	// objects that can be closer than their bounding box are evaluated for
+	// every point, the distance is still the same as the plain union
+	blend := Union3D(x[2], x[3])
+	blend.(*UnionSDF3).SetMin(PolyMin(2))
+	mixed := []SDF3{
+		x[0],
+		ScaleDistance3D(x[1], 0.25),
+		blend,
+		Transform3D(Cone3D(4, 2, 0.5, 0), Translate3d(V3{10, 10, 10})),
+		Transform3D(Sphere3D(1), Scale3d(V3{3, 1, 1}).Mul(Translate3d(V3{5, 15, 5}))),
+		Transform3D(Box3D(V3{2, 3, 4}, 0.5), RotateZ(1).Mul(Translate3d(V3{15, 5, 15}))),
+	}
+	mixed = append(mixed, x[4:20]...)
+	s0 = Union3D(mixed...)
+	s1 = UnionMany3D(mixed...)
+	if len(s1.(*UnionManySDF3).rest) != 4 {
+		t.Error("FAIL")
+	}
+	bb = s0.BoundingBox().ScaleAboutCenter(1.2)
+	for _, p := range bb.RandomSet(10000) {
+		if s0.Evaluate(p) != s1.Evaluate(p) {
+			t.Error("FAIL")
+		}
+	}
+}
+
+func Benchmark_UnionNested(b *testing.B) {
+	x := spheres(1000, 50)
+	s := x[0]
+	for _, y := range x[1:] {
+		s = Union3D(s, y)
+	}
+	bb := s.BoundingBox()
+	p := bb.RandomSet(100)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Evaluate(p[i%len(p)])
+	}
+}
+
+func Benchmark_UnionMany(b *testing.B) {
+	s := UnionMany3D(spheres(1000, 50)...)
+	bb := s.BoundingBox()
+	p := bb.RandomSet(100)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Evaluate(p[i%len(p)])
+	}
+}
+
+func Benchmark_UnionScatter(b *testing.B) {
+	s := Union3D(spheres(10000, 200)...)
+	bb := s.BoundingBox()
+	p := bb.RandomSet(100)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Evaluate(p[i%len(p)])
+	}
+}
+
+func Benchmark_UnionManyScatter(b *testing.B) {
+	s := UnionMany3D(spheres(10000, 200)...)
+	bb := s.BoundingBox()
+	p := bb.RandomSet(100)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Evaluate(p[i%len(p)])
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_RoundedBoxVert3D(t *testing.T) {
+	s := RoundedBoxVert3D(V3{10, 6, 4}, 1)
+	if !s.BoundingBox().Equals(Box3{V3{-5, -3, -2}, V3{5, 3, 2}}, TOLERANCE) {
+		t.Error("FAIL")
+	}
+	tests := []struct {
+		p V3
+		d float64
+	}{
+		{V3{0, 0, 2}, 0},              // center of the top face
+		{V3{3.9, 1.9, 2}, 0},          // top face near the corner is flat
+		{V3{0, 0, 3}, 1},              // above the top face
+		{V3{4.5, 0, 2.5}, 0.5},        // above the top edge (sharp)
+		{V3{5, 3, 0}, math.Sqrt2 - 1}, // vertical edge is rounded
+		{V3{4, 2, 0}, -1},             // center of the vertical edge rounding
+		{V3{4, 2, 3}, 1},              // above the rounding
+	}
+	for _, v := range tests {
+		if d := s.Evaluate(v.p); Abs(d-v.d) > TOLERANCE {
+			t.Logf("%v: expected %f, actual %f\n", v.p, v.d, d)
+			t.Error("FAIL")
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_ValidateSDF3(t *testing.T) {
+	var _ = MustBeSDF3(&bumpySphere{})
+	box := Box3{V3{-2, -2, -2}, V3{2, 2, 2}}
+	if err := ValidateSDF3(Sphere3D(1), box, 1000); err != nil {
+		t.Error(err)
+	}
+	// scaling with a transform doesn't preserve distance
+	if err := ValidateSDF3(Transform3D(Sphere3D(1), Scale3d(V3{0.5, 0.5, 0.5})), box, 1000); err == nil {
+		t.Error("FAIL")
+	}
+	// ScaleUniform3D does
+	if err := ValidateSDF3(ScaleUniform3D(Sphere3D(1), 0.5), box, 1000); err != nil {
+		t.Error(err)
+	}
+	if err := ValidateSDF2(Box2D(V2{1, 2}, 0.2), Box2{V2{-2, -2}, V2{2, 2}}, 1000); err != nil {
+		t.Error(err)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// complexModel returns a model using a wide range of SDFs.
+func complexModel() SDF3 {
+	screw := Screw3D(ISOThread(5, 1, "external"), 20, 1, 1)
+	hex := Extrude3D(Polygon2D(Nagon(6, 8)), 5)
+	hex = Transform3D(hex, Translate3d(V3{0, 0, -12.5}))
+	bolt := Union3D(screw, hex)
+	hole := Cylinder3D(30, 2, 0)
+	body := Difference3D(Box3D(V3{30, 30, 10}, 2), hole)
+	body = RotateCopy3D(Transform3D(body, Translate3d(V3{25, 0, 0})), 3)
+	return UnionMany3D(append(spheres(8, 40), bolt, body)...)
+}
+
+func Test_ConcurrentEvaluate(t *testing.T) {
+	s := complexModel()
+	bb := s.BoundingBox()
+	p := bb.RandomSet(2000)
+	d := make([]float64, len(p))
+	for i := range p {
+		d[i] = s.Evaluate(p[i])
+	}
+	// evaluate the same points from many goroutines, run with -race
+	var wg sync.WaitGroup
+	errs := make(chan int, 8)
+	for n := 0; n < 8; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range p {
+				if s.Evaluate(p[i]) != d[i] {
+					errs <- i
+					return
+				}
+			}
+		}()
+	}
+	// render concurrently with the evaluations
+	m := RenderMesh(s, 50)
+	wg.Wait()
+	close(errs)
+	for i := range errs {
+		t.Logf("distance at %v differs", p[i])
+		t.Error("FAIL")
+	}
+	if len(m.Triangles) == 0 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_RenderSTL_Deterministic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sdfx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := complexModel()
+	render := map[string]func(string){
+		"octree": func(path string) { RenderSTL(s, 40, path) },
+		"grid":   func(path string) { RenderSTL_Slow(s, 40, path) },
+	}
+	for name, fn := range render {
+		var stl [2][]byte
+		for i := range stl {
+			path := filepath.Join(dir, fmt.Sprintf("%s%d.stl", name, i))
+			fn(path)
+			if stl[i], err = ioutil.ReadFile(path); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !bytes.Equal(stl[0], stl[1]) {
+			t.Logf("%s rendering differs between runs", name)
+			t.Error("FAIL")
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_ExtrudeWinding(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sdfx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ccw := []V2{{-2, -2}, {2, -2}, {2, 2}, {-2, 2}}
+	cw := []V2{{-2, -2}, {-2, 2}, {2, 2}, {2, -2}}
+	for i, v := range [][]V2{ccw, cw} {
+		path := filepath.Join(dir, fmt.Sprintf("square%d.stl", i))
+		RenderSTL(Extrude3D(Polygon2D(v), 4), 20, path)
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var hdr STLHeader
+		if err := binary.Read(f, binary.LittleEndian, &hdr); err != nil {
+			t.Fatal(err)
+		}
+		// the extrusion is convex and centered on the origin, so the facet
+		// normals point away from the origin
+		bad := 0
+		for j := 0; j < int(hdr.Count); j++ {
+			var d STLTriangle
+			if err := binary.Read(f, binary.LittleEndian, &d); err != nil {
+				t.Fatal(err)
+			}
+			var c V3
+			for _, x := range [][3]float32{d.Vertex1, d.Vertex2, d.Vertex3} {
+				c = c.Add(V3{float64(x[0]), float64(x[1]), float64(x[2])})
+			}
+			n := V3{float64(d.Normal[0]), float64(d.Normal[1]), float64(d.Normal[2])}
+			if n.Dot(c) <= 0 {
+				bad++
+			}
+		}
+		f.Close()
+		if hdr.Count == 0 || bad != 0 {
+			t.Logf("%d of %d facets face inward", bad, hdr.Count)
+			t.Error("FAIL")
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Normal2(t *testing.T) {
+	s := Box2D(V2{2, 2}, 0)
+	test_vals := []struct {
+		p, n V2
+	}{
+		{V2{2, 0}, V2{1, 0}},
+		{V2{0, -1.5}, V2{0, -1}},
+		{V2{3, 3}, V2{1, 1}.Normalize()},
+	}
+	for _, v := range test_vals {
+		if !Normal2(s, v.p, 1e-4).Equals(v.n, 1e-6) {
+			t.Error("FAIL")
+		}
+	}
+}
+
+func Test_BevelExtrude3D(t *testing.T) {
+	// a 10x10 square, 4 high with a 1 unit bevel gives an 8x8 top face
+	s := BevelExtrude3D(Box2D(V2{10, 10}, 0), 4, 1, 1e-3)
+	test_vals := []struct {
+		p V3
+		d float64
+	}{
+		{V3{0, 0, 2}, 0},              // top face
+		{V3{4, 0, 2}, 0},              // top edge
+		{V3{5, 0, 1}, 0},              // bottom of the bevel
+		{V3{4.5, 0, 1.5}, 0},          // within the bevel
+		{V3{4.5, 2, 1.5}, 0},          // within the bevel
+		{V3{5, 0, 2}, 1 / math.Sqrt2}, // outside the bevel
+		{V3{5, 5, -2}, 0},             // bottom corner
+		{V3{0, 0, 0}, -2},             // center
+		{V3{6, 0, 0}, 1},              // side
+	}
+	for _, v := range test_vals {
+		if math.Abs(s.Evaluate(v.p)-v.d) > 1e-6 {
+			t.Logf("%v %f expected %f", v.p, s.Evaluate(v.p), v.d)
+			t.Error("FAIL")
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_ChamferExtrude3D(t *testing.T) {
+	// surface points on the chamfer of a 10x10 square, 4 high
+	slope := func(s SDF3, chamfer float64) {
+		z0 := 2 - chamfer
+		for i := 0; i <= 10; i++ {
+			z := z0 + chamfer*float64(i)/10
+			// 45 degrees: the edge moves in by the height above the chamfer
+			p := V3{5 - (z - z0), 0, z}
+			if math.Abs(s.Evaluate(p)) > 1e-9 {
+				t.Logf("%v %f", p, s.Evaluate(p))
+				t.Error("FAIL")
+			}
+		}
+	}
+	square := Box2D(V2{10, 10}, 0)
+	slope(ChamferExtrude3D(square, 4, 1), 1)
+	// the bottom edge isn't chamfered
+	if math.Abs(ChamferExtrude3D(square, 4, 1).Evaluate(V3{5, 0, -2})) > 1e-9 {
+		t.Error("FAIL")
+	}
+	s := DoubleChamferExtrude3D(square, 4, 1)
+	slope(s, 1)
+	if math.Abs(s.Evaluate(V3{4, 0, -2})) > 1e-9 {
+		t.Error("FAIL")
+	}
+	// clamped to half the height
+	slope(ChamferExtrude3D(square, 4, 3), 2)
+	// clamped to the depth of the profile
+	slope(ChamferExtrude3D(Box2D(V2{10, 2}, 0), 4, 1.5), 1)
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_UnionSmooth3D(t *testing.T) {
+	// two boxes with a 1 unit gap, the origin is 0.5 from both
+	a := Transform3D(Box3D(V3{2, 2, 2}, 0), Translate3d(V3{-1.5, 0, 0}))
+	b := Transform3D(Box3D(V3{2, 2, 2}, 0), Translate3d(V3{1.5, 0, 0}))
+	k := 0.5
+	test_vals := []struct {
+		kind SmoothKind
+		d    float64 // at the seam
+	}{
+		{SMOOTH_POLY, 0.5 - k/4},
+		{SMOOTH_EXP, 0.5 - k*math.Ln2},
+		{SMOOTH_POW, 0.5 * math.Pow(2, -k)},
+	}
+	for _, v := range test_vals {
+		s := UnionSmooth3D(k, v.kind, a, b)
+		if math.Abs(s.Evaluate(V3{0, 0, 0})-v.d) > 1e-9 {
+			t.Logf("kind %d: %f expected %f", v.kind, s.Evaluate(V3{0, 0, 0}), v.d)
+			t.Error("FAIL")
+		}
+		// away from the seam the union is (close to) unchanged
+		if math.Abs(s.Evaluate(V3{-3.5, 0, 0})-1) > 0.05 {
+			t.Error("FAIL")
+		}
+		// inside point
+		if s.Evaluate(V3{-1.5, 0, 0}) >= 0 {
+			t.Error("FAIL")
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_DrillHole3D(t *testing.T) {
+	for _, angle := range []float64{118, 135} {
+		s := DrillHole3D(10, 20, DtoR(angle))
+		// apex depth from the diameter and point angle
+		apex := 20 + 5/math.Tan(DtoR(angle)/2)
+		if math.Abs(s.BoundingBox().Min.Z+apex) > 1e-9 {
+			t.Error("FAIL")
+		}
+		if math.Abs(s.Evaluate(V3{0, 0, -apex})) > 1e-6 {
+			t.Error("FAIL")
+		}
+		// full diameter down to the depth
+		if math.Abs(s.Evaluate(V3{5, 0, -20})) > 1e-6 {
+			t.Error("FAIL")
+		}
+		if math.Abs(s.Evaluate(V3{0, 0, 0})) > 1e-6 {
+			t.Error("FAIL")
+		}
+	}
+	s := ThroughHole3D(4, 10)
+	bb := s.BoundingBox()
+	if bb.Max.Z <= 0 || bb.Min.Z >= -10 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Shafts(t *testing.T) {
+	test_vals := []struct {
+		s SDF2
+		p V2
+		d float64
+	}{
+		// 5mm shaft, 4.5mm across the flat
+		{DShaft2D(5, 4.5), V2{0, 2}, 0},
+		{DShaft2D(5, 4.5), V2{0, 0}, -2},
+		{DShaft2D(5, 4.5), V2{0, -2.5}, 0},
+		{DShaft2D(5, 4.5), V2{0, 3}, 1},
+		// 10mm shaft with a 3mm wide, 1mm deep keyway
+		{Keyway2D(10, 3, 1), V2{0, 4}, 0},
+		{Keyway2D(10, 3, 1), V2{1.5, 4.5}, 0},
+		{Keyway2D(10, 3, 1), V2{0, -5}, 0},
+		{KeyedBore2D(10, 3, 1), V2{0, 6}, 0},
+		{KeyedBore2D(10, 3, 1), V2{1.5, 5.5}, 0},
+		{KeyedBore2D(10, 3, 1), V2{0, -5}, 0},
+	}
+	for _, v := range test_vals {
+		if math.Abs(v.s.Evaluate(v.p)-v.d) > 1e-9 {
+			t.Logf("%v %f expected %f", v.p, v.s.Evaluate(v.p), v.d)
+			t.Error("FAIL")
+		}
+	}
+	s := DShaft3D(5, 4.5, 10)
+	if math.Abs(s.Evaluate(V3{0, 2, 0})) > 1e-9 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Rack2D(t *testing.T) {
+	m := 2.0
+	pitch := PI * m
+	s := Rack2D(m, 7.5*pitch, DtoR(20))
+	// find the tooth tops just below the addendum
+	y := 2*m + 2.25*m - 0.01
+	bb := s.BoundingBox()
+	var tops []float64
+	inside := false
+	x0 := 0.0
+	for x := bb.Min.X; x <= bb.Max.X; x += 0.001 {
+		d := s.Evaluate(V2{x, y})
+		if d < 0 && !inside {
+			x0 = x
+		}
+		if d >= 0 && inside {
+			tops = append(tops, (x0+x)/2)
+		}
+		inside = d < 0
+	}
+	if len(tops) != 7 {
+		t.Logf("%d teeth, expected 7", len(tops))
+		t.Error("FAIL")
+	}
+	for i := 1; i < len(tops); i++ {
+		if math.Abs(tops[i]-tops[i-1]-pitch) > 0.01 {
+			t.Error("FAIL")
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_TimingPulley2D(t *testing.T) {
+	b := BeltLookup("GT2")
+	// 20 tooth GT2 pulley
+	if math.Abs(b.PitchDiameter(20)-12.732) > 1e-3 {
+		t.Error("FAIL")
+	}
+	s := TimingPulley2D("GT2", 20)
+	r := b.OutsideDiameter(20) / 2
+	// the land between grooves is on the outside diameter
+	if math.Abs(s.Evaluate(PolarToXY(r, PI/20))) > 1e-9 {
+		t.Error("FAIL")
+	}
+	// count the grooves, starting on a land
+	grooves := 0
+	inside := true
+	for i := 0; i < 3600; i++ {
+		d := s.Evaluate(PolarToXY(r-b.GrooveDepth/2, PI/20+TAU*float64(i)/3600))
+		if d > 0 && inside {
+			grooves++
+		}
+		inside = d <= 0
+	}
+	if grooves != 20 {
+		t.Logf("%d grooves, expected 20", grooves)
+		t.Error("FAIL")
+	}
+	// groove bottom
+	if math.Abs(s.Evaluate(V2{r - b.GrooveDepth, 0})) > 1e-9 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_KnurlTexture3D(t *testing.T) {
+	pitch, depth := 1.0, 0.3
+	for _, pattern := range []KnurlPattern{KNURL_STRAIGHT, KNURL_HELICAL, KNURL_DIAMOND} {
+		s := KnurlTexture3D(Cylinder3D(10, 5, 0), pitch, depth, pattern)
+		m := RenderMesh(s, 120)
+		// radial extent of the knurled surface
+		rmin, rmax := 5.0, 0.0
+		for _, v := range m.Vertices() {
+			if Abs(v.Z) < 3 {
+				r := V2{v.X, v.Y}.Length()
+				rmin = Min(rmin, r)
+				rmax = Max(rmax, r)
+			}
+		}
+		// allow for the mesh cell size
+		if math.Abs(rmax-5) > 0.1 || math.Abs(rmin-(5-depth)) > 0.1 {
+			t.Logf("pattern %d: radius %f to %f", pattern, rmin, rmax)
+			t.Error("FAIL")
+		}
+	}
+	// the ridges are periodic around the circumference
+	s := KnurlTexture3D(Cylinder3D(10, 5, 0), pitch, depth, KNURL_STRAIGHT)
+	ridges := 0
+	inside := false
+	for i := 0; i < 3600; i++ {
+		d := s.Evaluate(PolarToXY(5-depth/2, TAU*float64(i)/3600).ToV3(0))
+		if d < 0 && !inside {
+			ridges++
+		}
+		inside = d < 0
+	}
+	if ridges != int(math.Round(TAU*5/pitch)) {
+		t.Logf("%d ridges", ridges)
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_ORingGroove3D(t *testing.T) {
+	id, cord := 20.0, 2.0
+	// face seal
+	s := ORingGroove3D(id, cord)
+	w := s.BoundingBox().Max.X - id/2
+	h := -s.BoundingBox().Min.Z
+	if math.Abs(w-1.4*cord) > 1e-9 || math.Abs(h-0.75*cord) > 1e-9 {
+		t.Error("FAIL")
+	}
+	// groove bottom and walls
+	if math.Abs(s.Evaluate(V3{id/2 + w/2, 0, -h})) > 1e-9 {
+		t.Error("FAIL")
+	}
+	if math.Abs(s.Evaluate(V3{0, id / 2, -h / 2})) > 1e-9 {
+		t.Error("FAIL")
+	}
+	// bore seal
+	s = ORingBoreGroove3D(id, cord)
+	bb := s.BoundingBox()
+	if math.Abs(bb.Max.Z-bb.Min.Z-1.3*cord) > 1e-9 || math.Abs(bb.Max.X-(id/2+0.8*cord)) > 1e-9 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_TextStroke(t *testing.T) {
+	f, err := truetype.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filled, err := TextSDF2(f, NewText("O"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txt := NewText("O")
+	txt.SetStroke(0.2)
+	stroked, err := TextSDF2(f, txt, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// find the deepest point of the filled ring on the x-axis
+	var p V2
+	dmin := 0.0
+	for x := 0.0; x < 10; x += 0.01 {
+		if d := filled.Evaluate(V2{x, 0}); d < dmin {
+			dmin = d
+			p = V2{x, 0}
+		}
+	}
+	if dmin >= -0.1 {
+		t.Fatal("no filled ring")
+	}
+	// the stroked ring is hollow
+	if stroked.Evaluate(p) <= 0 {
+		t.Error("FAIL")
+	}
+	// and has outlines on both sides of the filled ring
+	crossings := 0
+	inside := false
+	for x := 0.0; x < 10; x += 0.01 {
+		d := stroked.Evaluate(V2{x, 0})
+		if d < 0 && !inside {
+			crossings++
+		}
+		inside = d < 0
+	}
+	if crossings != 2 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// regions returns the number of connected regions of an SDF2 sampled on a
+// grid over the bounding box, for either the inside or outside of the SDF2.
+func regions(s SDF2, n int, inside bool) int {
+	bb := s.BoundingBox().ScaleAboutCenter(1.2)
+	size := bb.Size().DivScalar(float64(n))
+	grid := make([][]bool, n)
+	for i := range grid {
+		grid[i] = make([]bool, n)
+		for j := range grid[i] {
+			p := bb.Min.Add(V2{float64(i) + 0.5, float64(j) + 0.5}.Mul(size))
+			grid[i][j] = (s.Evaluate(p) < 0) == inside
+		}
+	}
+	count := 0
+	var fill func(i, j int)
+	fill = func(i, j int) {
+		if i < 0 || j < 0 || i >= n || j >= n || !grid[i][j] {
+			return
+		}
+		grid[i][j] = false
+		fill(i+1, j)
+		fill(i-1, j)
+		fill(i, j+1)
+		fill(i, j-1)
+	}
+	for i := range grid {
+		for j := range grid[i] {
+			if grid[i][j] {
+				count++
+				fill(i, j)
+			}
+		}
+	}
+	return count
+}
+
+func Test_TextStencil(t *testing.T) {
+	f, err := truetype.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := TextSDF2(f, NewText("O"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the counter of an O falls out of a stencil
+	if regions(s, 200, false) != 2 {
+		t.Error("FAIL")
+	}
+	txt := NewText("OB")
+	txt.SetStencil(0.5)
+	s, err = TextSDF2(f, txt, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the stencil and the letters are each in one piece
+	if regions(s, 200, false) != 1 {
+		t.Error("FAIL")
+	}
+	if regions(s, 200, true) != 2 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_TextSimplify(t *testing.T) {
+	f, err := truetype.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scale := fixed.Int26_6(f.FUnitsPerEm())
+	tol := 5.0
+	for _, r := range "Sog" {
+		g := &truetype.GlyphBuf{}
+		err = g.Load(f, scale, f.Index(r), font.HintingNone)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the vertex count drops
+		n0, n1 := 0, 0
+		for n := range g.Ends {
+			s0, _ := glyph_curve(g, n, 0)
+			s1, _ := glyph_curve(g, n, tol)
+			n0 += len(s0.(*PolySDF2).vertex)
+			n1 += len(s1.(*PolySDF2).vertex)
+		}
+		t.Logf("%c vertices %d -> %d", r, n0, n1)
+		if n1 >= n0/2 {
+			t.Error("FAIL")
+		}
+		// the shape stays within tolerance (the curve sampling is randomised)
+		SetSeed(1)
+		a := glyph_convert(g, 0, 0, FILL_NONZERO)
+		SetSeed(1)
+		b := glyph_convert(g, 0, tol, FILL_NONZERO)
+		bb := a.BoundingBox()
+		for _, p := range bb.RandomSet(1000) {
+			if Abs(a.Evaluate(p)-b.Evaluate(p)) > tol {
+				t.Error("FAIL")
+				break
+			}
+		}
+	}
+	// sharp corners are kept
+	var v []V2
+	for _, k := range []V2{{1, 0}, {0, 1}, {-1, 0}, {0, -1}} {
+		// the corners of the square
+		c := V2{k.Y - k.X, -k.X - k.Y}.MulScalar(0.5)
+		for i := 0; i < 10; i++ {
+			v = append(v, c.Add(k.MulScalar(float64(i)/10)))
+		}
+	}
+	if len(Simplify2D(v, 0.1)) != 4 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Simplify2D(t *testing.T) {
+	// over-sampled circle
+	r := 10.0
+	tol := 0.01
+	v := make([]V2, 1000)
+	for i := range v {
+		v[i] = PolarToXY(r, TAU*float64(i)/float64(len(v)))
+	}
+	s := Simplify2D(v, tol)
+	t.Logf("vertices %d -> %d", len(v), len(s))
+	if len(s) >= len(v)/5 {
+		t.Error("FAIL")
+	}
+	// the edges stay within tolerance of the circle
+	for i := range s {
+		m := s[i].Add(s[(i+1)%len(s)]).MulScalar(0.5)
+		if Abs(m.Length()-r) > tol {
+			t.Error("FAIL")
+		}
+	}
+	// SDF2 distances stay within tolerance
+	c := SimplifySDF2(Polygon2D(v), tol)
+	bb := c.BoundingBox()
+	for _, p := range bb.RandomSet(1000) {
+		if Abs(c.Evaluate(p)-(p.Length()-r)) > tol+1e-3 {
+			t.Error("FAIL")
+			break
+		}
+	}
+	// a thin sliver that self-intersects with plain Douglas-Peucker
+	v = nil
+	for i := 0; i <= 200; i++ {
+		x := 10 * float64(i) / 200
+		v = append(v, V2{x, math.Sin(x)})
+	}
+	for i := 200; i >= 0; i-- {
+		x := 10 * float64(i) / 200
+		v = append(v, V2{x, 1.1*math.Sin(x+0.2) + 0.3})
+	}
+	s = Simplify2D(v, 0.3)
+	n := len(s)
+	for a := 0; a < n; a++ {
+		for b := a + 2; b < n; b++ {
+			if a == 0 && b == n-1 {
+				continue
+			}
+			if segments_intersect(s[a], s[a+1], s[b], s[(b+1)%n]) {
+				t.Error("FAIL")
+			}
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Resample2D(t *testing.T) {
+	// unevenly sampled circle
+	r := 10.0
+	var v []V2
+	for i := 0; i < 100; i++ {
+		k := float64(i) / 100
+		v = append(v, PolarToXY(r, TAU*k*k))
+	}
+	n := 50
+	s := Resample2D(v, n, true)
+	if len(s) != n || !s[0].Equals(v[0], TOLERANCE) {
+		t.Error("FAIL")
+	}
+	// the points are roughly equidistant
+	d0 := 2 * r * math.Sin(PI/float64(n))
+	for i := range s {
+		d := s[(i+1)%n].Sub(s[i]).Length()
+		if Abs(d-d0) > 0.02*d0 {
+			t.Errorf("FAIL %d %f %f", i, d, d0)
+		}
+	}
+	// an open polyline keeps its end points
+	s = Resample2D([]V2{{0, 0}, {1, 0}, {1, 3}}, 5, false)
+	e := []V2{{0, 0}, {1, 0}, {1, 1}, {1, 2}, {1, 3}}
+	for i := range e {
+		if !s[i].Equals(e[i], TOLERANCE) {
+			t.Error("FAIL")
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_PolygonLoft3D(t *testing.T) {
+	square := []V2{{-5, -5}, {5, -5}, {5, 5}, {-5, 5}}
+	circle := make([]V2, 64)
+	for i := range circle {
+		// clockwise, the loft fixes the direction
+		circle[i] = PolarToXY(5, -TAU*float64(i)/64)
+	}
+	volume := func(m *Mesh) float64 {
+		v := 0.0
+		for _, x := range m.Triangles {
+			v += x.V[0].Dot(x.V[1].Cross(x.V[2])) / 6
+		}
+		return v
+	}
+	m := PolygonLoft3D(square, circle, 10)
+	if !m.IsWatertight() {
+		t.Error("FAIL")
+	}
+	// the volume is between the cylinder and the box
+	vol := volume(m)
+	t.Logf("volume %f", vol)
+	if vol <= 250*PI || vol >= 1000 {
+		t.Error("FAIL")
+	}
+	// the walls are ruled lines between the profiles
+	v := m.Vertices()
+	bb := Box3{v.Min(), v.Max()}
+	if !bb.Equals(Box3{V3{-5, -5, 0}, V3{5, 5, 10}}, 1e-9) {
+		t.Error("FAIL")
+	}
+	// a concave profile
+	l := []V2{{0, 0}, {4, 0}, {4, 1}, {1, 1}, {1, 4}, {0, 4}}
+	m = PolygonLoft3D(l, l, 1)
+	if !m.IsWatertight() || Abs(volume(m)-7) > 1e-9 {
+		t.Error("FAIL")
+	}
+}
+
+func Test_TriangulatePolygon(t *testing.T) {
+	// a concave star (counter-clockwise)
+	var star []V2
+	for i := 0; i < 10; i++ {
+		r := 5.0
+		if i%2 == 1 {
+			r = 2
+		}
+		star = append(star, PolarToXY(r, TAU*float64(i)/10))
+	}
+	// a notch whose most convex corners are not ears
+	notch := []V2{{0, 0}, {10, 0}, {10, 10}, {5, 1}, {0, 10}}
+	for _, v := range [][]V2{star, notch} {
+		s := Polygon2D(v)
+		ts := triangulate_polygon(v)
+		if len(ts) != len(v)-2 {
+			t.Error("FAIL")
+		}
+		area := 0.0
+		for _, x := range ts {
+			a, b, c := v[x[0]], v[x[1]], v[x[2]]
+			k := PolygonArea2D([]V2{a, b, c})
+			// counter-clockwise and within the polygon
+			if k <= 0 || s.Evaluate(a.Add(b).Add(c).DivScalar(3)) > 0 {
+				t.Error("FAIL")
+			}
+			area += k
+		}
+		if Abs(area-PolygonArea2D(v)) > 1e-9 {
+			t.Error("FAIL")
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_SevenSegment(t *testing.T) {
+	s := SevenSegment("8 8")
+	for _, k := range segmentPosition {
+		// all segments of the first and last digits are lit
+		if s.Evaluate(k.p) >= 0 || s.Evaluate(k.p.Add(V2{3, 0})) >= 0 {
+			t.Error("FAIL")
+		}
+		// the space is blank
+		if s.Evaluate(k.p.Add(V2{1.5, 0})) <= 0 {
+			t.Error("FAIL")
+		}
+	}
+	if SevenSegment(" ") != nil {
+		t.Error("FAIL")
+	}
+	// only the middle segment of a minus is lit
+	s = SevenSegment("-")
+	if s.Evaluate(V2{0.5, 1}) >= 0 || s.Evaluate(V2{0.5, 2}) <= 0 {
+		t.Error("FAIL")
+	}
+}
+
+func Test_DotMatrixText(t *testing.T) {
+	s := DotMatrixText("1 -", 7, 5, 1)
+	pitch := 1.25
+	dot := func(char, row, col int) float64 {
+		return s.Evaluate(V2{float64(char*6+col) * pitch, float64(6-row) * pitch})
+	}
+	// top of the 1, the space, the minus
+	if dot(0, 0, 2) >= 0 || dot(0, 0, 0) <= 0 {
+		t.Error("FAIL")
+	}
+	for row := 0; row < 7; row++ {
+		for col := 0; col < 5; col++ {
+			if dot(1, row, col) <= 0 {
+				t.Error("FAIL")
+			}
+			if (dot(2, row, col) < 0) != (row == 3) {
+				t.Error("FAIL")
+			}
+		}
+	}
+	if DotMatrixText("  ", 7, 5, 1) != nil {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_QRCode2D(t *testing.T) {
+	// 1-M "HELLO WORLD" codewords
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	ec := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if !bytes.Equal(rsEncode(data, 10), ec) {
+		t.Error("FAIL")
+	}
+	// level L format bits
+	if qrFormatBits(0) != 0x77c4 || qrFormatBits(4) != 0x662f {
+		t.Error("FAIL")
+	}
+	test_vals := []struct {
+		data    string
+		version int
+	}{
+		{"HELLO WORLD", 1},
+		{"https://github.com/deadsy/sdfx", 2},
+		{"part 1234-5678-90AB-CDEF rev C, batch 2020-04", 3},
+	}
+	for _, v := range test_vals {
+		s := QRCode2D(v.data, 0.5)
+		// modules, including the quiet zone
+		n := 4*v.version + 25
+		if math.Abs(s.BoundingBox().Size().X-float64(n)*0.5) > 1e-9 {
+			t.Logf("%q: %f modules, expected %d", v.data, s.BoundingBox().Size().X/0.5, n)
+			t.Error("FAIL")
+		}
+		// the center of the top left finder pattern is dark
+		c := s.BoundingBox().TopLeft().Add(V2{7.5 * 0.5, -7.5 * 0.5})
+		if math.Abs(s.Evaluate(c)+1.5*0.5) > 1e-9 {
+			t.Error("FAIL")
+		}
+		// quiet zone
+		if math.Abs(s.Evaluate(s.BoundingBox().TopLeft())-math.Sqrt(32)*0.5) > 1e-9 {
+			t.Error("FAIL")
+		}
+	}
+}
+
+func Test_Code128(t *testing.T) {
+	for i, p := range code128Patterns {
+		w := 0
+		for _, c := range p {
+			w += int(c - '0')
+		}
+		if (i == code128Stop && w != 13) || (i != code128Stop && w != 11) {
+			t.Error("FAIL")
+		}
+	}
+	// start, 3 characters, checksum, stop + quiet zones
+	s := Code128_2D("SDF", 0.25, 10)
+	n := 11*5 + 13 + 20
+	if math.Abs(s.BoundingBox().Size().X-float64(n)*0.25) > 1e-9 {
+		t.Error("FAIL")
+	}
+	// the start symbol begins with a 2 module bar
+	x := s.BoundingBox().Min.X + 10*0.25
+	if math.Abs(s.Evaluate(V2{x + 0.25, 0})+0.25) > 1e-9 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Hatch2D(t *testing.T) {
+	// 10x10 square, horizontal lines 1 apart
+	s := Box2D(V2{10, 10}, 0)
+	h := Hatch2D(s, 0, 1)
+	if len(h) != 10 {
+		t.Logf("%d segments, expected 10", len(h))
+		t.Error("FAIL")
+	}
+	for _, l := range h {
+		if math.Abs(l[0].X+5) > 1e-3 || math.Abs(l[1].X-5) > 1e-3 || l[0].Y != l[1].Y {
+			t.Error("FAIL")
+		}
+	}
+	// vertical lines
+	h = Hatch2D(s, DtoR(90), 2)
+	if len(h) != 5 {
+		t.Error("FAIL")
+	}
+	// a concave U shape: 3 lines through the base, 2 segments per line through the arms
+	u := Difference2D(s, Transform2D(Box2D(V2{4, 10}, 0), Translate2d(V2{0, 3})))
+	h = Hatch2D(u, 0, 1)
+	if len(h) != 3+2*7 {
+		t.Logf("%d segments, expected 17", len(h))
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_MedialAxis2D(t *testing.T) {
+	// 10x4 rectangle: a spine from x = -3 to 3 with branches to the corners
+	s := Box2D(V2{10, 4}, 0)
+	m := MedialAxis2D(s, V2i{100, 40})
+	if len(m) == 0 {
+		t.Fatal("FAIL")
+	}
+	h := 0.1
+	xmin, xmax := 0.0, 0.0
+	for _, l := range m {
+		for _, p := range l {
+			// distance to the medial axis
+			var d float64
+			if Abs(p.X) <= 3 {
+				d = Abs(p.Y)
+			} else {
+				// corner branch: |y| = 2 - (5 - |x|)
+				d = Abs(Abs(p.Y)-(Abs(p.X)-3)) * SQRT_HALF
+			}
+			if d > 1.5*h {
+				t.Logf("%v is not on the medial axis", p)
+				t.Error("FAIL")
+			}
+			if Abs(p.Y) < h {
+				xmin = Min(xmin, p.X)
+				xmax = Max(xmax, p.X)
+			}
+		}
+	}
+	// the spine is covered
+	if xmin > -3 || xmax < 3 {
+		t.Logf("spine %f to %f", xmin, xmax)
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Spring3D(t *testing.T) {
+	wire, coil, pitch, turns := 1.0, 10.0, 3.0, 5.0
+	for _, closed := range []bool{false, true} {
+		s := Spring3D(wire, coil, pitch, turns, closed)
+		bb := s.BoundingBox()
+		l := pitch * turns
+		if closed {
+			l += 2 * wire
+		}
+		if math.Abs(bb.Size().Z-l) > 1e-9 {
+			t.Logf("free length %f expected %f", bb.Size().Z, l)
+			t.Error("FAIL")
+		}
+		if math.Abs(bb.Max.X-(coil+wire)/2) > 1e-9 {
+			t.Error("FAIL")
+		}
+		// the center of the wire is on the coil diameter
+		for _, theta := range []float64{0, PI / 2, PI} {
+			z := pitch * theta / TAU
+			p := V3{coil / 2 * math.Cos(theta), coil / 2 * math.Sin(theta), z}
+			if math.Abs(s.Evaluate(p)+wire/2) > 1e-9 {
+				t.Error("FAIL")
+			}
+		}
+		// between the coils
+		if s.Evaluate(V3{coil / 2, 0, pitch / 2}) <= 0 {
+			t.Error("FAIL")
+		}
+	}
+	// a closed end coil joins the body coil, and the end turns touch
+	s := Spring3D(wire, coil, pitch, turns, true)
+	z0 := pitch * turns / 2
+	theta := TAU * z0 / pitch
+	for _, dz := range []float64{-wire / 4, wire / 4, wire / 2} {
+		if s.Evaluate(V3{coil / 2 * math.Cos(theta), coil / 2 * math.Sin(theta), z0 + dz}) >= 0 {
+			t.Error("FAIL")
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Spiral2D(t *testing.T) {
+	r0, r1, turns, thickness := 2.0, 12.0, 5.0, 0.5
+	s := Spiral2D(r0, r1, turns, thickness)
+	b := (r1 - r0) / (TAU * turns)
+	for theta := 0.1; theta < TAU*turns; theta += 0.7 {
+		// the arm radius grows linearly with angle
+		r := r0 + b*theta
+		if math.Abs(s.Evaluate(PolarToXY(r, theta))+thickness/2) > 1e-9 {
+			t.Error("FAIL")
+		}
+		// arm thickness (normal to the arm)
+		sin, cos := math.Sincos(theta)
+		n := V2{b*sin + r*cos, r*sin - b*cos}.Normalize()
+		for _, dr := range []float64{-thickness / 2, thickness / 2} {
+			if math.Abs(s.Evaluate(PolarToXY(r, theta).Add(n.MulScalar(dr)))) > 1e-9 {
+				t.Error("FAIL")
+			}
+		}
+		// between the arms
+		if s.Evaluate(PolarToXY(r+TAU*b/2, theta)) <= 0 {
+			t.Error("FAIL")
+		}
+	}
+	// rounded ends
+	if math.Abs(s.Evaluate(V2{r0 - thickness/2, 0})) > 1e-2 {
+		t.Error("FAIL")
+	}
+	// merged arms
+	s = Spiral2D(r0, r1, turns, 3)
+	if s.Evaluate(PolarToXY(r0+TAU*b*1.5, 0)) >= 0 {
+		t.Error("FAIL")
+	}
+	// the distance to a densely sampled arm, inside the inner turn and outside
+	// the outer turn too
+	for _, x := range [][4]float64{{0.5, 2.5, 3, 0.2}, {10, 1, 2.5, 1}, {0, 5, 1.3, 0.3}, {3, 3, 2, 0.4}} {
+		s := Spiral2D(x[0], x[1], x[2], x[3])
+		theta := TAU * x[2]
+		b := (x[1] - x[0]) / theta
+		arm := make([]V2, 10001)
+		for i := range arm {
+			a := theta * float64(i) / float64(len(arm)-1)
+			arm[i] = PolarToXY(x[0]+b*a, a)
+		}
+		bb := s.BoundingBox().ScaleAboutCenter(1.2)
+		for _, p := range bb.RandomSet(500) {
+			d := math.MaxFloat64
+			for i := 1; i < len(arm); i++ {
+				d = Min(d, segment_distance(p, arm[i-1], arm[i]))
+			}
+			if Abs(s.Evaluate(p)-(d-x[3]/2)) > 1e-4 {
+				t.Error("FAIL")
+			}
+		}
+		if err := ValidateSDF2(s, bb, 10000); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_RevolveAxis(t *testing.T) {
+	// a profile from x = -2 to x = 1 that crosses the axis
+	p := Transform2D(Box2D(V2{3, 2}, 0), Translate2d(V2{-0.5, 0}))
+	s := Revolve3D(p)
+	// the same as revolving the profile clipped to x >= 0
+	c := Revolve3D(Transform2D(Box2D(V2{1, 2}, 0), Translate2d(V2{0.5, 0})))
+	if !s.BoundingBox().Equals(c.BoundingBox(), TOLERANCE) {
+		t.Error("FAIL")
+	}
+	bb := Box3{V3{-3, -3, -2}, V3{3, 3, 2}}
+	for _, x := range bb.RandomSet(1000) {
+		a := s.Evaluate(x)
+		b := c.Evaluate(x)
+		if (a < 0) != (b < 0) {
+			t.Error("FAIL")
+			break
+		}
+	}
+	// the solid is filled on the axis
+	if s.Evaluate(V3{0, 0, 0}) >= 0 || s.Evaluate(V3{1.5, 0, 0}) <= 0 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_RenderAssemblySTL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sdfx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "assembly.stl")
+
+	parts := []SDF3{
+		Box3D(V3{2, 2, 2}, 0.2),
+		Transform3D(Sphere3D(1), Translate3d(V3{5, 0, 0})),
+		Transform3D(Cylinder3D(2, 0.5, 0), Translate3d(V3{0, 5, 0})),
+	}
+	RenderAssemblySTL(parts, 0.1, path)
+	n := 0
+	for _, s := range parts {
+		k := RenderParms{CellSize: 0.1}
+		n += len(k.RenderMesh(s).Triangles)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var hdr STLHeader
+	if err := binary.Read(f, binary.LittleEndian, &hdr); err != nil {
+		t.Fatal(err)
+	}
+	if n == 0 || int(hdr.Count) != n {
+		t.Logf("%d facets, expected %d", hdr.Count, n)
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_LoadSTL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sdfx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ascii := `solid cube
+  facet normal 0 0 -1
+    outer loop
+      vertex 0 0 0
+      vertex 0 1 0
+      vertex 1 0 0
+    endloop
+  endfacet
+  facet normal 0 0 1
+    outer loop
+      vertex 0 0 1
+      vertex 1 0 1
+      vertex 0 1 1.5e0
+    endloop
+  endfacet
+endsolid cube
+`
+	path := filepath.Join(dir, "ascii.stl")
+	if err := ioutil.WriteFile(path, []byte(ascii), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := LoadSTL(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m) != 2 || m[1].V[2] != (V3{0, 1, 1.5}) {
+		t.Error("FAIL")
+	}
+
+	// a binary file with a header that starts with "solid"
+	s := Box3D(V3{1, 1, 1}, 0)
+	mesh := MarchingCubes(s, sampleBox3(s.BoundingBox(), 0.25), 0.25)
+	hdr := STLHeader{}
+	copy(hdr.Text[:], "solid binary")
+	path = filepath.Join(dir, "binary.stl")
+	if err := saveSTL(path, mesh, hdr, 1); err != nil {
+		t.Fatal(err)
+	}
+	m, err = LoadSTL(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m) != len(mesh) {
+		t.Error("FAIL")
+	}
+	for i := range m {
+		for j := range m[i].V {
+			if !m[i].V[j].Equals(mesh[i].V[j], 1e-6) {
+				t.Error("FAIL")
+			}
+		}
+	}
+
+	// malformed files
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad := [][]byte{
+		data[:len(data)-10],
+		data[:50],
+		[]byte(ascii[:len(ascii)-30]),
+		[]byte(strings.Replace(ascii, "vertex 1 0 0", "vertex 1 0 x", 1)),
+		[]byte(strings.Replace(ascii, "      vertex 1 0 0\n", "", 1)),
+	}
+	for i, b := range bad {
+		_, err := ParseSTL(b)
+		t.Logf("%d: %v", i, err)
+		if err == nil {
+			t.Error("FAIL")
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_FontMetrics(t *testing.T) {
+	f, err := truetype.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := FontMetrics(f)
+	t.Logf("%+v", m)
+	if m.UnitsPerEm != 2048 || m.Ascent != 1935 || m.Descent != 432 || m.LineHeight != 1974 {
+		t.Error("FAIL")
+	}
+	if m.LineGap != m.LineHeight-m.Ascent-m.Descent {
+		t.Error("FAIL")
+	}
+	// the Go fonts have no kerning table
+	if Kerning(f, 'A', 'V') != 0 || Kerning(f, 'T', 'o') != 0 {
+		t.Error("FAIL")
+	}
+	// glyph layout with the advance widths gives the same text as TextSDF2
+	// (the curve sampling is randomised)
+	SetSeed(1)
+	var ss []SDF2
+	x := 0.0
+	for _, r := range "Hi" {
+		s, adv, err := GlyphSDF2(f, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ss = append(ss, Transform2D(s, Translate2d(V2{x, 0})))
+		x += adv
+	}
+	a := CenterAndScale2D(Union2D(ss...), 10/m.LineHeight)
+	SetSeed(1)
+	txt := NewText("Hi")
+	txt.SetOverlap(0)
+	b, err := TextSDF2(f, txt, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bb := b.BoundingBox()
+	for _, p := range bb.RandomSet(100) {
+		if Abs(a.Evaluate(p)-b.Evaluate(p)) > 1e-9 {
+			t.Error("FAIL")
+			break
+		}
+	}
+	// no outline for a space
+	if s, adv, _ := GlyphSDF2(f, ' '); s != nil || adv <= 0 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_TextCase(t *testing.T) {
+	f, err := truetype.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	height := func(txt *Text) float64 {
+		txt.SetOverlap(0)
+		s, err := TextSDF2(f, txt, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s.BoundingBox().Size().Y
+	}
+	upper := height(NewText("ABC"))
+	txt := NewText("abc")
+	txt.SetCase(UPPER_CASE)
+	if height(txt) != upper {
+		t.Error("FAIL")
+	}
+	// small caps are shorter than caps
+	txt.SetCase(SMALL_CAPS)
+	small := height(txt)
+	t.Logf("caps %f small caps %f", upper, small)
+	if Abs(small-0.75*upper) > 1e-6 {
+		t.Error("FAIL")
+	}
+	// and upper case shaped (the curve sampling is randomised)
+	SetSeed(1)
+	ss, _, err := lineSDF2(f, []TextRun{{"a", 1, 0, 0}}, txt, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetSeed(1)
+	a, _, err := GlyphSDF2(f, 'A')
+	if err != nil {
+		t.Fatal(err)
+	}
+	a = ScaleUniform2D(a, 0.75)
+	bb := a.BoundingBox()
+	for _, p := range bb.RandomSet(100) {
+		if Abs(ss[0].Evaluate(p)-a.Evaluate(p)) > 1e-6 {
+			t.Error("FAIL")
+			break
+		}
+	}
+	// upper case letters are full size
+	txt = NewText("Axx")
+	txt.SetCase(SMALL_CAPS)
+	if Abs(height(txt)-height(NewText("A"))) > 1e-6 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_TextRuns(t *testing.T) {
+	f, err := truetype.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// mm squared
+	txt := NewTextRuns([]TextRun{{"mm", 1, 0, 0}, {"2", 0.6, 0.4, 0}})
+	ss, _, err := lineSDF2(f, txt.lines()[0], txt, 1, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, _, err := GlyphSDF2(f, '2')
+	if err != nil {
+		t.Fatal(err)
+	}
+	b0 := base.BoundingBox()
+	b1 := ss[len(ss)-1].BoundingBox()
+	t.Logf("base %v superscript %v", b0, b1)
+	// the superscript is higher and smaller than the base text
+	if b1.Min.Y-b0.Min.Y < 399 || b1.Size().Y > 0.61*b0.Size().Y {
+		t.Error("FAIL")
+	}
+	// a single run is the same as plain text (the curve sampling is randomised)
+	SetSeed(1)
+	a, err := TextSDF2(f, NewText("A\nB"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetSeed(1)
+	b, err := TextSDF2(f, NewTextRuns([]TextRun{{"A\n", 1, 0, 0}, {"B", 1, 0, 0}}), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bb := a.BoundingBox()
+	for _, p := range bb.RandomSet(100) {
+		if Abs(a.Evaluate(p)-b.Evaluate(p)) > 1e-9 {
+			t.Error("FAIL")
+			break
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_TextTabs(t *testing.T) {
+	f, err := truetype.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txt := NewText("1\tX\n333\tX\n\tX\n1\t\tX")
+	txt.halign = L_ALIGN
+	txt.SetTabWidth(20)
+	// the text height is 10
+	ah := FontMetrics(f).LineHeight
+	k := ah / 10
+	var x []float64
+	for _, l := range txt.lines() {
+		ss, _, err := lineSDF2(f, l, txt, k, ah)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the left hand side of the X
+		x = append(x, ss[len(ss)-1].BoundingBox().Min.X/k)
+	}
+	t.Logf("%v", x)
+	// the second columns align, a tab at the start of a line goes to the first stop
+	if Abs(x[0]-x[1]) > 1e-9 || Abs(x[0]-x[2]) > 1e-9 {
+		t.Error("FAIL")
+	}
+	// two tabs go to the second stop
+	if Abs(x[3]-x[0]-20) > 1e-9 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_TextSpace(t *testing.T) {
+	// a copy of the Go font with a zero advance width for the space
+	ttf := append([]byte(nil), goregular.TTF...)
+	f, err := truetype.Parse(ttf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table := func(tag string) int {
+		n := int(binary.BigEndian.Uint16(ttf[4:]))
+		for i := 0; i < n; i++ {
+			x := ttf[12+16*i:]
+			if string(x[:4]) == tag {
+				return int(binary.BigEndian.Uint32(x[8:]))
+			}
+		}
+		t.Fatalf("no %s table", tag)
+		return 0
+	}
+	i := int(f.Index(' '))
+	if i >= int(binary.BigEndian.Uint16(ttf[table("hhea")+34:])) {
+		t.Fatal("space has no horizontal metrics")
+	}
+	binary.BigEndian.PutUint16(ttf[table("hmtx")+4*i:], 0)
+	q, err := truetype.Parse(ttf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.HMetric(fixed.Int26_6(q.FUnitsPerEm()), q.Index(' ')).AdvanceWidth != 0 {
+		t.Fatal("font not patched")
+	}
+	// the gap between the letters of "a b"
+	gap := func(f *truetype.Font) float64 {
+		txt := NewText("a b")
+		ss, _, err := lineSDF2(f, txt.lines()[0], txt, 1, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ss[1].BoundingBox().Min.X - ss[0].BoundingBox().Max.X
+	}
+	g0 := gap(f)
+	g1 := gap(q)
+	t.Logf("gap %f, zero width space gap %f", g0, g1)
+	if g1 < 0.2*float64(q.FUnitsPerEm()) || g1 > g0 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_CircleSegments(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sdfx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r := 10.0
+	tol := 0.01
+	n := CircleSegments(r, tol)
+	sagitta := func(n int) float64 { return r * (1 - math.Cos(PI/float64(n))) }
+	if sagitta(n) > tol || sagitta(n-1) <= tol {
+		t.Error("FAIL")
+	}
+	// a circle exported with n segments has n vertices
+	for _, n := range []int{6, 36, n} {
+		path := filepath.Join(dir, "circle.dxf")
+		d := NewDXF(path)
+		d.Circle(V2{1, 2}, r, n)
+		if err := d.Save(); err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := 0
+		for _, l := range strings.Split(string(data), "\n") {
+			if strings.TrimSpace(l) == "LINE" {
+				lines++
+			}
+		}
+		if lines != n {
+			t.Logf("%d segments, expected %d", lines, n)
+			t.Error("FAIL")
+		}
+		// and as a polygon
+		v := CirclePolygon(V2{1, 2}, r, n).Vertices()
+		if len(v) != n {
+			t.Error("FAIL")
+		}
+		for _, p := range v {
+			if Abs(p.Sub(V2{1, 2}).Length()-r) > TOLERANCE {
+				t.Error("FAIL")
+			}
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Box2D_Exact(t *testing.T) {
+	for _, r := range []float64{0, 0.5} {
+		size := V2{4, 2}
+		s := Box2D(size, r)
+		h := size.MulScalar(0.5).SubScalar(r)
+		bb := Box2{V2{-5, -5}, V2{5, 5}}
+		SetSeed(1)
+		for _, p := range bb.RandomSet(2000) {
+			// the exact distance
+			q := p.Abs().Sub(h)
+			d := q.Max(V2{0, 0}).Length() + Min(Max(q.X, q.Y), 0) - r
+			if Abs(s.Evaluate(p)-d) > 1e-12 {
+				t.Error("FAIL")
+				break
+			}
+			// the gradient is 1 away from the (inside) medial axis
+			if q.X < 0 && q.Y < 0 && Abs(q.X-q.Y) < 1e-3 {
+				continue
+			}
+			const eps = 1e-7
+			g := V2{
+				s.Evaluate(p.Add(V2{eps, 0})) - s.Evaluate(p.Sub(V2{eps, 0})),
+				s.Evaluate(p.Add(V2{0, eps})) - s.Evaluate(p.Sub(V2{0, eps})),
+			}.DivScalar(2 * eps)
+			if Abs(g.Length()-1) > 1e-4 {
+				t.Logf("p %v |grad| %f", p, g.Length())
+				t.Error("FAIL")
+				break
+			}
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_RegularPolygon2D(t *testing.T) {
+	r := 3.0
+	s := RegularPolygon2D(6, r)
+	p := Polygon2D(Nagon(6, r))
+	bb := Box2{V2{-5, -5}, V2{5, 5}}
+	m := Rotate2d(PI / 3)
+	for _, x := range bb.RandomSet(1000) {
+		// six-fold symmetry
+		if Abs(s.Evaluate(x)-s.Evaluate(m.MulPosition(x))) > 1e-9 {
+			t.Error("FAIL")
+			break
+		}
+		// the same as the polygon
+		if Abs(s.Evaluate(x)-p.Evaluate(x)) > 1e-9 {
+			t.Error("FAIL")
+			break
+		}
+	}
+	if !s.BoundingBox().Equals(p.BoundingBox(), 1e-9) {
+		t.Error("FAIL")
+	}
+	// the stadium is a capsule, the distance to a line segment less the radius
+	l := 10.0
+	c := Stadium2D(l, 1)
+	b := c.BoundingBox()
+	if !b.Equals(Box2{V2{-5, -1}, V2{5, 1}}, 1e-9) {
+		t.Error("FAIL")
+	}
+	for _, x := range bb.RandomSet(1000) {
+		d := segment_distance(x, V2{-4, 0}, V2{4, 0}) - 1
+		if Abs(c.Evaluate(x)-d) > 1e-9 {
+			t.Error("FAIL")
+			break
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Star2D(t *testing.T) {
+	n := 5
+	s := Star2D(n, 4, 1.5)
+	// the star outline as a polygon
+	var v []V2
+	for i := 0; i < 2*n; i++ {
+		r := 4.0
+		if i%2 == 1 {
+			r = 1.5
+		}
+		v = append(v, PolarToXY(r, float64(i)*PI/float64(n)))
+	}
+	p := Polygon2D(v)
+	bb := Box2{V2{-5, -5}, V2{5, 5}}
+	m := Rotate2d(TAU / float64(n))
+	for _, x := range bb.RandomSet(1000) {
+		// n-fold symmetry
+		if Abs(s.Evaluate(x)-s.Evaluate(m.MulPosition(x))) > 1e-9 {
+			t.Error("FAIL")
+			break
+		}
+		if Abs(s.Evaluate(x)-p.Evaluate(x)) > 1e-9 {
+			t.Error("FAIL")
+			break
+		}
+	}
+	if !s.BoundingBox().Equals(p.BoundingBox(), 1e-9) {
+		t.Error("FAIL")
+	}
+}
+
+func Test_Cross2D(t *testing.T) {
+	s := Cross2D(10, 2)
+	// the arms are 10 long and 2 thick
+	if !s.BoundingBox().Equals(Box2{V2{-5, -5}, V2{5, 5}}, 1e-9) {
+		t.Error("FAIL")
+	}
+	for _, x := range []V2{{5, 0}, {-5, 0.5}, {0, 5}, {3, 1}, {-1, -3}} {
+		if Abs(s.Evaluate(x)) > 1e-9 {
+			t.Error("FAIL")
+		}
+	}
+	// the same as the polygon
+	p := Polygon2D([]V2{
+		{5, -1}, {5, 1}, {1, 1}, {1, 5}, {-1, 5}, {-1, 1},
+		{-5, 1}, {-5, -1}, {-1, -1}, {-1, -5}, {1, -5}, {1, -1},
+	})
+	bb := Box2{V2{-6, -6}, V2{6, 6}}
+	for _, x := range bb.RandomSet(1000) {
+		if Abs(s.Evaluate(x)-p.Evaluate(x)) > 1e-9 {
+			t.Error("FAIL")
+			break
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_PolarFold2D(t *testing.T) {
+	n := 7
+	theta := TAU / float64(n)
+	bb := Box2{V2{-5, -5}, V2{5, 5}}
+	for _, p := range bb.RandomSet(1000) {
+		q := PolarFold2D(p, n)
+		// the folded point is in the first sector, at the same radius
+		phi := math.Atan2(q.Y, q.X)
+		if phi < -1e-12 {
+			phi += TAU
+		}
+		if phi < -1e-12 || phi >= theta+1e-12 || Abs(q.Length()-p.Length()) > 1e-9 {
+			t.Error("FAIL")
+			break
+		}
+		// all rotations of the point fold to the same point
+		r := Rotate2d(float64(1+int(p.X*100)%n) * theta).MulPosition(p)
+		if !PolarFold2D(r, n).Equals(q, 1e-9) {
+			t.Error("FAIL")
+			break
+		}
+	}
+	// a repeated bump gives n bumps
+	bump := Transform2D(Circle2D(0.5), Translate2d(V2{3, 0}))
+	s := PolarRepeat2D(bump, n)
+	if regions(s, 200, true) != n {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_RenderSnap(t *testing.T) {
+	s := Transform3D(Sphere3D(1.3), Translate3d(V3{0.17, -0.41, 0.29}))
+	anchor := V3{0.3, -0.2, 0.1}
+	on_grid := func(x, inc float64) bool {
+		k := x / inc
+		return Abs(k-math.Round(k)) < 1e-6
+	}
+	for _, inc := range []float64{0.1, 0.2, 0.4} {
+		k := RenderParms{CellSize: inc, Snap: true, Anchor: anchor}
+		bb := k.grid(s)
+		// the grid covers the object
+		if !bb.Contains(s.BoundingBox().Min) || !bb.Contains(s.BoundingBox().Max) {
+			t.Error("FAIL")
+		}
+		// the grid origin is on the grid lines of the anchor for all cell sizes
+		d := bb.Min.Sub(anchor)
+		if !on_grid(d.X, 0.5*inc) || !on_grid(d.Y, 0.5*inc) || !on_grid(d.Z, 0.5*inc) {
+			t.Error("FAIL")
+		}
+		// and so on the grid lines of the finest cell size
+		if !on_grid(d.X, 0.05) || !on_grid(d.Y, 0.05) || !on_grid(d.Z, 0.05) {
+			t.Error("FAIL")
+		}
+		m := k.RenderMesh(s)
+		if len(m.Triangles) == 0 {
+			t.Error("FAIL")
+		}
+	}
+	// without snap the grid is anchored to the bounding box
+	k := RenderParms{CellSize: 0.1}
+	if !k.grid(s).Center().Equals(s.BoundingBox().Center(), 1e-9) {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_SaveOBJ(t *testing.T) {
+	s := Sphere3D(2)
+	m := RenderMesh(s, 40)
+	dir, err := ioutil.TempDir("", "sdfx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sphere.obj")
+	if err := m.SaveOBJ(path, s); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v, vn []V3
+	faces := 0
+	for _, line := range strings.Split(string(data), "\n") {
+		var p V3
+		switch {
+		case strings.HasPrefix(line, "v "):
+			fmt.Sscanf(line, "v %g %g %g", &p.X, &p.Y, &p.Z)
+			v = append(v, p)
+		case strings.HasPrefix(line, "vn "):
+			fmt.Sscanf(line, "vn %g %g %g", &p.X, &p.Y, &p.Z)
+			vn = append(vn, p)
+		case strings.HasPrefix(line, "f "):
+			faces++
+		}
+	}
+	if len(v) == 0 || len(v) != len(vn) || faces != len(newMeshIndex(m.Triangles).f) {
+		t.Error("FAIL")
+	}
+	// the normals on a sphere are radial
+	for i := range v {
+		if vn[i].Sub(v[i].Normalize()).Length() > 1e-3 {
+			t.Error("FAIL")
+			break
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_FontAtlas(t *testing.T) {
+	f, err := truetype.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := NewFontAtlas(f, "0123456789ABCDEF", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the atlas gives the same text as TextSDF2 (to within the sampling of the curves)
+	for _, txt := range []string{"C0FFEE", "12\tAB\n9 8", "AXB"} {
+		s0 := a.Text(txt)
+		s1, err := TextSDF2(f, NewText(txt), 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !s0.BoundingBox().Min.Equals(s1.BoundingBox().Min, 0.05) || !s0.BoundingBox().Max.Equals(s1.BoundingBox().Max, 0.05) {
+			t.Error("FAIL")
+		}
+		bb := s1.BoundingBox()
+		for _, p := range bb.RandomSet(500) {
+			if Abs(s0.Evaluate(p)-s1.Evaluate(p)) > 0.05 {
+				t.Error("FAIL")
+				break
+			}
+		}
+	}
+	// and the text options apply
+	opts := []TextOption{WithAlign(L_ALIGN), WithTracking(2), WithLineSpacing(1.5)}
+	s0 := a.Text("AB\n9", opts...)
+	s1, err := TextSDF2(f, NewTextWithOptions("AB\n9", opts...), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s0.BoundingBox().Min.Equals(s1.BoundingBox().Min, 0.05) || !s0.BoundingBox().Max.Equals(s1.BoundingBox().Max, 0.05) {
+		t.Error("FAIL")
+	}
+	if s0.BoundingBox().Size().Y < 20 {
+		t.Error("FAIL")
+	}
+}
+
+func Benchmark_TextSDF2(b *testing.B) {
+	f, _ := truetype.Parse(goregular.TTF)
+	for i := 0; i < b.N; i++ {
+		TextSDF2(f, NewText("PART 1234-5678"), 10)
+	}
+}
+
+func Benchmark_FontAtlas(b *testing.B) {
+	f, _ := truetype.Parse(goregular.TTF)
+	a, _ := NewFontAtlas(f, "PART 0123456789-", 10)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		a.Text("PART 1234-5678")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_GlyphUnion(t *testing.T) {
+	// two rectangles that nearly touch, with a floating point sized gap
+	gap := 1e-9
+	r0 := Transform2D(Box2D(V2{1, 1}, 0), Translate2d(V2{-0.5, 0}))
+	r1 := Transform2D(Box2D(V2{1, 1}, 0), Translate2d(V2{0.5 + gap, 0}))
+	// without growth the seam is outside
+	s := glyph_union([]SDF2{r0, r1}, 0)
+	if s.Evaluate(V2{gap / 2, 0}) <= 0 {
+		t.Error("FAIL")
+	}
+	// with growth there is one region with no gap at the seam
+	s = glyph_union([]SDF2{r0, r1}, 1e-4)
+	for y := -0.45; y < 0.5; y += 0.05 {
+		if s.Evaluate(V2{gap / 2, y}) >= 0 {
+			t.Error("FAIL")
+			break
+		}
+	}
+	if regions(s, 200, true) != 1 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_MissingGlyphs(t *testing.T) {
+	f, err := truetype.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txt := NewText("AB\x01C\U0001F600")
+	txt.SetStrict(true)
+	SetSeed(1)
+	s0, err := TextSDF2(f, txt, 10)
+	missing, ok := err.(*MissingGlyphs)
+	if !ok || string(missing.Runes) != "\x01\U0001F600" || s0 == nil {
+		t.Error("FAIL")
+	}
+	t.Logf("%v", err)
+	// the missing glyphs are skipped
+	SetSeed(1)
+	s1, err := TextSDF2(f, NewText("ABC"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bb := s1.BoundingBox()
+	if !s0.BoundingBox().Min.Equals(bb.Min, 1e-9) || !s0.BoundingBox().Max.Equals(bb.Max, 1e-9) {
+		t.Error("FAIL")
+	}
+	// no error if not strict
+	txt.SetStrict(false)
+	if _, err := TextSDF2(f, txt, 10); err != nil {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_TextBaseline(t *testing.T) {
+	f, err := truetype.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txt := NewText("Ag\nxy")
+	txt.halign = L_ALIGN
+	SetSeed(1)
+	s0, err := TextSDF2(f, txt, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txt.SetBaseline(true)
+	SetSeed(1)
+	s1, err := TextSDF2(f, txt, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bb0 := s0.BoundingBox()
+	bb1 := s1.BoundingBox()
+	t.Logf("centered %v baseline %v", bb0, bb1)
+	// centered on the origin
+	if !bb0.Center().Equals(V2{0, 0}, 1e-9) {
+		t.Error("FAIL")
+	}
+	// the same text, moved
+	if !bb0.Size().Equals(bb1.Size(), 1e-9) {
+		t.Error("FAIL")
+	}
+	// the A starts near the origin, the first line is above the baseline
+	// and the g and the second line are below it
+	if bb1.Min.X < 0 || bb1.Min.X > 1 || bb1.Max.Y < 5 || bb1.Max.Y > 10 || bb1.Min.Y > -10 {
+		t.Error("FAIL")
+	}
+	// the baseline is at y = 0, the bottom of the A is on it
+	if d := s1.Evaluate(V2{bb1.Min.X + 0.5, -0.05}); d <= 0 {
+		t.Error("FAIL")
+	}
+	if d := s1.Evaluate(V2{bb1.Min.X + 0.5, 0.05}); d >= 0 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_TextLines(t *testing.T) {
+	f, err := truetype.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txt := NewTextLines([]LineSpec{
+		{"TITLE", C_ALIGN},
+		{"left\nleft", L_ALIGN},
+		{"right", R_ALIGN},
+	})
+	txt.SetBaseline(true)
+	s, err := TextSDF2(f, txt, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// return the x extents of the i-th line (baseline at y = -i * 10)
+	// between the baseline and (about) the cap height
+	extent := func(i int) (float64, float64) {
+		x0, x1 := math.Inf(1), math.Inf(-1)
+		y0 := -float64(i) * 10
+		for x := -40.0; x < 40; x += 0.05 {
+			for y := y0 + 0.25; y < y0+7; y += 0.25 {
+				if s.Evaluate(V2{x, y}) < 0 {
+					x0 = math.Min(x0, x)
+					x1 = math.Max(x1, x)
+				}
+			}
+		}
+		return x0, x1
+	}
+	x0, x1 := extent(0)
+	t.Logf("centered %f %f", x0, x1)
+	if Abs(x0+x1) > 0.5 {
+		t.Error("FAIL")
+	}
+	for _, i := range []int{1, 2} {
+		x0, x1 = extent(i)
+		t.Logf("left %f %f", x0, x1)
+		if x0 < 0 || x0 > 1 || x1 < 5 {
+			t.Error("FAIL")
+		}
+	}
+	x0, x1 = extent(3)
+	t.Logf("right %f %f", x0, x1)
+	if x1 > 0.5 || x1 < -1 || x0 > -5 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_TextRotation(t *testing.T) {
+	f, err := truetype.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	theta := DtoR(45)
+	for _, baseline := range []bool{false, true} {
+		txt := NewText("WARNING")
+		txt.SetBaseline(baseline)
+		SetSeed(1)
+		s0, err := TextSDF2(f, txt, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		txt.SetRotation(theta)
+		SetSeed(1)
+		s1, err := TextSDF2(f, txt, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bb0 := Rotate2d(theta).MulBox(s0.BoundingBox())
+		bb1 := s1.BoundingBox()
+		if !bb0.Min.Equals(bb1.Min, 1e-9) || !bb0.Max.Equals(bb1.Max, 1e-9) {
+			t.Error("FAIL")
+		}
+		// the rotated text is the same text
+		m := Rotate2d(theta)
+		bb := s0.BoundingBox()
+		for _, p := range bb.RandomSet(100) {
+			if Abs(s0.Evaluate(p)-s1.Evaluate(m.MulPosition(p))) > 1e-9 {
+				t.Error("FAIL")
+				break
+			}
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_InlaySDF2(t *testing.T) {
+	f, err := truetype.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inset := 0.2
+	SetSeed(1)
+	full, s, err := InlaySDF2(f, NewText("INLAY"), 10, inset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the full glyphs are the text
+	SetSeed(1)
+	txt, _ := TextSDF2(f, NewText("INLAY"), 10)
+	if !full.BoundingBox().Min.Equals(txt.BoundingBox().Min, 1e-9) || !full.BoundingBox().Max.Equals(txt.BoundingBox().Max, 1e-9) {
+		t.Error("FAIL")
+	}
+	// the inset region is strictly inside the full region
+	bb := full.BoundingBox()
+	inside := 0
+	for _, p := range bb.RandomSet(2000) {
+		if s.Evaluate(p) < 0 {
+			inside++
+			if full.Evaluate(p) > -inset+1e-6 {
+				t.Error("FAIL")
+				break
+			}
+		}
+	}
+	if inside == 0 {
+		t.Error("FAIL")
+	}
+	// a large inset collapses the narrow glyphs
+	_, s, err = InlaySDF2(f, NewText("I"), 10, 2)
+	if err != nil || s != nil {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_RoundExtrude3D(t *testing.T) {
+	s := RoundExtrude3D(Circle2D(5), 4, 1)
+	// the outline of the profile is kept, the top is flat inside the rounding
+	for _, p := range []V3{{5, 0, 0}, {0, 5, 0.5}, {0, 0, 2}, {3.9, 0, 2}, {0, 0, -2}} {
+		if Abs(s.Evaluate(p)) > 1e-9 {
+			t.Error("FAIL")
+		}
+	}
+	// the rim is rounded with the cap radius about (4, 0, 1)
+	for theta := 0.0; theta <= DtoR(90); theta += DtoR(10) {
+		c := V3{4 + math.Cos(theta), 0, 1 + math.Sin(theta)}
+		if Abs(s.Evaluate(c)) > 1e-9 {
+			t.Error("FAIL")
+			break
+		}
+		// exact distance outside the rounding
+		o := V3{4 + 2*math.Cos(theta), 0, -1 - 2*math.Sin(theta)}
+		if Abs(s.Evaluate(o)-1) > 1e-9 {
+			t.Error("FAIL")
+			break
+		}
+	}
+	// a large cap radius gives a fully rounded rim (radius = height/2)
+	s = RoundExtrude3D(Circle2D(5), 4, 10)
+	if Abs(s.Evaluate(V3{5, 0, 0})) > 1e-9 || Abs(s.Evaluate(V3{3, 0, 2})) > 1e-9 || s.Evaluate(V3{3.5, 0, 2}) <= 0 {
+		t.Error("FAIL")
+	}
+	bb := s.BoundingBox()
+	if !bb.Min.Equals(V3{-5, -5, -2}, 1e-9) || !bb.Max.Equals(V3{5, 5, 2}, 1e-9) {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_AffineWarp3D(t *testing.T) {
+	// shear x by y, scale z
+	m := M44{
+		1, 0.8, 0, 0,
+		0, 1, 0, 0,
+		0, 0, 2.5, 0,
+		0, 0, 0, 1}
+	s := AffineWarp3D(Box3D(V3{2, 2, 2}, 0), m)
+	// the distance is a bound, i.e. the field is 1-Lipschitz
+	bb := s.BoundingBox().ScaleAboutCenter(1.5)
+	p := bb.RandomSet(500)
+	for i := 1; i < len(p); i++ {
+		if Abs(s.Evaluate(p[i])-s.Evaluate(p[i-1])) > p[i].Sub(p[i-1]).Length()+1e-9 {
+			t.Error("FAIL")
+			break
+		}
+	}
+	// the surface is where it should be
+	for _, x := range []V3{{1, 0, 0}, {1.8, 1, 0}, {0, 0, 2.5}, {-1.8, -1, -2.5}} {
+		if Abs(s.Evaluate(x)) > 1e-9 {
+			t.Error("FAIL")
+		}
+	}
+	// the sheared box meshes watertight
+	mesh := RenderMesh(s, 50)
+	if len(mesh.Triangles) == 0 || !mesh.IsWatertight() {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_ScaleDistance3D(t *testing.T) {
+	// a half turn twist of a thin plate, the twist stretches the field by
+	// about sqrt(1 + (5 * pi / 5)^2) = 3.3 at the edges of the plate
+	s := TwistExtrude3D(Box2D(V2{10, 0.3}, 0), 5, DtoR(180))
+	m0 := RenderMesh(s, 80)
+	t.Logf("twisted %d triangles, watertight %v", len(m0.Triangles), m0.IsWatertight())
+	m1 := RenderMesh(ScaleDistance3D(s, 0.2), 80)
+	if !m1.IsWatertight() {
+		t.Error("FAIL")
+	}
+	// the mesh doesn't change with a smaller factor
+	m2 := RenderMesh(ScaleDistance3D(s, 0.1), 80)
+	if len(m1.Triangles) != len(m2.Triangles) {
+		t.Error("FAIL")
+	}
+	// the object is the same
+	if ScaleDistance3D(s, 0.2).BoundingBox() != s.BoundingBox() {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_RenderStats(t *testing.T) {
+	s := Box3D(V3{10, 8, 6}, 1)
+	var stats RenderStats
+	k := RenderParms{MeshCells: 50, Stats: &stats}
+	m := k.RenderMesh(s)
+	t.Logf("%v", stats)
+	if stats.Triangles != len(m.Triangles) || stats.Vertices != len(m.Vertices()) {
+		t.Error("FAIL")
+	}
+	// a closed mesh of triangles has V - E + F = 2, with E = 3F/2
+	if stats.Vertices != stats.Triangles/2+2 {
+		t.Error("FAIL")
+	}
+	if stats.Evaluations <= stats.Vertices || stats.EmptyCubes == 0 || stats.Time <= 0 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Counted3D(t *testing.T) {
+	inner := Sphere3D(1)
+	c, count := Counted3D(inner)
+	s := Union3D(Box3D(V3{3, 3, 1}, 0.2), Transform3D(c, Translate3d(V3{0, 0, 1})))
+	var stats RenderStats
+	k := RenderParms{MeshCells: 40, Stats: &stats}
+	m0 := k.RenderMesh(s)
+	t.Logf("%d sphere evaluations, %d total", *count, stats.Evaluations)
+	// each evaluation of the union evaluates the sphere once
+	if *count == 0 || *count != int64(stats.Evaluations) {
+		t.Error("FAIL")
+	}
+	// the counter doesn't change the mesh
+	m1 := RenderMesh(Union3D(Box3D(V3{3, 3, 1}, 0.2), Transform3D(inner, Translate3d(V3{0, 0, 1}))), 40)
+	if len(m0.Triangles) != len(m1.Triangles) {
+		t.Fatal("FAIL")
+	}
+	for i := range m0.Triangles {
+		if m0.Triangles[i].V != m1.Triangles[i].V {
+			t.Error("FAIL")
+			break
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// tightSDF3 is an SDF3 with a bounding box that clips the surface.
+type tightSDF3 struct {
+	SDF3
+	bb Box3
+}
+
+func (s *tightSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+func Test_RenderPad(t *testing.T) {
+	r := Box3D(V3{4, 4, 4}, 1)
+	bb := r.BoundingBox()
+	s := &tightSDF3{r, Box3{bb.Min.AddScalar(0.2), bb.Max.SubScalar(0.2)}}
+	// the bounding box clips the faces of the box
+	m := RenderMesh(s, 40)
+	if m.IsWatertight() {
+		t.Error("FAIL")
+	}
+	// a pad gives a closed mesh
+	k := RenderParms{MeshCells: 40, Pad: 0.3}
+	m = k.RenderMesh(s)
+	if !m.IsWatertight() {
+		t.Error("FAIL")
+	}
+	mb := m.Vertices().Max().Sub(m.Vertices().Min())
+	if !mb.Equals(V3{4, 4, 4}, 0.1) {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_OffsetShellBoundingBox(t *testing.T) {
+	// return true if the zero isosurface of an SDF3 is within its bounding box
+	contained3 := func(s SDF3) bool {
+		bb := s.BoundingBox()
+		big := bb.ScaleAboutCenter(2)
+		for _, p := range big.RandomSet(20000) {
+			if s.Evaluate(p) <= 0 && !bb.Contains(p) {
+				return false
+			}
+		}
+		m := RenderMesh(s, 40)
+		for _, v := range m.Vertices() {
+			if !bb.Contains(v) {
+				return false
+			}
+		}
+		return len(m.Triangles) > 0
+	}
+	contained2 := func(s SDF2) bool {
+		bb := s.BoundingBox()
+		big := bb.ScaleAboutCenter(2)
+		for _, p := range big.RandomSet(20000) {
+			if s.Evaluate(p) <= 0 && !bb.Contains(p) {
+				return false
+			}
+		}
+		return true
+	}
+	b3 := Box3D(V3{3, 2, 1}, 0)
+	for _, s := range []SDF3{Offset3D(b3, 0.5), Offset3D(b3, -0.2), Shell3D(b3, 0.4)} {
+		if !contained3(s) {
+			t.Error("FAIL")
+		}
+	}
+	// the offset is the same as a rounded box
+	r := Offset3D(Box3D(V3{2, 2, 2}, 0), 0.5)
+	if r.BoundingBox() != Box3D(V3{3, 3, 3}, 0.5).BoundingBox() || Abs(r.Evaluate(V3{1.5, 0, 0})) > 1e-9 {
+		t.Error("FAIL")
+	}
+	b2 := Box2D(V2{3, 2}, 0)
+	for _, s := range []SDF2{Offset2D(b2, 0.5), Offset2D(b2, -0.2), Shell2D(b2, 0.4)} {
+		if !contained2(s) {
+			t.Error("FAIL")
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_PolygonArea2D(t *testing.T) {
+	square := []V2{{0, 0}, {1, 0}, {1, 1}, {0, 1}}
+	if PolygonArea2D(square) != 1 || !PolygonCentroid2D(square).Equals(V2{0.5, 0.5}, 1e-12) {
+		t.Error("FAIL")
+	}
+	// clockwise has a negative area, the same centroid
+	cw := []V2{{0, 0}, {0, 1}, {1, 1}, {1, 0}}
+	if PolygonArea2D(cw) != -1 || !PolygonCentroid2D(cw).Equals(V2{0.5, 0.5}, 1e-12) {
+		t.Error("FAIL")
+	}
+	// an L shape, the centroid is pulled toward the heavy corner
+	l := []V2{{0, 0}, {2, 0}, {2, 1}, {1, 1}, {1, 2}, {0, 2}}
+	if PolygonArea2D(l) != 3 || !PolygonCentroid2D(l).Equals(V2{5.0 / 6, 5.0 / 6}, 1e-12) {
+		t.Error("FAIL")
+	}
+	// a circle
+	c := Nagon(360, 2)
+	if Abs(PolygonArea2D(c)-PI*4) > 1e-3 || !PolygonCentroid2D(c).Equals(V2{0, 0}, 1e-9) {
+		t.Error("FAIL")
+	}
+	// no area
+	if !PolygonCentroid2D([]V2{{0, 0}, {2, 2}}).Equals(V2{1, 1}, 1e-12) {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_DistanceToSegment(t *testing.T) {
+	a := V2{0, 0}
+	b := V2{4, 0}
+	tests := []struct {
+		p, q V2
+		d    float64
+	}{
+		{V2{-3, 4}, a, 5},       // beyond the a endpoint
+		{V2{7, -4}, b, 5},       // beyond the b endpoint
+		{V2{2, 0}, V2{2, 0}, 0}, // the midpoint
+		{V2{1, 3}, V2{1, 0}, 3}, // the perpendicular foot
+	}
+	for _, x := range tests {
+		d, q := DistanceToSegment2D(x.p, a, b)
+		if Abs(d-x.d) > 1e-12 || !q.Equals(x.q, 1e-12) {
+			t.Error("FAIL")
+		}
+		d3, q3 := DistanceToSegment3D(V3{x.p.X, 0, x.p.Y}, V3{a.X, 0, a.Y}, V3{b.X, 0, b.Y})
+		if Abs(d3-x.d) > 1e-12 || !q3.Equals(V3{x.q.X, 0, x.q.Y}, 1e-12) {
+			t.Error("FAIL")
+		}
+	}
+	// a zero length segment
+	if d, q := DistanceToSegment2D(V2{3, 4}, a, a); d != 5 || q != a {
+		t.Error("FAIL")
+	}
+	// a polyline, nearest to the second segment
+	line := []V2{{0, 0}, {4, 0}, {4, 4}, {0, 4}}
+	d, q, i := NearestOnPolyline(V2{5, 1}, line)
+	if d != 1 || !q.Equals(V2{4, 1}, 1e-12) || i != 1 {
+		t.Error("FAIL")
+	}
+	// the polyline is open, the nearest point is (0, 0) not on (0, 4)-(0, 0)
+	d, q, i = NearestOnPolyline(V2{-1, 1}, line)
+	if Abs(d-math.Sqrt2) > 1e-12 || q != a || i != 0 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// gyroidSDF3 is a gyroid lattice (approximate distance).
+type gyroidSDF3 struct {
+	k, t float64 // scale, thickness
+}
+
+func (s *gyroidSDF3) Evaluate(p V3) float64 {
+	p = p.MulScalar(s.k)
+	g := math.Sin(p.X)*math.Cos(p.Y) + math.Sin(p.Y)*math.Cos(p.Z) + math.Sin(p.Z)*math.Cos(p.X)
+	return (Abs(g) - s.t) / (2 * s.k)
+}
+
+func (s *gyroidSDF3) BoundingBox() Box3 {
+	return Box3{V3{-100, -100, -100}, V3{100, 100, 100}}
+}
+
+func Test_Mask3D(t *testing.T) {
+	lattice := &gyroidSDF3{2, 0.3}
+	region := Sphere3D(5)
+	s := Mask3D(lattice, region)
+	// the box is the region box
+	if s.BoundingBox() != region.BoundingBox() {
+		t.Error("FAIL")
+	}
+	// the lattice surface inside the region, nothing outside
+	bb := Box3{V3{-7, -7, -7}, V3{7, 7, 7}}
+	for _, p := range bb.RandomSet(1000) {
+		d := s.Evaluate(p)
+		if region.Evaluate(p) < lattice.Evaluate(p) && d != lattice.Evaluate(p) {
+			t.Error("FAIL")
+			break
+		}
+		if region.Evaluate(p) > 0 && d <= 0 {
+			t.Error("FAIL")
+			break
+		}
+	}
+	// the masked lattice meshes closed, within the sphere
+	m := RenderMesh(s, 60)
+	for _, v := range m.Vertices() {
+		if v.Length() > 5.01 {
+			t.Error("FAIL")
+			break
+		}
+	}
+	if len(m.Triangles) == 0 || !m.IsWatertight() {
+		t.Error("FAIL")
+	}
+	// no overlap
+	if s := Mask3D(Transform3D(Sphere3D(1), Translate3d(V3{10, 0, 0})), region); s.BoundingBox().Size().X != 0 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_DifferenceClearance3D(t *testing.T) {
+	block := Box3D(V3{20, 20, 10}, 0)
+	peg := Cylinder3D(12, 3, 0)
+	// the hole radius along the x-axis (at z = 0)
+	hole := func(s SDF3) float64 {
+		x0, x1 := 0.0, 10.0
+		for i := 0; i < 60; i++ {
+			x := 0.5 * (x0 + x1)
+			if s.Evaluate(V3{x, 0, 0}) > 0 {
+				x0 = x
+			} else {
+				x1 = x
+			}
+		}
+		return x0
+	}
+	for _, c := range []float64{0.2, 0.5} {
+		d := 2 * hole(DifferenceClearance3D(block, peg, c))
+		if Abs(d-(6+2*c)) > 1e-9 {
+			t.Error("FAIL")
+		}
+	}
+	// a press fit is smaller than the peg
+	d := 2 * hole(PressFit3D(block, peg, 0.1))
+	if Abs(d-5.8) > 1e-9 {
+		t.Error("FAIL")
+	}
+	// no clearance is a plain difference
+	if Abs(2*hole(DifferenceClearance3D(block, peg, 0))-6) > 1e-9 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_SaveSTLGradient(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sdfx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s := Sphere3D(5)
+	m := RenderMesh(s, 30)
+	// return the facet normals of an STL file
+	normals := func(path string) [][3]float32 {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := bytes.NewReader(data)
+		var hdr STLHeader
+		binary.Read(r, binary.LittleEndian, &hdr)
+		n := make([][3]float32, hdr.Count)
+		for i := range n {
+			var d STLTriangle
+			binary.Read(r, binary.LittleEndian, &d)
+			n[i] = d.Normal
+		}
+		return n
+	}
+	p0 := filepath.Join(dir, "winding.stl")
+	p1 := filepath.Join(dir, "gradient.stl")
+	if err := m.SaveSTL(p0); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SaveSTLGradient(p1, s); err != nil {
+		t.Fatal(err)
+	}
+	n0 := normals(p0)
+	n1 := normals(p1)
+	if len(n0) != len(m.Triangles) || len(n1) != len(m.Triangles) {
+		t.Fatal("FAIL")
+	}
+	v3 := func(n [3]float32) V3 { return V3{float64(n[0]), float64(n[1]), float64(n[2])} }
+	for i, f := range m.Triangles {
+		c := f.V[0].Add(f.V[1]).Add(f.V[2]).DivScalar(3)
+		// the gradient normal is radial at the centroid
+		if v3(n1[i]).Sub(c.Normalize()).Length() > 1e-5 {
+			t.Error("FAIL")
+			break
+		}
+		// and close to the winding normal
+		if v3(n0[i]).Dot(v3(n1[i])) < math.Cos(DtoR(15)) {
+			t.Error("FAIL")
+			break
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_RenderSTLStream(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sdfx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s := Union3D(Box3D(V3{10, 6, 4}, 1), Transform3D(Sphere3D(3), Translate3d(V3{5, 0, 2})))
+	p0 := filepath.Join(dir, "memory.stl")
+	p1 := filepath.Join(dir, "stream.stl")
+	RenderSTL_Slow(s, 50, p0)
+	RenderSTLStream(s, 50, p1)
+	b0, err := ioutil.ReadFile(p0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b1, err := ioutil.ReadFile(p1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b0) <= 84 || !bytes.Equal(b0, b1) {
+		t.Error("FAIL")
+	}
+	// the count is back-patched
+	m, err := LoadSTL(p1)
+	if err != nil || int64(len(b1)) != stlBinarySize(uint32(len(m))) {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_RenderSTLTiled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sdfx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s := Sphere3D(5)
+	load := func(tiles V3i) []*Triangle3 {
+		path := filepath.Join(dir, "tiled.stl")
+		RenderSTLTiled(s, 0.4, tiles, path)
+		m, err := LoadSTL(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	m1 := load(V3i{1, 1, 1})
+	m8 := load(V3i{2, 2, 2})
+	// the tiled mesh is watertight
+	if len(m8) == 0 || !IsWatertight(m8) || !IsWatertight(m1) {
+		t.Error("FAIL")
+	}
+	// and it's the same as the single tile mesh
+	count := make(map[[3]V3]int)
+	for _, f := range m1 {
+		count[f.V]++
+	}
+	for _, f := range m8 {
+		count[f.V]--
+	}
+	for _, n := range count {
+		if n != 0 {
+			t.Error("FAIL")
+			break
+		}
+	}
+	// uneven tiles
+	if m := load(V3i{3, 1, 2}); len(m) != len(m1) || !IsWatertight(m) {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_EvaluateBatch(t *testing.T) {
+	a := Transform3D(Box3D(V3{4, 3, 2}, 0.3), RotateZ(0.3).Mul(Translate3d(V3{1, 0, 0})))
+	b := Difference3D(Sphere3D(3), Cylinder3D(8, 1, 0.1))
+	c := ScaleUniform3D(Intersect3D(Box3D(V3{2, 2, 2}, 0), Sphere3D(1.2)), 1.5)
+	// not a batch SDF3
+	d, _ := Counted3D(Transform3D(Sphere3D(1), Translate3d(V3{0, 3, 0})))
+	s := Union3D(a, b, c, d)
+	s.(*UnionSDF3).SetMin(PolyMin(0.5))
+	bb := s.BoundingBox().ScaleAboutCenter(1.2)
+	p := bb.RandomSet(1000)
+	batch := EvaluateBatch3(s, p)
+	for i := range p {
+		if batch[i] != s.Evaluate(p[i]) {
+			t.Error("FAIL")
+			break
+		}
+	}
+	// the mesh is the same with or without batch evaluation
+	m0 := MarchingCubes(s, sampleBox3(s.BoundingBox(), 0.2), 0.2)
+	scalar, _ := Counted3D(s)
+	m1 := MarchingCubes(scalar, sampleBox3(s.BoundingBox(), 0.2), 0.2)
+	if len(m0) == 0 || len(m0) != len(m1) {
+		t.Fatal("FAIL")
+	}
+	for i := range m0 {
+		if m0[i].V != m1[i].V {
+			t.Error("FAIL")
+			break
+		}
+	}
+}
+
+func Benchmark_EvaluateScalar(b *testing.B) {
+	s := Union3D(spheres(50, 20)...)
+	bb := s.BoundingBox()
+	p := bb.RandomSet(100)
+	d := make([]float64, len(p))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := range p {
+			d[j] = s.Evaluate(p[j])
+		}
+	}
+}
+
+func Benchmark_EvaluateBatch(b *testing.B) {
+	s := Union3D(spheres(50, 20)...)
+	bb := s.BoundingBox()
+	p := bb.RandomSet(100)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		EvaluateBatch3(s, p)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// deepModel returns a model with n levels of nested operations.
+func deepModel(n int) SDF3 {
+	s := Sphere3D(1)
+	for i := 0; i < n; i++ {
+		switch i % 6 {
+		case 0:
+			s = Union3D(s, Transform3D(Box3D(V3{1, 2, 3}, 0.1), Translate3d(V3{float64(i) * 0.1, 0, 0})))
+		case 1:
+			s = Transform3D(s, RotateZ(0.1))
+		case 2:
+			s = Difference3D(s, Sphere3D(0.5))
+		case 3:
+			s = ScaleUniform3D(s, 1.01)
+		case 4:
+			s, _ = Counted3D(s)
+		case 5:
+			s = ScaleDistance3D(Material3D(s, 1), 0.5)
+		}
+	}
+	return s
+}
+
+// freshBoundingBox works out the bounding box of a model from its leaves.
+func freshBoundingBox(s SDF3) Box3 {
+	switch t := s.(type) {
+	case *UnionSDF3:
+		bb := freshBoundingBox(t.sdf[0])
+		for _, x := range t.sdf[1:] {
+			bb = bb.Extend(freshBoundingBox(x))
+		}
+		return bb
+	case *DifferenceSDF3:
+		return freshBoundingBox(t.s0)
+	case *TransformSDF3:
+		return t.matrix.MulBox(freshBoundingBox(t.sdf))
+	case *ScaleUniformSDF3:
+		return Scale3d(V3{t.k, t.k, t.k}).MulBox(freshBoundingBox(t.sdf))
+	case *CountedSDF3:
+		return freshBoundingBox(t.sdf)
+	case *MaterialSDF3:
+		return freshBoundingBox(t.sdf)
+	case *ScaleDistanceSDF3:
+		return freshBoundingBox(t.sdf)
+	}
+	return s.BoundingBox()
+}
+
+func Test_CachedBoundingBox(t *testing.T) {
+	s := deepModel(300)
+	if !s.BoundingBox().Equals(freshBoundingBox(s), 1e-9) {
+		t.Error("FAIL")
+	}
+}
+
+func Benchmark_BoundingBox(b *testing.B) {
+	for _, n := range []int{10, 1000} {
+		s := deepModel(n)
+		b.Run(fmt.Sprintf("depth%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				s.BoundingBox()
+			}
+		})
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_RenderNewton(t *testing.T) {
+	s := Sphere3D(10)
+	// the worst vertex radius error
+	rerr := func(newton int) float64 {
+		k := RenderParms{MeshCells: 20, Newton: newton}
+		m := k.RenderMesh(s)
+		if len(m.Triangles) == 0 {
+			t.Fatal("FAIL")
+		}
+		e := 0.0
+		for _, tr := range m.Triangles {
+			for _, v := range tr.V {
+				e = Max(e, Abs(v.Length()-10))
+			}
+		}
+		return e
+	}
+	linear := rerr(0)
+	if rerr(1) >= linear {
+		t.Error("FAIL")
+	}
+	if rerr(4) > 1e-6 || linear < 1e-3 {
+		t.Error("FAIL")
+	}
+	// the mesh is still watertight
+	k := RenderParms{MeshCells: 20, Newton: 4}
+	if !k.RenderMesh(s).IsWatertight() {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Color3D(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sdfx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	red := [3]uint8{255, 0, 0}
+	blue := [3]uint8{0, 0, 255}
+	a := Color3D(Transform3D(Sphere3D(1.5), Translate3d(V3{-1, 0, 0})), red)
+	b := Color3D(Transform3D(Sphere3D(1.5), Translate3d(V3{1, 0, 0})), blue)
+	s := Union3D(a, b)
+
+	// the preview is red on the left (-x) and blue on the right (+x)
+	path := filepath.Join(dir, "color.png")
+	RenderPreviewPNG3(s, 60, 60, V3{0, 1, 0}, path)
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reds, blues := 0, 0
+	for x := 0; x < 60; x++ {
+		r, _, b, _ := img.At(x, 30).RGBA()
+		if r > b {
+			reds++
+			if x >= 30 {
+				t.Error("FAIL")
+			}
+		}
+		if b > r {
+			blues++
+			if x < 30 {
+				t.Error("FAIL")
+			}
+		}
+	}
+	if reds == 0 || blues == 0 {
+		t.Error("FAIL")
+	}
+
+	// the PLY vertices are colored by the nearest tagged sphere
+	path = filepath.Join(dir, "color.ply")
+	m := RenderMesh(s, 30)
+	if err := m.SavePLY(path, s); err != nil {
+		t.Fatal(err)
+	}
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(buf), "\n")
+	if lines[0] != "ply" || !strings.Contains(string(buf), "property uchar red") {
+		t.Fatal("FAIL")
+	}
+	n := 0
+	for _, l := range lines {
+		var x, y, z float64
+		var c [3]int
+		if k, _ := fmt.Sscanf(l, "%g %g %g %d %d %d", &x, &y, &z, &c[0], &c[1], &c[2]); k != 6 {
+			continue
+		}
+		n++
+		if (x < -0.01 && c != [3]int{255, 0, 0}) || (x > 0.01 && c != [3]int{0, 0, 255}) {
+			t.Error("FAIL")
+			break
+		}
+	}
+	if n != len(m.Vertices()) {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_VectorFunctions(t *testing.T) {
+	a := V3{-1.5, 0, 2.5}
+	b := V2{-1.5, 2.5}
+	if a.Floor() != (V3{-2, 0, 2}) || b.Floor() != (V2{-2, 2}) {
+		t.Error("FAIL")
+	}
+	if a.Sign() != (V3{-1, 0, 1}) || b.Sign() != (V2{-1, 1}) {
+		t.Error("FAIL")
+	}
+	if a.MinScalar(0) != (V3{-1.5, 0, 0}) || b.MinScalar(0) != (V2{-1.5, 0}) {
+		t.Error("FAIL")
+	}
+	if a.MaxScalar(0) != (V3{0, 0, 2.5}) || b.MaxScalar(0) != (V2{0, 2.5}) {
+		t.Error("FAIL")
+	}
+	if a.Clamp(V3{-1, 1, -1}, V3{1, 2, 1}) != (V3{-1, 1, 1}) || b.Clamp(V2{-1, -1}, V2{1, 3}) != (V2{-1, 2.5}) {
+		t.Error("FAIL")
+	}
+	if a.Mix(V3{0.5, 1, 0.5}, 0.5) != (V3{-0.5, 0.5, 1.5}) || b.Mix(V2{0.5, 0.5}, 0.25) != (V2{-1, 2}) {
+		t.Error("FAIL")
+	}
+	// a GLSL box: length(max(abs(p) - b, 0.0)) + min(max(q.x, max(q.y, q.z)), 0.0)
+	box := V3{1, 2, 3}
+	for _, p := range []V3{{2, 3, 4}, {0.5, 0.5, 0.5}, {3, 0, 0}} {
+		q := p.Abs().Sub(box)
+		d := q.MaxScalar(0).Length() + Min(q.MaxComponent(), 0)
+		if Abs(d-sdf_box3d(p, box)) > TOLERANCE {
+			t.Error("FAIL")
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_SmoothMinMax(t *testing.T) {
+	ab := [][2]float64{{0.3, 0.7}, {-0.2, 0.5}, {-1, -0.4}, {2, 2}, {5, 0.1}}
+	for _, x := range ab {
+		a, b := x[0], x[1]
+		// k = 0 is the plain min/max
+		if Smin(a, b, 0) != Min(a, b) || Smax(a, b, 0) != Max(a, b) {
+			t.Error("FAIL")
+		}
+		// the blend is no more than k/4
+		if d := Min(a, b) - Smin(a, b, 0.4); d < -TOLERANCE || d > 0.1+TOLERANCE {
+			t.Error("FAIL")
+		}
+		if Smax(a, b, 0.4) != -Smin(-a, -b, 0.4) {
+			t.Error("FAIL")
+		}
+		// PolyMin/PolyMax are the same math
+		if PolyMin(0.4)(a, b) != Smin(a, b, 0.4) || PolyMax(0.4)(a, b) != Smax(a, b, 0.4) {
+			t.Error("FAIL")
+		}
+		// and reduce to min/max as k -> 0
+		for _, k := range []float64{1e-3, 1e-6, 1e-9} {
+			if Abs(Smin(a, b, k)-Min(a, b)) > k/4+EPSILON || Abs(Smax(a, b, k)-Max(a, b)) > k/4+EPSILON {
+				t.Error("FAIL")
+			}
+		}
+	}
+	if Mix(1, 3, 0.25) != 1.5 || Clamp(2, -1, 1) != 1 || Clamp(-2, -1, 1) != -1 || Clamp(0.5, -1, 1) != 0.5 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Polygon2DWithHoles(t *testing.T) {
+	outer := []V2{{-2, -2}, {2, -2}, {2, 2}, {-2, 2}}
+	// clockwise hole
+	hole := []V2{{-1, -1}, {-1, 1}, {1, 1}, {1, -1}}
+	s := Polygon2DWithHoles(outer, [][]V2{hole}, FILL_NONZERO)
+	if s.Evaluate(V2{0, 0}) != 1 {
+		// the center is empty, 1 from the hole edge
+		t.Error("FAIL")
+	}
+	if s.Evaluate(V2{1.5, 0}) != -0.5 || s.Evaluate(V2{0, -1.5}) != -0.5 {
+		// the border is solid
+		t.Error("FAIL")
+	}
+	if s.Evaluate(V2{3, 0}) != 1 {
+		t.Error("FAIL")
+	}
+	// with even-odd the winding of the contours doesn't matter
+	s1 := Polygon2DWithHoles(reverse_vertices(outer), [][]V2{hole}, FILL_EVEN_ODD)
+	bb := s.BoundingBox()
+	for _, p := range bb.RandomSet(100) {
+		if Abs(s.Evaluate(p)-s1.Evaluate(p)) > TOLERANCE {
+			t.Error("FAIL")
+			break
+		}
+	}
+	// no holes
+	if Polygon2DWithHoles(outer, nil, FILL_NONZERO).Evaluate(V2{0, 0}) != -2 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_EqualsSnap(t *testing.T) {
+	a := V3{1, 2, 3}
+	// the EqualWithin tolerance is inclusive
+	if !a.EqualWithin(V3{1.5, 2, 3}, 0.5) || !a.EqualWithin(V3{1, 1.5, 3.5}, 0.5) {
+		t.Error("FAIL")
+	}
+	if a.EqualWithin(V3{1.5, 2, 3}, 0.4999) || a.EqualWithin(V3{1, 2, 3.5001}, 0.5) {
+		t.Error("FAIL")
+	}
+	// the Equals tolerance isn't
+	if a.Equals(V3{1.5, 2, 3}, 0.5) || !a.Equals(V3{1.5, 2, 3}, 0.5001) {
+		t.Error("FAIL")
+	}
+	// a zero tolerance is exact equality
+	if !a.EqualWithin(a, 0) || a.EqualWithin(V3{1, 2, math.Nextafter(3, 4)}, 0) {
+		t.Error("FAIL")
+	}
+	b := V2{1, 2}
+	if !b.EqualWithin(V2{0.75, 2.25}, 0.25) || b.EqualWithin(V2{0.75, 2.25}, 0.2499) || !b.EqualWithin(b, 0) {
+		t.Error("FAIL")
+	}
+	if b.Equals(V2{0.75, 2.25}, 0.25) {
+		t.Error("FAIL")
+	}
+	// snapping to a grid
+	if (V3{0.26, -0.74, 1.25}).Snap(0.5) != (V3{0.5, -0.5, 1.5}) {
+		t.Error("FAIL")
+	}
+	if (V2{0.24, -0.76}).Snap(0.5) != (V2{0, -1}) || (V2{3, -7}).Snap(1) != (V2{3, -7}) {
+		t.Error("FAIL")
+	}
+	// snapped points are on the grid
+	bb := Box3{V3{-10, -10, -10}, V3{10, 10, 10}}
+	for _, p := range bb.RandomSet(100) {
+		q := p.Snap(0.25)
+		if !q.Equals(p, 0.125) || q.DivScalar(0.25).Round() != q.DivScalar(0.25) {
+			t.Error("FAIL")
+			break
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_BezierFlatness(t *testing.T) {
+	// y = x * (2 - x) for x in [0, 2]
+	curve := func(flatness float64) ([]V2, float64) {
+		SetSeed(1)
+		b := NewBezier()
+		b.Add(0, 0)
+		b.Add(1, 2).Mid()
+		b.Add(2, 0)
+		if flatness > 0 {
+			b.SetFlatness(flatness)
+		}
+		v := b.Polygon().Vertices()
+		// worst distance from the midpoint of the edges to the curve
+		e := 0.0
+		for i := 0; i < len(v)-1; i++ {
+			m := v[i].Add(v[i+1]).MulScalar(0.5)
+			e = Max(e, Abs(m.Y-m.X*(2-m.X)))
+		}
+		return v, e
+	}
+	v0, e0 := curve(0)
+	v1, e1 := curve(BezierFlatness)
+	v2, e2 := curve(0.002)
+	if len(v0) != len(v1) || e0 != e1 {
+		// the default flatness
+		t.Error("FAIL")
+	}
+	if len(v2) <= len(v0) || e2 >= e0 || e2 > 1e-3 {
+		t.Error("FAIL")
+	}
+	// the vertices are on the curve
+	for _, p := range v2 {
+		if Abs(p.Y-p.X*(2-p.X)) > TOLERANCE {
+			t.Error("FAIL")
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_BezierLength(t *testing.T) {
+	// cubic approximation of a unit quarter circle
+	k := 4 * (math.Sqrt2 - 1) / 3
+	b := NewBezier()
+	b.Add(1, 0)
+	b.Add(1, k).Mid()
+	b.Add(k, 1).Mid()
+	b.Add(0, 1)
+	// the radial error of the approximation is < 3e-4
+	if Abs(b.Length()-PI/2) > 3e-4*PI/2 {
+		t.Error("FAIL")
+	}
+	if !b.PointAt(0).Equals(V2{1, 0}, TOLERANCE) || !b.PointAt(1).Equals(V2{0, 1}, TOLERANCE) {
+		t.Error("FAIL")
+	}
+	if !b.TangentAt(0).Equals(V2{0, 1}, TOLERANCE) || !b.TangentAt(1).Equals(V2{-1, 0}, TOLERANCE) {
+		t.Error("FAIL")
+	}
+	// the curve is symmetric about y = x
+	p := b.PointAt(0.5)
+	if Abs(p.X-p.Y) > TOLERANCE || Abs(p.Length()-1) > 3e-4 {
+		t.Error("FAIL")
+	}
+	if !b.TangentAt(0.5).Equals(V2{-1, 1}.Normalize(), TOLERANCE) {
+		t.Error("FAIL")
+	}
+	// a polyline has the exact length, each segment covers an equal range of t
+	l := NewBezier()
+	l.Add(0, 0)
+	l.Add(3, 0)
+	l.Add(3, 4)
+	if Abs(l.Length()-7) > 1e-9 || !l.PointAt(0.25).Equals(V2{1.5, 0}, TOLERANCE) || !l.PointAt(0.75).Equals(V2{3, 2}, TOLERANCE) {
+		t.Error("FAIL")
+	}
+	// the length is the limit of the polygon perimeter
+	SetSeed(1)
+	b.SetFlatness(1e-3)
+	v := b.Polygon().Vertices()
+	perimeter := 0.0
+	for i := 0; i < len(v)-1; i++ {
+		perimeter += v[i+1].Sub(v[i]).Length()
+	}
+	if perimeter > b.Length() || b.Length()-perimeter > 1e-5 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_BezierArc(t *testing.T) {
+	// a rounded slot, 4 long with radius 1
+	b := NewBezier()
+	b.AddPolyline([]V2{{-1, -1}, {1, -1}})
+	b.AddArc(V2{1, 0}, 1, -PI/2, PI/2)
+	b.AddPolyline([]V2{{1, 1}, {-1, 1}})
+	b.AddArc(V2{-1, 0}, 1, PI/2, 3*PI/2)
+	b.Close()
+	SetSeed(1)
+	s := Polygon2D(b.Polygon().Vertices())
+	slot := Stadium2D(4, 1)
+	bb := slot.BoundingBox().ScaleAboutCenter(1.5)
+	for _, p := range bb.RandomSet(1000) {
+		if Abs(s.Evaluate(p)-slot.Evaluate(p)) > 1e-3 {
+			t.Error("FAIL")
+			break
+		}
+	}
+	// 2 lines + 2 arcs of 2 cubic splines each, no repeated vertices
+	if len(b.splines()) != 6 {
+		t.Error("FAIL")
+	}
+	if b.Length() < 4+2*PI-1e-3 || b.Length() > 4+2*PI+1e-3 {
+		t.Error("FAIL")
+	}
+	if !b.PointAt(0.1).Equals(V2{0.2, -1}, TOLERANCE) {
+		t.Error("FAIL")
+	}
+	// a clockwise arc
+	c := NewBezier()
+	c.AddArc(V2{0, 0}, 2, PI, 0)
+	if !c.PointAt(0.5).Equals(V2{0, 2}, TOLERANCE) || !c.TangentAt(0.5).Equals(V2{1, 0}, TOLERANCE) {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_BezierSDF2(t *testing.T) {
+	curve := func() *Bezier {
+		b := NewBezier()
+		b.Add(-2, 0)
+		b.Add(0, 3).Mid()
+		b.Add(2, 0)
+		b.Add(0, -1).Mid()
+		b.Close()
+		return b
+	}
+	for _, tol := range []float64{0, 0.01} {
+		SetSeed(1)
+		b := curve()
+		b.SetSimplify(tol)
+		s0 := b.SDF2()
+		SetSeed(1)
+		s1 := Polygon2D(Simplify2D(curve().Polygon().Vertices(), tol))
+		if len(s0.(*PolySDF2).Vertices()) != len(s1.(*PolySDF2).Vertices()) {
+			t.Error("FAIL")
+		}
+		bb := s1.BoundingBox().ScaleAboutCenter(1.2)
+		for _, p := range bb.RandomSet(200) {
+			if s0.Evaluate(p) != s1.Evaluate(p) {
+				t.Error("FAIL")
+				break
+			}
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_PolygonWinding(t *testing.T) {
+	ccw := Polygon2D([]V2{{-1, -1}, {1, -1}, {1, 1}, {-1, 1}})
+	cw := Polygon2D([]V2{{-1, -1}, {-1, 1}, {1, 1}, {1, -1}})
+	// both are solid inside
+	for _, s := range []SDF2{ccw, cw} {
+		if s.Evaluate(V2{0, 0}) != -1 || s.Evaluate(V2{0.5, 0}) != -0.5 || s.Evaluate(V2{3, 0}) != 2 {
+			t.Error("FAIL")
+		}
+	}
+	bb := Box2{V2{-2, -2}, V2{2, 2}}
+	for _, p := range bb.RandomSet(100) {
+		if ccw.Evaluate(p) != cw.Evaluate(p) {
+			t.Error("FAIL")
+			break
+		}
+	}
+	// with the winding preserved the clockwise square is a hole
+	ccw.(*PolySDF2).SetPreserveWinding(true)
+	cw.(*PolySDF2).SetPreserveWinding(true)
+	if ccw.Evaluate(V2{0, 0}) != -1 || cw.Evaluate(V2{0, 0}) != 1 || cw.Evaluate(V2{3, 0}) != -2 {
+		t.Error("FAIL")
+	}
+	outer := Polygon2D([]V2{{-2, -2}, {2, -2}, {2, 2}, {-2, 2}})
+	for _, p := range bb.RandomSet(100) {
+		inside := Abs(p.X) > 1 || Abs(p.Y) > 1
+		if (Max(outer.Evaluate(p), cw.Evaluate(p)) < 0) != inside {
+			t.Error("FAIL")
+			break
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_TextOptions(t *testing.T) {
+	f, err := truetype.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	render := func(txt *Text) SDF2 {
+		SetSeed(1)
+		s, err := TextSDF2(f, txt, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	// the options are the same as the setters
+	s0 := render(NewTextWithOptions("AV\nAV", WithAlign(L_ALIGN), WithTracking(2), WithLineSpacing(2), WithOverlap(0)))
+	txt := NewText("AV\nAV")
+	txt.halign = L_ALIGN
+	txt.SetTracking(2)
+	txt.SetLineSpacing(2)
+	txt.SetOverlap(0)
+	s1 := render(txt)
+	bb := s0.BoundingBox()
+	if bb != s1.BoundingBox() {
+		t.Error("FAIL")
+	}
+	for _, p := range bb.RandomSet(200) {
+		if s0.Evaluate(p) != s1.Evaluate(p) {
+			t.Error("FAIL")
+			break
+		}
+	}
+	// tracking adds space between the 2 characters, line spacing adds a
+	// line height (the text height) between the 2 lines
+	plain := render(NewTextWithOptions("AV\nAV", WithAlign(L_ALIGN), WithOverlap(0))).BoundingBox().Size()
+	size := bb.Size()
+	if Abs(size.X-plain.X-2) > 1e-6 || Abs(size.Y-plain.Y-10) > 1e-6 {
+		t.Error("FAIL")
+	}
+	// negative tracking tightens the text
+	tight := render(NewTextWithOptions("AV", WithTracking(-0.5), WithOverlap(0))).BoundingBox().Size()
+	one := render(NewTextWithOptions("AV", WithOverlap(0))).BoundingBox().Size()
+	if Abs(one.X-tight.X-0.5) > 1e-6 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_FillRule(t *testing.T) {
+	// two overlapping counter-clockwise squares
+	a := []V2{{-2, -1}, {1, -1}, {1, 1}, {-2, 1}}
+	b := []V2{{-1, -1}, {2, -1}, {2, 1}, {-1, 1}}
+	nz := Polygon2DWithHoles(a, [][]V2{b}, FILL_NONZERO)
+	eo := Polygon2DWithHoles(a, [][]V2{b}, FILL_EVEN_ODD)
+	// the overlap is solid for nonzero, empty for even-odd
+	if nz.Evaluate(V2{0, 0}) >= 0 || eo.Evaluate(V2{0, 0}) <= 0 {
+		t.Error("FAIL")
+	}
+	// elsewhere they are the same
+	for _, p := range []V2{{-1.5, 0}, {1.5, 0}, {3, 0}, {0, 2}} {
+		if nz.Evaluate(p) != eo.Evaluate(p) {
+			t.Error("FAIL")
+		}
+	}
+	if nz.BoundingBox() != (Box2{V2{-2, -1}, V2{2, 1}}) {
+		t.Error("FAIL")
+	}
+	// a hole with the same winding is a hole for even-odd only
+	outer := []V2{{-2, -2}, {2, -2}, {2, 2}, {-2, 2}}
+	hole := []V2{{-1, -1}, {1, -1}, {1, 1}, {-1, 1}}
+	if Polygon2DWithHoles(outer, [][]V2{hole}, FILL_NONZERO).Evaluate(V2{0, 0}) != -1 {
+		t.Error("FAIL")
+	}
+	if Polygon2DWithHoles(outer, [][]V2{hole}, FILL_EVEN_ODD).Evaluate(V2{0, 0}) != 1 {
+		t.Error("FAIL")
+	}
+	// with a hole of the opposite winding nonzero is a difference
+	s0 := Polygon2DWithHoles(outer, [][]V2{reverse_vertices(hole)}, FILL_NONZERO)
+	s1 := Difference2D(Polygon2D(outer), Polygon2D(hole))
+	for _, p := range []V2{{0, 0}, {1.5, 0}, {0, -1.2}, {3, 3}} {
+		if Abs(s0.Evaluate(p)-s1.Evaluate(p)) > TOLERANCE {
+			t.Error("FAIL")
+		}
+	}
+	// a font with well formed curves is the same for both rules
+	f, err := truetype.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetSeed(1)
+	g0, _ := TextSDF2(f, NewTextWithOptions("BO8", WithOverlap(0)), 10)
+	SetSeed(1)
+	g1, _ := TextSDF2(f, NewTextWithOptions("BO8", WithOverlap(0), WithFillRule(FILL_EVEN_ODD)), 10)
+	bb := g0.BoundingBox()
+	for _, p := range bb.RandomSet(500) {
+		if Abs(g0.Evaluate(p)-g1.Evaluate(p)) > 1e-9 || (g0.Evaluate(p) < 0) != (g1.Evaluate(p) < 0) {
+			t.Error("FAIL")
+			break
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_ProjectToSurface3(t *testing.T) {
+	s := Sphere3D(5)
+	bb := Box3{V3{-10, -10, -10}, V3{10, 10, 10}}
+	for _, p := range bb.RandomSet(100) {
+		if p.Length() < 0.5 {
+			continue
+		}
+		q, ok := ProjectToSurface3(s, p, 20)
+		if !ok || Abs(s.Evaluate(q)) > 1e-5 {
+			t.Error("FAIL")
+		}
+	}
+	// a distance field that overestimates still converges
+	q, ok := ProjectToSurface3(ScaleDistance3D(s, 3), V3{2, 1, -1}, 50)
+	if !ok || Abs(s.Evaluate(q)) > 1e-5 {
+		t.Error("FAIL")
+	}
+	// no gradient at the center
+	if _, ok := ProjectToSurface3(s, V3{}, 20); ok {
+		t.Error("FAIL")
+	}
+	// far away in empty space
+	if _, ok := ProjectToSurface3(s, V3{100, 0, 0}, 20); ok {
+		t.Error("FAIL")
+	}
+	// not enough steps
+	box := Box3D(V3{1, 1, 1}, 0.1)
+	if _, ok := ProjectToSurface3(ScaleDistance3D(box, 0.01), V3{1, 0, 0}, 3); ok {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_EmbossText3D(t *testing.T) {
+	base := Box3D(V3{20, 20, 4}, 0)
+	text := Box2D(V2{6, 6}, 0)
+	blend := 0.5
+	// second difference of s along a line through an edge of the text
+	// (stopping short of the kink in the distance inside the text)
+	curvature := func(s SDF3, p, dir V3) float64 {
+		h := 0.01
+		kmax := 0.0
+		for i := -50; i <= 100; i++ {
+			q := p.Add(dir.MulScalar(float64(i) * h))
+			f0 := s.Evaluate(q.Sub(dir.MulScalar(h)))
+			f1 := s.Evaluate(q)
+			f2 := s.Evaluate(q.Add(dir.MulScalar(h)))
+			kmax = Max(kmax, Abs(f0-2*f1+f2)/(h*h))
+		}
+		return kmax
+	}
+	for _, depth := range []float64{1, -1} {
+		hard := EmbossText3D(base, text, 2, depth, 0, 0)
+		soft := EmbossText3D(base, text, 2, depth, blend, 0)
+		// just off the base surface across the edge of the text
+		z := 2 + 0.1*depth
+		if curvature(hard, V3{3, 0, z}, V3{1, 0, 0}) < 10 {
+			t.Error("FAIL")
+		}
+		if curvature(soft, V3{3, 0, z}, V3{1, 0, 0}) > 2/blend {
+			t.Error("FAIL")
+		}
+		// away from the edges the blend has no effect
+		for _, p := range []V3{{0, 0, 2 + 1.5*depth}, {8, 8, 2.2}, {0, 0, -1}, {3, 0, 2 + 2*depth}} {
+			if Abs(hard.Evaluate(p)-soft.Evaluate(p)) > TOLERANCE {
+				t.Error("FAIL")
+			}
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_DraftExtrude3D(t *testing.T) {
+	f, err := truetype.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := TextSDF2(f, NewText("I"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// find the right edge of the stem
+	c := text.BoundingBox().Center()
+	x0, x1 := c.X, text.BoundingBox().Max.X
+	for i := 0; i < 50; i++ {
+		if x := 0.5 * (x0 + x1); text.Evaluate(V2{x, c.Y}) < 0 {
+			x0 = x
+		} else {
+			x1 = x
+		}
+	}
+	base := Box3D(V3{20, 20, 4}, 0)
+	draft := DtoR(10)
+	for _, depth := range []float64{1, -1} {
+		s := EmbossText3D(base, text, 2, depth, 0, draft)
+		// start just outside the right wall of the letter, half way up (or down)
+		p := V3{x0 + 0.1*depth, c.Y, 2 + depth/2}
+		q, ok := ProjectToSurface3(s, p, 20)
+		if !ok {
+			t.Error("FAIL")
+			continue
+		}
+		n := Normal3(s, q, 1e-5)
+		// the wall is tilted up by the draft angle
+		if Abs(math.Asin(n.Z)-draft) > DtoR(0.1) || n.X*depth < 0 {
+			t.Error("FAIL")
+		}
+	}
+	// the walls of a plain extrusion lean in by the draft
+	s := DraftExtrude3D(Box2D(V2{4, 4}, 0), 2, draft)
+	for _, z := range []float64{-0.5, 0, 0.5} {
+		if Abs(s.Evaluate(V3{2 - z*math.Tan(draft), 0, z})) > 1e-9 {
+			t.Error("FAIL")
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_UnionMany2D(t *testing.T) {
+	bb := Box2{V2{-20, -20}, V2{20, 20}}
+	var x []SDF2
+	for _, p := range bb.RandomSet(100) {
+		x = append(x, Transform2D(Circle2D(0.5), Translate2d(p)))
+	}
+	s0 := Union2D(x...)
+	s1 := UnionMany2D(UnionMany2D(x[:50]...), UnionMany2D(x[50:]...))
+	if len(s1.(*UnionManySDF2).sdf) != 100 {
+		t.Error("FAIL")
+	}
+	if s0.BoundingBox() != s1.BoundingBox() {
+		t.Error("FAIL")
+	}
+	bb = s0.BoundingBox().ScaleAboutCenter(1.2)
+	for _, p := range bb.RandomSet(1000) {
+		if s0.Evaluate(p) != s1.Evaluate(p) {
+			t.Error("FAIL")
+		}
+	}
+	// objects that can be closer than their bounding box are evaluated for
+	// every point, the distance is still the minimum over all the objects
+	blend := Union2D(x[2], x[3])
+	blend.(*UnionSDF2).SetMin(PolyMin(2))
+	mixed := []SDF2{
+		x[0],
+		Offset2D(x[1], -0.2),
+		blend,
+		Transform2D(Star2D(5, 3, 1), Translate2d(V2{10, 10})),
+		Transform2D(Circle2D(1), Scale2d(V2{3, 1}).Mul(Translate2d(V2{-10, 5}))),
+		Transform2D(Box2D(V2{2, 3}, 0.5), Rotate2d(1).Mul(Translate2d(V2{5, -10}))),
+		Polygon2D([]V2{{0, 0}, {4, 0}, {4, 1}, {1, 1}, {1, 4}, {0, 4}}),
+	}
+	mixed = append(mixed, x[4:20]...)
+	u := Union2D(mixed...).(*UnionSDF2)
+	s1 = UnionMany2D(mixed...)
+	if len(s1.(*UnionManySDF2).rest) != 4 {
+		t.Error("FAIL")
+	}
+	bb = u.BoundingBox().ScaleAboutCenter(1.2)
+	for _, p := range bb.RandomSet(10000) {
+		if u.Evaluate_Slow(p) != s1.Evaluate(p) {
+			t.Error("FAIL")
+		}
+	}
+}
+
+// Return the glyphs of a paragraph of text.
+func paragraph(b *testing.B) []SDF2 {
+	f, err := truetype.Parse(goregular.TTF)
+	if err != nil {
+		b.Fatal(err)
+	}
+	line := "The quick brown fox jumps over the lazy dog. "
+	text := line + line + "\n" + line + line + "\n" + line + line + "\n" + line + line
+	ss, _, err := text_glyphs(f, NewText(text), 10)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return ss
+}
+
+func Benchmark_UnionMany2D(b *testing.B) {
+	ss := paragraph(b)
+	nested := ss[0]
+	for _, x := range ss[1:] {
+		nested = Union2D(nested, x)
+	}
+	flat := UnionMany2D(ss...)
+	bb := flat.BoundingBox()
+	step := bb.Size().MaxComponent() / 400
+	b.Run("nested", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			MarchingSquares(nested, bb, step)
+		}
+	})
+	b.Run("flat", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			MarchingSquares(flat, bb, step)
+		}
+	})
+}
+
+//-----------------------------------------------------------------------------
+
+// Return the closed loops of a set of line segments, or false if some of
+// the segments don't join up. Zero length segments are ignored.
+func lineLoops(lines []*Line2_PP, tol float64) ([][]V2, bool) {
+	used := make([]bool, len(lines))
+	for i, l := range lines {
+		used[i] = l[0].Equals(l[1], tol)
+	}
+	var loops [][]V2
+	for i := range lines {
+		if used[i] {
+			continue
+		}
+		used[i] = true
+		loop := []V2{lines[i][0]}
+		end := lines[i][1]
+		for !end.Equals(loop[0], tol) {
+			next := -1
+			for j := range lines {
+				if !used[j] && (lines[j][0].Equals(end, tol) || lines[j][1].Equals(end, tol)) {
+					next = j
+					break
+				}
+			}
+			if next < 0 {
+				return nil, false
+			}
+			used[next] = true
+			loop = append(loop, end)
+			if lines[next][0].Equals(end, tol) {
+				end = lines[next][1]
+			} else {
+				end = lines[next][0]
+			}
+		}
+		loops = append(loops, loop)
+	}
+	return loops, true
+}
+
+func Test_MarchingSquaresAdaptive(t *testing.T) {
+	r := 10.0
+	s := Circle2D(r)
+	resolution := 0.2
+	uniform := MarchingSquares(s, s.BoundingBox().ScaleAboutCenter(1.1), resolution)
+	adaptive := MarchingSquaresAdaptive(s, resolution)
+	if len(adaptive) >= len(uniform) {
+		t.Error("FAIL")
+	}
+	u, ok := lineLoops(uniform, 1e-9)
+	if !ok || len(u) != 1 {
+		t.Fatal("FAIL")
+	}
+	a, ok := lineLoops(adaptive, 1e-9)
+	if !ok || len(a) != 1 {
+		t.Fatal("FAIL")
+	}
+	// the loops match
+	for _, p := range a[0] {
+		if d, _, _ := NearestOnPolyline(p, append(u[0], u[0][0])); d > 0.1*resolution {
+			t.Error("FAIL")
+		}
+	}
+	if Abs(PolygonArea2D(a[0])-PolygonArea2D(u[0])) > 0.01*PolygonArea2D(u[0]) {
+		t.Error("FAIL")
+	}
+	// sharp corners and holes refine without cracks
+	f, err := truetype.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := TextSDF2(f, NewText("SDFX 08"), 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ = lineLoops(MarchingSquares(text, text.BoundingBox().ScaleAboutCenter(1.01), 0.1), 1e-9)
+	a, ok = lineLoops(MarchingSquaresAdaptive(text, 0.1), 1e-9)
+	if !ok || len(a) != len(u) {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Center(t *testing.T) {
+	// an L shape, the centroid isn't the bounding box center
+	l2 := Union2D(
+		Transform2D(Box2D(V2{4, 1}, 0), Translate2d(V2{5, 3.5})),
+		Transform2D(Box2D(V2{1, 4}, 0), Translate2d(V2{3.5, 5})),
+	)
+	symmetric2 := func(bb Box2) bool {
+		return bb.Min.Neg().Equals(bb.Max, 1e-12)
+	}
+	if !symmetric2(Center2D(l2).BoundingBox()) || !symmetric2(CenterAndScale2D(l2, 3).BoundingBox()) {
+		t.Error("FAIL")
+	}
+	if !CenterAndScale2D(l2, 3).BoundingBox().Size().Equals(l2.BoundingBox().Size().MulScalar(3), 1e-12) {
+		t.Error("FAIL")
+	}
+	// a sample point moves with the bounding box center
+	p := V2{3.5, 3.5}
+	if Center2D(l2).Evaluate(p.Sub(l2.BoundingBox().Center())) != l2.Evaluate(p) {
+		t.Error("FAIL")
+	}
+	l3 := Union3D(
+		Transform3D(Box3D(V3{4, 1, 2}, 0), Translate3d(V3{5, 3.5, -7})),
+		Transform3D(Sphere3D(2), Translate3d(V3{3.5, 5, -6})),
+	)
+	symmetric3 := func(bb Box3) bool {
+		return bb.Min.Neg().Equals(bb.Max, 1e-12)
+	}
+	if !symmetric3(Center3D(l3).BoundingBox()) || !symmetric3(CenterAndScale3D(l3, 0.5).BoundingBox()) {
+		t.Error("FAIL")
+	}
+	if !CenterAndScale3D(l3, 0.5).BoundingBox().Size().Equals(l3.BoundingBox().Size().MulScalar(0.5), 1e-12) {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_FitToBox(t *testing.T) {
+	target := NewBox3(V3{10, 20, 30}, V3{1, 1, 1})
+	s := FitToBox3D(Sphere3D(1), target, true)
+	if !s.BoundingBox().Equals(target, 1e-12) {
+		t.Error("FAIL")
+	}
+	// radius 0.5, centered on the target
+	for _, d := range []V3{{0.5, 0, 0}, {0, -0.5, 0}, {0, 0, 0.5}} {
+		if Abs(s.Evaluate(target.Center().Add(d))) > 1e-12 {
+			t.Error("FAIL")
+		}
+	}
+	if Abs(s.Evaluate(target.Center())+0.5) > 1e-12 {
+		t.Error("FAIL")
+	}
+	// a wide plate
+	plate := Box2{V2{-30, -5}, V2{30, 5}}
+	logo := Box2D(V2{4, 1}, 0)
+	if !FitToBox2D(logo, plate, true).BoundingBox().Equals(Box2{V2{-20, -5}, V2{20, 5}}, 1e-12) {
+		t.Error("FAIL")
+	}
+	if !FitToBox2D(logo, plate, false).BoundingBox().Equals(plate, 1e-12) {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_GenerateSupports3D(t *testing.T) {
+	// a post with a ledge sticking out, over a step
+	post := Box3D(V3{2, 2, 10}, 0)
+	ledge := Transform3D(Box3D(V3{8, 2, 1}, 0), Translate3d(V3{4, 0, 4}))
+	step := Transform3D(Box3D(V3{2, 2, 2}, 0), Translate3d(V3{6, 0, -4}))
+	s := Union3D(post, ledge, step)
+	supports := GenerateSupports3D(s, DtoR(45), 0.4, 1)
+	if supports == nil {
+		t.Fatal("FAIL")
+	}
+	bb := supports.BoundingBox()
+	// under the ledge, from the plate to the bottom of the ledge
+	if bb.Min.X < 1-0.2 || bb.Max.X > 8+0.2 || Abs(bb.Min.Z+5) > 0.1 || Abs(bb.Max.Z-3.5) > 0.1 {
+		t.Error("FAIL")
+	}
+	// pillars reach the plate or stop on the step
+	plate, onStep := 0, 0
+	for _, x := range supports.(*UnionManySDF3).sdf {
+		bb := x.BoundingBox()
+		if Abs(bb.Min.Z+5) < 0.1 {
+			plate++
+		}
+		if Abs(bb.Min.Z+3) < 0.1 {
+			onStep++
+			if bb.Min.X < 5-0.2 || bb.Max.X > 7+0.2 {
+				t.Error("FAIL")
+			}
+		}
+	}
+	if plate == 0 || onStep == 0 || plate+onStep != len(supports.(*UnionManySDF3).sdf) {
+		t.Error("FAIL")
+	}
+	if supports.Evaluate(V3{6, 0, -3.5}) < 0 {
+		t.Error("FAIL")
+	}
+	// no supports for a flat bottomed box
+	if GenerateSupports3D(Box3D(V3{5, 3, 2}, 0), DtoR(45), 0.4, 1) != nil {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Raft3D(t *testing.T) {
+	part := Transform3D(Box3D(V3{6, 4, 3}, 0), Translate3d(V3{1, 2, 8}))
+	margin := 2.0
+	thickness := 1.0
+	raft := Raft3D(part, margin, thickness)
+	// just below the part
+	bb := raft.BoundingBox()
+	if Abs(bb.Max.Z-6.5) > 1e-9 || Abs(bb.Min.Z-5.5) > 1e-9 {
+		t.Error("FAIL")
+	}
+	// the footprint grown by margin
+	grown := Transform2D(Offset2D(Box2D(V2{6, 4}, 0), margin), Translate2d(V2{1, 2}))
+	b2 := grown.BoundingBox().ScaleAboutCenter(1.5)
+	for _, p := range b2.RandomSet(1000) {
+		d := grown.Evaluate(p)
+		if d < -0.5*thickness {
+			continue
+		}
+		if Abs(raft.Evaluate(V3{p.X, p.Y, 6})-d) > 1e-3 {
+			t.Error("FAIL")
+		}
+	}
+	// the brim is a ring around the footprint
+	brim := Brim2D(part, margin)
+	if brim.Evaluate(V2{1, 2}) <= 0 || brim.Evaluate(V2{1 + 3 + 0.5*margin, 2}) >= 0 || brim.Evaluate(V2{1 + 3 + 1.5*margin, 2}) <= 0 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_HollowForResin3D(t *testing.T) {
+	s := Sphere3D(10)
+	h := HollowForResin3D(s, 1, 2, []V3{{0, 0, -11}, {7, 7, 0}})
+	// hollow, with the outside unchanged
+	if h.Evaluate(V3{}) <= 0 || h.Evaluate(V3{0, 9.5, 0}) >= 0 {
+		t.Error("FAIL")
+	}
+	if Abs(h.Evaluate(V3{0, 12, 0})-2) > 1e-9 || Abs(h.Evaluate(V3{0, 8, 0})-1) > 1e-9 {
+		t.Error("FAIL")
+	}
+	// the drain holes connect the inside to the outside
+	for _, dir := range []V3{{0, 0, -1}, V3{1, 1, 0}.Normalize()} {
+		for r := 0.0; r < 12; r += 0.05 {
+			if h.Evaluate(dir.MulScalar(r)) <= 0 {
+				t.Error("FAIL")
+				break
+			}
+		}
+	}
+	// but not elsewhere
+	if h.Evaluate(V3{0, 0, 9.5}) >= 0 || h.Evaluate(V3{-7.07, -7.07, 0}) >= 0 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_KernOverride(t *testing.T) {
+	f, err := truetype.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := 10.0
+	scale := fixed.Int26_6(f.FUnitsPerEm())
+	ah := float64(f.VMetric(scale, f.Index('\n')).AdvanceHeight)
+	em := float64(f.FUnitsPerEm())
+	width := func(opts ...TextOption) float64 {
+		s, err := TextSDF2(f, NewTextWithOptions("WAVE", append(opts, WithOverlap(0))...), h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s.BoundingBox().Size().X
+	}
+	w0 := width()
+	// replace the kerning of one pair
+	ov := -0.1
+	w1 := width(WithKernOverride(map[[2]rune]float64{{'A', 'V'}: ov}))
+	dw := (ov*em - Kerning(f, 'A', 'V')) * h / ah
+	if Abs(w1-w0-dw) > 1e-9 {
+		t.Error("FAIL")
+	}
+	// the order of a pair matters, a pair that isn't in the text does nothing
+	if width(WithKernOverride(map[[2]rune]float64{{'V', 'A'}: ov, {'X', 'Y'}: 1})) != w0 {
+		t.Error("FAIL")
+	}
+	// the map is copied
+	kern := map[[2]rune]float64{{'A', 'V'}: ov}
+	text := NewText("WAVE")
+	text.SetKernOverride(kern)
+	kern[[2]rune{'A', 'V'}] = 0
+	text.SetOverlap(0)
+	s, _ := TextSDF2(f, text, h)
+	if Abs(s.BoundingBox().Size().X-w1) > 1e-9 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_UpAxis(t *testing.T) {
+	s := Box3D(V3{1, 2, 3}, 0.1)
+	k := RenderParms{MeshCells: 30, Up: Y_UP}
+	m := k.RenderMesh(s)
+	// the height (z) is along y
+	v := m.Vertices()
+	bb := Box3{v.Min(), v.Max()}
+	if !bb.Size().Equals(V3{1, 3, 2}, 0.05) || !bb.Center().Equals(V3{}, 1e-3) {
+		t.Error("FAIL")
+	}
+	// the triangles still face outwards
+	for _, tri := range m.Triangles {
+		c := tri.V[0].Add(tri.V[1]).Add(tri.V[2])
+		if n := tri.Normal(); !math.IsNaN(n.X) && n.Dot(c) < 0 {
+			t.Error("FAIL")
+			break
+		}
+	}
+	// the OBJ vertex normals are mapped with the vertices
+	dir, err := ioutil.TempDir("", "sdfx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "box.obj")
+	k.RenderOBJ(s, path)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ymax, nup float64
+	for _, l := range strings.Split(string(data), "\n") {
+		var x, y, z float64
+		if n, _ := fmt.Sscanf(l, "v %g %g %g", &x, &y, &z); n == 3 {
+			ymax = Max(ymax, y)
+		}
+		if n, _ := fmt.Sscanf(l, "vn %g %g %g", &x, &y, &z); n == 3 && y > 0.999 {
+			nup++
+		}
+	}
+	if Abs(ymax-1.5) > 0.05 || nup == 0 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_RenderSweep(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sdfx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	values := []float64{0.5, 1, 1.5}
+	gen := func(p float64) SDF3 { return Shell3D(Box3D(V3{4, 4, 4}, 0), p) }
+	for _, parallel := range []bool{false, true} {
+		pattern := filepath.Join(dir, fmt.Sprintf("wall_%v_%%02d.stl", parallel))
+		RenderSweep(gen, values, 0.25, pattern, parallel)
+		for i, v := range values {
+			m, err := LoadSTL(fmt.Sprintf(pattern, i))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the outside of the shell is at 2 + v/2
+			bb := NewMesh(m).Vertices()
+			if Abs(bb.Max().X-(2+v/2)) > 0.05 {
+				t.Error("FAIL")
+			}
+		}
+		files, _ := filepath.Glob(filepath.Join(dir, fmt.Sprintf("wall_%v_*", parallel)))
+		if len(files) != len(values) {
+			t.Error("FAIL")
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Fingerprint(t *testing.T) {
+	model := func(r float64) SDF3 {
+		body := Cylinder3D(10, r, 1)
+		hole := Transform3D(Cylinder3D(12, 1, 0), Translate3d(V3{2, 0, 0}))
+		return Difference3D(Union3D(body, Box3D(V3{4, 4, 12}, 0)), hole)
+	}
+	fp := func(s SDF3) string {
+		h, err := FingerprintSDF3(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	a := fp(model(5))
+	// built separately, but the same
+	if fp(model(5)) != a || len(a) != 64 {
+		t.Error("FAIL")
+	}
+	// a different radius
+	if fp(model(5.001)) == a {
+		t.Error("FAIL")
+	}
+	// evaluation doesn't change the fingerprint
+	s, _ := Counted3D(model(5))
+	b := fp(s)
+	s.Evaluate(V3{})
+	if fp(s) != b {
+		t.Error("FAIL")
+	}
+	// 2D models, including some with maps and slices
+	f, err := truetype.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := func(k float64) SDF2 {
+		// the glyph curves are randomly sampled
+		SetSeed(DEFAULT_SEED)
+		tx := NewText("Ab")
+		tx.SetKernOverride(map[[2]rune]float64{{'A', 'b'}: k, {'b', 'A'}: 0})
+		s, err := TextSDF2(f, tx, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	h0, err0 := FingerprintSDF2(text(0.1))
+	h1, err1 := FingerprintSDF2(text(0.1))
+	h2, err2 := FingerprintSDF2(text(0.2))
+	if err0 != nil || err1 != nil || err2 != nil || h0 != h1 || h0 == h2 {
+		t.Error("FAIL")
+	}
+	// closures can't be fingerprinted
+	if _, err := FingerprintSDF3(UnionSmooth3D(1, SMOOTH_POLY, Sphere3D(1), Box3D(V3{1, 1, 1}, 0))); err == nil {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// a model with all the detail at the bottom, and the sample grid for it
+func unevenModel() (SDF3, Box3, V3i) {
+	var parts []SDF3
+	for x := 0; x < 20; x++ {
+		for y := 0; y < 20; y++ {
+			parts = append(parts, Transform3D(Sphere3D(0.4), Translate3d(V3{float64(x), float64(y), 0})))
+		}
+	}
+	parts = append(parts, Transform3D(Box3D(V3{20, 20, 1}, 0), Translate3d(V3{9.5, 9.5, 20})))
+	return UnionMany3D(parts...), Box3{V3{0, 0, -1}, V3{19.5, 19.5, 20.45}}, V3i{39, 39, 39}
+}
+
+// static split: each worker gets an equal range of z-slabs
+func Benchmark_EvaluateStatic(b *testing.B) {
+	s, bb, steps := unevenModel()
+	inc := bb.Size().Div(steps.ToV3())
+	n := runtime.NumCPU()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var wg sync.WaitGroup
+		for w := 0; w < n; w++ {
+			wg.Add(1)
+			go func(z0, z1 int) {
+				for z := z0; z < z1; z++ {
+					for x := 0; x <= steps[0]; x++ {
+						for y := 0; y <= steps[1]; y++ {
+							s.Evaluate(bb.Min.Add(V3{float64(x), float64(y), float64(z)}.Mul(inc)))
+						}
+					}
+				}
+				wg.Done()
+			}((steps[2]+1)*w/n, (steps[2]+1)*(w+1)/n)
+		}
+		wg.Wait()
+	}
+}
+
+// the mesher: the workers take 100 point batches from a shared channel, so
+// the workers with the empty slabs take more batches
+func Benchmark_EvaluateLayers(b *testing.B) {
+	s, bb, steps := unevenModel()
+	inc := bb.Size().Div(steps.ToV3())
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l := NewLayerYZ(bb.Min, inc, steps)
+		for x := 0; x <= steps[0]; x++ {
+			l.Evaluate(s, x)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_DifferenceCoplanar(t *testing.T) {
+	// the top of the pocket is coplanar with the top of the base
+	base := Box3D(V3{10, 10, 10}, 0)
+	cut := Transform3D(Box3D(V3{4, 4, 5}, 0), Translate3d(V3{0, 0, 2.5}))
+	s := Difference3D(base, cut)
+	// the difference is exact
+	if s.Evaluate(V3{0, 0, 5}) != 0 || s.Evaluate(V3{1, 1, 1}) != 1 {
+		t.Error("FAIL")
+	}
+	// sampled on the coincident faces the mesh is still manifold, the
+	// distance field difference needs no epsilon
+	k := RenderParms{MeshCells: 20, Snap: true}
+	m := k.RenderMesh(s)
+	if ok, _ := m.IsManifold(); !ok || !m.IsWatertight() {
+		t.Error("FAIL")
+	}
+	m = NewMesh(MarchingCubes(s, Box3{V3{-6, -6, -6}, V3{6, 6, 6}}, 0.5))
+	if ok, _ := m.IsManifold(); !ok || !m.IsWatertight() {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Slot(t *testing.T) {
+	length, width := 10.0, 4.0
+	s := Slot2D(length, width)
+	bb := s.BoundingBox()
+	if !bb.Min.Equals(V2{-7, -2}, 1e-9) || !bb.Max.Equals(V2{7, 2}, 1e-9) {
+		t.Error("FAIL")
+	}
+	// the straight sides
+	for _, x := range []float64{-5, -2, 0, 3, 5} {
+		if Abs(s.Evaluate(V2{x, 2})) > 1e-9 || Abs(s.Evaluate(V2{x, -1})+1) > 1e-9 {
+			t.Error("FAIL")
+		}
+	}
+	// the semicircular ends
+	for i := 0; i <= 10; i++ {
+		a := PI * (float64(i)/10 - 0.5)
+		p := V2{math.Cos(a), math.Sin(a)}.MulScalar(2)
+		if Abs(s.Evaluate(p.Add(V2{5, 0}))) > 1e-9 || Abs(s.Evaluate(V2{-5, 0}.Sub(p))) > 1e-9 {
+			t.Error("FAIL")
+		}
+	}
+	// the through slot cuts the part from z = 0 to z = -3
+	h := SlotHole3D(length, width, 3)
+	for _, z := range []float64{0, -1.5, -3} {
+		if Abs(h.Evaluate(V3{7, 0, z})) > 1e-9 || Abs(h.Evaluate(V3{0, 2, z})) > 1e-9 {
+			t.Error("FAIL")
+		}
+	}
+	// the counter bore is at the top
+	cb := CounterBored_Slot3D(6, length, width, 8, 2)
+	if Abs(cb.Evaluate(V3{9, 0, 2.5})) > 1e-9 || Abs(cb.Evaluate(V3{7, 0, 0})) > 1e-9 || Abs(cb.Evaluate(V3{0, 4, 2.5})) > 1e-9 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_FastenerPockets(t *testing.T) {
+	for _, name := range []string{"M3", "M4", "M5", "M6", "M8", "M10"} {
+		f := FastenerLookup(name)
+		s := f.NutPocket3D()
+		z := -0.5 * f.Nut_Height
+		// across the flats (with a flat normal to y and one at 30 degrees)
+		af := 0.0
+		for _, a := range []float64{DtoR(90), DtoR(30), DtoR(-150)} {
+			u := V2{math.Cos(a), math.Sin(a)}
+			x0, x1 := 0.0, f.Nut_Flat2Flat
+			for i := 0; i < 60; i++ {
+				x := 0.5 * (x0 + x1)
+				if s.Evaluate(V3{u.X * x, u.Y * x, z}) < 0 {
+					x0 = x
+				} else {
+					x1 = x
+				}
+			}
+			af += x0
+		}
+		if Abs(af/1.5-f.Nut_Flat2Flat) > 1e-9 {
+			t.Error("FAIL")
+		}
+		// the bottom of the pocket
+		if Abs(s.Evaluate(V3{0, 0, -f.Nut_Height})) > 1e-9 {
+			t.Error("FAIL")
+		}
+		// the cap head recess
+		c := f.CapHeadPocket3D()
+		if Abs(c.Evaluate(V3{f.CapHead_Dia / 2, 0, -0.5 * f.CapHead_Height})) > 1e-9 ||
+			Abs(c.Evaluate(V3{f.Clearance / 2, 0, -2 * f.CapHead_Height})) > 1e-9 ||
+			c.Evaluate(V3{0, 0, 1e-3}) >= 0 {
+			t.Error("FAIL")
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_BaseChamfer(t *testing.T) {
+	profile := Box2D(V2{10, 6}, 0)
+	s := Extrude3D(profile, 4)
+	s.(*ExtrudeSDF3).SetBaseChamfer(0.5)
+	// the edge in x at height z
+	edge := func(z float64) float64 {
+		x0, x1 := 0.0, 10.0
+		for i := 0; i < 60; i++ {
+			x := 0.5 * (x0 + x1)
+			if s.Evaluate(V3{x, 0, z}) < 0 {
+				x0 = x
+			} else {
+				x1 = x
+			}
+		}
+		return x0
+	}
+	// the base is larger by the chamfer, then tapers at 45 degrees
+	if Abs(edge(-2+1e-9)-5.5) > 1e-6 || Abs(edge(-1.75)-5.25) > 1e-6 {
+		t.Error("FAIL")
+	}
+	// the rest is the nominal profile
+	for _, z := range []float64{-1.5 + 1e-9, 0, 1, 2 - 1e-9} {
+		if Abs(edge(z)-5) > 1e-6 {
+			t.Error("FAIL")
+		}
+	}
+	// the top face is unchanged
+	if s.Evaluate(V3{4, 2, 2}) != 0 || s.Evaluate(V3{4, 2, 3}) != 1 {
+		t.Error("FAIL")
+	}
+	bb := s.BoundingBox()
+	if !bb.Min.Equals(V3{-5.5, -3.5, -2}, 1e-9) || !bb.Max.Equals(V3{5.5, 3.5, 2}, 1e-9) {
+		t.Error("FAIL")
+	}
+	// back to the plain extrusion
+	s.(*ExtrudeSDF3).SetBaseChamfer(0)
+	if Abs(edge(-2+1e-9)-5) > 1e-6 || s.BoundingBox() != Extrude3D(profile, 4).BoundingBox() {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_TextMaterials3D(t *testing.T) {
+	f, err := truetype.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txt := NewTextRuns([]TextRun{{"AB", 1, 0, 1}, {"C", 1, 0, 2}})
+	parts, err := TextPartsSDF2(f, txt, 10)
+	if err != nil || len(parts) != 2 || parts[0].Material != 1 || parts[1].Material != 2 {
+		t.Fatal("FAIL")
+	}
+	// the parts are placed as the whole text
+	all, _ := TextSDF2(f, txt, 10)
+	bb := parts[0].SDF.BoundingBox().Extend(parts[1].SDF.BoundingBox())
+	if !bb.Min.Equals(all.BoundingBox().Min, 1e-9) || !bb.Max.Equals(all.BoundingBox().Max, 1e-9) {
+		t.Error("FAIL")
+	}
+	for _, p := range []V2{{-7, 0}, {-3, 0}, {0, 0}, {4, 1}, {6, -2}} {
+		d := Min(parts[0].SDF.Evaluate(p), parts[1].SDF.Evaluate(p))
+		if Abs(d-all.Evaluate(p)) > 1e-9 {
+			t.Error("FAIL")
+		}
+	}
+
+	s, err := TextMaterials3D(f, txt, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "sdfx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "text.3mf")
+	Render3MF(s, 150, path)
+
+	z, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer z.Close()
+	var model xml3mfModel
+	for _, file := range z.File {
+		if file.Name == "3D/3dmodel.model" {
+			r, _ := file.Open()
+			b, _ := ioutil.ReadAll(r)
+			r.Close()
+			if err := xml.Unmarshal(b, &model); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if len(model.Objects) != 2 || model.Objects[0].Name != "material 1" || model.Objects[1].Name != "material 2" {
+		t.Fatal("FAIL")
+	}
+	// "AB" is red, "C" (to the right) is green
+	x0, x1 := -math.MaxFloat64, math.MaxFloat64
+	for _, v := range model.Objects[0].Mesh.Vertices {
+		x0 = math.Max(x0, v.X)
+	}
+	for _, v := range model.Objects[1].Mesh.Vertices {
+		x1 = math.Min(x1, v.X)
+	}
+	bb0, bb1 := parts[0].SDF.BoundingBox(), parts[1].SDF.BoundingBox()
+	if x0 >= x1 || Abs(x0-bb0.Max.X) > 0.2 || Abs(x1-bb1.Min.X) > 0.2 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_CheckFeatures(t *testing.T) {
+	base := Box3D(V3{20, 20, 4}, 0)
+	// a 0.3 thick fin, the cell size is 0.5
+	fin := Transform3D(Box3D(V3{0.3, 10, 8}, 0), Translate3d(V3{0, 0, 5}))
+	k := RenderParms{CellSize: 0.5}
+	r := k.CheckFeatures(Union3D(base, fin))
+	if r.Thin == 0 || r.Warning() == "" || Abs(r.MinFeature-0.3) > 0.01 || Abs(r.At.X) > 0.2 {
+		t.Error("FAIL")
+	}
+	// 4 thick walls are fine
+	r = k.CheckFeatures(base)
+	if r.Thin != 0 || r.Warning() != "" || r.Samples == 0 || Abs(r.MinFeature-4) > 0.01 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_MeshQuery(t *testing.T) {
+	m := RenderMesh(Box3D(V3{2, 3, 4}, 0), 20)
+	if m.NumTriangles() != len(m.Triangles) || m.NumVertices() != len(m.Vertices()) || m.NumVertices() == 0 {
+		t.Error("FAIL")
+	}
+	// a closed triangle mesh, V - E + F = 2 (E = 3F/2)
+	if m.NumVertices()-m.NumTriangles()/2 != 2 {
+		t.Error("FAIL")
+	}
+	bb := m.BoundingBox()
+	if !bb.Min.Equals(V3{-1, -1.5, -2}, 0.05) || !bb.Max.Equals(V3{1, 1.5, 2}, 0.05) {
+		t.Error("FAIL")
+	}
+	// a translated copy
+	d := V3{10, -5, 2}
+	m1 := m.Transform(Translate3d(d))
+	bb1 := m1.BoundingBox()
+	if !bb1.Min.Equals(bb.Min.Add(d), 1e-9) || !bb1.Max.Equals(bb.Max.Add(d), 1e-9) {
+		t.Error("FAIL")
+	}
+	if m1.NumTriangles() != m.NumTriangles() || m.BoundingBox() != bb {
+		t.Error("FAIL")
+	}
+	// a mirrored copy keeps the normals pointing out
+	m2 := m.Transform(MirrorYZ())
+	for _, tr := range m2.Triangles {
+		if tr.Normal().Dot(tr.V[0].Add(tr.V[1]).Add(tr.V[2])) <= 0 {
+			t.Error("FAIL")
+			break
+		}
+	}
+	if ok, _ := m2.IsManifold(); !ok || !m2.IsWatertight() {
+		t.Error("FAIL")
+	}
+	if NewMesh(nil).BoundingBox() != (Box3{}) || NewMesh(nil).NumVertices() != 0 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_LoadOBJ(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sdfx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a 2x2x2 cube with quad faces, some with relative indices
+	cube := `# cube
+mtllib cube.mtl
+o Cube
+v -1 -1 -1
+v 1 -1 -1
+v 1 1 -1
+v -1 1 -1
+v -1 -1 1
+v 1 -1 1
+v 1 1 1
+v -1 1 1
+vt 0 0
+vn 0 0 1
+usemtl none
+s off
+f 1 4 3 2
+f 5/1 6/1 7/1 8/1
+f 1//1 2//1 6//1 5//1
+f 3/1/1 4/1/1 8/1/1 7/1/1
+f -7 -6 -2 -3
+f -5/1 -8/1 -4/1 -1/1
+`
+	path := filepath.Join(dir, "cube.obj")
+	if err := ioutil.WriteFile(path, []byte(cube), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := LoadOBJ(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.BoundingBox() != (Box3{V3{-1, -1, -1}, V3{1, 1, 1}}) {
+		t.Error("FAIL")
+	}
+	// the same distances as the box, inside and outside
+	box := Box3D(V3{2, 2, 2}, 0)
+	bb := s.BoundingBox().ScaleAboutCenter(2)
+	for _, p := range bb.RandomSet(1000) {
+		if Abs(s.Evaluate(p)-box.Evaluate(p)) > 1e-9 {
+			t.Error("FAIL")
+			break
+		}
+	}
+
+	// a meshed sphere is within the cell size of the sphere
+	sphere := Sphere3D(5)
+	m := RenderMesh(sphere, 50)
+	path = filepath.Join(dir, "sphere.obj")
+	if err := m.SaveOBJ(path, sphere); err != nil {
+		t.Fatal(err)
+	}
+	s, err = LoadOBJ(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bb = sphere.BoundingBox().ScaleAboutCenter(1.5)
+	for _, p := range bb.RandomSet(1000) {
+		if Abs(s.Evaluate(p)-sphere.Evaluate(p)) > 0.05 {
+			t.Error("FAIL")
+			break
+		}
+	}
+
+	// malformed files
+	bad := []string{
+		"v 1 2\n",
+		"v 1 2 x\n",
+		"v 0 0 0\nv 1 0 0\nf 1 2\n",
+		"v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 4\n",
+		"v 0 0 0\nv 1 0 0\nv 0 1 0\nf 0 1 2\n",
+		"v 0 0 0\nv 1 0 0\nv 0 1 0\nf -4 1 2\n",
+	}
+	for _, b := range bad {
+		if _, err := ParseOBJ([]byte(b)); err == nil {
+			t.Error("FAIL")
+		}
+	}
+	if _, err := Mesh3D(nil); err == nil {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_OrientMesh(t *testing.T) {
+	cube := func(size float64) []*Triangle3 {
+		return RenderMesh(Box3D(V3{size, size, size}, 0), 10).Triangles
+	}
+	// an inward wound cube
+	inward := FlipNormals(cube(2))
+	for _, tr := range inward {
+		if tr.Normal().Dot(tr.V[0]) >= 0 {
+			t.Fatal("FAIL")
+		}
+	}
+	s, err := Mesh3D(inward)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Evaluate(V3{0, 0, 0}) >= 0 || s.Evaluate(V3{0.5, -0.2, 0.9}) >= 0 || s.Evaluate(V3{2, 0, 0}) <= 0 {
+		t.Error("FAIL")
+	}
+	// mixed windings
+	mixed := cube(2)
+	for i := 0; i < len(mixed); i += 3 {
+		mixed[i] = FlipNormals(mixed[i : i+1])[0]
+	}
+	oriented := OrientMesh(mixed)
+	if !IsWatertight(oriented) {
+		t.Error("FAIL")
+	}
+	for _, tr := range oriented {
+		if tr.Normal().Dot(tr.V[0]) <= 0 {
+			t.Error("FAIL")
+			break
+		}
+	}
+	// a hollow cube, with both surfaces wound outwards
+	hollow := append(cube(4), cube(2)...)
+	s, err = Mesh3D(hollow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Evaluate(V3{0, 0, 0}) <= 0 || s.Evaluate(V3{1.5, 0, 0}) >= 0 || s.Evaluate(V3{3, 0, 0}) <= 0 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// rayParity returns true if p is inside a mesh by the parity of the crossings
+// of a +x ray.
+func rayParity(mesh []*Triangle3, p V3) bool {
+	n := 0
+	for _, t := range mesh {
+		// the ray crosses the triangle if p is inside its yz projection
+		var s [3]float64
+		for i := 0; i < 3; i++ {
+			a, b := t.V[i], t.V[(i+1)%3]
+			s[i] = (b.Y-a.Y)*(p.Z-a.Z) - (b.Z-a.Z)*(p.Y-a.Y)
+		}
+		if !((s[0] > 0 && s[1] > 0 && s[2] > 0) || (s[0] < 0 && s[1] < 0 && s[2] < 0)) {
+			continue
+		}
+		// and the crossing is in front of p
+		nrm := t.V[1].Sub(t.V[0]).Cross(t.V[2].Sub(t.V[0]))
+		if x := t.V[0].X + nrm.Dot(V3{0, p.Y, p.Z}.Sub(V3{0, t.V[0].Y, t.V[0].Z}))/-nrm.X; x > p.X {
+			n++
+		}
+	}
+	return n%2 == 1
+}
+
+func Test_MeshWinding3D(t *testing.T) {
+	// a closed sphere
+	sphere := Sphere3D(2)
+	mesh := RenderMesh(sphere, 30).Triangles
+	s, err := MeshWinding3D(mesh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := s.(*MeshSDF3).winding
+	if Abs(w.winding(V3{0, 0, 0})-1) > 0.05 || Abs(w.winding(V3{10, 3, 0})) > 0.05 {
+		t.Error("FAIL")
+	}
+	bb := sphere.BoundingBox().ScaleAboutCenter(2)
+	for _, p := range bb.RandomSet(500) {
+		d := sphere.Evaluate(p)
+		if Abs(d) > 0.1 && (s.Evaluate(p) < 0) != (d < 0) {
+			t.Error("FAIL")
+			break
+		}
+	}
+
+	// a box with a gap in the +x face
+	mesh = RenderMesh(Box3D(V3{2, 2, 2}, 0), 10).Triangles
+	var open []*Triangle3
+	var gap V3
+	for _, tr := range mesh {
+		c := tr.V[0].Add(tr.V[1]).Add(tr.V[2]).DivScalar(3)
+		if Abs(c.X-1) < 1e-3 && Abs(c.Y) < 0.25 && Abs(c.Z) < 0.25 {
+			gap = c
+			continue
+		}
+		open = append(open, tr)
+	}
+	if IsWatertight(open) || len(open) == len(mesh) {
+		t.Fatal("FAIL")
+	}
+	// a ray through the gap has the wrong parity
+	p := V3{0, gap.Y, gap.Z}
+	if rayParity(open, p) || !rayParity(open, V3{0, 0.7, -0.6}) {
+		t.Error("FAIL")
+	}
+	s, err = MeshWinding3D(open)
+	if err != nil {
+		t.Fatal(err)
+	}
+	box := Box3D(V3{2, 2, 2}, 0)
+	for _, q := range []V3{p, {0.9, gap.Y, gap.Z}, {0, 0, 0}, {0, 0.7, -0.6}} {
+		if s.Evaluate(q) >= 0 {
+			t.Error("FAIL")
+		}
+	}
+	for _, q := range []V3{{1.1, gap.Y, gap.Z}, {1.5, 0, 0}, {-3, 0, 0}} {
+		if s.Evaluate(q) <= 0 {
+			t.Error("FAIL")
+		}
+	}
+	bb = box.BoundingBox().ScaleAboutCenter(2)
+	for _, q := range bb.RandomSet(500) {
+		d := box.Evaluate(q)
+		if Abs(d) > 0.1 && (s.Evaluate(q) < 0) != (d < 0) {
+			t.Error("FAIL")
+			break
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_ExportSCAD(t *testing.T) {
+	s := Difference3D(Box3D(V3{10, 10, 10}, 0), Transform3D(Sphere3D(6), Translate3d(V3{0, 0, 5})))
+	var buf bytes.Buffer
+	if err := ExportSCAD(s, &buf, 0); err != nil {
+		t.Fatal(err)
+	}
+	expected := "// generated by sdfx\n" +
+		"difference() {\n" +
+		"  cube([10, 10, 10], center = true);\n" +
+		"  translate([0, 0, 5]) {\n" +
+		"    sphere(r = 6);\n" +
+		"  }\n" +
+		"}\n"
+	if buf.String() != expected {
+		t.Logf("%s", buf.String())
+		t.Error("FAIL")
+	}
+	// rounded primitives, rotations and unsupported nodes
+	s = Union3D(
+		Transform3D(Cylinder3D(10, 3, 1), RotateX(DtoR(90))),
+		AffineWarp3D(Sphere3D(2), Scale3d(V3{2, 1, 1})),
+	)
+	buf.Reset()
+	if err := ExportSCAD(s, &buf, 0); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, x := range []string{"union() {", "multmatrix([[1, 0, 0, 0], [0, ", "minkowski() {", "cylinder(h = 8, r = 2, center = true);", "sphere(r = 1);", "// unsupported *sdf.AffineWarpSDF3"} {
+		if !strings.Contains(out, x) {
+			t.Logf("%s", out)
+			t.Error("FAIL")
+			break
+		}
+	}
+	if strings.Count(out, "{") != strings.Count(out, "}") {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Probe3D(t *testing.T) {
+	a := Sphere3D(2)
+	b := Box3D(V3{2, 2, 2}, 0)
+	s := Union3D(a, Transform3D(b, Translate3d(V3{3, 0, 0})))
+	// inside the sphere, the sphere is nearer
+	r := Probe3D(s, V3{0.5, 0, 0})
+	if r.Decisive() != a || Abs(r.Distance+1.5) > TOLERANCE || len(r.Path) != 2 {
+		t.Logf("%s", r)
+		t.Error("FAIL")
+	}
+	// inside the box, the box is nearer
+	r = Probe3D(s, V3{3.5, 0, 0})
+	if r.Decisive() != b || Abs(r.Distance+0.5) > TOLERANCE || len(r.Path) != 3 {
+		t.Logf("%s", r)
+		t.Error("FAIL")
+	}
+	if !r.Path[2].P.Equals(V3{0.5, 0, 0}, TOLERANCE) || !r.Normal.Equals(V3{1, 0, 0}, 1e-3) {
+		t.Error("FAIL")
+	}
+	// the subtracted sphere decides inside the hole
+	s = Difference3D(b, a)
+	r = Probe3D(s, V3{0.2, 0.1, 0})
+	if r.Decisive() != a || r.Distance <= 0 {
+		t.Logf("%s", r)
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Precision(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sdfx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	mesh := RenderMesh(Sphere3D(10.123456789), 20).Triangles
+	// the maximum number of decimal places in a file
+	decimals := func(data []byte) int {
+		n := 0
+		for _, f := range strings.Fields(string(data)) {
+			if i := strings.IndexByte(f, '.'); i >= 0 {
+				if _, err := fmt.Sscanf(f, "%g", new(float64)); err == nil && len(f)-i-1 > n {
+					n = len(f) - i - 1
+				}
+			}
+		}
+		return n
+	}
+	for _, k := range []int{2, 3, 6} {
+		stl := filepath.Join(dir, "a.stl")
+		obj := filepath.Join(dir, "a.obj")
+		if SaveSTLAscii(stl, mesh, k) != nil || saveOBJ(obj, mesh, nil, Z_UP, k) != nil {
+			t.Fatal("FAIL")
+		}
+		for _, path := range []string{stl, obj} {
+			data, _ := ioutil.ReadFile(path)
+			if decimals(data) != k {
+				t.Error("FAIL")
+			}
+		}
+		// round trip within the precision
+		data, _ := ioutil.ReadFile(stl)
+		m, err := ParseSTL(data)
+		if err != nil || len(m) != len(mesh) {
+			t.Fatal("FAIL")
+		}
+		tol := 0.5*math.Pow(10, -float64(k)) + 1e-9
+		for i, tr := range m {
+			for j := range tr.V {
+				if !tr.V[j].Equals(mesh[i].V[j], tol) {
+					t.Fatal("FAIL")
+				}
+			}
+		}
+		var buf bytes.Buffer
+		ExportSCAD(Sphere3D(1.23456789), &buf, k)
+		if !strings.Contains(buf.String(), fmt.Sprintf("sphere(r = %.*f);", k, 1.23456789)) {
+			t.Error("FAIL")
+		}
+	}
+	// the render option
+	path := filepath.Join(dir, "b.obj")
+	k := RenderParms{MeshCells: 20, Precision: 2}
+	k.RenderOBJ(Sphere3D(10.123456789), path)
+	if data, _ := ioutil.ReadFile(path); decimals(data) != 2 {
+		t.Error("FAIL")
+	}
+	// by default the numbers are written with %g
+	path = filepath.Join(dir, "c.obj")
+	if SaveOBJ(path, mesh, nil) != nil {
+		t.Fatal("FAIL")
+	}
+	data, _ := ioutil.ReadFile(path)
+	v := mesh[0].V[0]
+	if !strings.Contains(string(data), fmt.Sprintf("v %g %g %g\n", v.X, v.Y, v.Z)) {
+		t.Error("FAIL")
+	}
+	// trailing zeros are dropped
+	if ftoa(2.5, 3) != "2.5" || ftoa(-0.0001, 3) != "0" || ftoa(10, 3) != "10" || ftoa(0.1, 0) != "0.1" {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_VoronoiTexture3D(t *testing.T) {
+	// seeds on a jittered grid on the top face of a plate
+	var seeds []V3
+	for x := -8.0; x <= 8; x += 4 {
+		for y := -8.0; y <= 8; y += 4 {
+			seeds = append(seeds, V3{x + randomRange(-1, 1), y + randomRange(-1, 1), 2})
+		}
+	}
+	depth := 0.5
+	s := VoronoiTexture3D(Box3D(V3{20, 20, 4}, 0), seeds, depth).(*VoronoiTextureSDF3)
+	// the k-d tree matches a brute force search
+	bb := s.BoundingBox()
+	for _, p := range bb.RandomSet(200) {
+		d1, d2 := math.MaxFloat64, math.MaxFloat64
+		for _, x := range seeds {
+			d := p.Sub(x).Length()
+			if d < d1 {
+				d1, d2 = d, d1
+			} else if d < d2 {
+				d2 = d
+			}
+		}
+		if Abs(s.cellDistance(p)-0.5*(d2-d1)) > 1e-9 {
+			t.Fatal("FAIL")
+		}
+	}
+	// the cell floors are depth down, the ridges are on the surface
+	zmin, zmax := 2.0, 0.0
+	for _, v := range RenderMesh(s, 120).Vertices() {
+		if v.Z < 1 || Abs(v.X) > 9 || Abs(v.Y) > 9 {
+			continue
+		}
+		zmin = Min(zmin, v.Z)
+		zmax = Max(zmax, v.Z)
+		if v.Z > 2-0.05 && s.cellDistance(v) > 0.2 {
+			t.Error("FAIL")
+			break
+		}
+	}
+	if Abs(zmax-2) > 0.1 || Abs(zmin-(2-depth)) > 0.1 {
+		t.Logf("z %f to %f", zmin, zmax)
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Tube3D(t *testing.T) {
+	s := Tube3D(6, 10, 20)
+	// in the wall
+	if s.Evaluate(V3{4, 0, 0}) >= 0 || s.Evaluate(V3{0, -3.5, 9}) >= 0 {
+		t.Error("FAIL")
+	}
+	// in the bore and outside
+	if s.Evaluate(V3{0, 0, 0}) <= 0 || s.Evaluate(V3{2, 1, 5}) <= 0 || s.Evaluate(V3{6, 0, 0}) <= 0 || s.Evaluate(V3{4, 0, 11}) <= 0 {
+		t.Error("FAIL")
+	}
+	// the same surface as the difference of two cylinders, with exact distances
+	d := Difference3D(Cylinder3D(20, 5, 0), Cylinder3D(30, 3, 0))
+	bb := s.BoundingBox().ScaleAboutCenter(1.5)
+	for _, p := range bb.RandomSet(1000) {
+		if (s.Evaluate(p) < 0) != (d.Evaluate(p) < 0) || s.Evaluate(p) < d.Evaluate(p)-1e-9 {
+			t.Fatal("FAIL")
+		}
+	}
+	if Abs(s.Evaluate(V3{0, 0, 0})-3) > 1e-9 || Abs(s.Evaluate(V3{8, 0, 14})-5) > 1e-9 {
+		t.Error("FAIL")
+	}
+	// the 2d annulus
+	a := Annulus2D(3, 5)
+	if Abs(a.Evaluate(V2{4, 0})+1) > 1e-9 || Abs(a.Evaluate(V2{0, 0})-3) > 1e-9 || Abs(a.Evaluate(V2{0, -7})-2) > 1e-9 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Wedge3D(t *testing.T) {
+	s := Wedge3D(V3{10, 4, 6})
+	// distances from the middle of the sloped face
+	n := V3{6, 0, 10}.Normalize()
+	if Abs(s.Evaluate(n.MulScalar(0.5))-0.5) > 1e-9 || Abs(s.Evaluate(n.MulScalar(-0.2))+0.2) > 1e-9 {
+		t.Error("FAIL")
+	}
+	// beyond the top edge of the slope
+	if Abs(s.Evaluate(V3{-5, 3, 4})-math.Sqrt(2)) > 1e-9 {
+		t.Error("FAIL")
+	}
+	// the same distances as a mesh of the wedge
+	v := []V3{{-5, -2, -3}, {5, -2, -3}, {-5, -2, 3}, {-5, 2, -3}, {5, 2, -3}, {-5, 2, 3}}
+	mesh := []*Triangle3{
+		NewTriangle3(v[0], v[2], v[1]), NewTriangle3(v[3], v[4], v[5]),
+		NewTriangle3(v[0], v[1], v[4]), NewTriangle3(v[0], v[4], v[3]),
+		NewTriangle3(v[0], v[3], v[5]), NewTriangle3(v[0], v[5], v[2]),
+		NewTriangle3(v[1], v[2], v[5]), NewTriangle3(v[1], v[5], v[4]),
+	}
+	m, err := Mesh3D(mesh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bb := s.BoundingBox().ScaleAboutCenter(1.5)
+	for _, p := range bb.RandomSet(1000) {
+		if Abs(s.Evaluate(p)-m.Evaluate(p)) > 1e-6 {
+			t.Fatal("FAIL")
+		}
+	}
+	// and the pyramid
+	s = Pyramid3D(V2{6, 4}, 5)
+	v = []V3{{-3, -2, -2.5}, {3, -2, -2.5}, {3, 2, -2.5}, {-3, 2, -2.5}, {0, 0, 2.5}}
+	mesh = []*Triangle3{
+		NewTriangle3(v[0], v[2], v[1]), NewTriangle3(v[0], v[3], v[2]),
+		NewTriangle3(v[0], v[1], v[4]), NewTriangle3(v[1], v[2], v[4]),
+		NewTriangle3(v[2], v[3], v[4]), NewTriangle3(v[3], v[0], v[4]),
+	}
+	if m, err = Mesh3D(mesh); err != nil {
+		t.Fatal(err)
+	}
+	bb = s.BoundingBox().ScaleAboutCenter(1.5)
+	for _, p := range bb.RandomSet(1000) {
+		if Abs(s.Evaluate(p)-m.Evaluate(p)) > 1e-6 {
+			t.Fatal("FAIL")
+		}
+	}
+	if s.BoundingBox() != (Box3{V3{-3, -2, -2.5}, V3{3, 2, 2.5}}) {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_RevolvePoles(t *testing.T) {
+	// euler characteristic of a closed mesh, 2 for a sphere, 0 if the mesh
+	// has a hole through it
+	euler := func(mesh []*Triangle3) int {
+		m := newMeshIndex(mesh)
+		return len(m.v) - len(m.f)/2
+	}
+	// semicircle profiles, with the flat side on the axis
+	poly := NewPolygon()
+	poly.Add(0, -5)
+	for i := 1; i < 32; i++ {
+		poly.AddV2(PolarToXY(5, -0.5*PI+PI*float64(i)/32))
+	}
+	poly.Add(0, 5)
+	profiles := []SDF2{
+		Polygon2D(poly.Vertices()),
+		Cut2D(Circle2D(5), V2{0, 0}, V2{0, 1}),
+	}
+	for _, profile := range profiles {
+		s := Revolve3D(profile)
+		// inside on the axis
+		if d := s.Evaluate(V3{0, 0, 1}); d > -3.9 {
+			t.Logf("axis distance %f", d)
+			t.Error("FAIL")
+		}
+		for _, x := range []SDF3{s, Offset3D(s, -1), Shell3D(s, 0.5)} {
+			m := RenderMesh(x, 40).Triangles
+			if !IsWatertight(m) {
+				t.Error("FAIL")
+			}
+			// the poles are closed
+			bb := NewMesh(m).BoundingBox()
+			if bb.Max.Z < 3.8 || bb.Min.Z > -3.8 {
+				t.Error("FAIL")
+			}
+			e := euler(m)
+			if _, ok := x.(*ShellSDF3); ok {
+				// inner and outer spheres
+				e -= 2
+			}
+			if e != 2 {
+				t.Logf("euler characteristic %d", e)
+				t.Error("FAIL")
+			}
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_ForEachTriangle(t *testing.T) {
+	s := Sphere3D(5)
+	n := 0
+	area := 0.0
+	ForEachTriangle(s, V3i{20, 20, 20}, func(a, b, c V3) {
+		n++
+		area += 0.5 * b.Sub(a).Cross(c.Sub(a)).Length()
+	})
+	// the mesh on the same grid
+	box := s.BoundingBox().ScaleAboutCenter(1.01)
+	step := box.Size().X / 20
+	if box.Size().DivScalar(step).Ceil().ToV3i() != (V3i{20, 20, 20}) {
+		t.Fatal("FAIL")
+	}
+	mesh := MarchingCubes(s, box, step)
+	if n == 0 || n != len(mesh) {
+		t.Logf("%d callbacks, %d triangles", n, len(mesh))
+		t.Error("FAIL")
+	}
+	if Abs(area-4*PI*25)/(4*PI*25) > 0.02 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_DifferenceRound3D(t *testing.T) {
+	// a pocket 10 wide and 3 deep in the top (z = 0) of a plate
+	plate := Transform3D(Box3D(V3{20, 20, 10}, 0), Translate3d(V3{0, 0, -5}))
+	pocket := Transform3D(Box3D(V3{10, 30, 10}, 0), Translate3d(V3{0, 0, 2}))
+	r := 1.0
+	s := DifferenceRound3D(plate, pocket, r)
+	// the rim of the pocket is a quarter circle of radius r
+	c := V2{5 + r, -r}
+	for _, a := range []float64{0.5 * PI, 0.6 * PI, 0.75 * PI, 0.9 * PI, PI} {
+		p := c.Add(PolarToXY(r, a))
+		if Abs(s.Evaluate(V3{p.X, 0, p.Y})) > 1e-9 {
+			t.Error("FAIL")
+		}
+	}
+	if Abs(s.Evaluate(V3{5, 0, 0})-r*(math.Sqrt2-1)) > 1e-9 {
+		t.Error("FAIL")
+	}
+	// away from the rim the surfaces are the same as the plain difference
+	d := Difference3D(plate, pocket)
+	for _, p := range []V3{{8, 0, 0}, {5, 0, -2}, {0, 0, -3}, {3, 0, -3}, {-8, 0, -4}} {
+		if Abs(s.Evaluate(p)-d.Evaluate(p)) > 1e-9 {
+			t.Error("FAIL")
+		}
+	}
+	// the rim of a rendered pocket
+	m := RenderMesh(s, 100)
+	for _, v := range m.Vertices() {
+		if Abs(v.X) > 5 && Abs(v.X) < 5+r && v.Z > -r && Abs(v.Y) < 9 {
+			q := V2{Abs(v.X), v.Z}.Sub(c)
+			if Abs(q.Length()-r) > 0.05 {
+				t.Error("FAIL")
+				break
+			}
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_EnclosureBox3D(t *testing.T) {
+	k := &EnclosureParms{
+		Inner:        V3{40, 30, 20},
+		Wall:         2,
+		LidHeight:    8,
+		CornerRadius: 3,
+		BossDiameter: 6,
+		BossHole:     2.5,
+		LidHole:      3.2,
+	}
+	base, lid := EnclosureBox3D(k)
+	both := Union3D(base, lid)
+	h := 24.0
+	// the cavity dimensions
+	for _, p := range []V3{{20, 0, 5}, {-20, 0, 15}, {0, 15, 10}, {0, -15, 20}, {0, 0, 2}, {0, 0, 22}} {
+		if Abs(both.Evaluate(p)) > 1e-6 {
+			t.Logf("%v %f", p, both.Evaluate(p))
+			t.Error("FAIL")
+		}
+	}
+	if both.Evaluate(V3{0, 0, 10}) <= 0 || both.Evaluate(V3{21, 0, 10}) >= 0 {
+		t.Error("FAIL")
+	}
+	// the outside
+	if !base.BoundingBox().Equals(Box3{V3{-22, -17, 0}, V3{22, 17, h - 8}}, 1e-9) {
+		t.Error("FAIL")
+	}
+	// the parts don't overlap
+	bb := Box3{V3{-22, -17, 0}, V3{22, 17, h}}
+	for _, p := range bb.RandomSet(20000) {
+		if base.Evaluate(p) < -1e-9 && lid.Evaluate(p) < -1e-9 {
+			t.Logf("overlap at %v", p)
+			t.Fatal("FAIL")
+		}
+	}
+	// the lip is in the recess of the base, with a clearance all around
+	zs, c := h-8, 0.2
+	lip := V3{20.5, 0, zs - 2}
+	if lid.Evaluate(lip) >= 0 || base.Evaluate(lip) <= 0 {
+		t.Error("FAIL")
+	}
+	for _, p := range []V3{{21 - 0.5*c, 0, zs - 2}, {20.5, 0, zs - 4 + 0.5*c}, {-20.5, 0, zs - 4 + 0.5*c}} {
+		if lid.Evaluate(p) <= 0 || base.Evaluate(p) <= 0 {
+			t.Logf("no clearance at %v", p)
+			t.Error("FAIL")
+		}
+	}
+	if Abs(lid.Evaluate(V3{0, 15.5, zs - 4 + c})) > 1e-6 || Abs(base.Evaluate(V3{0, 15.5, zs - 4})) > 1e-6 {
+		t.Error("FAIL")
+	}
+	// the bosses and holes
+	if base.Evaluate(V3{17 + 2, 12, 10}) >= 0 || base.Evaluate(V3{17, 12, 10}) <= 0 || base.Evaluate(V3{17 + 2, 12, zs - 3.9}) <= 0 {
+		t.Error("FAIL")
+	}
+	if lid.Evaluate(V3{17 + 2, 12, 20}) >= 0 || lid.Evaluate(V3{17, 12, 23}) <= 0 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_LivingHinge2D(t *testing.T) {
+	// 6 rows, 4 slot spacings high
+	l, w, gap := 8.0, 1.0, 2.0
+	pitch := l + gap
+	s := LivingHinge2D(30, 4*pitch, l, w, gap, 6)
+	// slots along the center line of each row
+	slots := func(x float64) ([]float64, int) {
+		var centers []float64
+		var y0 float64
+		inside := false
+		n := 0
+		for y := -2*pitch - 1; y <= 2*pitch+1; y += 0.01 {
+			if d := s.Evaluate(V2{x, y}); d < 0 && !inside {
+				inside = true
+				y0 = y
+				n++
+			} else if d >= 0 && inside {
+				inside = false
+				centers = append(centers, 0.5*(y0+y))
+			}
+		}
+		return centers, n
+	}
+	for i := 0; i < 6; i++ {
+		x := -15 + 2.5 + 5*float64(i)
+		c, n := slots(x)
+		if i%2 == 0 {
+			// 3 whole slots and 2 half slots at the ends
+			if n != 5 || Abs(c[2]) > 0.01 {
+				t.Logf("row %d: %d slots", i, n)
+				t.Error("FAIL")
+			}
+		} else {
+			// staggered by half the spacing
+			if n != 4 || Abs(c[1]+0.5*pitch) > 0.01 || Abs(c[2]-0.5*pitch) > 0.01 {
+				t.Logf("row %d: %d slots", i, n)
+				t.Error("FAIL")
+			}
+		}
+		// the slot width
+		if Abs(s.Evaluate(V2{x + 0.5*w, 0.5 * pitch * float64(i%2)})) > 1e-9 {
+			t.Error("FAIL")
+		}
+	}
+	// between the rows and outside the region
+	for _, p := range []V2{{-10, 0}, {0, 0}, {16, 0}, {-12.5, 21}} {
+		if s.Evaluate(p) <= 0 {
+			t.Error("FAIL")
+		}
+	}
+	// the distance is a bound
+	bb := s.BoundingBox().ScaleAboutCenter(1.2)
+	for _, p := range bb.RandomSet(200) {
+		for _, q := range bb.RandomSet(5) {
+			if Abs(s.Evaluate(p)-s.Evaluate(q)) > p.Sub(q).Length()+1e-9 {
+				t.Fatal("FAIL")
+			}
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_AnisotropicCells(t *testing.T) {
+	s := Sphere3D(10)
+	for _, k := range []RenderParms{
+		{AxisCells: V3i{60, 20, 10}},
+		{AxisSize: V3{0.5, 3, 1.5}, Newton: 2},
+	} {
+		stats := RenderStats{}
+		k.Stats = &stats
+		m := k.RenderMesh(s)
+		if !m.IsWatertight() {
+			t.Error("FAIL")
+		}
+		// the proportions are kept, the extent on each axis is within a cell
+		bb := m.BoundingBox()
+		cells, grid, _ := k.axisCells(s)
+		cell := grid.Size().Div(cells.ToV3())
+		if k.AxisSize.X > 0 && !cell.Equals(k.AxisSize, TOLERANCE) {
+			t.Error("FAIL")
+		}
+		for i, x := range []float64{bb.Max.X, bb.Max.Y, bb.Max.Z, -bb.Min.X, -bb.Min.Y, -bb.Min.Z} {
+			if x > 10+TOLERANCE || x < 10-[]float64{cell.X, cell.Y, cell.Z}[i%3] {
+				t.Error("FAIL")
+			}
+		}
+		// the vertices are interpolated onto the surface
+		for _, tr := range m.Triangles {
+			for _, v := range tr.V {
+				if Abs(v.Length()-10) > 0.2 {
+					t.Error("FAIL")
+				}
+			}
+		}
+		if stats.Triangles != len(m.Triangles) || stats.EmptyCubes != 0 {
+			t.Error("FAIL")
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Sector2D(t *testing.T) {
+	// boundary points of a sector and a segment
+	sector := func(r, a0, a1 float64) V2Set {
+		var b V2Set
+		for i := 0; i <= 1000; i++ {
+			x := float64(i) / 1000
+			b = append(b, PolarToXY(r, a0+x*(a1-a0)), PolarToXY(x*r, a0), PolarToXY(x*r, a1))
+		}
+		return b
+	}
+	segment := func(r, h float64) V2Set {
+		var b V2Set
+		w := math.Sqrt(r*r - h*h)
+		a := math.Asin(h / r)
+		for i := 0; i <= 1000; i++ {
+			x := float64(i) / 1000
+			b = append(b, PolarToXY(r, a+x*(PI-2*a)), V2{-w + 2*w*x, h})
+		}
+		return b
+	}
+	tests := []struct {
+		s        SDF2
+		boundary V2Set
+		in, out  V2
+		bb       Box2
+	}{
+		{Sector2D(10, 0, 0.5*PI), sector(10, 0, 0.5*PI), V2{3, 3}, V2{-1, 3}, Box2{V2{0, 0}, V2{10, 10}}},
+		{Sector2D(10, 0.25*PI, 1.75*PI), sector(10, 0.25*PI, 1.75*PI), V2{-3, 0}, V2{3, 0}, Box2{V2{-10, -10}, V2{10 * math.Sqrt2 / 2, 10}}},
+		{DiskSegment2D(10, 0), segment(10, 0), V2{0, 1}, V2{0, -1}, Box2{V2{-10, 0}, V2{10, 10}}},
+		{DiskSegment2D(10, 6), segment(10, 6), V2{0, 7}, V2{0, 5}, Box2{V2{-8, 6}, V2{8, 10}}},
+		{DiskSegment2D(10, -6), segment(10, -6), V2{0, -5}, V2{0, -7}, Box2{V2{-10, -6}, V2{10, 10}}},
+	}
+	for _, x := range tests {
+		if !x.s.BoundingBox().Equals(x.bb, TOLERANCE) {
+			t.Error("FAIL")
+		}
+		if x.s.Evaluate(x.in) >= 0 || x.s.Evaluate(x.out) <= 0 {
+			t.Error("FAIL")
+		}
+		// the distance is to the nearest boundary point
+		bb := x.bb.ScaleAboutCenter(1.5)
+		for _, p := range bb.RandomSet(1000) {
+			d := math.MaxFloat64
+			for _, b := range x.boundary {
+				d = Min(d, p.Sub(b).Length())
+			}
+			if Abs(Abs(x.s.Evaluate(p))-d) > 0.05 {
+				t.Error("FAIL")
+			}
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_RenderQuality(t *testing.T) {
+	s := Cylinder3D(20, 4, 1)
+	triangles := 0
+	flatness := math.Inf(1)
+	for q := QUALITY_DRAFT; q <= QUALITY_ULTRA; q++ {
+		k := RenderQualityParms(q)
+		n := len(k.RenderMesh(s).Triangles)
+		if n <= triangles || RenderQualityFlatness(q) >= flatness {
+			t.Error("FAIL")
+		}
+		triangles = n
+		flatness = RenderQualityFlatness(q)
+	}
+	// the normal preset is the default flatness
+	if RenderQualityFlatness(QUALITY_NORMAL) != BezierFlatness {
+		t.Error("FAIL")
+	}
+	// settings can be overridden
+	k := RenderQualityParms(QUALITY_ULTRA)
+	k.MeshCells = 50
+	if n := len(k.RenderMesh(s).Triangles); n >= triangles {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_CheckAssembly3D(t *testing.T) {
+	// a plate, a boss that pokes 1mm into it, a block off to the side
+	plate := Box3D(V3{40, 40, 4}, 0)
+	boss := Transform3D(Cylinder3D(10, 3, 0), Translate3d(V3{5, 0, -6}))
+	block := Transform3D(Box3D(V3{10, 10, 10}, 0), Translate3d(V3{40, 0, 0}))
+	parts := []SDF3{block, plate, boss}
+	r := CheckAssembly3D(parts, V3i{20, 20, 20})
+	if len(r) != 1 || r[0].A != 1 || r[0].B != 2 {
+		t.Fatal("FAIL")
+	}
+	// half the thickness of the overlap
+	if Abs(r[0].Depth-0.5) > 0.1 {
+		t.Error("FAIL")
+	}
+	if r[0].At.Z > -1 || r[0].At.Z < -2 {
+		t.Error("FAIL")
+	}
+	// parts that just touch don't interfere
+	touch := Transform3D(Box3D(V3{10, 10, 10}, 0), Translate3d(V3{25, 0, 0}))
+	if len(CheckAssembly3D([]SDF3{plate, touch}, V3i{20, 20, 20})) != 0 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Cylinder3D_Exact(t *testing.T) {
+	for _, round := range []float64{0, 1} {
+		s := Cylinder3D(10, 4, round)
+		// the standard capped cylinder distance in (r, z)
+		exact := func(p V3) float64 {
+			d := V2{V2{p.X, p.Y}.Length() - (4 - round), Abs(p.Z) - (5 - round)}
+			return d.MaxScalar(0).Length() + Min(d.MaxComponent(), 0) - round
+		}
+		bb := NewBox3(V3{}, V3{14, 14, 16})
+		for _, p := range bb.RandomSet(1000) {
+			if Abs(s.Evaluate(p)-exact(p)) > TOLERANCE {
+				t.Error("FAIL")
+			}
+		}
+		// around the rim the gradient is a unit vector
+		for i := 0; i < 100; i++ {
+			a := 2 * PI * float64(i) / 100
+			rim := V3{4 * math.Cos(a), 4 * math.Sin(a), 5}
+			for _, d := range []V3{{0, 0, 0.5}, {0.5, 0, 0.5}, {-0.5, 0, -0.3}, {0.3, 0, -0.2}} {
+				p := rim.Add(V3{d.X * math.Cos(a), d.X * math.Sin(a), d.Z})
+				h := 1e-6
+				g := V3{
+					s.Evaluate(p.Add(V3{h, 0, 0})) - s.Evaluate(p.Sub(V3{h, 0, 0})),
+					s.Evaluate(p.Add(V3{0, h, 0})) - s.Evaluate(p.Sub(V3{0, h, 0})),
+					s.Evaluate(p.Add(V3{0, 0, h})) - s.Evaluate(p.Sub(V3{0, 0, h})),
+				}.DivScalar(2 * h)
+				if Abs(g.Length()-1) > 1e-3 {
+					t.Error("FAIL")
+				}
+			}
+		}
+		// outside the cap edge the distance is to the rim circle
+		p := V3{4 + 3, 0, 5 + 4}
+		if d := s.Evaluate(p); round == 0 && Abs(d-5) > TOLERANCE {
+			t.Error("FAIL")
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_TextRelief3D(t *testing.T) {
+	f, err := truetype.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txt := NewTextLines([]LineSpec{{"AB", C_ALIGN}, {"C", C_ALIGN}})
+	depth := func(g TextGlyph) float64 {
+		switch {
+		case g.Line == 1:
+			return -1
+		case g.Index == 0:
+			return 2
+		}
+		return 5
+	}
+	s, err := TextRelief3D(f, txt, 10, depth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bb := s.BoundingBox()
+	if Abs(bb.Min.Z+1) > TOLERANCE || Abs(bb.Max.Z-5) > TOLERANCE {
+		t.Error("FAIL")
+	}
+	// each glyph has its own height
+	flat, _ := TextSDF2(f, txt, 10)
+	fb := flat.BoundingBox()
+	c := fb.Center()
+	n := 0
+	for _, p := range fb.RandomSet(2000) {
+		if flat.Evaluate(p) > -0.2 || Abs(p.X-c.X) < 1 || Abs(p.Y-c.Y) < 1 {
+			continue
+		}
+		d := -1.0
+		if p.Y > c.Y {
+			d = 2
+			if p.X > c.X {
+				d = 5
+			}
+		}
+		if s.Evaluate(V3{p.X, p.Y, 0.5 * d}) >= 0 || s.Evaluate(V3{p.X, p.Y, Max(d, 0) + 0.5}) <= 0 {
+			t.Error("FAIL")
+		}
+		n++
+	}
+	if n < 100 {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_BoxAlgebra(t *testing.T) {
+	a := Box3{V3{0, 0, 0}, V3{4, 4, 4}}
+	b := Box3{V3{2, -1, 1}, V3{6, 3, 3}}
+	if !a.Union(b).Equals(Box3{V3{0, -1, 0}, V3{6, 4, 4}}, TOLERANCE) {
+		t.Error("FAIL")
+	}
+	if x := a.Intersect(b); x.Empty() || !x.Equals(Box3{V3{2, 0, 1}, V3{4, 3, 3}}, TOLERANCE) {
+		t.Error("FAIL")
+	}
+	// disjoint boxes
+	c := Box3{V3{5, 5, 5}, V3{6, 6, 6}}
+	if !a.Intersect(c).Empty() {
+		t.Error("FAIL")
+	}
+	// touching boxes intersect in a face
+	d := Box3{V3{4, 0, 0}, V3{5, 1, 1}}
+	if a.Intersect(d).Empty() || a.Intersect(d).Size().X != 0 {
+		t.Error("FAIL")
+	}
+	// the boundary is in the box
+	for _, p := range []V3{{0, 0, 0}, {4, 4, 4}, {4, 2, 0}} {
+		if !a.Contains(p) {
+			t.Error("FAIL")
+		}
+	}
+	if a.Contains(V3{4 + 1e-9, 2, 2}) || a.Contains(V3{2, -1e-9, 2}) {
+		t.Error("FAIL")
+	}
+	if !a.Expand(1).Equals(NewBox3(a.Center(), a.Size().AddScalar(2)), TOLERANCE) || !a.Expand(-3).Empty() {
+		t.Error("FAIL")
+	}
+	// 2D
+	e := Box2{V2{0, 0}, V2{2, 2}}
+	f := Box2{V2{3, 0}, V2{4, 1}}
+	if !e.Intersect(f).Empty() || !e.Union(f).Equals(Box2{V2{0, 0}, V2{4, 2}}, TOLERANCE) || !e.Contains(V2{2, 1}) {
+		t.Error("FAIL")
+	}
+	if !e.Expand(0.5).Contains(V2{-0.5, 2.5}) {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_SafeDifference3D(t *testing.T) {
+	big := Box3D(V3{20, 20, 20}, 0)
+	small := Transform3D(Cylinder3D(5, 2, 0), Translate3d(V3{3, 3, 3}))
+	// the right way round
+	s, err := SafeDifference3D(big, small)
+	if err != nil || s.Evaluate(V3{-8, -8, -8}) >= 0 {
+		t.Error("FAIL")
+	}
+	// swapped
+	s, err = SafeDifference3D(small, big)
+	e, ok := err.(*EmptyDifference)
+	if !ok || !e.Swapped {
+		t.Fatal("FAIL")
+	}
+	if s == nil || s.Evaluate(V3{3, 3, 3}) < 0 {
+		t.Error("FAIL")
+	}
+	// empty, but not swapped either
+	if _, err := SafeDifference3D(big, big); err == nil || err.(*EmptyDifference).Swapped {
+		t.Error("FAIL")
+	}
+	// a partial overlap leaves something
+	if _, err := SafeDifference3D(big, Transform3D(big, Translate3d(V3{15, 0, 0}))); err != nil {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_WrapText(t *testing.T) {
+	f, err := truetype.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	width := func(s string) float64 {
+		x, _ := TextSDF2(f, NewText(s), 10)
+		return x.BoundingBox().Size().X
+	}
+	// room for 3 words a line
+	w := 0.5 * (width("wxyz wxyz wxyz") + width("wxyz wxyz wxyz wxyz"))
+	txt := WrapText(f, strings.Repeat("wxyz ", 11)+"wxyz", 10, w)
+	lines := txt.lines()
+	if len(lines) != 4 {
+		t.Fatal("FAIL")
+	}
+	for _, l := range lines {
+		if l[0].Text != "wxyz wxyz wxyz" {
+			t.Error("FAIL")
+		}
+	}
+	if s, _ := TextSDF2(f, txt, 10); s.BoundingBox().Size().X > w {
+		t.Error("FAIL")
+	}
+	// newlines are kept, long words are broken
+	txt = WrapText(f, "ab\nabcdefghijklmnopqrstuvwxyz", 10, 30)
+	lines = txt.lines()
+	if len(lines) < 3 || lines[0][0].Text != "ab" {
+		t.Fatal("FAIL")
+	}
+	word := ""
+	for _, l := range lines[1:] {
+		if width(l[0].Text) > 30 {
+			t.Error("FAIL")
+		}
+		word += l[0].Text
+	}
+	if word != "abcdefghijklmnopqrstuvwxyz" {
+		t.Error("FAIL")
+	}
+}
+
+//-----------------------------------------------------------------------------
@@ -8,6 +8,8 @@ Common 2D shapes.
 
 package sdf
 
+import "math"
+
 //-----------------------------------------------------------------------------
 
 type PanelParms struct {
@@ -65,3 +67,138 @@ func FingerButton2D(k *FingerButtonParms) SDF2 {
 }
 
 //-----------------------------------------------------------------------------
+// slots
+
+// Return a slot (a stadium) along the x-axis, e.g. for an adjustable screw
+// mounting. length is the distance between the centers of the semicircular
+// ends, width is the width of the slot (the diameter of the ends).
+// A length of 0 is a round hole.
+func Slot2D(length, width float64) SDF2 {
+	if width <= 0 {
+		panic("width <= 0")
+	}
+	if length < 0 {
+		panic("length < 0")
+	}
+	return Line2D(length, 0.5*width)
+}
+
+//-----------------------------------------------------------------------------
+// shafts and keyways
+
+// Return a D-shaft profile: a circle with one chord cut off.
+// flat is the distance across the flat, the flat is at y = flat - dia/2.
+func DShaft2D(dia, flat float64) SDF2 {
+	r := 0.5 * dia
+	if flat <= r || flat >= dia {
+		panic("flat must be between the radius and the diameter")
+	}
+	return Cut2D(Circle2D(r), V2{0, flat - r}, V2{1, 0})
+}
+
+// keySlot returns the box for a key slot centered on the top of a circle.
+func keySlot(dia, keyWidth, keyDepth float64) SDF2 {
+	if keyWidth <= 0 || keyWidth >= dia || keyDepth <= 0 {
+		panic("bad key size")
+	}
+	s := Box2D(V2{keyWidth, 2 * keyDepth}, 0)
+	return Transform2D(s, Translate2d(V2{0, 0.5 * dia}))
+}
+
+// Return a shaft profile with a keyway cut keyDepth into the top of the shaft.
+func Keyway2D(dia, keyWidth, keyDepth float64) SDF2 {
+	return Difference2D(Circle2D(0.5*dia), keySlot(dia, keyWidth, keyDepth))
+}
+
+// Return the profile of a keyed bore. This is the tool to subtract from a hub
+// for a shaft with a keyway, the key slot extends keyDepth past the bore.
+func KeyedBore2D(dia, keyWidth, keyDepth float64) SDF2 {
+	return Union2D(Circle2D(0.5*dia), keySlot(dia, keyWidth, keyDepth))
+}
+
+//-----------------------------------------------------------------------------
+// living hinges
+
+type LivingHingeSDF2 struct {
+	size  V2      // half size of the hinge region
+	pitch V2      // row spacing (x), slot spacing along a row (y)
+	a     float64 // half length of the straight part of a slot
+	r     float64 // slot end radius
+	rows  int
+	bb    Box2
+}
+
+// LivingHinge2D returns the slot pattern of a living hinge, to subtract
+// from a flat panel so it bends (about the y-axis) within the pattern.
+// The pattern covers a width (x) by height (y) region centered on the
+// origin. It has rows of slots along the y-axis, evenly spaced across the
+// width. The slots have rounded ends, they are slotLength long (overall)
+// and slotWidth wide, with slotGap between the slots of a row. The even
+// rows have a slot centered on y = 0, the odd rows are staggered by half the
+// slot spacing. Slots at the ends of the rows may run out of the region,
+// i.e. they are open at the panel edge if the panel is the same height.
+// More rows, narrower gaps and longer slots give a more flexible hinge.
+func LivingHinge2D(width, height, slotLength, slotWidth, slotGap float64, rows int) SDF2 {
+	if width <= 0 || height <= 0 {
+		panic("invalid size")
+	}
+	if rows <= 0 {
+		panic("rows <= 0")
+	}
+	if slotWidth <= 0 || slotGap <= 0 {
+		panic("invalid slot size")
+	}
+	if slotLength < slotWidth {
+		panic("slotLength < slotWidth")
+	}
+	if slotWidth >= width/float64(rows) {
+		panic("the slots are wider than the row spacing")
+	}
+	s := LivingHingeSDF2{}
+	s.size = V2{width, height}.MulScalar(0.5)
+	s.pitch = V2{width / float64(rows), slotLength + slotGap}
+	s.r = 0.5 * slotWidth
+	s.a = 0.5*slotLength - s.r
+	s.rows = rows
+	s.bb = Box2{s.size.Negate(), s.size}
+	return &s
+}
+
+// Return the minimum distance to the slots.
+func (s *LivingHingeSDF2) Evaluate(p V2) float64 {
+	// the nearest slot of a row
+	row := func(j int) float64 {
+		x := p.X - (-s.size.X + (float64(j)+0.5)*s.pitch.X)
+		y := p.Y
+		if j%2 == 1 {
+			// staggered row
+			y += 0.5 * s.pitch.Y
+		}
+		y -= s.pitch.Y * math.Round(y/s.pitch.Y)
+		return V2{x, Max(Abs(y)-s.a, 0)}.Length() - s.r
+	}
+	// search out from the nearest row until the rows are further away
+	i := int(math.Round((p.X+s.size.X)/s.pitch.X - 0.5))
+	i = int(Clamp(float64(i), 0, float64(s.rows-1)))
+	d := row(i)
+	for k := 1; k < s.rows; k++ {
+		if float64(k)*s.pitch.X-s.pitch.X/2-s.r > d {
+			break
+		}
+		if i-k >= 0 {
+			d = Min(d, row(i-k))
+		}
+		if i+k < s.rows {
+			d = Min(d, row(i+k))
+		}
+	}
+	// clip to the hinge region
+	return Max(d, sdf_box2d(p, s.size))
+}
+
+// Return the bounding box.
+func (s *LivingHingeSDF2) BoundingBox() Box2 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
@@ -48,6 +48,105 @@ func CounterSunk_Hole3D(
 	return Chamfered_Hole3D(l, r, r)
 }
 
+// Drilled Hole with a conical drill point.
+// The hole goes down from z = 0. The full diameter extends to depth and
+// the drill point is below that. Standard point angles are DtoR(118) and
+// DtoR(135).
+func DrillHole3D(
+	dia float64, // hole diameter
+	depth float64, // depth of the full diameter
+	point_angle float64, // included angle of the drill point (radians)
+) SDF3 {
+	if point_angle <= 0 || point_angle >= PI {
+		panic("point_angle must be in (0, PI)")
+	}
+	r := dia / 2
+	// height of the drill point cone
+	h := r / math.Tan(point_angle/2)
+	s0 := Cylinder3D(depth, r, 0)
+	s0 = Transform3D(s0, Translate3d(V3{0, 0, -depth / 2}))
+	s1 := Cone3D(h, 0, r, 0)
+	s1 = Transform3D(s1, Translate3d(V3{0, 0, -depth - h/2}))
+	return Union3D(s0, s1)
+}
+
+// Through Hole for a part from z = 0 down to z = -l.
+// The hole extends past both faces of the part so no skin is left when
+// it is subtracted.
+func ThroughHole3D(
+	dia float64, // hole diameter
+	l float64, // thickness of the part
+) SDF3 {
+	ext := dia / 2
+	s := Cylinder3D(l+2*ext, dia/2, 0)
+	return Transform3D(s, Translate3d(V3{0, 0, -l / 2}))
+}
+
+// Counter Bored Slot, the slot version of CounterBored_Hole3D (see Slot2D).
+func CounterBored_Slot3D(
+	l float64, // total length
+	length float64, // slot length (between centers)
+	width float64, // slot width
+	cb_width float64, // counter bore width
+	cb_d float64, // counter bore depth
+) SDF3 {
+	s0 := Extrude3D(Slot2D(length, width), l)
+	s1 := Extrude3D(Slot2D(length, cb_width), cb_d)
+	s1 = Transform3D(s1, Translate3d(V3{0, 0, (l - cb_d) / 2}))
+	return Union3D(s0, s1)
+}
+
+// Through Slot for a part from z = 0 down to z = -l (see Slot2D).
+// As with ThroughHole3D the slot extends past both faces of the part.
+func SlotHole3D(
+	length float64, // slot length (between centers)
+	width float64, // slot width
+	l float64, // thickness of the part
+) SDF3 {
+	ext := width / 2
+	s := Extrude3D(Slot2D(length, width), l+2*ext)
+	return Transform3D(s, Translate3d(V3{0, 0, -l / 2}))
+}
+
+// Hex Nut Pocket for a captive nut, from z = 0 down to z = -thickness.
+// The pocket extends above z = 0 so no skin is left when it is subtracted
+// from a face. The flats are parallel to the x-axis. See FastenerLookup for
+// standard sizes.
+func HexNutPocket3D(
+	acrossFlats float64, // nut flat to flat distance
+	thickness float64, // nut thickness
+) SDF3 {
+	if acrossFlats <= 0 || thickness <= 0 {
+		panic("acrossFlats <= 0 || thickness <= 0")
+	}
+	r := acrossFlats / (2 * math.Cos(DtoR(30)))
+	ext := r
+	s := Extrude3D(RegularPolygon2D(6, r), thickness+ext)
+	return Transform3D(s, Translate3d(V3{0, 0, (ext - thickness) / 2}))
+}
+
+// Socket Cap Head Pocket for a counterbored cap screw. The head recess goes
+// from z = 0 down to z = -headHeight and the clearance hole goes on down for
+// another 2 * headDia, union a ThroughHole3D for a deeper hole. As with
+// HexNutPocket3D the recess extends above z = 0. See FastenerLookup for
+// standard sizes.
+func SocketCapHeadPocket3D(
+	dia float64, // clearance hole diameter
+	headDia float64, // head diameter
+	headHeight float64, // head height
+) SDF3 {
+	if dia <= 0 || headDia <= dia || headHeight <= 0 {
+		panic("bad cap screw size")
+	}
+	ext := headDia / 2
+	s0 := Cylinder3D(headHeight+ext, headDia/2, 0)
+	s0 = Transform3D(s0, Translate3d(V3{0, 0, (ext - headHeight) / 2}))
+	l := 2 * headDia
+	s1 := Cylinder3D(l+ext, dia/2, 0)
+	s1 = Transform3D(s1, Translate3d(V3{0, 0, -headHeight - (l-ext)/2}))
+	return Union3D(s0, s1)
+}
+
 //-----------------------------------------------------------------------------
 
 // Return a rounded hex head for a nut or bolt.
@@ -145,6 +244,102 @@ func Washer3D(
 	return Difference3D(Cylinder3D(t, r_outer, 0), Cylinder3D(t, r_inner, 0))
 }
 
+//-----------------------------------------------------------------------------
+// Springs
+
+// Return a helical compression spring centered on the origin.
+// The wire is swept along the helix using Screw3D, so the wire section is
+// circular in the axial plane (slightly thinner than a true swept circle
+// for steep helixes). The ends are ground flat. With closed ends there is
+// an extra coil with touching turns at each end, so the free length is
+// pitch * turns + 2 * wire_dia, otherwise it is pitch * turns.
+// A pitch less than the wire diameter is clamped, the coils touch.
+func Spring3D(
+	wire_dia float64, // wire diameter
+	coil_dia float64, // mean coil diameter (at the center of the wire)
+	pitch float64, // distance between the active coils
+	turns float64, // number of active turns
+	closed_ends bool, // add closed coils at each end
+) SDF3 {
+	if wire_dia <= 0 || turns <= 0 {
+		panic("wire_dia, turns must be > 0")
+	}
+	if coil_dia <= wire_dia {
+		panic("coil_dia <= wire_dia")
+	}
+	pitch = Max(pitch, wire_dia)
+	// the wire section at the coil radius
+	wire := Transform2D(Circle2D(wire_dia/2), Translate2d(V2{0, coil_dia / 2}))
+	l := pitch * turns
+	body := Screw3D(wire, l, pitch, 1)
+	if !closed_ends {
+		return body
+	}
+	// closed coil from z0, phased to join the body coil
+	end := func(z0, zc float64) SDF3 {
+		theta := TAU * z0 / pitch
+		phi := theta - TAU*(z0-zc)/wire_dia
+		s := Screw3D(wire, wire_dia, wire_dia, 1)
+		return Transform3D(s, Translate3d(V3{0, 0, zc}).Mul(RotateZ(phi)))
+	}
+	top := end(l/2, (l+wire_dia)/2)
+	bottom := end(-l/2, -(l+wire_dia)/2)
+	return Union3D(body, top, bottom)
+}
+
+//-----------------------------------------------------------------------------
+// O-ring grooves
+// The groove sizes are the usual static seal design ratios of the cord
+// diameter: the depth gives 20-25% squeeze of the cord and the width leaves
+// room for the cord to swell.
+
+const (
+	ORING_FACE_DEPTH  = 0.75 // face seal groove depth / cord diameter
+	ORING_FACE_WIDTH  = 1.4  // face seal groove width / cord diameter
+	ORING_BORE_DEPTH  = 0.8  // bore seal groove depth / cord diameter
+	ORING_BORE_WIDTH  = 1.3  // bore seal groove width / cord diameter
+	oring_tool_extend = 0.1  // tool extension past the cut face / cord diameter
+)
+
+// oringTool returns a rectangular section ring from r0 to r1, z0 to z1.
+func oringTool(r0, r1, z0, z1 float64) SDF3 {
+	s := Box2D(V2{r1 - r0, z1 - z0}, 0)
+	s = Transform2D(s, Translate2d(V2{(r0 + r1) / 2, (z0 + z1) / 2}))
+	return Revolve3D(s)
+}
+
+// Return the tool to cut a face seal (axial) O-ring groove.
+// The groove is cut down from z = 0 and its inner wall is at the O-ring
+// inner diameter.
+func ORingGroove3D(
+	id float64, // nominal O-ring inner diameter
+	cord float64, // O-ring cord diameter
+) SDF3 {
+	if id <= 0 || cord <= 0 {
+		panic("bad O-ring size")
+	}
+	r := id / 2
+	w := ORING_FACE_WIDTH * cord
+	h := ORING_FACE_DEPTH * cord
+	return oringTool(r, r+w, -h, oring_tool_extend*cord)
+}
+
+// Return the tool to cut a bore seal (radial) O-ring groove.
+// The groove is cut into the wall of a bore of the O-ring inner diameter
+// and is centered on z = 0.
+func ORingBoreGroove3D(
+	id float64, // nominal O-ring inner diameter
+	cord float64, // O-ring cord diameter
+) SDF3 {
+	if id <= 0 || cord <= 0 {
+		panic("bad O-ring size")
+	}
+	r := id / 2
+	w := ORING_BORE_WIDTH * cord
+	h := ORING_BORE_DEPTH * cord
+	return oringTool(r-oring_tool_extend*cord, r+h, -w/2, w/2)
+}
+
 //-----------------------------------------------------------------------------
 // Board standoffs
 
@@ -528,3 +723,132 @@ func PanelBox3D(k *PanelBoxParms) []SDF3 {
 }
 
 //-----------------------------------------------------------------------------
+
+// Return a D-shaft of length l. See DShaft2D.
+func DShaft3D(dia, flat, l float64) SDF3 {
+	return Extrude3D(DShaft2D(dia, flat), l)
+}
+
+// Return a shaft with a keyway of length l. See Keyway2D.
+func Keyway3D(dia, keyWidth, keyDepth, l float64) SDF3 {
+	return Extrude3D(Keyway2D(dia, keyWidth, keyDepth), l)
+}
+
+// Return a keyed bore of length l to subtract from a hub. See KeyedBore2D.
+func KeyedBore3D(dia, keyWidth, keyDepth, l float64) SDF3 {
+	return Extrude3D(KeyedBore2D(dia, keyWidth, keyDepth), l)
+}
+
+//-----------------------------------------------------------------------------
+// Enclosures
+
+type EnclosureParms struct {
+	Inner        V3      // inner cavity size
+	Wall         float64 // wall thickness
+	LidHeight    float64 // outer height of the lid (> wall)
+	CornerRadius float64 // outer edge rounding
+	LipHeight    float64 // height of the lid lip (default 2 * wall)
+	Clearance    float64 // lip clearance (default 0.1 * wall)
+	BossDiameter float64 // corner screw boss diameter (0 for none)
+	BossHole     float64 // pilot hole diameter in the base bosses
+	LidHole      float64 // clearance hole diameter in the lid bosses
+}
+
+// EnclosureBox3D returns the base and lid of a box with the given inner
+// cavity, sitting on z = 0 with the lid in its assembled position (flip it
+// over to print it). The lid has a lip (the inner half of the wall) that
+// drops into a recess in the top of the base wall, with a clearance all
+// around. The optional screw bosses are in the corners of the cavity, the
+// base and lid bosses meet below the lip.
+func EnclosureBox3D(k *EnclosureParms) (base, lid SDF3) {
+	// sanity checks
+	if k.Inner.MinComponent() <= 0 {
+		panic("invalid inner size")
+	}
+	if k.Wall <= 0 {
+		panic("invalid wall size")
+	}
+	if k.CornerRadius < 0 {
+		panic("invalid corner radius")
+	}
+	if k.LipHeight < 0 || k.Clearance < 0 || k.BossDiameter < 0 || k.BossHole < 0 || k.LidHole < 0 {
+		panic("invalid parameter < 0")
+	}
+	lip := k.LipHeight
+	if lip == 0 {
+		lip = 2 * k.Wall
+	}
+	c := k.Clearance
+	if c == 0 {
+		c = 0.1 * k.Wall
+	}
+	if c >= 0.5*k.Wall {
+		panic("clearance >= wall / 2")
+	}
+
+	h := k.Inner.Z + 2*k.Wall // outer height
+	zs := h - k.LidHeight     // the base/lid split
+	zl := zs - lip            // the bottom of the lip
+	if k.LidHeight <= k.Wall || zl <= k.Wall {
+		panic("the lid and lip don't fit the box height")
+	}
+	if k.BossDiameter > 0 && (k.BossDiameter > k.Inner.X/2 || k.BossDiameter > k.Inner.Y/2) {
+		panic("the bosses don't fit the cavity")
+	}
+
+	// the prism between z0 and z1 of a rounded xy box
+	prism := func(size V2, round, z0, z1 float64) SDF3 {
+		s := Extrude3D(Box2D(size, Max(0, round)), z1-z0)
+		return Transform3D(s, Translate3d(V3{0, 0, 0.5 * (z0 + z1)}))
+	}
+	inner := V2{k.Inner.X, k.Inner.Y}
+	ri := k.CornerRadius - k.Wall
+	mid := inner.AddScalar(k.Wall)
+
+	// the box shell
+	outer := Transform3D(Box3D(V3{k.Inner.X + 2*k.Wall, k.Inner.Y + 2*k.Wall, h}, k.CornerRadius), Translate3d(V3{0, 0, 0.5 * h}))
+	cavity := Transform3D(Box3D(k.Inner, Max(0, ri)), Translate3d(V3{0, 0, 0.5 * h}))
+	shell := Difference3D(outer, cavity)
+
+	// the base, with a recess for the lip
+	base = Difference3D(shell, prism(mid, ri+0.5*k.Wall, zl, h+k.Wall))
+	// the lid, with the lip
+	lidLip := Difference3D(prism(mid.SubScalar(2*c), ri+0.5*k.Wall-c, zl+c, zs+k.Wall), prism(inner, ri, zl, h))
+	lid = Union3D(Cut3D(shell, V3{0, 0, zs}, V3{0, 0, 1}), lidLip)
+
+	if k.BossDiameter > 0 {
+		r := 0.5 * k.BossDiameter
+		x, y := 0.5*k.Inner.X-r, 0.5*k.Inner.Y-r
+		corners := V3Set{{x, y, 0}, {-x, y, 0}, {-x, -y, 0}, {x, -y, 0}}
+		cylinder := func(d, z0, z1 float64) SDF3 {
+			s := Cylinder3D(z1-z0, 0.5*d, 0)
+			return Transform3D(s, Translate3d(V3{0, 0, 0.5 * (z0 + z1)}))
+		}
+		var bosses, holes []SDF3
+		for _, p := range corners {
+			bosses = append(bosses, Transform3D(cylinder(k.BossDiameter, 0.5*k.Wall, zl), Translate3d(p)))
+			if k.BossHole > 0 {
+				holes = append(holes, Transform3D(cylinder(k.BossHole, k.Wall, zl+k.Wall), Translate3d(p)))
+			}
+		}
+		base = Difference3D(Union3D(base, Union3D(bosses...)), Union3D(holes...))
+		bosses, holes = nil, nil
+		for _, p := range corners {
+			bosses = append(bosses, Transform3D(cylinder(k.BossDiameter, zl+c, h-0.5*k.Wall), Translate3d(p)))
+			if k.LidHole > 0 {
+				holes = append(holes, Transform3D(cylinder(k.LidHole, zl, h+k.Wall), Translate3d(p)))
+			}
+		}
+		// keep the lid bosses off the base walls
+		lidBosses := Intersect3D(Union3D(bosses...), Offset3D(cavity, -c))
+		lid = Difference3D(Union3D(lid, lidBosses), Union3D(holes...))
+	}
+
+	// split the shell
+	w := V3{0.5*k.Inner.X + k.Wall, 0.5*k.Inner.Y + k.Wall, 0}
+	base = Clip3D(base, Box3{V3{-w.X, -w.Y, 0}, V3{w.X, w.Y, zs}})
+	lid = Clip3D(lid, Box3{V3{-w.X, -w.Y, zl + c}, V3{w.X, w.Y, h}})
+	return base, lid
+}
+
+//-----------------------------------------------------------------------------
@@ -10,16 +10,21 @@ package sdf
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/binary"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
 )
 
 //-----------------------------------------------------------------------------
 
 type STLHeader struct {
-	_     [80]uint8 // Header
+	Text  [80]uint8 // Header
 	Count uint32    // Number of triangles
 }
 
@@ -30,8 +35,82 @@ type STLTriangle struct {
 
 //-----------------------------------------------------------------------------
 
+// STLUnits are the units of the model being written to an STL file.
+// STL files have no units, but slicers assume mm, so models in other
+// units are scaled to mm as they are written.
+type STLUnits int
+
+const (
+	STL_MM   STLUnits = iota // model units are mm
+	STL_INCH                 // model units are inches
+)
+
+// stlHeader returns the STL header and the scaling to mm for the model units.
+func stlHeader(units STLUnits) (STLHeader, float64) {
+	hdr := STLHeader{}
+	var k float64
+	var name string
+	switch units {
+	case STL_MM:
+		k, name = 1, "mm"
+	case STL_INCH:
+		k, name = MM_PER_INCH, "inch"
+	default:
+		panic("unknown stl units")
+	}
+	// The text must not start with "solid" or readers may think this is an ASCII file.
+	copy(hdr.Text[:], fmt.Sprintf("sdfx: units mm (model units %s, scale %g)", name, k))
+	return hdr, k
+}
+
+// set sets the STL triangle from a triangle scaled by k.
+func (d *STLTriangle) set(t *Triangle3, k float64) {
+	n := t.Normal()
+	d.Normal[0] = float32(n.X)
+	d.Normal[1] = float32(n.Y)
+	d.Normal[2] = float32(n.Z)
+	d.Vertex1[0] = float32(k * t.V[0].X)
+	d.Vertex1[1] = float32(k * t.V[0].Y)
+	d.Vertex1[2] = float32(k * t.V[0].Z)
+	d.Vertex2[0] = float32(k * t.V[1].X)
+	d.Vertex2[1] = float32(k * t.V[1].Y)
+	d.Vertex2[2] = float32(k * t.V[1].Z)
+	d.Vertex3[0] = float32(k * t.V[2].X)
+	d.Vertex3[1] = float32(k * t.V[2].Y)
+	d.Vertex3[2] = float32(k * t.V[2].Z)
+}
+
+//-----------------------------------------------------------------------------
+
 // SaveSTL writes a triangle mesh to an STL file.
 func SaveSTL(path string, mesh []*Triangle3) error {
+	return saveSTL(path, mesh, STLHeader{}, 1)
+}
+
+// SaveSTLUnits writes a triangle mesh with the given model units to an STL file.
+// The output is scaled to mm and the units are noted in the file header.
+func SaveSTLUnits(path string, mesh []*Triangle3, units STLUnits) error {
+	hdr, k := stlHeader(units)
+	return saveSTL(path, mesh, hdr, k)
+}
+
+// SaveSTLGradient writes a triangle mesh to an STL file with the facet
+// normals taken from the gradient of s (at the centroid of each facet)
+// rather than the winding of the facet. s should be the SDF3 the mesh was
+// rendered from. Some viewers shade with the facet normals, for them this
+// looks smoother. The winding normals (SaveSTL) are the usual choice.
+func SaveSTLGradient(path string, mesh []*Triangle3, s SDF3) error {
+	return saveSTLNormals(path, mesh, STLHeader{}, 1, s)
+}
+
+// saveSTL writes a triangle mesh scaled by k to an STL file.
+func saveSTL(path string, mesh []*Triangle3, header STLHeader, k float64) error {
+	return saveSTLNormals(path, mesh, header, k, nil)
+}
+
+// saveSTLNormals writes a triangle mesh scaled by k to an STL file.
+// If s is not nil the facet normals are the normals of s.
+func saveSTLNormals(path string, mesh []*Triangle3, header STLHeader, k float64, s SDF3) error {
 	file, err := os.Create(path)
 	if err != nil {
 		return err
@@ -39,27 +118,24 @@ func SaveSTL(path string, mesh []*Triangle3) error {
 	defer file.Close()
 
 	buf := bufio.NewWriter(file)
-	header := STLHeader{}
 	header.Count = uint32(len(mesh))
 	if err := binary.Write(buf, binary.LittleEndian, &header); err != nil {
 		return err
 	}
 
+	eps := 0.0
+	if s != nil {
+		eps = normal_eps(s)
+	}
+
 	var d STLTriangle
 	for _, triangle := range mesh {
-		n := triangle.Normal()
-		d.Normal[0] = float32(n.X)
-		d.Normal[1] = float32(n.Y)
-		d.Normal[2] = float32(n.Z)
-		d.Vertex1[0] = float32(triangle.V[0].X)
-		d.Vertex1[1] = float32(triangle.V[0].Y)
-		d.Vertex1[2] = float32(triangle.V[0].Z)
-		d.Vertex2[0] = float32(triangle.V[1].X)
-		d.Vertex2[1] = float32(triangle.V[1].Y)
-		d.Vertex2[2] = float32(triangle.V[1].Z)
-		d.Vertex3[0] = float32(triangle.V[2].X)
-		d.Vertex3[1] = float32(triangle.V[2].Y)
-		d.Vertex3[2] = float32(triangle.V[2].Z)
+		d.set(triangle, k)
+		if s != nil {
+			c := triangle.V[0].Add(triangle.V[1]).Add(triangle.V[2]).DivScalar(3)
+			n := Normal3(s, c, eps)
+			d.Normal = [3]float32{float32(n.X), float32(n.Y), float32(n.Z)}
+		}
 		if err := binary.Write(buf, binary.LittleEndian, &d); err != nil {
 			return err
 		}
@@ -68,10 +144,53 @@ func SaveSTL(path string, mesh []*Triangle3) error {
 	return buf.Flush()
 }
 
+// writeAsciiSTL writes a triangle mesh as an ASCII STL file.
+func writeAsciiSTL(w io.Writer, mesh []*Triangle3, decimals int) error {
+	buf := bufio.NewWriter(w)
+	v3 := func(v V3) string {
+		return ftoa(v.X, decimals) + " " + ftoa(v.Y, decimals) + " " + ftoa(v.Z, decimals)
+	}
+	fmt.Fprintf(buf, "solid sdfx\n")
+	for _, t := range mesh {
+		fmt.Fprintf(buf, "facet normal %s\n outer loop\n", v3(t.Normal()))
+		for _, v := range t.V {
+			fmt.Fprintf(buf, "  vertex %s\n", v3(v))
+		}
+		fmt.Fprintf(buf, " endloop\nendfacet\n")
+	}
+	fmt.Fprintf(buf, "endsolid sdfx\n")
+	return buf.Flush()
+}
+
+// SaveSTLAscii writes a triangle mesh to an ASCII STL file.
+// The numbers are rounded to decimals decimal places with trailing zeros
+// dropped, decimals <= 0 writes them with %g.
+// Binary files (SaveSTL) are smaller and exact to float32.
+func SaveSTLAscii(path string, mesh []*Triangle3, decimals int) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return writeAsciiSTL(f, mesh, decimals)
+}
+
 //-----------------------------------------------------------------------------
 
 // WriteSTL writes a stream of triangles to an STL file.
 func WriteSTL(wg *sync.WaitGroup, path string) (chan<- *Triangle3, error) {
+	return writeSTL(wg, path, STLHeader{}, 1)
+}
+
+// WriteSTLUnits writes a stream of triangles with the given model units to an STL file.
+// The output is scaled to mm and the units are noted in the file header.
+func WriteSTLUnits(wg *sync.WaitGroup, path string, units STLUnits) (chan<- *Triangle3, error) {
+	hdr, k := stlHeader(units)
+	return writeSTL(wg, path, hdr, k)
+}
+
+// writeSTL writes a stream of triangles scaled by k to an STL file.
+func writeSTL(wg *sync.WaitGroup, path string, hdr STLHeader, k float64) (chan<- *Triangle3, error) {
 
 	f, err := os.Create(path)
 	if err != nil {
@@ -82,8 +201,7 @@ func WriteSTL(wg *sync.WaitGroup, path string) (chan<- *Triangle3, error) {
 	// The default buffer size doesn't appear to limit performance.
 	buf := bufio.NewWriter(f)
 
-	// write an empty header
-	hdr := STLHeader{}
+	// write the header, the count is filled in later
 	if err := binary.Write(buf, binary.LittleEndian, &hdr); err != nil {
 		return nil, err
 	}
@@ -101,19 +219,7 @@ func WriteSTL(wg *sync.WaitGroup, path string) (chan<- *Triangle3, error) {
 		var d STLTriangle
 		// read triangles from the channel and write them to the file
 		for t := range c {
-			n := t.Normal()
-			d.Normal[0] = float32(n.X)
-			d.Normal[1] = float32(n.Y)
-			d.Normal[2] = float32(n.Z)
-			d.Vertex1[0] = float32(t.V[0].X)
-			d.Vertex1[1] = float32(t.V[0].Y)
-			d.Vertex1[2] = float32(t.V[0].Z)
-			d.Vertex2[0] = float32(t.V[1].X)
-			d.Vertex2[1] = float32(t.V[1].Y)
-			d.Vertex2[2] = float32(t.V[1].Z)
-			d.Vertex3[0] = float32(t.V[2].X)
-			d.Vertex3[1] = float32(t.V[2].Y)
-			d.Vertex3[2] = float32(t.V[2].Z)
+			d.set(t, k)
 			if err := binary.Write(buf, binary.LittleEndian, &d); err != nil {
 				fmt.Printf("%s\n", err)
 				return
@@ -140,3 +246,122 @@ func WriteSTL(wg *sync.WaitGroup, path string) (chan<- *Triangle3, error) {
 }
 
 //-----------------------------------------------------------------------------
+
+// stlBinarySize returns the size of a binary STL file with n triangles.
+func stlBinarySize(n uint32) int64 {
+	return 84 + 50*int64(n)
+}
+
+// parseBinarySTL parses the triangles of a binary STL file.
+func parseBinarySTL(data []byte) ([]*Triangle3, error) {
+	if len(data) < 84 {
+		return nil, fmt.Errorf("truncated binary stl: %d byte header", len(data))
+	}
+	var hdr STLHeader
+	r := bytes.NewReader(data)
+	if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+		return nil, err
+	}
+	if size := stlBinarySize(hdr.Count); size != int64(len(data)) {
+		return nil, fmt.Errorf("truncated binary stl: %d triangles need %d bytes, file is %d bytes", hdr.Count, size, len(data))
+	}
+	mesh := make([]*Triangle3, hdr.Count)
+	var d STLTriangle
+	for i := range mesh {
+		if err := binary.Read(r, binary.LittleEndian, &d); err != nil {
+			return nil, err
+		}
+		v := func(x [3]float32) V3 {
+			return V3{float64(x[0]), float64(x[1]), float64(x[2])}
+		}
+		mesh[i] = NewTriangle3(v(d.Vertex1), v(d.Vertex2), v(d.Vertex3))
+	}
+	return mesh, nil
+}
+
+// parseAsciiSTL parses the triangles of an ASCII STL file.
+func parseAsciiSTL(data []byte) ([]*Triangle3, error) {
+	var mesh []*Triangle3
+	var v []V3
+	state := "solid"
+	lines := strings.Split(string(data), "\n")
+	for i, l := range lines {
+		f := strings.Fields(l)
+		if len(f) == 0 {
+			continue
+		}
+		unexpected := func() error {
+			return fmt.Errorf("ascii stl line %d: unexpected \"%s\"", i+1, strings.TrimSpace(l))
+		}
+		switch {
+		case state == "solid" && f[0] == "solid":
+			state = "facet"
+		case state == "facet" && f[0] == "facet":
+			state = "outer"
+		case state == "facet" && f[0] == "endsolid":
+			state = "end"
+		case state == "outer" && len(f) == 2 && f[0] == "outer" && f[1] == "loop":
+			state = "vertex"
+			v = v[:0]
+		case state == "vertex" && f[0] == "vertex":
+			if len(f) != 4 {
+				return nil, unexpected()
+			}
+			var x [3]float64
+			for j := range x {
+				var err error
+				if x[j], err = strconv.ParseFloat(f[j+1], 64); err != nil {
+					return nil, fmt.Errorf("ascii stl line %d: %s", i+1, err)
+				}
+			}
+			v = append(v, V3{x[0], x[1], x[2]})
+		case state == "vertex" && f[0] == "endloop":
+			if len(v) != 3 {
+				return nil, fmt.Errorf("ascii stl line %d: facet has %d vertices", i+1, len(v))
+			}
+			mesh = append(mesh, NewTriangle3(v[0], v[1], v[2]))
+			state = "endfacet"
+		case state == "endfacet" && f[0] == "endfacet":
+			state = "facet"
+		default:
+			return nil, unexpected()
+		}
+	}
+	if state != "end" {
+		return nil, fmt.Errorf("truncated ascii stl: no endsolid")
+	}
+	return mesh, nil
+}
+
+// ParseSTL parses the triangles of an ASCII or binary STL file.
+// A binary file may start with "solid" (like an ASCII file), so a file is
+// taken to be binary if the triangle count in the header matches the file
+// size. Otherwise it is parsed as ASCII, if it starts with "solid" and has
+// no NUL bytes.
+func ParseSTL(data []byte) ([]*Triangle3, error) {
+	if len(data) >= 84 {
+		n := binary.LittleEndian.Uint32(data[80:84])
+		if stlBinarySize(n) == int64(len(data)) {
+			return parseBinarySTL(data)
+		}
+	}
+	// a NUL is a sure sign of binary data
+	ascii := bytes.IndexByte(data, 0) < 0
+	if ascii && bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte("solid")) {
+		return parseAsciiSTL(data)
+	}
+	// not ascii, report the problem with the binary file
+	return parseBinarySTL(data)
+}
+
+// LoadSTL reads the triangles of an ASCII or binary STL file.
+// See ParseSTL.
+func LoadSTL(path string) ([]*Triangle3, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSTL(data)
+}
+
+//-----------------------------------------------------------------------------
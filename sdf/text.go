@@ -11,8 +11,12 @@ Convert a string and font specification into an SDF2
 package sdf
 
 import (
+	"fmt"
 	"io/ioutil"
+	"math"
+	"sort"
 	"strings"
+	"unicode"
 
 	"github.com/golang/freetype/truetype"
 	"golang.org/x/image/font"
@@ -29,9 +33,65 @@ const (
 	C_ALIGN              // center x = 0
 )
 
+// TextCase is a case transform applied to text before layout.
+type TextCase int
+
+const (
+	NO_CASE    TextCase = iota // as is
+	UPPER_CASE                 // upper case
+	LOWER_CASE                 // lower case
+	SMALL_CAPS                 // lower case as scaled down upper case
+)
+
+// TextRun is a run of text with its own size and baseline.
+type TextRun struct {
+	Text     string  // text of the run
+	Scale    float64 // size relative to the text height, e.g. 0.6 for a superscript
+	Offset   float64 // baseline shift as a fraction of the text height, > 0 is up
+	Material int     // material id of the glyphs (see TextMaterials3D), 0 is the default
+}
+
+// TextGlyph is where a glyph of a text object came from.
+type TextGlyph struct {
+	Line     int  // line of the text, from 0
+	Index    int  // character of the line, from 0 (whitespace counts)
+	Rune     rune // the character, after the case transform
+	Material int  // material id of the text run
+}
+
+// LineSpec is a line of text with its own alignment.
+type LineSpec struct {
+	Text  string // text of the line
+	Align align  // horizontal alignment of the line
+}
+
 type Text struct {
-	s      string
-	halign align
+	runs      []TextRun
+	halign    align
+	lalign    []align             // per line alignment (overrides halign)
+	stroke    float64             // stroke width for outlined text (0 == filled)
+	bridge    float64             // bridge width for stencil text (0 == no bridges)
+	simplify  float64             // polygon simplification tolerance (0 == none)
+	tcase     TextCase            // case transform
+	smallcaps float64             // small caps size relative to upper case
+	tab       float64             // tab width (0 == 4 spaces)
+	overlap   float64             // glyph growth before union (< 0 == default)
+	strict    bool                // report missing glyphs
+	baseline  bool                // first baseline at the origin (false == centered)
+	rotation  float64             // rotation about the origin (radians)
+	tracking  float64             // extra space between characters
+	spacing   float64             // line spacing (0 == 1, the font line height)
+	fill      FillRule            // fill rule for the glyph curves
+	kern      map[[2]rune]float64 // kerning overrides (em units)
+}
+
+// MissingGlyphs is the error for text with characters that can't be rendered.
+type MissingGlyphs struct {
+	Runes []rune // the missing characters, in text order
+}
+
+func (e *MissingGlyphs) Error() string {
+	return fmt.Sprintf("missing glyphs for %q", string(e.Runes))
 }
 
 //-----------------------------------------------------------------------------
@@ -44,7 +104,8 @@ func p_to_V2(p truetype.Point) V2 {
 //-----------------------------------------------------------------------------
 
 // return the SDF2 for the n-th curve of the glyph
-func glyph_curve(g *truetype.GlyphBuf, n int) (SDF2, bool) {
+// tol > 0 simplifies the curve polygon to within tol (in font units).
+func glyph_curve(g *truetype.GlyphBuf, n int, tol float64) (SDF2, bool) {
 	// get the start and end point
 	start := 0
 	if n != 0 {
@@ -53,9 +114,8 @@ func glyph_curve(g *truetype.GlyphBuf, n int) (SDF2, bool) {
 	end := g.Ends[n] - 1
 
 	// build a bezier curve from the points
-	// work out the cw/ccw direction
 	b := NewBezier()
-	sum := 0.0
+	var points []V2
 	off_prev := false
 	v_prev := p_to_V2(g.Points[end])
 
@@ -74,69 +134,234 @@ func glyph_curve(g *truetype.GlyphBuf, n int) (SDF2, bool) {
 		if off {
 			x.Mid()
 		}
-		// accumulate the cw/ccw direction
-		sum += (v.X - v_prev.X) * (v.Y + v_prev.Y)
+		points = append(points, v)
 		// next point...
 		v_prev = v
 		off_prev = off
 	}
 	b.Close()
 
-	return Polygon2D(b.Polygon().Vertices()), sum > 0
+	// work out the cw/ccw direction from the control points
+	b.SetSimplify(tol)
+	return b.SDF2(), PolygonArea2D(points) < 0
 }
 
 // return the SDF2 for a glyph
-func glyph_convert(g *truetype.GlyphBuf) SDF2 {
+// bridge > 0 cuts a bridge of that width (in font units) from each
+// counter (enclosed hole) up through the top of the glyph.
+// tol > 0 simplifies the glyph polygons to within tol (in font units).
+// With FILL_NONZERO (TrueType) the clockwise curves are solid and the
+// counter-clockwise curves are holes, with FILL_EVEN_ODD the curves are
+// filled by the even-odd rule (see Polygon2DWithHoles).
+func glyph_convert(g *truetype.GlyphBuf, bridge, tol float64, rule FillRule) SDF2 {
 	var s0 SDF2
-	for n := 0; n < len(g.Ends); n++ {
-		s1, cw := glyph_curve(g, n)
-		if cw {
-			s0 = Union2D(s0, s1)
-		} else {
-			s0 = Difference2D(s0, s1)
+	var holes []Box2
+	if rule == FILL_EVEN_ODD {
+		var curves []*PolySDF2
+		var contours [][]V2
+		for n := 0; n < len(g.Ends); n++ {
+			if s1, _ := glyph_curve(g, n, tol); s1 != nil {
+				curves = append(curves, s1.(*PolySDF2))
+				contours = append(contours, s1.(*PolySDF2).Vertices())
+			}
+		}
+		s0 = polygon_fill(contours, FILL_EVEN_ODD)
+		// a hole is within an odd number of other curves
+		for i, c := range curves {
+			k := 0
+			for j, x := range curves {
+				if i != j && x.Evaluate(c.vertex[0]) < 0 {
+					k++
+				}
+			}
+			if k%2 == 1 {
+				holes = append(holes, c.BoundingBox())
+			}
 		}
+	} else {
+		for n := 0; n < len(g.Ends); n++ {
+			s1, cw := glyph_curve(g, n, tol)
+			if cw {
+				s0 = Union2D(s0, s1)
+			} else {
+				s0 = Difference2D(s0, s1)
+				holes = append(holes, s1.BoundingBox())
+			}
+		}
+	}
+	if s0 == nil || bridge <= 0 || len(holes) == 0 {
+		return s0
 	}
-	return s0
+	// each bridge connects a counter to the outside, so the stencil around
+	// the counter stays in one piece
+	top := s0.BoundingBox().Max.Y + bridge
+	var bridges []SDF2
+	for _, h := range holes {
+		c := h.Center()
+		b := Box2D(V2{bridge, top - c.Y}, 0)
+		bridges = append(bridges, Transform2D(b, Translate2d(V2{c.X, (top + c.Y) / 2})))
+	}
+	return Difference2D(s0, Union2D(bridges...))
 }
 
 //-----------------------------------------------------------------------------
 
-// Return an SDF2 slice for a line of text
-func lineSDF2(f *truetype.Font, l string) ([]SDF2, float64, error) {
+// fallback width of whitespace (fraction of an em)
+const space_width = 0.25
+
+// default glyph overlap (fraction of the text height)
+const text_overlap = 1e-4
+
+// Return the union of the glyphs of a text, each grown by eps so glyphs
+// that just touch (e.g. with tight kerning) merge without a hairline gap.
+func glyph_union(ss []SDF2, eps float64) SDF2 {
+	if eps <= 0 {
+		return UnionMany2D(ss...)
+	}
+	grown := make([]SDF2, len(ss))
+	for i := range ss {
+		grown[i] = Offset2D(ss[i], eps)
+	}
+	return UnionMany2D(grown...)
+}
+
+// Return the advance width (in font units) of a whitespace character.
+// Fonts with no glyph for the character, or a zero advance width for it,
+// get a fraction of an em so words don't run together.
+func space_advance(f *truetype.Font, r rune) float64 {
+	scale := fixed.Int26_6(f.FUnitsPerEm())
+	i := f.Index(r)
+	adv := float64(f.HMetric(scale, i).AdvanceWidth)
+	if i == 0 || adv <= 0 {
+		adv = space_width * float64(f.FUnitsPerEm())
+	}
+	return adv
+}
+
+// Return true if a character has no glyph to render. Whitespace isn't
+// missing, it's rendered as an advance.
+func glyph_missing(f *truetype.Font, r rune) bool {
+	return !unicode.IsSpace(r) && (f.Index(r) == 0 || unicode.IsControl(r))
+}
+
+// glyphSource returns the outline (in font units) of a character, converted
+// with the bridge width, simplification tolerance and fill rule.
+type glyphSource func(r rune, bridge, tol float64, rule FillRule) (SDF2, error)
+
+// Return a glyph source that loads and converts the glyphs of a font.
+func font_glyphs(f *truetype.Font) glyphSource {
+	scale := fixed.Int26_6(f.FUnitsPerEm())
+	return func(r rune, bridge, tol float64, rule FillRule) (SDF2, error) {
+		g := &truetype.GlyphBuf{}
+		err := g.Load(f, scale, f.Index(r), font.HintingNone)
+		if err != nil {
+			return nil, err
+		}
+		return glyph_convert(g, bridge, tol, rule), nil
+	}
+}
+
+// Return an SDF2 slice for a line of text runs.
+// Missing glyphs are skipped.
+// The stroke, bridge and simplification settings of the text object are
+// scaled to font units by k. The baseline shift of a run is a fraction of
+// the line height ah (in font units).
+func lineSDF2(f *truetype.Font, l []TextRun, t *Text, k, ah float64) ([]SDF2, float64, error) {
+	ss, _, x_ofs, err := line_glyphs(f, font_glyphs(f), l, t, k, ah)
+	return ss, x_ofs, err
+}
+
+// Return the glyphs of a line of text as for lineSDF2, and where each glyph
+// came from (the Line is left 0). The font gives the metrics, the outlines
+// come from the glyph source.
+func line_glyphs(f *truetype.Font, glyph glyphSource, l []TextRun, t *Text, k, ah float64) ([]SDF2, []TextGlyph, float64, error) {
 	i_prev := truetype.Index(0)
+	r_prev := rune(0)
 	scale := fixed.Int26_6(f.FUnitsPerEm())
+	em := float64(f.FUnitsPerEm())
 	x_ofs := 0.0
 
 	var ss []SDF2
+	var ids []TextGlyph
 
-	for _, r := range l {
-		i := f.Index(r)
+	// tab stops are measured from the start of the line
+	tab := t.tab * k
+	if tab <= 0 {
+		tab = 4 * space_advance(f, ' ')
+	}
+	tracking := t.tracking * k
+	n := 0
 
-		// get the glyph metrics
-		hm := f.HMetric(scale, i)
+	for _, run := range l {
+		y_ofs := run.Offset * ah
+		for _, r := range run.Text {
+			// tracking between characters
+			if n > 0 && r != '\t' && !glyph_missing(f, r) {
+				x_ofs += tracking
+			}
+			n++
+			if r == '\t' {
+				// advance to the next tab stop
+				x_ofs = (math.Floor(x_ofs/tab) + 1) * tab
+				i_prev = 0
+				r_prev = 0
+				continue
+			}
+			if unicode.IsSpace(r) {
+				// no outline, just the advance
+				x_ofs += run.Scale * space_advance(f, r)
+				i_prev = 0
+				r_prev = 0
+				continue
+			}
+			if glyph_missing(f, r) {
+				continue
+			}
 
-		// apply kerning
-		k := f.Kern(scale, i_prev, i)
-		x_ofs += float64(k)
-		i_prev = i
+			id := TextGlyph{Index: n - 1, Rune: r, Material: run.Material}
+			size := run.Scale
+			// small caps are scaled down upper case glyphs
+			if t.tcase == SMALL_CAPS && unicode.IsLower(r) {
+				r = unicode.ToUpper(r)
+				size *= t.smallcaps
+			}
 
-		// load the glyph
-		g := &truetype.GlyphBuf{}
-		err := g.Load(f, scale, i, font.HintingNone)
-		if err != nil {
-			return nil, 0, err
-		}
+			i := f.Index(r)
 
-		s := glyph_convert(g)
-		if s != nil {
-			s = Transform2D(s, Translate2d(V2{x_ofs, 0}))
-			ss = append(ss, s)
-		}
+			// get the glyph metrics
+			hm := f.HMetric(scale, i)
 
-		x_ofs += float64(hm.AdvanceWidth)
+			// apply kerning
+			if k, ok := t.kern[[2]rune{r_prev, r}]; ok && r_prev != 0 {
+				x_ofs += size * k * em
+			} else {
+				x_ofs += size * float64(f.Kern(scale, i_prev, i))
+			}
+			i_prev = i
+			r_prev = r
+
+			// the widths and tolerance are for the scaled glyph
+			s, err := glyph(r, t.bridge*k/size, t.simplify*k/size, t.fill)
+			if err != nil {
+				return nil, nil, 0, err
+			}
+			if s != nil {
+				if size != 1 {
+					s = ScaleUniform2D(s, size)
+				}
+				if t.stroke > 0 {
+					s = Shell2D(s, t.stroke*k)
+				}
+				s = Transform2D(s, Translate2d(V2{x_ofs, y_ofs}))
+				ss = append(ss, s)
+				ids = append(ids, id)
+			}
+
+			x_ofs += size * float64(hm.AdvanceWidth)
+		}
 	}
 
-	return ss, x_ofs, nil
+	return ss, ids, x_ofs, nil
 }
 
 //-----------------------------------------------------------------------------
@@ -144,10 +369,319 @@ func lineSDF2(f *truetype.Font, l string) ([]SDF2, float64, error) {
 
 // NewText returns a text object (text and alignment).
 func NewText(s string) *Text {
+	return NewTextRuns([]TextRun{{s, 1, 0, 0}})
+}
+
+// NewTextRuns returns a text object for a sequence of text runs.
+// Each run is scaled and has its baseline shifted relative to the text
+// height, e.g. a superscript is a run with Scale 0.6 and Offset 0.4.
+// Runs may contain newlines.
+func NewTextRuns(runs []TextRun) *Text {
+	for _, r := range runs {
+		if r.Scale <= 0 {
+			panic("scale <= 0")
+		}
+		if r.Material < 0 {
+			panic("material < 0")
+		}
+	}
 	return &Text{
-		s:      s,
-		halign: C_ALIGN,
+		runs:      runs,
+		halign:    C_ALIGN,
+		smallcaps: 0.75,
+		overlap:   -1,
+	}
+}
+
+// NewTextLines returns a text object for lines of text with their own
+// alignment, e.g. a centered title above left aligned text. A line with
+// newlines is split into lines with the same alignment.
+func NewTextLines(lines []LineSpec) *Text {
+	var text []string
+	var lalign []align
+	for _, l := range lines {
+		text = append(text, l.Text)
+		for range strings.Split(l.Text, "\n") {
+			lalign = append(lalign, l.Align)
+		}
+	}
+	t := NewText(strings.Join(text, "\n"))
+	t.lalign = lalign
+	return t
+}
+
+// WrapText returns a text object for a string word wrapped to lines no
+// wider than maxWidth for a text height h, e.g. to fit user text on a plate.
+// The width of a line is the sum of its glyph advances and kerning (as for
+// TextSDF2 with the default settings), the glyph outlines aren't built.
+// Words are split on whitespace, newlines in the string are kept as line
+// breaks. A word wider than maxWidth is broken between characters, each
+// line gets as many characters of it as fit (at least one).
+func WrapText(f *truetype.Font, s string, h, maxWidth float64) *Text {
+	if h <= 0 {
+		panic("h <= 0")
+	}
+	if maxWidth <= 0 {
+		panic("maxWidth <= 0")
+	}
+	vm := f.VMetric(fixed.Int26_6(f.FUnitsPerEm()), f.Index('\n'))
+	ah := float64(vm.AdvanceHeight)
+	k := ah / h
+	t := NewText("")
+	// lay out the advances and kerning only, no glyph outlines are built
+	none := func(r rune, bridge, tol float64, rule FillRule) (SDF2, error) {
+		return nil, nil
+	}
+	// the width of a line of text
+	width := func(line string) float64 {
+		_, _, x, _ := line_glyphs(f, none, []TextRun{{line, 1, 0, 0}}, t, k, ah)
+		return x / k
+	}
+	var lines []string
+	for _, para := range strings.Split(s, "\n") {
+		line := ""
+		for _, word := range strings.Fields(para) {
+			if line != "" {
+				if x := line + " " + word; width(x) <= maxWidth {
+					line = x
+					continue
+				}
+				lines = append(lines, line)
+			}
+			// break up a word that's too wide for a line
+			r := []rune(word)
+			for len(r) > 1 && width(string(r)) > maxWidth {
+				n := 1
+				for n < len(r)-1 && width(string(r[:n+1])) <= maxWidth {
+					n++
+				}
+				lines = append(lines, string(r[:n]))
+				r = r[n:]
+			}
+			line = string(r)
+		}
+		lines = append(lines, line)
+	}
+	return NewText(strings.Join(lines, "\n"))
+}
+
+// SetStroke sets the stroke width for outlined text, 0 gives filled text.
+// The width is in the same units as the text height. Strokes wider than
+// the stems of a glyph merge, so the glyph is filled in again.
+func (t *Text) SetStroke(width float64) {
+	if width < 0 {
+		panic("width < 0")
+	}
+	t.stroke = width
+}
+
+// SetStencil sets the bridge width for stencil text, 0 gives no bridges.
+// A bridge is cut from each counter of a glyph (e.g. the center of an O)
+// up through the top of the glyph, so a stencil cut with the text stays in
+// one piece. The width is in the same units as the text height.
+func (t *Text) SetStencil(width float64) {
+	if width < 0 {
+		panic("width < 0")
+	}
+	t.bridge = width
+}
+
+// SetTabWidth sets the distance between tab stops, 0 gives 4 spaces.
+// A tab advances to the next tab stop from the start of the line. The width
+// is in the same units as the text height.
+func (t *Text) SetTabWidth(width float64) {
+	if width < 0 {
+		panic("width < 0")
+	}
+	t.tab = width
+}
+
+// SetSimplify sets the tolerance for simplifying the glyph outlines, 0 gives
+// no simplification. Outline vertices that are within tol of a straight line
+// between their neighbours are removed, which reduces the vertex count of the
+// SDF2 (and the triangle count of extruded text). The tolerance is in the same
+// units as the text height.
+func (t *Text) SetSimplify(tol float64) {
+	if tol < 0 {
+		panic("tol < 0")
+	}
+	t.simplify = tol
+}
+
+// SetOverlap sets the distance that each glyph is grown by before the glyphs
+// are unioned, so adjacent glyphs that just touch merge reliably. The default
+// is a small fraction of the text height, 0 gives no growth. The distance is
+// in the same units as the text height.
+func (t *Text) SetOverlap(eps float64) {
+	if eps < 0 {
+		panic("eps < 0")
+	}
+	t.overlap = eps
+}
+
+// SetStrict sets the reporting of missing glyphs. Characters with no glyph in
+// the font (and control characters) aren't rendered. If strict is set
+// TextSDF2 returns a *MissingGlyphs error listing them, along with the SDF2
+// for the rest of the text.
+func (t *Text) SetStrict(strict bool) {
+	t.strict = strict
+}
+
+// SetBaseline sets the placement of the text. By default the text is centered
+// on the origin. With baseline set the text isn't centered, the baseline of
+// the first line is on the x-axis and the lines are aligned (see WithAlign)
+// about x = 0, e.g. with L_ALIGN the first line starts at the origin.
+func (t *Text) SetBaseline(baseline bool) {
+	t.baseline = baseline
+}
+
+// SetRotation sets the rotation (counter-clockwise, in radians) of the text.
+// The text is rotated about the origin, i.e. about its center, or about the
+// start of the first baseline (see SetBaseline).
+func (t *Text) SetRotation(theta float64) {
+	t.rotation = theta
+}
+
+// SetCase sets the case transform for the text.
+// SMALL_CAPS renders lower case letters as upper case glyphs scaled down by
+// the small caps ratio (see SetSmallCaps).
+func (t *Text) SetCase(c TextCase) {
+	t.tcase = c
+}
+
+// SetSmallCaps sets the size of small caps relative to upper case, e.g. 0.75.
+func (t *Text) SetSmallCaps(ratio float64) {
+	if ratio <= 0 || ratio > 1 {
+		panic("ratio must be in (0, 1]")
+	}
+	t.smallcaps = ratio
+}
+
+// SetTracking sets extra space between the characters of a line (negative
+// values tighten the text), 0 gives the font spacing. The space is in the
+// same units as the text height.
+func (t *Text) SetTracking(space float64) {
+	t.tracking = space
+}
+
+// SetLineSpacing sets the distance between the baselines of the lines as a
+// multiple of the line height of the font, e.g. 1.5. The default is 1.
+func (t *Text) SetLineSpacing(k float64) {
+	if k <= 0 {
+		panic("k <= 0")
+	}
+	t.spacing = k
+}
+
+// SetFillRule sets the fill rule for the curves of the glyphs. The default
+// is FILL_NONZERO, the TrueType rule. FILL_EVEN_ODD is for fonts (or art
+// converted to fonts) with holes that have the same winding as their outer
+// curve, see Polygon2DWithHoles.
+func (t *Text) SetFillRule(rule FillRule) {
+	t.fill = rule
+}
+
+// SetKernOverride sets kerning for pairs of characters that replaces the
+// kerning of the font, e.g. {{'A', 'V'}: -0.08}. The kerning is in em units
+// (negative values move the characters closer) and applies to the characters
+// as rendered, i.e. after case transforms. Pairs that aren't in the map keep
+// the font kerning.
+func (t *Text) SetKernOverride(kern map[[2]rune]float64) {
+	t.kern = make(map[[2]rune]float64, len(kern))
+	for k, v := range kern {
+		t.kern[k] = v
+	}
+}
+
+//-----------------------------------------------------------------------------
+// functional options
+
+// TextOption is an option for NewTextWithOptions.
+type TextOption func(t *Text)
+
+// NewTextWithOptions returns a text object with a set of options applied
+// in order, e.g. NewTextWithOptions("A\nB", WithAlign(L_ALIGN), WithLineSpacing(1.5)).
+// The options are the same as the setters with the same names. A text object
+// isn't changed by rendering, so once it's built it can be rendered from
+// concurrent goroutines.
+func NewTextWithOptions(s string, opts ...TextOption) *Text {
+	t := NewText(s)
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// WithAlign sets the horizontal alignment of the lines of text (L_ALIGN,
+// R_ALIGN or C_ALIGN). The alignments of the lines from NewTextLines are kept.
+func WithAlign(a align) TextOption { return func(t *Text) { t.halign = a } }
+
+// WithTracking is the option for SetTracking.
+func WithTracking(space float64) TextOption { return func(t *Text) { t.SetTracking(space) } }
+
+// WithLineSpacing is the option for SetLineSpacing.
+func WithLineSpacing(k float64) TextOption { return func(t *Text) { t.SetLineSpacing(k) } }
+
+// WithStroke is the option for SetStroke.
+func WithStroke(width float64) TextOption { return func(t *Text) { t.SetStroke(width) } }
+
+// WithStencil is the option for SetStencil.
+func WithStencil(width float64) TextOption { return func(t *Text) { t.SetStencil(width) } }
+
+// WithTabWidth is the option for SetTabWidth.
+func WithTabWidth(width float64) TextOption { return func(t *Text) { t.SetTabWidth(width) } }
+
+// WithSimplify is the option for SetSimplify.
+func WithSimplify(tol float64) TextOption { return func(t *Text) { t.SetSimplify(tol) } }
+
+// WithOverlap is the option for SetOverlap.
+func WithOverlap(eps float64) TextOption { return func(t *Text) { t.SetOverlap(eps) } }
+
+// WithStrict is the option for SetStrict.
+func WithStrict(strict bool) TextOption { return func(t *Text) { t.SetStrict(strict) } }
+
+// WithBaseline is the option for SetBaseline.
+func WithBaseline(baseline bool) TextOption { return func(t *Text) { t.SetBaseline(baseline) } }
+
+// WithRotation is the option for SetRotation.
+func WithRotation(theta float64) TextOption { return func(t *Text) { t.SetRotation(theta) } }
+
+// WithFillRule is the option for SetFillRule.
+func WithFillRule(rule FillRule) TextOption { return func(t *Text) { t.SetFillRule(rule) } }
+
+// WithKernOverride is the option for SetKernOverride.
+func WithKernOverride(kern map[[2]rune]float64) TextOption {
+	return func(t *Text) { t.SetKernOverride(kern) }
+}
+
+// WithCase is the option for SetCase.
+func WithCase(c TextCase) TextOption { return func(t *Text) { t.SetCase(c) } }
+
+// WithSmallCaps is the option for SetSmallCaps.
+func WithSmallCaps(ratio float64) TextOption { return func(t *Text) { t.SetSmallCaps(ratio) } }
+
+//-----------------------------------------------------------------------------
+
+// lines returns the runs of each line of text with the upper/lower case
+// transform applied. Small caps are done glyph by glyph.
+func (t *Text) lines() [][]TextRun {
+	lines := [][]TextRun{nil}
+	for _, r := range t.runs {
+		switch t.tcase {
+		case UPPER_CASE:
+			r.Text = strings.ToUpper(r.Text)
+		case LOWER_CASE:
+			r.Text = strings.ToLower(r.Text)
+		}
+		for i, l := range strings.Split(r.Text, "\n") {
+			if i > 0 {
+				lines = append(lines, nil)
+			}
+			r.Text = l
+			lines[len(lines)-1] = append(lines[len(lines)-1], r)
+		}
 	}
+	return lines
 }
 
 // LoadFont loads a truetype (*.ttf) font file.
@@ -160,35 +694,390 @@ func LoadFont(fname string) (*truetype.Font, error) {
 	return truetype.Parse(b)
 }
 
-// TextSDF2 returns a sized SDF2 for a text object.
-func TextSDF2(f *truetype.Font, t *Text, h float64) (SDF2, error) {
+// Return the glyphs (in font units) of a text object with height h, and
+// the line height.
+func text_glyphs(f *truetype.Font, t *Text, h float64) ([]SDF2, float64, error) {
+	ss, _, ah, err := text_glyph_ids(f, font_glyphs(f), t, h)
+	return ss, ah, err
+}
+
+// Return the glyphs of a text object as for text_glyphs, with the outlines
+// from a glyph source, and where each glyph came from.
+func text_glyph_ids(f *truetype.Font, glyph glyphSource, t *Text, h float64) ([]SDF2, []TextGlyph, float64, error) {
 	scale := fixed.Int26_6(f.FUnitsPerEm())
-	lines := strings.Split(t.s, "\n")
+	lines := t.lines()
 	y_ofs := 0.0
 	vm := f.VMetric(scale, f.Index('\n'))
 	ah := float64(vm.AdvanceHeight)
 
 	var ss []SDF2
+	var ids []TextGlyph
 
 	for i := range lines {
-		ss_line, hlen, err := lineSDF2(f, lines[i])
+		ss_line, ids_line, hlen, err := line_glyphs(f, glyph, lines[i], t, ah/h, ah)
 		if err != nil {
-			return nil, err
+			return nil, nil, 0, err
+		}
+		halign := t.halign
+		if i < len(t.lalign) {
+			halign = t.lalign[i]
 		}
 		x_ofs := 0.0
-		if t.halign == R_ALIGN {
+		if halign == R_ALIGN {
 			x_ofs = -hlen
-		} else if t.halign == C_ALIGN {
+		} else if halign == C_ALIGN {
 			x_ofs = -hlen / 2.0
 		}
-		for i := range ss_line {
-			ss_line[i] = Transform2D(ss_line[i], Translate2d(V2{x_ofs, y_ofs}))
+		for j := range ss_line {
+			ss_line[j] = Transform2D(ss_line[j], Translate2d(V2{x_ofs, y_ofs}))
+			ids_line[j].Line = i
 		}
 		ss = append(ss, ss_line...)
-		y_ofs -= ah
+		ids = append(ids, ids_line...)
+		if t.spacing > 0 {
+			y_ofs -= ah * t.spacing
+		} else {
+			y_ofs -= ah
+		}
+	}
+
+	return ss, ids, ah, nil
+}
+
+// Return an SDF2 in font units placed as text, i.e. moved by -center (unless
+// baseline placement is set), scaled by k and rotated.
+func (t *Text) place(s SDF2, center V2, k float64) SDF2 {
+	if !t.baseline {
+		s = Transform2D(s, Translate2d(center.Neg()))
+	}
+	s = ScaleUniform2D(s, k)
+	if t.rotation != 0 {
+		s = Transform2D(s, Rotate2d(t.rotation))
+	}
+	return s
+}
+
+// Return the glyph overlap (in font units).
+func (t *Text) overlap_eps(ah, h float64) float64 {
+	if t.overlap >= 0 {
+		return t.overlap * ah / h
+	}
+	return text_overlap * ah
+}
+
+// TextSDF2 returns a sized SDF2 for a text object.
+func TextSDF2(f *truetype.Font, t *Text, h float64) (SDF2, error) {
+	ss, ah, err := text_glyphs(f, t, h)
+	if err != nil {
+		return nil, err
+	}
+
+	s := glyph_union(ss, t.overlap_eps(ah, h))
+	s = t.place(s, s.BoundingBox().Center(), h/ah)
+
+	if t.strict {
+		var missing []rune
+		for _, l := range t.lines() {
+			for _, run := range l {
+				for _, r := range run.Text {
+					if glyph_missing(f, r) {
+						missing = append(missing, r)
+					}
+				}
+			}
+		}
+		if len(missing) > 0 {
+			return s, &MissingGlyphs{missing}
+		}
+	}
+
+	return s, nil
+}
+
+// Return true if some of an SDF2 is inside, sampled on an n x n grid of its
+// bounding box.
+func has_inside(s SDF2, n int) bool {
+	bb := s.BoundingBox()
+	d := bb.Size().DivScalar(float64(n))
+	for i := 0; i <= n; i++ {
+		for j := 0; j <= n; j++ {
+			if s.Evaluate(bb.Min.Add(V2{float64(i) * d.X, float64(j) * d.Y})) < 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// InlaySDF2 returns the SDF2s for a two color inlay of a text object, the
+// full glyphs and the glyphs shrunk by inset. The shrunk glyphs are within
+// the full glyphs, the difference is a border of width inset. Glyphs with
+// stems narrower than 2 * inset collapse, these are left out of the inset
+// SDF2 (which is nil if all the glyphs collapse).
+func InlaySDF2(f *truetype.Font, t *Text, h, inset float64) (SDF2, SDF2, error) {
+	if inset <= 0 {
+		panic("inset <= 0")
+	}
+	ss, ah, err := text_glyphs(f, t, h)
+	if err != nil {
+		return nil, nil, err
+	}
+	full := glyph_union(ss, t.overlap_eps(ah, h))
+	center := full.BoundingBox().Center()
+
+	k := ah / h
+	var si []SDF2
+	for _, g := range ss {
+		g = Offset2D(g, -inset*k)
+		if has_inside(g, 100) {
+			si = append(si, g)
+		}
+	}
+	var s SDF2
+	if len(si) > 0 {
+		s = t.place(Union2D(si...), center, 1/k)
+	}
+
+	return t.place(full, center, 1/k), s, nil
+}
+
+// TextPart is the part of a text with a given material.
+type TextPart struct {
+	Material int
+	SDF      SDF2
+}
+
+// TextPartsSDF2 returns the SDF2s for the glyphs of each material of a text
+// object (see TextRun). The parts are placed as for TextSDF2, so together
+// they are the SDF2 of the whole text. They are returned in material id order.
+func TextPartsSDF2(f *truetype.Font, t *Text, h float64) ([]TextPart, error) {
+	ss, ids, ah, err := text_glyph_ids(f, font_glyphs(f), t, h)
+	if err != nil {
+		return nil, err
+	}
+	eps := t.overlap_eps(ah, h)
+	center := glyph_union(ss, eps).BoundingBox().Center()
+
+	glyphs := make(map[int][]SDF2)
+	for i, g := range ss {
+		glyphs[ids[i].Material] = append(glyphs[ids[i].Material], g)
 	}
+	var materials []int
+	for id := range glyphs {
+		materials = append(materials, id)
+	}
+	sort.Ints(materials)
+	parts := make([]TextPart, len(materials))
+	for i, id := range materials {
+		parts[i] = TextPart{id, t.place(glyph_union(glyphs[id], eps), center, h/ah)}
+	}
+	return parts, nil
+}
+
+// TextMaterials3D returns the text extruded to height with the glyphs tagged
+// with the material ids of their text runs (see Material3D), e.g. for a
+// multi-color print with Render3MF. Glyphs with material 0 are untagged.
+func TextMaterials3D(f *truetype.Font, t *Text, h, height float64) (SDF3, error) {
+	parts, err := TextPartsSDF2(f, t, h)
+	if err != nil {
+		return nil, err
+	}
+	var ss []SDF3
+	for _, p := range parts {
+		s := Extrude3D(p.SDF, height)
+		if p.Material > 0 {
+			s = Material3D(s, p.Material)
+		}
+		ss = append(ss, s)
+	}
+	return Union3D(ss...), nil
+}
+
+// TextRelief3D returns the text extruded with a height for each glyph, e.g.
+// for a plaque with a title deeper than the body. The text is placed as
+// for TextSDF2 and depth gives the height of each glyph from where it came
+// from. A glyph with depth > 0 is from z = 0 up to the depth, with depth < 0
+// from the depth up to z = 0 (union that with a base with its top at z = 0
+// for raised text, subtract this from it for engraved text). Glyphs with 0
+// depth are left out. Glyphs of the same depth are unioned as for TextSDF2.
+func TextRelief3D(f *truetype.Font, t *Text, h float64, depth func(g TextGlyph) float64) (SDF3, error) {
+	ss, ids, ah, err := text_glyph_ids(f, font_glyphs(f), t, h)
+	if err != nil {
+		return nil, err
+	}
+	eps := t.overlap_eps(ah, h)
+	center := glyph_union(ss, eps).BoundingBox().Center()
+
+	glyphs := make(map[float64][]SDF2)
+	for i, g := range ss {
+		if d := depth(ids[i]); d != 0 {
+			glyphs[d] = append(glyphs[d], g)
+		}
+	}
+	var depths []float64
+	for d := range glyphs {
+		depths = append(depths, d)
+	}
+	sort.Float64s(depths)
+	var s3 []SDF3
+	for _, d := range depths {
+		s := Extrude3D(t.place(glyph_union(glyphs[d], eps), center, h/ah), Abs(d))
+		s3 = append(s3, Transform3D(s, Translate3d(V3{0, 0, 0.5 * d})))
+	}
+	if len(s3) == 0 {
+		return nil, fmt.Errorf("no glyphs with a depth")
+	}
+	return Union3D(s3...), nil
+}
+
+// EmbossText3D embosses an SDF2 (e.g. from TextSDF2) onto the top face of a
+// base SDF3. The SDF2 is placed on the plane z = top and is raised depth
+// above it (depth > 0) or engraved -depth into it (depth < 0). With blend > 0
+// the text is joined to the base with a smooth union (or difference) of size
+// blend, so raised text is filleted into the base and engraved text has a
+// rounded lip. The blend only changes the surface where the text and base
+// surfaces are within blend of each other, so with blend < |depth| the top of
+// raised text and the floor of engraved text stay sharp.
+// The walls of the letters are tapered by a draft angle (radians, >= 0) so the
+// part releases from a mold: raised text is narrower at the top, engraved
+// text is narrower at the bottom. The text keeps its size on the plane.
+func EmbossText3D(base SDF3, text SDF2, top, depth, blend, draft float64) SDF3 {
+	if depth == 0 {
+		panic("depth == 0")
+	}
+	if blend < 0 {
+		panic("blend < 0")
+	}
+	if draft < 0 {
+		panic("draft < 0")
+	}
+	if depth < 0 {
+		// narrower going down
+		draft = -draft
+	}
+	// the text is extruded through the plane, so it overlaps the base
+	t := Transform3D(DraftExtrude3D(text, 2*Abs(depth), draft), Translate3d(V3{0, 0, top}))
+	if depth > 0 {
+		if blend == 0 {
+			return Union3D(base, t)
+		}
+		return UnionSmooth3D(blend, SMOOTH_POLY, base, t)
+	}
+	s := Difference3D(base, t)
+	if d, ok := s.(*DifferenceSDF3); ok && blend > 0 {
+		d.SetMax(PolyMax(blend))
+	}
+	return s
+}
+
+//-----------------------------------------------------------------------------
+// Font metrics
+
+// FontInfo is the metrics of a font, all in font units.
+type FontInfo struct {
+	UnitsPerEm float64 // font units per em
+	Ascent     float64 // height above the baseline
+	Descent    float64 // depth below the baseline (> 0)
+	LineHeight float64 // baseline to baseline distance used by TextSDF2
+	LineGap    float64 // LineHeight - (Ascent + Descent), < 0 for lines closer than the glyph extents
+}
+
+// FontMetrics returns the metrics of a font.
+func FontMetrics(f *truetype.Font) FontInfo {
+	upem := f.FUnitsPerEm()
+	// at 72 dpi the size in points is the number of pixels per em
+	m := truetype.NewFace(f, &truetype.Options{Size: float64(upem), DPI: 72}).Metrics()
+	vm := f.VMetric(fixed.Int26_6(upem), f.Index('\n'))
+	fi := FontInfo{
+		UnitsPerEm: float64(upem),
+		Ascent:     float64(m.Ascent) / 64,
+		Descent:    float64(m.Descent) / 64,
+		LineHeight: float64(vm.AdvanceHeight),
+	}
+	fi.LineGap = fi.LineHeight - fi.Ascent - fi.Descent
+	return fi
+}
+
+// Kerning returns the kerning adjustment (in font units) between two
+// characters, > 0 moves them further apart. It's 0 for fonts without
+// kerning tables.
+func Kerning(f *truetype.Font, a, b rune) float64 {
+	return float64(f.Kern(fixed.Int26_6(f.FUnitsPerEm()), f.Index(a), f.Index(b)))
+}
+
+// GlyphSDF2 returns the SDF2 (in font units) and the advance width of a
+// character. The glyph origin is on the baseline at the left hand side.
+// The SDF2 is nil for characters with no outline (e.g. a space).
+func GlyphSDF2(f *truetype.Font, r rune) (SDF2, float64, error) {
+	scale := fixed.Int26_6(f.FUnitsPerEm())
+	i := f.Index(r)
+	g := &truetype.GlyphBuf{}
+	if err := g.Load(f, scale, i, font.HintingNone); err != nil {
+		return nil, 0, err
+	}
+	return glyph_convert(g, 0, 0, FILL_NONZERO), float64(f.HMetric(scale, i).AdvanceWidth), nil
+}
+
+//-----------------------------------------------------------------------------
+// Font atlas
+
+// FontAtlas is a set of glyphs converted to SDF2s once, so text can be
+// built from them quickly. The atlas isn't modified after it is built, so
+// it can be used concurrently.
+type FontAtlas struct {
+	f     *truetype.Font
+	h     float64
+	glyph map[rune]SDF2 // outline in font units, nil for no outline
+}
+
+// NewFontAtlas returns a font atlas for a set of characters with text
+// height h. Characters that aren't in the atlas are converted as needed
+// (and not cached).
+func NewFontAtlas(f *truetype.Font, chars string, h float64) (*FontAtlas, error) {
+	if h <= 0 {
+		panic("h <= 0")
+	}
+	a := FontAtlas{f: f, h: h, glyph: make(map[rune]SDF2)}
+	for _, r := range chars {
+		if _, ok := a.glyph[r]; ok || unicode.IsSpace(r) {
+			continue
+		}
+		s, _, err := GlyphSDF2(f, r)
+		if err != nil {
+			return nil, err
+		}
+		a.glyph[r] = s
+	}
+	return &a, nil
+}
+
+// Return a glyph source for the atlas. The atlas glyphs are used when the
+// outline isn't bridged or simplified, other glyphs are converted from the
+// font. Glyphs that can't be loaded from the font are left out.
+func (a *FontAtlas) glyphs() glyphSource {
+	font := font_glyphs(a.f)
+	return func(r rune, bridge, tol float64, rule FillRule) (SDF2, error) {
+		if s, ok := a.glyph[r]; ok && bridge == 0 && tol == 0 && rule == FILL_NONZERO {
+			return s, nil
+		}
+		s, err := font(r, bridge, tol, rule)
+		if err != nil {
+			return nil, nil
+		}
+		return s, nil
+	}
+}
 
-	return CenterAndScale2D(Union2D(ss...), h/ah), nil
+// Text returns a sized SDF2 for a string built from the glyphs of the atlas.
+// The text options are applied as for NewTextWithOptions, so with no options
+// it's the same as TextSDF2 with the default settings.
+// Missing glyphs, and glyphs that can't be loaded from the font, are left out.
+func (a *FontAtlas) Text(s string, opts ...TextOption) SDF2 {
+	t := NewTextWithOptions(s, opts...)
+	// the atlas glyph source doesn't return errors
+	ss, _, ah, _ := text_glyph_ids(a.f, a.glyphs(), t, a.h)
+	u := glyph_union(ss, t.overlap_eps(ah, a.h))
+	return t.place(u, u.BoundingBox().Center(), a.h/ah)
 }
 
 //-----------------------------------------------------------------------------
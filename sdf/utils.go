@@ -7,6 +7,10 @@ package sdf
 import (
 	"fmt"
 	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
 )
 
 //-----------------------------------------------------------------------------
@@ -17,6 +21,7 @@ const SQRT_HALF = 0.7071067811865476
 const MM_PER_INCH = 25.4
 const TOLERANCE = 1e-9
 const EPSILON = 1e-12
+const DEFAULT_SEED = 1
 
 //-----------------------------------------------------------------------------
 
@@ -152,17 +157,91 @@ func Poly(a, b, k float64) float64 {
 	return Mix(b, a, h) - k*h*(1.0-h)
 }
 
+// Smin is the polynomial smooth minimum of a and b (GLSL smin), the math
+// used by PolyMin. a and b are blended where they are within k of each
+// other, for k <= 0 it's Min(a, b).
+func Smin(a, b, k float64) float64 {
+	if k <= 0 {
+		return Min(a, b)
+	}
+	return Poly(a, b, k)
+}
+
+// Smax is the polynomial smooth maximum of a and b (GLSL smax), the math
+// used by PolyMax. For k <= 0 it's Max(a, b).
+func Smax(a, b, k float64) float64 {
+	return -Smin(-a, -b, k)
+}
+
 func PolyMin(k float64) MinFunc {
 	return func(a, b float64) float64 {
 		return Poly(a, b, k)
 	}
 }
 
+// SmoothKind is the type of blend used by a smooth minimum.
+type SmoothKind int
+
+const (
+	// Polynomial: C1 continuous, cheap. Only the region within k of the
+	// seam is changed.
+	SMOOTH_POLY SmoothKind = iota
+	// Exponential: C-infinity continuous. Every surface moves slightly
+	// (by up to k*ln(2)), but it behaves well when many objects are
+	// blended since the result doesn't depend on the blend order.
+	SMOOTH_EXP
+	// Power: C-infinity continuous outside both objects, the inside
+	// distances are not blended. Outside distances are reduced even far
+	// from the seam.
+	SMOOTH_POW
+)
+
+// SmoothMin returns a smooth minimum function of a given kind.
+// k is the size of the blend region for all kinds.
+func SmoothMin(k float64, kind SmoothKind) MinFunc {
+	switch kind {
+	case SMOOTH_POLY:
+		return PolyMin(k)
+	case SMOOTH_EXP:
+		return ExpMin(1 / k)
+	case SMOOTH_POW:
+		pow := PowMin(1 / k)
+		return func(a, b float64) float64 {
+			if a <= 0 || b <= 0 {
+				return Min(a, b)
+			}
+			return pow(a, b)
+		}
+	}
+	panic("unknown smooth kind")
+}
+
+// smoothGrowth returns how far a smooth minimum can move a surface outwards.
+func smoothGrowth(k float64, kind SmoothKind) float64 {
+	switch kind {
+	case SMOOTH_POLY:
+		return k / 4
+	case SMOOTH_EXP:
+		return k * math.Ln2
+	}
+	return 0
+}
+
 //-----------------------------------------------------------------------------
 // Maximum Functions for SDF blending
 
 type MaxFunc func(a, b float64) float64
 
+// Round Maximum, the maximum version of RoundMin. Where the surfaces meet
+// at an edge of an intersection (or difference) the edge is a quarter-circle
+// of radius k.
+func RoundMax(k float64) MaxFunc {
+	min := RoundMin(k)
+	return func(a, b float64) float64 {
+		return -min(-a, -b)
+	}
+}
+
 // Polynomial Smooth Maximum (Try k = 0.1, a bigger k gives a bigger fillet).
 func PolyMax(k float64) MaxFunc {
 	return func(a, b float64) float64 {
@@ -309,3 +388,53 @@ func MapCombinations(n, k int, f func([]int)) {
 }
 
 //-----------------------------------------------------------------------------
+
+// Random numbers
+
+// The stochastic functions in this package draw from a shared generator with
+// a fixed default seed, so their results are repeatable from run to run.
+var prng = struct {
+	sync.Mutex
+	r *rand.Rand
+}{r: rand.New(rand.NewSource(DEFAULT_SEED))}
+
+// SetSeed seeds the random number generator used by the package.
+// The functions that use it are:
+// Box2/Box3 Random and RandomSet, RandomM22/RandomM33/RandomM44,
+// BenchmarkSDF2/BenchmarkSDF3 (sample points) and Bezier curve
+// sampling (perturbed midpoint tests).
+// For non-repeatable results seed it from the time.
+func SetSeed(seed int64) {
+	prng.Lock()
+	prng.r.Seed(seed)
+	prng.Unlock()
+}
+
+// randomFloat64 returns a random float64 [0,1) from the package generator.
+func randomFloat64() float64 {
+	prng.Lock()
+	x := prng.r.Float64()
+	prng.Unlock()
+	return x
+}
+
+//-----------------------------------------------------------------------------
+
+// ftoa returns a float64 as text for a text file. With decimals > 0 the
+// number is rounded to that many decimal places and trailing zeros are
+// dropped, e.g. 3 decimals is 1um for mm models. With decimals <= 0 it's %g.
+func ftoa(x float64, decimals int) string {
+	if decimals <= 0 {
+		return strconv.FormatFloat(x, 'g', -1, 64)
+	}
+	s := strconv.FormatFloat(x, 'f', decimals, 64)
+	if strings.IndexByte(s, '.') >= 0 {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,90 @@
+//-----------------------------------------------------------------------------
+/*
+
+Validation of user defined SDFs
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "fmt"
+
+//-----------------------------------------------------------------------------
+
+// MustBeSDF2 checks at compile time that a type implements SDF2. E.g.
+//
+//	var _ = sdf.MustBeSDF2(&MyShape{})
+func MustBeSDF2(s SDF2) SDF2 {
+	return s
+}
+
+// MustBeSDF3 checks at compile time that a type implements SDF3. E.g.
+//
+//	var _ = sdf.MustBeSDF3(&MyShape{})
+func MustBeSDF3(s SDF3) SDF3 {
+	return s
+}
+
+//-----------------------------------------------------------------------------
+
+// lipschitz tolerance: allow for small numerical errors
+const validateTolerance = 1e-6
+
+// ValidateSDF2 checks an SDF2 against the contract of the SDF2 interface.
+// Random pairs of points within box are sampled (see SetSeed) and an error
+// is returned if the difference in distance between two points is more than
+// the distance between them, or if a point inside the object is outside the
+// bounding box.
+func ValidateSDF2(s SDF2, box Box2, samples int) error {
+	bb := s.BoundingBox()
+	p0 := box.RandomSet(samples)
+	p1 := box.RandomSet(samples)
+	for i := range p0 {
+		d0 := s.Evaluate(p0[i])
+		d1 := s.Evaluate(p1[i])
+		l := p0[i].Sub(p1[i]).Length()
+		if Abs(d0-d1) > l*(1+validateTolerance)+validateTolerance {
+			return fmt.Errorf("distance changes by %g over %g between %v and %v", Abs(d0-d1), l, p0[i], p1[i])
+		}
+		for _, x := range []struct {
+			p V2
+			d float64
+		}{{p0[i], d0}, {p1[i], d1}} {
+			if x.d < 0 && !bb.ScaleAboutCenter(1+validateTolerance).Contains(x.p) {
+				return fmt.Errorf("inside point %v is outside the bounding box", x.p)
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateSDF3 checks an SDF3 against the contract of the SDF3 interface.
+// Random pairs of points within box are sampled (see SetSeed) and an error
+// is returned if the difference in distance between two points is more than
+// the distance between them, or if a point inside the object is outside the
+// bounding box.
+func ValidateSDF3(s SDF3, box Box3, samples int) error {
+	bb := s.BoundingBox()
+	p0 := box.RandomSet(samples)
+	p1 := box.RandomSet(samples)
+	for i := range p0 {
+		d0 := s.Evaluate(p0[i])
+		d1 := s.Evaluate(p1[i])
+		l := p0[i].Sub(p1[i]).Length()
+		if Abs(d0-d1) > l*(1+validateTolerance)+validateTolerance {
+			return fmt.Errorf("distance changes by %g over %g between %v and %v", Abs(d0-d1), l, p0[i], p1[i])
+		}
+		for _, x := range []struct {
+			p V3
+			d float64
+		}{{p0[i], d0}, {p1[i], d1}} {
+			if x.d < 0 && !bb.ScaleAboutCenter(1+validateTolerance).Contains(x.p) {
+				return fmt.Errorf("inside point %v is outside the bounding box", x.p)
+			}
+		}
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
@@ -3,6 +3,10 @@
 
 Floating Point 2D/3D Vectors
 
+The component-wise functions mirror the GLSL vector functions (abs, min,
+max, clamp, mix, sign, floor, ...) to make it easier to port shader SDFs.
+e.g. GLSL "length(max(abs(p) - b, 0.0))" is p.Abs().Sub(b).MaxScalar(0).Length()
+
 */
 //-----------------------------------------------------------------------------
 
@@ -10,7 +14,6 @@ package sdf
 
 import (
 	"math"
-	"math/rand"
 )
 
 //-----------------------------------------------------------------------------
@@ -46,11 +49,39 @@ func (a V2) Equals(b V2, tolerance float64) bool {
 		Abs(a.Y-b.Y) < tolerance)
 }
 
+// EqualWithin returns true if each component of a and b differs by no more
+// than tol. Unlike Equals the limit is inclusive, so a tol of 0 is exact
+// equality. Use it for welding and stitching points.
+func (a V3) EqualWithin(b V3, tol float64) bool {
+	return (Abs(a.X-b.X) <= tol &&
+		Abs(a.Y-b.Y) <= tol &&
+		Abs(a.Z-b.Z) <= tol)
+}
+
+// EqualWithin returns true if each component of a and b differs by no more
+// than tol, see V3.EqualWithin.
+func (a V2) EqualWithin(b V2, tol float64) bool {
+	return (Abs(a.X-b.X) <= tol &&
+		Abs(a.Y-b.Y) <= tol)
+}
+
+// Snap rounds each vector component to the nearest multiple of grid.
+// Points within grid/2 of each other (per component) may still snap to
+// different grid points, so snapping isn't a substitute for Equals.
+func (a V3) Snap(grid float64) V3 {
+	return a.DivScalar(grid).Round().MulScalar(grid)
+}
+
+// Snap rounds each vector component to the nearest multiple of grid.
+func (a V2) Snap(grid float64) V2 {
+	return a.DivScalar(grid).Round().MulScalar(grid)
+}
+
 //-----------------------------------------------------------------------------
 
 // randomRange returns a random float64 [a,b)
 func randomRange(a, b float64) float64 {
-	return a + (b-a)*rand.Float64()
+	return a + (b-a)*randomFloat64()
 }
 
 // Random returns a random point within a bounding box.
@@ -198,11 +229,41 @@ func (a V3) Ceil() V3 {
 	return V3{math.Ceil(a.X), math.Ceil(a.Y), math.Ceil(a.Z)}
 }
 
+// Floor takes the floor value of each vector component.
+func (a V3) Floor() V3 {
+	return V3{math.Floor(a.X), math.Floor(a.Y), math.Floor(a.Z)}
+}
+
 // Ceil takes the ceiling value of each vector component.
 func (a V2) Ceil() V2 {
 	return V2{math.Ceil(a.X), math.Ceil(a.Y)}
 }
 
+// Floor takes the floor value of each vector component.
+func (a V2) Floor() V2 {
+	return V2{math.Floor(a.X), math.Floor(a.Y)}
+}
+
+// Round rounds each vector component to the nearest integer (half away from zero).
+func (a V3) Round() V3 {
+	return V3{math.Round(a.X), math.Round(a.Y), math.Round(a.Z)}
+}
+
+// Round rounds each vector component to the nearest integer (half away from zero).
+func (a V2) Round() V2 {
+	return V2{math.Round(a.X), math.Round(a.Y)}
+}
+
+// Sign takes the sign (-1, 0 or 1) of each vector component.
+func (a V3) Sign() V3 {
+	return V3{Sign(a.X), Sign(a.Y), Sign(a.Z)}
+}
+
+// Sign takes the sign (-1, 0 or 1) of each vector component.
+func (a V2) Sign() V2 {
+	return V2{Sign(a.X), Sign(a.Y)}
+}
+
 //-----------------------------------------------------------------------------
 
 // Min return a vector with the minimum components of two vectors.
@@ -225,6 +286,50 @@ func (a V2) Max(b V2) V2 {
 	return V2{Max(a.X, b.X), Max(a.Y, b.Y)}
 }
 
+// MinScalar returns a vector with each component the minimum of the
+// component and b.
+func (a V3) MinScalar(b float64) V3 {
+	return V3{Min(a.X, b), Min(a.Y, b), Min(a.Z, b)}
+}
+
+// MinScalar returns a vector with each component the minimum of the
+// component and b.
+func (a V2) MinScalar(b float64) V2 {
+	return V2{Min(a.X, b), Min(a.Y, b)}
+}
+
+// MaxScalar returns a vector with each component the maximum of the
+// component and b.
+func (a V3) MaxScalar(b float64) V3 {
+	return V3{Max(a.X, b), Max(a.Y, b), Max(a.Z, b)}
+}
+
+// MaxScalar returns a vector with each component the maximum of the
+// component and b.
+func (a V2) MaxScalar(b float64) V2 {
+	return V2{Max(a.X, b), Max(a.Y, b)}
+}
+
+// Clamp clamps each vector component between the components of lo and hi.
+func (a V3) Clamp(lo, hi V3) V3 {
+	return V3{Clamp(a.X, lo.X, hi.X), Clamp(a.Y, lo.Y, hi.Y), Clamp(a.Z, lo.Z, hi.Z)}
+}
+
+// Clamp clamps each vector component between the components of lo and hi.
+func (a V2) Clamp(lo, hi V2) V2 {
+	return V2{Clamp(a.X, lo.X, hi.X), Clamp(a.Y, lo.Y, hi.Y)}
+}
+
+// Mix linearly interpolates from a to b, k = [0,1].
+func (a V3) Mix(b V3, k float64) V3 {
+	return V3{Mix(a.X, b.X, k), Mix(a.Y, b.Y, k), Mix(a.Z, b.Z, k)}
+}
+
+// Mix linearly interpolates from a to b, k = [0,1].
+func (a V2) Mix(b V2, k float64) V2 {
+	return V2{Mix(a.X, b.X, k), Mix(a.Y, b.Y, k)}
+}
+
 // Add adds two vectors. Returns a + b.
 func (a V3) Add(b V3) V3 {
 	return V3{a.X + b.X, a.Y + b.Y, a.Z + b.Z}
@@ -0,0 +1,144 @@
+//-----------------------------------------------------------------------------
+/*
+
+Voronoi Textures
+
+A voronoi texture is a cellular pattern cut into the surface of an SDF3.
+Each seed point has a cell, the part of space nearer to it than to any other
+seed. The cells are recessed into the surface and the cell boundaries are
+left standing as ridges, e.g. for decorative or grippy surfaces.
+
+The seeds are kept in a k-d tree, so a texture can have many seeds.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"math"
+	"sort"
+)
+
+//-----------------------------------------------------------------------------
+// k-d tree of points
+
+type kdNode struct {
+	p           V3
+	axis        int
+	left, right *kdNode
+}
+
+// kdAxis returns the x, y or z (0, 1, 2) component of a point.
+func kdAxis(p V3, axis int) float64 {
+	switch axis {
+	case 0:
+		return p.X
+	case 1:
+		return p.Y
+	}
+	return p.Z
+}
+
+// newKDTree returns a k-d tree of points.
+func newKDTree(points []V3) *kdNode {
+	if len(points) == 0 {
+		return nil
+	}
+	// split on the longest axis at the median
+	size := V3Set(points).Max().Sub(V3Set(points).Min())
+	axis := 0
+	if size.Y > size.X && size.Y >= size.Z {
+		axis = 1
+	} else if size.Z > size.X && size.Z > size.Y {
+		axis = 2
+	}
+	sort.Slice(points, func(i, j int) bool {
+		return kdAxis(points[i], axis) < kdAxis(points[j], axis)
+	})
+	m := len(points) / 2
+	return &kdNode{
+		p:     points[m],
+		axis:  axis,
+		left:  newKDTree(points[:m]),
+		right: newKDTree(points[m+1:]),
+	}
+}
+
+// nearest2 updates the squared distances from p to the nearest two points.
+func (n *kdNode) nearest2(p V3, d1, d2 *float64) {
+	if n == nil {
+		return
+	}
+	if d := p.Sub(n.p).Length2(); d < *d1 {
+		*d1, *d2 = d, *d1
+	} else if d < *d2 {
+		*d2 = d
+	}
+	// search the side of the split with p first
+	x := kdAxis(p, n.axis) - kdAxis(n.p, n.axis)
+	near, far := n.left, n.right
+	if x > 0 {
+		near, far = far, near
+	}
+	near.nearest2(p, d1, d2)
+	if x*x < *d2 {
+		far.nearest2(p, d1, d2)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// VoronoiTextureSDF3 is an SDF3 with a voronoi texture.
+type VoronoiTextureSDF3 struct {
+	sdf   SDF3
+	seeds *kdNode
+	depth float64
+	bb    Box3
+}
+
+// VoronoiTexture3D cuts a voronoi texture into the surface of an SDF3.
+// The seeds are the cell centers, normally on or near the surface, and
+// there must be at least 2 of them. Within a cell the surface is displaced
+// by the distance to the cell boundary, up to depth. So the ridges at the
+// cell boundaries stay on the surface and the cell floors are depth below
+// it, with sloped walls between them. The distance to the boundary is taken
+// as half the difference of the distances to the nearest two seeds, which
+// is exact on the line between the seeds and less elsewhere.
+//
+// The displacement changes as fast as the distance, so the sum can change
+// up to twice as fast. The result is halved to stay a bound on the distance
+// (see SDF3), which leaves the surface where it is but slows ray marching.
+func VoronoiTexture3D(sdf SDF3, seeds []V3, depth float64) SDF3 {
+	if len(seeds) < 2 {
+		panic("len(seeds) < 2")
+	}
+	if depth <= 0 {
+		panic("depth <= 0")
+	}
+	s := VoronoiTextureSDF3{}
+	s.sdf = sdf
+	s.seeds = newKDTree(append([]V3(nil), seeds...))
+	s.depth = depth
+	s.bb = sdf.BoundingBox()
+	return &s
+}
+
+// cellDistance returns the distance from p to the boundary of its cell.
+func (s *VoronoiTextureSDF3) cellDistance(p V3) float64 {
+	d1, d2 := math.MaxFloat64, math.MaxFloat64
+	s.seeds.nearest2(p, &d1, &d2)
+	return 0.5 * (math.Sqrt(d2) - math.Sqrt(d1))
+}
+
+// Return the minimum distance to the textured surface.
+func (s *VoronoiTextureSDF3) Evaluate(p V3) float64 {
+	return 0.5 * (s.sdf.Evaluate(p) + Min(s.cellDistance(p), s.depth))
+}
+
+// Return the bounding box.
+func (s *VoronoiTextureSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------